@@ -10,28 +10,57 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	Server     ServerConfig         `mapstructure:"server"`
-	Database   DatabaseConfig       `mapstructure:"database"`
-	CORS       CORSConfig           `mapstructure:"cors"`
-	JWT        JWTConfig            `mapstructure:"jwt"`
-	Redis      RedisConfig          `mapstructure:"redis"`
-	MailGoogle MailGoogleConfig     `mapstructure:"mail_google"`
-	Logging    logger.LogConfig     `mapstructure:"logging"`
-	Cloudinary CloudinaryConfig     `mapstructure:"cloudinary"`
-	WebSocket  WebSocketConfig      `mapstructure:"websocket"`
-	APIKey     APIKeyConfig         `mapstructure:"api_key"`
-	Chatbot    ChatbotConfig        `mapstructure:"chatbot"`
+	Server       ServerConfig       `mapstructure:"server"`
+	Database     DatabaseConfig     `mapstructure:"database"`
+	CORS         CORSConfig         `mapstructure:"cors"`
+	JWT          JWTConfig          `mapstructure:"jwt"`
+	SignedTokens SignedTokensConfig `mapstructure:"signed_tokens"`
+	Redis        RedisConfig        `mapstructure:"redis"`
+	MailGoogle   MailGoogleConfig   `mapstructure:"mail_google"`
+	Logging      logger.LogConfig   `mapstructure:"logging"`
+	Cloudinary   CloudinaryConfig   `mapstructure:"cloudinary"`
+	WebSocket    WebSocketConfig    `mapstructure:"websocket"`
+	APIKey       APIKeyConfig       `mapstructure:"api_key"`
+	Chatbot      ChatbotConfig      `mapstructure:"chatbot"`
+	Refund       RefundConfig       `mapstructure:"refund"`
+	Calendar     CalendarConfig     `mapstructure:"calendar"`
+	Gate         GateConfig         `mapstructure:"gate"`
+	Visitor      VisitorConfig      `mapstructure:"visitor"`
+	LoginGuard   LoginGuardConfig   `mapstructure:"login_guard"`
+	OTP          OTPConfig          `mapstructure:"otp"`
+	MFA          MFAConfig          `mapstructure:"mfa"`
+	OIDC         OIDCConfig         `mapstructure:"oidc"`
+	Metrics      MetricsConfig      `mapstructure:"metrics"`
 }
 
 type ServerConfig struct {
-	Host    string `mapstructure:"host"`
-	Port    string `mapstructure:"port"`
-	GinMode string `mapstructure:"gin_mode"` // debug, release, test
+	Host          string `mapstructure:"host"`
+	Port          string `mapstructure:"port"`
+	GinMode       string `mapstructure:"gin_mode"`       // debug, release, test
+	ShutdownDelay int    `mapstructure:"shutdown_delay"` // giây giữa lúc /health/ready báo lỗi và lúc dừng nhận kết nối
 }
 type JWTConfig struct {
-	Secret      string `mapstructure:"secret"`
-	Refresh_Exp int    `mapstructure:"refresh_exp"`
-	Access_Exp  int    `mapstructure:"access_exp"`
+	Secret       string         `mapstructure:"secret"`
+	Refresh_Exp  int            `mapstructure:"refresh_exp"`
+	Access_Exp   int            `mapstructure:"access_exp"`
+	SigningKeyID string         `mapstructure:"signing_key_id"` // kid của khoá đang dùng để ký, để trống thì ký HS256 bằng secret như cũ
+	Keys         []JWTKeyConfig `mapstructure:"keys"`           // mọi khoá còn hiệu lực, đều được công bố ở /.well-known/jwks.json
+	AcceptHS256  bool           `mapstructure:"accept_hs256"`   // vẫn nhận token HS256 cũ (không có kid) trong thời gian chuyển đổi
+}
+
+// SignedTokensConfig là khoá HMAC của token theo mục đích (QR ra/vào cổng, link lịch .ics).
+// Tách khỏi jwt.secret vì jwt.secret bỏ trống được sau khi chuyển sang khoá bất đối xứng.
+type SignedTokensConfig struct {
+	Secret string `mapstructure:"secret"` // bắt buộc, nên dài ít nhất 32 byte ngẫu nhiên
+}
+
+// JWTKeyConfig là một khoá ký bất đối xứng (RSA -> RS256, EC P-256 -> ES256, Ed25519 -> EdDSA).
+// Xoay khoá: thêm khoá mới vào keys, sau khi các service đã tải lại JWKS thì đổi signing_key_id,
+// khoá cũ giữ thêm ít nhất refresh_exp rồi mới xoá.
+type JWTKeyConfig struct {
+	ID             string `mapstructure:"id"`               // kid
+	PrivateKey     string `mapstructure:"private_key"`      // PEM (PKCS#8, PKCS#1 hoặc SEC1)
+	PrivateKeyFile string `mapstructure:"private_key_file"` // đường dẫn file PEM, dùng khi private_key trống
 }
 
 type RedisConfig struct {
@@ -70,13 +99,25 @@ type CORSConfig struct {
 	AllowCreds   bool
 }
 type WebSocketConfig struct {
-	WriteWait  int `mapstructure:"write_wait"`  // in seconds
-	PongWait   int `mapstructure:"pong_wait"`   // in seconds
-	PingPeriod int `mapstructure:"ping_period"` // in seconds
+	WriteWait      int   `mapstructure:"write_wait"`       // in seconds
+	PongWait       int   `mapstructure:"pong_wait"`        // in seconds
+	PingPeriod     int   `mapstructure:"ping_period"`      // in seconds
+	SendBuffer     int   `mapstructure:"send_buffer"`      // số message chờ gửi mỗi connection, đầy thì ngắt client chậm (mặc định 256)
+	MaxMessageSize int64 `mapstructure:"max_message_size"` // byte, message client gửi lên lớn hơn thì đóng connection (mặc định 64KB)
 }
 
+// MetricsConfig giới hạn truy cập /metrics: IP nằm trong allowed_ips hoặc gửi "Authorization: Bearer <token>".
+// Không cấu hình gì thì chỉ cho truy cập từ localhost.
+type MetricsConfig struct {
+	Token      string   `mapstructure:"token"`
+	AllowedIPs []string `mapstructure:"allowed_ips"` // IP hoặc CIDR, so với địa chỉ kết nối trực tiếp (không tin X-Forwarded-For)
+}
+
+// APIKeyConfig là khoá hệ thống gửi kèm khi gọi sang service khác.
+// Service gọi vào hệ thống dùng API client cấp qua /api-clients; AcceptLegacyChatbotKey chỉ để chuyển tiếp.
 type APIKeyConfig struct {
-	ChatbotService string `mapstructure:"chatbot_service"`
+	ChatbotService         string `mapstructure:"chatbot_service"`           // khoá gửi khi gọi chatbot service (đồng bộ dataset)
+	AcceptLegacyChatbotKey bool   `mapstructure:"accept_legacy_chatbot_key"` // vẫn nhận chatbot_service khi chatbot gọi vào /chatbot/datasets
 }
 
 // ChatbotConfig contains config for external chatbot service
@@ -84,6 +125,82 @@ type ChatbotConfig struct {
 	BaseURL string `mapstructure:"base_url"` // e.g. https://chatbot.example.com
 }
 
+// RefundConfig chứa quy tắc hoàn phí khi hợp đồng kết thúc sớm
+type RefundConfig struct {
+	NoticePeriodDays     int     `mapstructure:"notice_period_days"`     // số ngày báo trước tối thiểu, báo trễ bị trừ tiền số ngày còn thiếu
+	NonRefundableDeposit float64 `mapstructure:"non_refundable_deposit"` // tiền cọc không hoàn lại (VND)
+}
+
+// CalendarConfig cấu hình link lịch iCal cho Google/Outlook Calendar
+type CalendarConfig struct {
+	PublicBaseURL string `mapstructure:"public_base_url"` // e.g. https://api.example.com, để trống thì lấy theo request
+	BillDueDay    int    `mapstructure:"bill_due_day"`    // hạn đóng tiền điện: ngày trong tháng kế tiếp của kỳ hóa đơn
+}
+
+// GateConfig cấu hình giờ giới nghiêm ở cổng ký túc xá
+type GateConfig struct {
+	DefaultCurfew string `mapstructure:"default_curfew"` // HH:MM, dùng khi khu chưa đặt giờ giới nghiêm riêng
+	OpenTime      string `mapstructure:"open_time"`      // HH:MM, giờ mở cổng buổi sáng
+}
+
+// VisitorConfig là quy định tiếp khách mặc định, mỗi khu có thể đặt riêng
+type VisitorConfig struct {
+	VisitingStart       string `mapstructure:"visiting_start"`         // HH:MM
+	VisitingEnd         string `mapstructure:"visiting_end"`           // HH:MM
+	OvernightGuestCap   int    `mapstructure:"overnight_guest_cap"`    // 0 = không cho khách ở qua đêm
+	PassEarlyMinutes    int    `mapstructure:"pass_early_minutes"`     // mã vào cổng có hiệu lực sớm hơn giờ hẹn
+	MaxVisitDurationHrs int    `mapstructure:"max_visit_duration_hrs"` // thời gian thăm tối đa của một lượt
+}
+
+// LoginGuardConfig cấu hình chống dò mật khẩu: giới hạn theo username và IP, khoá tạm thời tăng dần
+type LoginGuardConfig struct {
+	MaxFailures          int    `mapstructure:"max_failures"`           // số lần sai theo username trước khi khoá
+	MaxFailuresPerIP     int    `mapstructure:"max_failures_per_ip"`    // số lần sai theo IP trước khi khoá (cao hơn vì nhiều SV dùng chung mạng KTX)
+	FailureWindowSeconds int    `mapstructure:"failure_window_seconds"` // thời gian đếm số lần sai
+	BaseLockoutSeconds   int    `mapstructure:"base_lockout_seconds"`   // thời gian khoá lần đầu, mỗi lần khoá sau gấp đôi
+	MaxLockoutSeconds    int    `mapstructure:"max_lockout_seconds"`
+	CaptchaThreshold     int    `mapstructure:"captcha_threshold"`  // số lần sai trước khi yêu cầu CAPTCHA, 0 = tắt
+	CaptchaVerifyURL     string `mapstructure:"captcha_verify_url"` // endpoint siteverify (reCAPTCHA/hCaptcha/Turnstile)
+	CaptchaSecret        string `mapstructure:"captcha_secret"`
+}
+
+// OTPConfig giới hạn số lần gửi/nhập OTP qua email
+type OTPConfig struct {
+	MaxPerEmail       int `mapstructure:"max_per_email"` // số OTP tối đa gửi tới một email trong cửa sổ
+	MaxPerIP          int `mapstructure:"max_per_ip"`    // số OTP tối đa yêu cầu từ một IP trong cửa sổ
+	WindowSeconds     int `mapstructure:"window_seconds"`
+	MaxVerifyAttempts int `mapstructure:"max_verify_attempts"` // số lần nhập OTP tối đa cho một email trong cửa sổ
+}
+
+// MFAConfig cấu hình xác thực hai lớp TOTP
+type MFAConfig struct {
+	Issuer          string   `mapstructure:"issuer"`            // tên hiển thị trong app xác thực
+	EnforcedRoles   []string `mapstructure:"enforced_roles"`    // vai trò bắt buộc bật 2FA
+	TokenTTLSeconds int      `mapstructure:"token_ttl_seconds"` // thời hạn mfa_token sau khi nhập đúng mật khẩu
+}
+
+// OIDCConfig cấu hình đăng nhập qua nhà cung cấp OpenID Connect (Microsoft, Google, ...)
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig `mapstructure:"providers"`
+}
+
+// OIDCProviderConfig là một issuer được tin cậy. ID token phải do issuer này ký và cấp cho một trong các client_ids.
+type OIDCProviderConfig struct {
+	Name      string           `mapstructure:"name"`       // dùng trong đường dẫn /oauth/:provider/callback
+	Issuer    string           `mapstructure:"issuer"`     // phải khớp chính xác claim iss
+	JWKSURL   string           `mapstructure:"jwks_url"`   // để trống thì lấy jwks_uri từ <issuer>/.well-known/openid-configuration
+	ClientIDs []string         `mapstructure:"client_ids"` // audience hợp lệ của ID token
+	Domains   []OIDCDomainRule `mapstructure:"domains"`    // domain email được phép đăng nhập, không khớp domain nào thì từ chối
+	// Claim boolean của riêng provider xác nhận claim email (vd. xms_edov của Microsoft Entra ID), dùng khi không có email_verified
+	TrustedEmailClaim string `mapstructure:"trusted_email_claim"`
+}
+
+// OIDCDomainRule quy định vai trò được đăng nhập theo domain email
+type OIDCDomainRule struct {
+	Domain     string   `mapstructure:"domain"`      // phần sau @, khớp chính xác (stu.ptit.edu.vn khác ptit.edu.vn)
+	Roles      []string `mapstructure:"roles"`       // vai trò của tài khoản được giữ lại khi đăng nhập qua domain này
+	CreateRole string   `mapstructure:"create_role"` // vai trò gán khi tự tạo tài khoản mới, để trống thì chỉ liên kết tài khoản có sẵn
+}
 
 func LoadConfig(cfgFile string) (*Config, error) {
 	// Use specific config file if provided
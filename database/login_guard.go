@@ -0,0 +1,102 @@
+package database
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Đếm số lần đăng nhập sai và khoá tạm thời theo username/IP.
+// login_fail:<scope>:<subject> đếm số lần sai trong cửa sổ thời gian,
+// login_lock:<scope>:<subject> tồn tại khi đang bị khoá,
+// login_lock_level:<scope>:<subject> đếm số lần đã bị khoá để tăng thời gian khoá lần sau.
+const (
+	loginFailPrefix      = "login_fail:"
+	loginLockPrefix      = "login_lock:"
+	loginLockLevelPrefix = "login_lock_level:"
+	loginLockLevelTTL    = 24 * time.Hour
+)
+
+func loginGuardKey(prefix, scope, subject string) string {
+	return prefix + scope + ":" + subject
+}
+
+// GetLoginLock trả về thời gian khoá còn lại, 0 nếu không bị khoá
+func GetLoginLock(scope, subject string) (time.Duration, error) {
+	ttl, err := RedisClient.PTTL(ctx, loginGuardKey(loginLockPrefix, scope, subject)).Result()
+	if err != nil {
+		logger.Error().Err(err).Str("scope", scope).Str("subject", subject).Msg("Failed to get login lock")
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// GetLoginFailures trả về số lần đăng nhập sai hiện tại
+func GetLoginFailures(scope, subject string) (int, error) {
+	n, err := RedisClient.Get(ctx, loginGuardKey(loginFailPrefix, scope, subject)).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("scope", scope).Str("subject", subject).Msg("Failed to get login failures")
+	}
+	return n, err
+}
+
+// RecordLoginFailure tăng số lần đăng nhập sai, bộ đếm hết hạn sau window kể từ lần sai đầu tiên
+func RecordLoginFailure(scope, subject string, window time.Duration) (int, error) {
+	return IncrRateLimit(loginGuardKey(loginFailPrefix, scope, subject), window)
+}
+
+// LockLogin khoá đăng nhập, thời gian khoá gấp đôi sau mỗi lần bị khoá (tối đa maxDur). Trả về thời gian khoá.
+func LockLogin(scope, subject string, base, maxDur time.Duration) (time.Duration, error) {
+	levelKey := loginGuardKey(loginLockLevelPrefix, scope, subject)
+	level, err := RedisClient.Incr(ctx, levelKey).Result()
+	if err != nil {
+		logger.Error().Err(err).Str("scope", scope).Str("subject", subject).Msg("Failed to increase login lock level")
+		return 0, err
+	}
+	RedisClient.Expire(ctx, levelKey, loginLockLevelTTL)
+
+	dur := base
+	for i := int64(1); i < level && dur < maxDur; i++ {
+		dur *= 2
+	}
+	if dur > maxDur {
+		dur = maxDur
+	}
+	_, err = RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, loginGuardKey(loginLockPrefix, scope, subject), level, dur)
+		pipe.Del(ctx, loginGuardKey(loginFailPrefix, scope, subject))
+		return nil
+	})
+	if err != nil {
+		logger.Error().Err(err).Str("scope", scope).Str("subject", subject).Msg("Failed to lock login")
+		return 0, err
+	}
+	logger.Warn().Str("scope", scope).Str("subject", subject).Dur("duration", dur).Int64("level", level).Msg("Login locked")
+	return dur, nil
+}
+
+// ClearLoginFailures xoá bộ đếm sai sau khi đăng nhập thành công (giữ lại mức khoá để lần sau vẫn tăng dần)
+func ClearLoginFailures(scope, subject string) error {
+	return RedisClient.Del(ctx, loginGuardKey(loginFailPrefix, scope, subject)).Err()
+}
+
+// UnlockLogin mở khoá và xoá toàn bộ bộ đếm, trả về false nếu không có khoá hay bộ đếm nào
+func UnlockLogin(scope, subject string) (bool, error) {
+	n, err := RedisClient.Del(ctx,
+		loginGuardKey(loginLockPrefix, scope, subject),
+		loginGuardKey(loginFailPrefix, scope, subject),
+		loginGuardKey(loginLockLevelPrefix, scope, subject),
+	).Result()
+	if err != nil {
+		logger.Error().Err(err).Str("scope", scope).Str("subject", subject).Msg("Failed to unlock login")
+		return false, err
+	}
+	return n > 0, nil
+}
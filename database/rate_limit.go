@@ -0,0 +1,19 @@
+package database
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"time"
+)
+
+// IncrRateLimit tăng bộ đếm của key, bộ đếm hết hạn sau window kể từ lần đếm đầu tiên. Trả về giá trị sau khi tăng.
+func IncrRateLimit(key string, window time.Duration) (int, error) {
+	n, err := RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		logger.Error().Err(err).Str("key", key).Msg("Failed to increase rate limit counter")
+		return 0, err
+	}
+	if n == 1 {
+		RedisClient.Expire(ctx, key, window)
+	}
+	return int(n), nil
+}
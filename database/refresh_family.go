@@ -0,0 +1,167 @@
+package database
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Mỗi lần đăng nhập tạo một "họ" refresh token, cũng là một phiên đăng nhập.
+// refresh_family:<family_id> là hash giữ token_id hiện tại và metadata của phiên,
+// user_sessions:<user_id> là set các family_id của người dùng,
+// refresh_used:<token_id> đánh dấu token đã bị xoay để phát hiện dùng lại.
+const (
+	refreshFamilyPrefix = "refresh_family:"
+	refreshUsedPrefix   = "refresh_used:"
+	userSessionsPrefix  = "user_sessions:"
+)
+
+// StartRefreshFamily lưu phiên đăng nhập mới (s.ID là family_id, s.TokenID là token_id đầu tiên)
+func StartRefreshFamily(s *models.Session, ttl time.Duration) error {
+	now := strconv.FormatInt(s.CreatedAt.Unix(), 10)
+	_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, refreshFamilyPrefix+s.ID,
+			"token_id", s.TokenID,
+			"user_id", s.UserID,
+			"device", s.Device,
+			"ip", s.IP,
+			"user_agent", s.UserAgent,
+			"created_at", now,
+			"last_used_at", now,
+		)
+		pipe.Expire(ctx, refreshFamilyPrefix+s.ID, ttl)
+		pipe.SAdd(ctx, userSessionsPrefix+s.UserID, s.ID)
+		pipe.Expire(ctx, userSessionsPrefix+s.UserID, ttl)
+		return nil
+	})
+	if err != nil {
+		logger.Error().Err(err).Str("family_id", s.ID).Str("user_id", s.UserID).Msg("Failed to start refresh token family")
+	}
+	return err
+}
+
+// RotateRefreshToken thay oldTokenID bằng newTokenID trong họ familyID và cập nhật lần dùng cuối của phiên.
+// Trả về false nếu oldTokenID đã bị xoay trước đó (refresh token bị dùng lại).
+func RotateRefreshToken(familyID, oldTokenID, newTokenID, userID, ip string, ttl time.Duration) (bool, error) {
+	ok, err := RedisClient.SetNX(ctx, refreshUsedPrefix+oldTokenID, familyID, ttl).Result()
+	if err != nil {
+		logger.Error().Err(err).Str("token_id", oldTokenID).Msg("Failed to mark refresh token as rotated")
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+	_, err = RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, oldTokenID)
+		pipe.Set(ctx, newTokenID, userID, ttl)
+		pipe.HSet(ctx, refreshFamilyPrefix+familyID,
+			"token_id", newTokenID,
+			"user_id", userID,
+			"ip", ip,
+			"last_used_at", strconv.FormatInt(time.Now().Unix(), 10),
+		)
+		pipe.Expire(ctx, refreshFamilyPrefix+familyID, ttl)
+		pipe.SAdd(ctx, userSessionsPrefix+userID, familyID)
+		pipe.Expire(ctx, userSessionsPrefix+userID, ttl)
+		return nil
+	})
+	if err != nil {
+		logger.Error().Err(err).Str("family_id", familyID).Str("old_token_id", oldTokenID).Str("new_token_id", newTokenID).Msg("Failed to rotate refresh token")
+		return false, err
+	}
+	logger.Debug().Str("family_id", familyID).Str("old_token_id", oldTokenID).Str("new_token_id", newTokenID).Msg("Refresh token rotated")
+	return true, nil
+}
+
+// GetRotatedFamily trả về family_id nếu tokenID là refresh token đã bị xoay
+func GetRotatedFamily(tokenID string) (string, bool, error) {
+	familyID, err := RedisClient.Get(ctx, refreshUsedPrefix+tokenID).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	} else if err != nil {
+		logger.Error().Err(err).Str("token_id", tokenID).Msg("Failed to check rotated refresh token")
+		return "", false, err
+	}
+	return familyID, true, nil
+}
+
+// GetSession lấy phiên đăng nhập theo family_id, trả về nil nếu phiên đã hết hạn hoặc bị thu hồi
+func GetSession(familyID string) (*models.Session, error) {
+	fields, err := RedisClient.HGetAll(ctx, refreshFamilyPrefix+familyID).Result()
+	if err != nil {
+		logger.Error().Err(err).Str("family_id", familyID).Msg("Failed to get session from Redis")
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	s := &models.Session{
+		ID:        familyID,
+		UserID:    fields["user_id"],
+		TokenID:   fields["token_id"],
+		Device:    fields["device"],
+		IP:        fields["ip"],
+		UserAgent: fields["user_agent"],
+	}
+	if sec, err := strconv.ParseInt(fields["created_at"], 10, 64); err == nil {
+		s.CreatedAt = time.Unix(sec, 0)
+	}
+	if sec, err := strconv.ParseInt(fields["last_used_at"], 10, 64); err == nil {
+		s.LastUsedAt = time.Unix(sec, 0)
+	}
+	return s, nil
+}
+
+// ListSessions lấy các phiên còn hiệu lực của người dùng, dọn các family_id đã hết hạn khỏi set
+func ListSessions(userID string) ([]models.Session, error) {
+	familyIDs, err := RedisClient.SMembers(ctx, userSessionsPrefix+userID).Result()
+	if err != nil {
+		logger.Error().Err(err).Str("user_id", userID).Msg("Failed to list user sessions")
+		return nil, err
+	}
+	var sessions []models.Session
+	var expired []interface{}
+	for _, familyID := range familyIDs {
+		s, err := GetSession(familyID)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			expired = append(expired, familyID)
+			continue
+		}
+		sessions = append(sessions, *s)
+	}
+	if len(expired) > 0 {
+		RedisClient.SRem(ctx, userSessionsPrefix+userID, expired...)
+	}
+	return sessions, nil
+}
+
+// RevokeRefreshFamily xoá token hiện tại của họ khỏi whitelist (kéo theo access token cùng token_id) và xoá phiên khỏi index
+func RevokeRefreshFamily(familyID string) error {
+	s, err := GetSession(familyID)
+	if err != nil {
+		return err
+	}
+	keys := []string{refreshFamilyPrefix + familyID}
+	if s != nil && s.TokenID != "" {
+		keys = append(keys, s.TokenID)
+	}
+	_, err = RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		if s != nil && s.UserID != "" {
+			pipe.SRem(ctx, userSessionsPrefix+s.UserID, familyID)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error().Err(err).Str("family_id", familyID).Msg("Failed to revoke refresh token family")
+		return err
+	}
+	logger.Info().Str("family_id", familyID).Msg("Refresh token family revoked")
+	return nil
+}
@@ -47,35 +47,23 @@ func Set(tokenID, userID string, ttl time.Duration) error {
 }
 
 
+// DeleteAllTokensByUserID thu hồi mọi phiên đăng nhập của người dùng qua set user_sessions:<user_id>
 func DeleteAllTokensByUserID(userID string) error {
-	var cursor uint64
-	var err error
-	var keysToDelete []string
-	for {
-		var keys []string
-		keys, cursor, err = RedisClient.Scan(ctx, cursor, "*", 100).Result()
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to scan Redis keys")
-			return err
-		}
-		for _, key := range keys {
-			val, err := RedisClient.Get(ctx, key).Result()
-			if err == nil && val == userID {
-				keysToDelete = append(keysToDelete, key)
-			}
-		}
-		if cursor == 0 {
-			break
-		}
+	familyIDs, err := RedisClient.SMembers(ctx, userSessionsPrefix+userID).Result()
+	if err != nil {
+		logger.Error().Err(err).Str("user_id", userID).Msg("Failed to list user sessions")
+		return err
 	}
-	if len(keysToDelete) > 0 {
-		_, err = RedisClient.Del(ctx, keysToDelete...).Result()
-		if err != nil {
-			logger.Error().Err(err).Strs("token_ids", keysToDelete).Msg("Failed to delete tokens by userID")
+	for _, familyID := range familyIDs {
+		if err := RevokeRefreshFamily(familyID); err != nil {
 			return err
 		}
-		logger.Info().Str("user_id", userID).Int("count", len(keysToDelete)).Msg("Deleted all tokens for user")
 	}
+	if err := RedisClient.Del(ctx, userSessionsPrefix+userID).Err(); err != nil {
+		logger.Error().Err(err).Str("user_id", userID).Msg("Failed to delete user session index")
+		return err
+	}
+	logger.Info().Str("user_id", userID).Int("count", len(familyIDs)).Msg("Deleted all tokens for user")
 	return nil
 }
 
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultAPIKeyRotationGrace = 24 * time.Hour
+
+type APIClientHandler struct {
+	Repo  *repository.APIClientRepository
+	Audit *repository.AuditRepository
+}
+
+func NewAPIClientHandler(repo *repository.APIClientRepository) *APIClientHandler {
+	return &APIClientHandler{Repo: repo}
+}
+
+func (h *APIClientHandler) ensureAdmin(c *gin.Context) bool {
+	if !utils.HasAnyRole(c, "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return false
+	}
+	return true
+}
+
+// validScopes bỏ trùng và kiểm tra scope có trong danh sách cho phép
+func validScopes(scopes []string) ([]string, bool) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		known := false
+		for _, k := range models.APIScopes {
+			if s == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, false
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out, true
+}
+
+// newAPIClientKey sinh khoá mới cho client, expiresInDays <= 0 là không hết hạn
+func newAPIClientKey(clientID string, expiresInDays int, now time.Time) (*models.APIClientKey, string, error) {
+	full, prefix, hash, err := service.GenerateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key := &models.APIClientKey{ID: uuid.NewString(), ClientID: clientID, Prefix: prefix, KeyHash: hash, CreatedAt: now}
+	if expiresInDays > 0 {
+		exp := now.AddDate(0, 0, expiresInDays)
+		key.ExpiresAt = &exp
+	}
+	return key, full, nil
+}
+
+// GET /api/v1/protected/api-clients (admin)
+func (h *APIClientHandler) List(c *gin.Context) {
+	if !h.ensureAdmin(c) {
+		return
+	}
+	list, err := h.Repo.List(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": list})
+}
+
+// GET /api/v1/protected/api-clients/:id (admin)
+func (h *APIClientHandler) Get(c *gin.Context) {
+	if !h.ensureAdmin(c) {
+		return
+	}
+	client, err := h.Repo.GetByID(context.Background(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if client == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API client not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": client})
+}
+
+type createAPIClientInput struct {
+	Name          string   `json:"name" binding:"required"`
+	Description   string   `json:"description"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 = khoá không hết hạn
+}
+
+// POST /api/v1/protected/api-clients (admin)
+// Tạo client và khoá đầu tiên, khoá đầy đủ chỉ trả về một lần
+func (h *APIClientHandler) Create(c *gin.Context) {
+	if !h.ensureAdmin(c) {
+		return
+	}
+	adminID, _ := utils.GetUserIDFromContext(c)
+	var input createAPIClientInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	scopes, ok := validScopes(input.Scopes)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope, allowed: " + strings.Join(models.APIScopes, ", ")})
+		return
+	}
+	now := time.Now()
+	client := &models.APIClient{
+		ID:          uuid.NewString(),
+		Name:        strings.TrimSpace(input.Name),
+		Description: input.Description,
+		Scopes:      scopes,
+		Status:      models.APIClientStatusActive,
+		CreatedBy:   adminID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	key, full, err := newAPIClientKey(client.ID, input.ExpiresInDays, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate API key"})
+		return
+	}
+	if err := h.Repo.Create(context.Background(), client, key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Ctx(c.Request.Context()).Info().Str("admin_id", adminID).Str("client_id", client.ID).Str("name", client.Name).Strs("scopes", scopes).Msg("API client created")
+	recordAudit(c, h.Audit, "api_client.create", "api_client", client.ID, nil, gin.H{"name": client.Name, "scopes": client.Scopes, "key_id": key.ID})
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "data": models.APIClientKeyResponse{ClientID: client.ID, KeyID: key.ID, APIKey: full, ExpiresAt: key.ExpiresAt}})
+}
+
+type updateAPIClientInput struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Scopes      []string `json:"scopes"` // nil = giữ nguyên
+}
+
+// PATCH /api/v1/protected/api-clients/:id (admin)
+func (h *APIClientHandler) Update(c *gin.Context) {
+	if !h.ensureAdmin(c) {
+		return
+	}
+	adminID, _ := utils.GetUserIDFromContext(c)
+	var input updateAPIClientInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	client, err := h.Repo.GetByID(context.Background(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if client == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API client not found"})
+		return
+	}
+	before := gin.H{"name": client.Name, "description": client.Description, "scopes": client.Scopes}
+	if input.Name != nil && strings.TrimSpace(*input.Name) != "" {
+		client.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Description != nil {
+		client.Description = *input.Description
+	}
+	if input.Scopes != nil {
+		scopes, ok := validScopes(input.Scopes)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope, allowed: " + strings.Join(models.APIScopes, ", ")})
+			return
+		}
+		client.Scopes = scopes
+	}
+	client.UpdatedAt = time.Now()
+	if err := h.Repo.Update(context.Background(), client); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Ctx(c.Request.Context()).Info().Str("admin_id", adminID).Str("client_id", client.ID).Strs("scopes", client.Scopes).Msg("API client updated")
+	recordAudit(c, h.Audit, "api_client.update", "api_client", client.ID, before, gin.H{"name": client.Name, "description": client.Description, "scopes": client.Scopes})
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": client})
+}
+
+// DELETE /api/v1/protected/api-clients/:id (admin)
+// Thu hồi client và toàn bộ khoá
+func (h *APIClientHandler) Revoke(c *gin.Context) {
+	if !h.ensureAdmin(c) {
+		return
+	}
+	adminID, _ := utils.GetUserIDFromContext(c)
+	id := c.Param("id")
+	revoked, err := h.Repo.Revoke(context.Background(), id, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API client not found or already revoked"})
+		return
+	}
+	logger.Ctx(c.Request.Context()).Info().Str("admin_id", adminID).Str("client_id", id).Msg("API client revoked")
+	recordAudit(c, h.Audit, "api_client.revoke", "api_client", id, gin.H{"status": models.APIClientStatusActive}, gin.H{"status": models.APIClientStatusRevoked})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+type rotateAPIKeyInput struct {
+	ExpiresInDays int  `json:"expires_in_days"` // hạn của khoá mới, 0 = không hết hạn
+	GraceHours    *int `json:"grace_hours"`     // khoá cũ còn dùng được bao lâu, mặc định 24h, 0 = hết hạn ngay
+}
+
+// POST /api/v1/protected/api-clients/:id/keys (admin)
+// Xoay khoá: tạo khoá mới, các khoá cũ hết hạn sau thời gian ân hạn để service kịp cập nhật
+func (h *APIClientHandler) RotateKey(c *gin.Context) {
+	if !h.ensureAdmin(c) {
+		return
+	}
+	adminID, _ := utils.GetUserIDFromContext(c)
+	var input rotateAPIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	client, err := h.Repo.GetByID(context.Background(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if client == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API client not found"})
+		return
+	}
+	if client.Status != models.APIClientStatusActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "API client is revoked"})
+		return
+	}
+	grace := defaultAPIKeyRotationGrace
+	if input.GraceHours != nil && *input.GraceHours >= 0 {
+		grace = time.Duration(*input.GraceHours) * time.Hour
+	}
+	now := time.Now()
+	key, full, err := newAPIClientKey(client.ID, input.ExpiresInDays, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate API key"})
+		return
+	}
+	if err := h.Repo.RotateKey(context.Background(), key, now.Add(grace)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Ctx(c.Request.Context()).Info().Str("admin_id", adminID).Str("client_id", client.ID).Str("key_id", key.ID).Dur("grace", grace).Msg("API key rotated")
+	recordAudit(c, h.Audit, "api_client.rotate_key", "api_client", client.ID, nil, gin.H{"key_id": key.ID, "grace_hours": grace.Hours()})
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "data": models.APIClientKeyResponse{ClientID: client.ID, KeyID: key.ID, APIKey: full, ExpiresAt: key.ExpiresAt}})
+}
+
+// DELETE /api/v1/protected/api-clients/:id/keys/:keyId (admin)
+// Thu hồi ngay một khoá (vd. bị lộ)
+func (h *APIClientHandler) RevokeKey(c *gin.Context) {
+	if !h.ensureAdmin(c) {
+		return
+	}
+	adminID, _ := utils.GetUserIDFromContext(c)
+	clientID, keyID := c.Param("id"), c.Param("keyId")
+	revoked, err := h.Repo.RevokeKey(context.Background(), clientID, keyID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+		return
+	}
+	logger.Ctx(c.Request.Context()).Info().Str("admin_id", adminID).Str("client_id", clientID).Str("key_id", keyID).Msg("API key revoked")
+	recordAudit(c, h.Audit, "api_client.revoke_key", "api_client", clientID, nil, gin.H{"key_id": keyID})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
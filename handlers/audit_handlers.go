@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/utils"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+	maxAuditExportRows   = 50000
+)
+
+// recordAudit ghi nhật ký một thao tác đã thành công. before/after là trạng thái trước/sau của đối tượng
+// (struct hoặc map), chỉ các trường khác nhau được lưu. Lỗi ghi nhật ký không làm hỏng request.
+func recordAudit(c *gin.Context, repo *repository.AuditRepository, action, entityType, entityID string, before, after interface{}) {
+	if repo == nil {
+		return
+	}
+	e := &models.AuditEvent{
+		ID:         uuid.NewString(),
+		ActorType:  models.AuditActorSystem,
+		ActorRoles: []string{},
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		CreatedAt:  time.Now(),
+	}
+	if claims, ok := c.Get("user"); ok {
+		if mc, ok := claims.(jwt.MapClaims); ok {
+			e.ActorType = models.AuditActorUser
+			e.ActorID, _ = mc["user_id"].(string)
+			if roles, ok := mc["roles"].([]interface{}); ok {
+				for _, r := range roles {
+					if s, ok := r.(string); ok {
+						e.ActorRoles = append(e.ActorRoles, s)
+					}
+				}
+			}
+		}
+	} else if client, ok := c.Get("api_client"); ok {
+		if ac, ok := client.(*models.APIClient); ok {
+			e.ActorType = models.AuditActorAPIClient
+			e.ActorID = ac.ID
+			e.ActorRoles = ac.Scopes
+		}
+	}
+	e.Before, e.After = auditDiff(before, after)
+	if err := repo.Create(context.Background(), e); err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("action", action).Str("entity_type", entityType).Str("entity_id", entityID).Msg("Failed to record audit event")
+	}
+}
+
+// auditDiff chỉ giữ các trường thay đổi. Tạo mới (before nil) hoặc xoá (after nil) thì lưu toàn bộ đối tượng.
+func auditDiff(before, after interface{}) (json.RawMessage, json.RawMessage) {
+	b, errB := toAuditMap(before)
+	a, errA := toAuditMap(after)
+	if errB != nil || errA != nil || b == nil || a == nil {
+		return marshalAudit(b), marshalAudit(a)
+	}
+	changedBefore := map[string]json.RawMessage{}
+	changedAfter := map[string]json.RawMessage{}
+	for k, v := range b {
+		if av, ok := a[k]; !ok || !bytes.Equal(av, v) {
+			changedBefore[k] = v
+		}
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || !bytes.Equal(bv, v) {
+			changedAfter[k] = v
+		}
+	}
+	return marshalAudit(changedBefore), marshalAudit(changedAfter)
+}
+
+func toAuditMap(v interface{}) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		// Không phải object (vd. chuỗi, số) thì lưu dưới khoá value
+		return map[string]json.RawMessage{"value": data}, nil
+	}
+	return m, nil
+}
+
+func marshalAudit(m map[string]json.RawMessage) json.RawMessage {
+	if m == nil {
+		return nil
+	}
+	data, _ := json.Marshal(m)
+	return data
+}
+
+type AuditHandler struct {
+	Repo *repository.AuditRepository
+}
+
+func NewAuditHandler(repo *repository.AuditRepository) *AuditHandler {
+	return &AuditHandler{Repo: repo}
+}
+
+// parseAuditFilter đọc bộ lọc từ query: actor_id, action, entity_type, entity_id, q, from, to (YYYY-MM-DD hoặc RFC3339)
+func parseAuditFilter(c *gin.Context) (models.AuditEventFilter, bool) {
+	f := models.AuditEventFilter{
+		ActorID:    strings.TrimSpace(c.Query("actor_id")),
+		Action:     strings.TrimSpace(c.Query("action")),
+		EntityType: strings.TrimSpace(c.Query("entity_type")),
+		EntityID:   strings.TrimSpace(c.Query("entity_id")),
+		Query:      strings.TrimSpace(c.Query("q")),
+	}
+	parse := func(s string, endOfDay bool) (*time.Time, bool) {
+		if s == "" {
+			return nil, true
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return &t, true
+		}
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			return nil, false
+		}
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, true
+	}
+	var ok bool
+	if f.From, ok = parse(c.Query("from"), false); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be YYYY-MM-DD or RFC3339"})
+		return f, false
+	}
+	if f.To, ok = parse(c.Query("to"), true); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be YYYY-MM-DD or RFC3339"})
+		return f, false
+	}
+	return f, true
+}
+
+// GET /api/v1/protected/audit-events?actor_id=&action=&entity_type=&entity_id=&q=&from=&to=&limit=&offset= (admin)
+func (h *AuditHandler) List(c *gin.Context) {
+	if !utils.HasAnyRole(c, "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	f, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+	f.Limit, _ = strconv.Atoi(c.Query("limit"))
+	if f.Limit <= 0 {
+		f.Limit = defaultAuditPageSize
+	}
+	if f.Limit > maxAuditPageSize {
+		f.Limit = maxAuditPageSize
+	}
+	f.Offset, _ = strconv.Atoi(c.Query("offset"))
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	total, err := h.Repo.Count(c.Request.Context(), f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := h.Repo.List(c.Request.Context(), f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": events, "total": total, "limit": f.Limit, "offset": f.Offset})
+}
+
+// GET /api/v1/protected/audit-events/export?... (admin)
+// Xuất CSV theo cùng bộ lọc, tối đa 50000 dòng
+func (h *AuditHandler) Export(c *gin.Context) {
+	if !utils.HasAnyRole(c, "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	f, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+	f.Limit = maxAuditExportRows
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"created_at", "actor_type", "actor_id", "actor_roles", "action", "entity_type", "entity_id", "before", "after", "ip", "user_agent"})
+	err := h.Repo.Each(c.Request.Context(), f, func(e *models.AuditEvent) error {
+		return w.Write(auditCSVRow(e))
+	})
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Việc xuất nhật ký cũng được ghi lại
+	recordAudit(c, h.Repo, "audit_events.export", "audit_events", "", nil, gin.H{
+		"actor_id": f.ActorID, "action": f.Action, "entity_type": f.EntityType, "entity_id": f.EntityID, "q": f.Query,
+		"from": c.Query("from"), "to": c.Query("to"),
+	})
+	filename := "audit_events_" + time.Now().Format("20060102_150405") + ".csv"
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// auditCSVRow là một dòng CSV của sự kiện, mọi ô đã qua csvSafe
+func auditCSVRow(e *models.AuditEvent) []string {
+	row := []string{
+		e.CreatedAt.Format(time.RFC3339),
+		e.ActorType,
+		e.ActorID,
+		strings.Join(e.ActorRoles, "|"),
+		e.Action,
+		e.EntityType,
+		e.EntityID,
+		string(e.Before),
+		string(e.After),
+		e.IP,
+		e.UserAgent,
+	}
+	for i := range row {
+		row[i] = csvSafe(row[i])
+	}
+	return row
+}
+
+// csvSafe chặn CSV/formula injection: ô bắt đầu bằng = + - @ (hoặc tab, CR) bị Excel/Sheets
+// hiểu là công thức, nên thêm dấu ' phía trước để giữ nguyên dạng chữ.
+// User-Agent, ghi chú... trong nhật ký đều do người dùng gửi lên.
+func csvSafe(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + s
+	}
+	return s
+}
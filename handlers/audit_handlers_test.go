@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCSVSafeNeutralizesFormulas(t *testing.T) {
+	cases := map[string]string{
+		"=HYPERLINK(\"http://evil\",\"x\")": "'=HYPERLINK(\"http://evil\",\"x\")",
+		"+1+1":                              "'+1+1",
+		"-2+3":                              "'-2+3",
+		"@SUM(A1:A2)":                       "'@SUM(A1:A2)",
+		"\t=1":                              "'\t=1",
+		"\r=1":                              "'\r=1",
+		"":                                  "",
+		"Mozilla/5.0":                       "Mozilla/5.0",
+		"a=b":                               "a=b",
+		"{\"status\":\"active\"}":           "{\"status\":\"active\"}",
+	}
+	for in, want := range cases {
+		if got := csvSafe(in); got != want {
+			t.Fatalf("csvSafe(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAuditCSVRowEscapesUserControlledCells(t *testing.T) {
+	e := &models.AuditEvent{
+		CreatedAt:  time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		ActorType:  models.AuditActorUser,
+		ActorID:    "u-1",
+		ActorRoles: []string{"admin_system"},
+		Action:     "user.update_status",
+		EntityType: "user",
+		EntityID:   "=cmd|' /C calc'!A0",
+		Before:     json.RawMessage(`{"status":"active"}`),
+		After:      json.RawMessage(`{"status":"locked"}`),
+		IP:         "10.0.0.1",
+		UserAgent:  "@evil",
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(auditCSVRow(e)); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := rows[0]
+	if row[6] != "'=cmd|' /C calc'!A0" || row[10] != "'@evil" {
+		t.Fatalf("entity_id/user_agent = %q/%q, want prefixed with '", row[6], row[10])
+	}
+	// Ô bình thường giữ nguyên
+	if row[0] != "2025-01-02T03:04:05Z" || row[3] != "admin_system" || row[7] != `{"status":"active"}` || row[9] != "10.0.0.1" {
+		t.Fatalf("row = %q: plain cells changed", row)
+	}
+}
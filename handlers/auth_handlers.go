@@ -7,13 +7,14 @@ import (
 	"Backend_Dorm_PTIT/logger"
 	"Backend_Dorm_PTIT/models"
 	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
 	"fmt"
 
 	"crypto/sha256"
 	"encoding/json"
-	"io"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -23,216 +24,28 @@ import (
 
 type AuthHandler struct {
 	cfg      *config.Config
+	jwtKeys  *service.JWTKeySet
 	userRepo *repository.UserRepository
-}
+	guard    *loginGuard
+	mfaRepo  *repository.MFARepository
 
-// MicrosoftOAuthRequest is the body sent from FE with Microsoft access_token
-type MicrosoftOAuthRequest struct {
-	AccessToken string `json:"access_token" binding:"required"`
-}
+	oidc         *service.OIDCVerifier
+	identityRepo *repository.UserIdentityRepository
 
-func NewAuthHandler(cfg *config.Config, userRepo *repository.UserRepository) *AuthHandler {
-	return &AuthHandler{cfg: cfg, userRepo: userRepo}
+	Audit *repository.AuditRepository
 }
 
-// MicrosoftOAuthCallback handles Microsoft OAuth2 login via access_token from FE
-// FE gọi Microsoft trực tiếp để lấy access_token, sau đó gửi access_token cho BE
-// BE dùng access_token gọi Graph lấy profile, rồi login theo email
-func (h *AuthHandler) MicrosoftOAuthCallback(c *gin.Context) {
-	var req MicrosoftOAuthRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, "invalid request: "+err.Error()))
-		return
-	}
-
-	ctx := c.Request.Context()
-	msAccessToken := req.AccessToken
-
-	// Call Microsoft Graph to get user profile
-	client := &http.Client{Timeout: 10 * time.Second}
-	profileReq, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://graph.microsoft.com/v1.0/me", nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to create profile request: "+err.Error()))
-		return
-	}
-	profileReq.Header.Set("Authorization", "Bearer "+msAccessToken)
-	respProfile, err := client.Do(profileReq)
-	if err != nil {
-		c.JSON(http.StatusBadGateway, models.ErrorResponse(http.StatusBadGateway, "failed to call Microsoft Graph: "+err.Error()))
-		return
-	}
-	defer respProfile.Body.Close()
-
-	if respProfile.StatusCode < 200 || respProfile.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(respProfile.Body)
-		c.JSON(http.StatusBadGateway, models.ErrorResponse(http.StatusBadGateway, fmt.Sprintf("graph api error: %d - %s", respProfile.StatusCode, string(bodyBytes))))
-		return
-	}
-
-	var user map[string]interface{}
-	if err := json.NewDecoder(respProfile.Body).Decode(&user); err != nil {
-		c.JSON(http.StatusBadGateway, models.ErrorResponse(http.StatusBadGateway, "failed to decode graph user: "+err.Error()))
-		return
-	}
-
-	displayName, _ := user["displayName"].(string)
-	email := ""
-	if m, ok := user["mail"].(string); ok && m != "" {
-		email = m
-	} else if upn, ok := user["userPrincipalName"].(string); ok {
-		email = upn
-	}
-	if email == "" {
-		c.JSON(http.StatusBadGateway, models.ErrorResponse(http.StatusBadGateway, "could not determine email from microsoft profile"))
-		return
+// captcha nil = không yêu cầu CAPTCHA khi đăng nhập sai nhiều lần
+func NewAuthHandler(cfg *config.Config, jwtKeys *service.JWTKeySet, userRepo *repository.UserRepository, lockoutRepo *repository.LoginLockoutRepository, captcha service.CaptchaVerifier, mfaRepo *repository.MFARepository, identityRepo *repository.UserIdentityRepository) *AuthHandler {
+	return &AuthHandler{
+		cfg:          cfg,
+		jwtKeys:      jwtKeys,
+		userRepo:     userRepo,
+		guard:        newLoginGuard(cfg.LoginGuard, lockoutRepo, captcha),
+		mfaRepo:      mfaRepo,
+		oidc:         service.NewOIDCVerifier(cfg.OIDC),
+		identityRepo: identityRepo,
 	}
-
-	// Chỉ chấp nhận email sinh viên PTIT
-	lowerEmail := strings.ToLower(email)
-	if !strings.HasSuffix(lowerEmail, "@stu.ptit.edu.vn") {
-		c.JSON(http.StatusForbidden, models.ErrorResponse(http.StatusForbidden, "email must be a PTIT student email (@stu.ptit.edu.vn)"))
-		return
-	}
-
-	// Từ đây coi như mật khẩu đã hợp lệ, tiến hành login theo email
-	config := h.cfg
-	jSecret := config.JWT.Secret
-	if jSecret == "" {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "jwt secret not configured"))
-		return
-	}
-
-	// Tìm user theo email
-	userRecord, err := h.userRepo.GetByEmail(ctx, email)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to get user by email: "+err.Error()))
-		return
-	}
-
-	var userInfo models.LoginUserInfo
-	// Helper check role
-	hasRole := func(roles []string, name string) bool {
-		for _, r := range roles {
-			if r == name {
-				return true
-			}
-		}
-		return false
-	}
-
-	if userRecord == nil {
-		// Chưa tồn tại user -> tạo user mới role guest
-		newID := uuid.NewString()
-		username := strings.SplitN(lowerEmail, "@", 2)[0]
-		now := time.Now()
-		newUser := &models.User{
-			ID:           newID,
-			Email:        email,
-			Username:     username,
-			PasswordHash: "", // không dùng password cho OAuth
-			Status:       "active",
-			CreatedAt:    now,
-			UpdatedAt:    now,
-		}
-		if err := h.userRepo.Create(ctx, newUser); err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to create user: "+err.Error()))
-			return
-		}
-		if err := h.userRepo.SetUserRoleByName(ctx, newID, "guest"); err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to assign guest role: "+err.Error()))
-			return
-		}
-		userInfo = models.LoginUserInfo{
-			UserID:      newID,
-			Email:       email,
-			Username:    username,
-			DisplayName: displayName,
-			Avatar:      "",
-			Roles:       []string{"guest"},
-		}
-	} else {
-		// User đã tồn tại: quyết định role theo DB
-		roles, err := h.userRepo.GetRolesByUserID(ctx, userRecord.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to get user roles: "+err.Error()))
-			return
-		}
-
-		// Ưu tiên student, sau đó guest; các role khác không cho đăng nhập bằng Microsoft
-		var loginRoles []string
-		if hasRole(roles, "student") {
-			loginRoles = []string{"student"}
-		} else if hasRole(roles, "guest") || len(roles) == 0 {
-			loginRoles = []string{"guest"}
-		} else {
-			c.JSON(http.StatusForbidden, models.ErrorResponse(http.StatusForbidden, "account role is not allowed for Microsoft login"))
-			return
-		}
-
-		// Thử lấy thông tin hiển thị từ hệ thống nếu có, nếu lỗi thì fallback
-		if uInfo, err := h.userRepo.GetUserInfo(ctx, userRecord.Username); err == nil {
-			userInfo = models.LoginUserInfo{
-				UserID:      uInfo.UserID,
-				Email:       uInfo.Email,
-				Username:    uInfo.Username,
-				DisplayName: uInfo.DisplayName,
-				Avatar:      uInfo.Avatar,
-				Roles:       loginRoles,
-			}
-		} else {
-			userInfo = models.LoginUserInfo{
-				UserID:      userRecord.ID,
-				Email:       userRecord.Email,
-				Username:    userRecord.Username,
-				DisplayName: displayName,
-				Avatar:      "",
-				Roles:       loginRoles,
-			}
-		}
-	}
-
-	// Sinh cặp access/refresh token giống luồng login thường
-	tokenID := uuid.NewString()
-	accessClaims := jwt.MapClaims{
-		"token_id": tokenID,
-		"user_id":  userInfo.UserID,
-		"roles":    userInfo.Roles,
-		"type":     "access",
-		"exp":      time.Now().Add(time.Duration(config.JWT.Access_Exp) * time.Second).Unix(),
-	}
-
-	accessTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	signedAccess, err := accessTokenJWT.SignedString([]byte(jSecret))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "Failed to sign access token: "+err.Error()))
-		return
-	}
-
-	refreshClaims := jwt.MapClaims{
-		"token_id": tokenID,
-		"user_id":  userInfo.UserID,
-		"roles":    userInfo.Roles,
-		"type":     "refresh",
-		"exp":      time.Now().Add(time.Duration(config.JWT.Refresh_Exp) * time.Second).Unix(),
-	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	signedRefresh, err := refreshToken.SignedString([]byte(jSecret))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "Failed to sign refresh token: "+err.Error()))
-		return
-	}
-
-	tokenTTL := time.Duration(config.JWT.Refresh_Exp) * time.Second
-	if err := database.Set(tokenID, userInfo.UserID, tokenTTL); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "Failed to store token: "+err.Error()))
-		return
-	}
-
-	c.JSON(http.StatusOK, models.LoginResponse{
-		AccessToken:  signedAccess,
-		RefreshToken: signedRefresh,
-		User:         userInfo,
-	})
 }
 
 // LogoutHandler godoc
@@ -245,11 +58,11 @@ func (h *AuthHandler) MicrosoftOAuthCallback(c *gin.Context) {
 // @Success 200 {object} models.Response "Logout status message (see Description for possible values)"
 // @Router /logout [post]
 func (h *AuthHandler) LogoutHandler(c *gin.Context) {
-	logger.Info().Msg("Logout request received")
+	logger.Ctx(c.Request.Context()).Info().Msg("Logout request received")
 
 	var req models.LogoutRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.Error().Err(err).Msg("Failed to bind logout request")
+		logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Failed to bind logout request")
 		c.JSON(http.StatusOK, models.Response{
 			Code:    http.StatusOK,
 			Message: constants.MsgLogoutSuccessButTokenInvalidMissingRefreshToken,
@@ -258,22 +71,7 @@ func (h *AuthHandler) LogoutHandler(c *gin.Context) {
 		return
 	}
 
-	secret := h.cfg.JWT.Secret
-	if secret == "" {
-		c.JSON(http.StatusOK, models.Response{
-			Code:    http.StatusOK,
-			Message: constants.MsgLogoutSuccessButTokenInvalidJWTSecretNotConfigured,
-			Data:    nil,
-		})
-		return
-	}
-
-	token, err := jwt.Parse(req.RefreshToken, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(secret), nil
-	})
+	token, err := h.jwtKeys.Parse(req.RefreshToken)
 	if err != nil || !token.Valid {
 		c.JSON(http.StatusOK, models.Response{
 			Code:    http.StatusOK,
@@ -314,8 +112,14 @@ func (h *AuthHandler) LogoutHandler(c *gin.Context) {
 		return
 	}
 
-	if err := database.Delete(oldTokenID); err != nil {
-		logger.Error().Err(err).Str("token_id", oldTokenID).Msg("Failed to delete token from Redis")
+	// Token có family_id thì thu hồi cả phiên để xoá khỏi danh sách phiên của người dùng
+	if familyID, _ := claims["family_id"].(string); familyID != "" {
+		err = database.RevokeRefreshFamily(familyID)
+	} else {
+		err = database.Delete(oldTokenID)
+	}
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("token_id", oldTokenID).Msg("Failed to delete token from Redis")
 		c.JSON(http.StatusOK, models.Response{
 			Code:    http.StatusOK,
 			Message: constants.MsgLogoutSuccessButTokenInvalidFailedToDelete,
@@ -324,7 +128,7 @@ func (h *AuthHandler) LogoutHandler(c *gin.Context) {
 		return
 	}
 
-	logger.Info().Str("token_id", oldTokenID).Msg("User logged out successfully")
+	logger.Ctx(c.Request.Context()).Info().Str("token_id", oldTokenID).Msg("User logged out successfully")
 	c.JSON(http.StatusOK, models.Response{
 		Code:    http.StatusOK,
 		Message: constants.MsgLogoutSuccessTokenDeleted,
@@ -350,11 +154,16 @@ func (h *AuthHandler) LogoutAllSessionsHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, "missing username or password"))
 		return
 	}
+	if !h.guard.allow(c, req.Username, req.CaptchaToken) {
+		return
+	}
 	ok, err := h.userRepo.VerifyCredentials(c.Request.Context(), req.Username, req.Password)
 	if err != nil || !ok {
+		h.guard.onFailure(c, req.Username)
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "invalid username or password"))
 		return
 	}
+	h.guard.onSuccess(c, req.Username)
 	user, err := h.userRepo.GetUserInfo(c.Request.Context(), req.Username)
 	if err != nil || user == nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "user not found"))
@@ -391,12 +200,19 @@ func (h *AuthHandler) LoginHandler(c *gin.Context) {
 		return
 	}
 
+	// Chặn dò mật khẩu: username/IP đang bị khoá hoặc cần CAPTCHA
+	if !h.guard.allow(c, req.Username, req.CaptchaToken) {
+		return
+	}
+
 	// Kiểm tra username, password qua repo
 	ok, err := h.userRepo.VerifyCredentials(c.Request.Context(), req.Username, req.Password)
 	if err != nil || !ok {
+		h.guard.onFailure(c, req.Username)
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "invalid username or password"))
 		return
 	}
+	h.guard.onSuccess(c, req.Username)
 
 	// Kiểm tra trạng thái toàn khoản nếu là inactive thì k cho đăng nhập , lấy status qua username từ repo
 	status, err := h.userRepo.GetStatusByUsername(c.Request.Context(), req.Username)
@@ -425,59 +241,12 @@ func (h *AuthHandler) LoginHandler(c *gin.Context) {
 		Roles:       user.Roles,
 	}
 
-	config := h.cfg
-	jwtSecret := config.JWT.Secret
-	if jwtSecret == "" {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "jwt secret not configured"))
-		return
-	}
-
-	tokenID := uuid.NewString()
-
-	accessClaims := jwt.MapClaims{
-		"token_id": tokenID,
-		"user_id":  userInfo.UserID,
-		"roles":    userInfo.Roles,
-		"type":     "access",
-		"exp":      time.Now().Add(time.Duration(config.JWT.Access_Exp) * time.Second).Unix(),
-	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	signedAccess, err := accessToken.SignedString([]byte(jwtSecret))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "Failed to sign access token: "+err.Error()))
-		return
-	}
-
-	refreshClaims := jwt.MapClaims{
-		"token_id": tokenID,
-		"user_id":  userInfo.UserID,
-		"roles":    userInfo.Roles,
-		"type":     "refresh",
-		"exp":      time.Now().Add(time.Duration(config.JWT.Refresh_Exp) * time.Second).Unix(),
-	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	signedRefresh, err := refreshToken.SignedString([]byte(jwtSecret))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "Failed to sign refresh token: "+err.Error()))
-		return
-	}
-
-	tokenTTL := time.Duration(config.JWT.Refresh_Exp) * time.Second
-	if err := database.Set(tokenID, userInfo.UserID, tokenTTL); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "Failed to store token: "+err.Error()))
-		return
-	}
-
-	c.JSON(http.StatusOK, models.LoginResponse{
-		AccessToken:  signedAccess,
-		RefreshToken: signedRefresh,
-		User:         userInfo,
-	})
+	h.completeLogin(c, userInfo)
 }
 
 // RefreshHandler godoc
 // @Summary Refresh access token
-// @Description Validate refresh token, rotate token ID, issue new access/refresh tokens, and update Redis whitelist. Returns new JWT tokens.
+// @Description Validate refresh token, rotate token ID within its token family, issue new access/refresh tokens, and update Redis whitelist. Presenting an already-rotated refresh token revokes the whole family. Returns new JWT tokens.
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -488,17 +257,18 @@ func (h *AuthHandler) LoginHandler(c *gin.Context) {
 // @Failure 500 {object} models.Response "Internal server error"
 // @Router /refresh [post]
 func (h *AuthHandler) RefreshHandler(c *gin.Context) {
-	logger.Info().Msg("Token refresh request received")
+	logger.Ctx(c.Request.Context()).Info().Msg("Token refresh request received")
 
 	var req models.RefreshRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.Error().Err(err).Msg("Failed to bind refresh request")
+		logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Failed to bind refresh request")
 		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, "missing refresh_token"))
 		return
 	}
 
+	// Không cache response theo request: gửi lại refresh token cũ (kể cả ngay sau khi xoay) phải luôn
+	// đi qua kiểm tra dùng lại bên dưới để thu hồi cả họ token
 	reqData, _ := json.Marshal(req)
-	hashRequest := fmt.Sprintf("refresh_req:%x", sha256.Sum256(reqData))
 	hashLockKey := fmt.Sprintf("refresh_lock:%x", sha256.Sum256(reqData))
 
 	lockKey := hashLockKey
@@ -507,56 +277,29 @@ func (h *AuthHandler) RefreshHandler(c *gin.Context) {
 	for i := 0; i < maxRetry; i++ {
 		ok, err := database.SetLockKey(lockKey, "1", 25*time.Second)
 		if err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Lock Key is being held!")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Lock Key is being held!")
 		}
 		if ok {
 			lockAcquired = true
-			logger.Info().Str("lockKey", lockKey).Msg("Lock acquired")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock acquired")
 			break
 		}
 		time.Sleep(1000 * time.Millisecond)
 	}
 	if !lockAcquired {
-		logger.Error().Str("lockKey", lockKey).Msg("Could not acquire lock after retries")
+		logger.Ctx(c.Request.Context()).Error().Str("lockKey", lockKey).Msg("Could not acquire lock after retries")
 		c.JSON(http.StatusTooManyRequests, models.ErrorResponse(http.StatusTooManyRequests, "Server busy, please retry"))
 		return
 	}
 
-	if ok, cachedResp, err := database.GetCacheRequest(hashRequest); err == nil && ok {
-		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
-		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
-		}
-		logger.Info().Str("hash_request", hashRequest).Msg("Cache request exists, returning cached response")
-		c.Data(http.StatusOK, "application/json", []byte(cachedResp))
-		return
-	}
-
 	config := h.cfg
-	secret := config.JWT.Secret
-	if secret == "" {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "jwt secret not configured"))
-		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
-		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
-		}
-		return
-	}
-
-	token, err := jwt.Parse(req.RefreshToken, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(secret), nil
-	})
+	token, err := h.jwtKeys.Parse(req.RefreshToken)
 	if err != nil || !token.Valid {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, constants.ErrInvalidOrExpiredRefreshToken))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
@@ -565,9 +308,9 @@ func (h *AuthHandler) RefreshHandler(c *gin.Context) {
 	if !ok {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "invalid claims"))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
@@ -575,9 +318,9 @@ func (h *AuthHandler) RefreshHandler(c *gin.Context) {
 	if t, _ := claims["type"].(string); t != "refresh" {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "token is not a refresh token"))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
@@ -586,9 +329,9 @@ func (h *AuthHandler) RefreshHandler(c *gin.Context) {
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "invalid refresh token (missing user_id)"))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
@@ -596,9 +339,9 @@ func (h *AuthHandler) RefreshHandler(c *gin.Context) {
 	if !ok {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "invalid refresh token (missing roles)"))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
@@ -616,32 +359,39 @@ func (h *AuthHandler) RefreshHandler(c *gin.Context) {
 	if len(Roles) == 0 {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "invalid refresh token (missing roles)"))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
 
 	oldTokenID, _ := claims["token_id"].(string)
+	// Token phát hành trước khi có token family thì coi token_id là family_id
+	familyID, _ := claims["family_id"].(string)
+	if familyID == "" {
+		familyID = oldTokenID
+	}
 
-	exists, _, err := database.Get(oldTokenID)
-	if err != nil || !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "refresh token not found on whitelist"))
+	// Refresh token đã bị xoay mà vẫn được gửi lại => có thể bị lộ, thu hồi cả họ
+	if reusedFamily, reused, err := database.GetRotatedFamily(oldTokenID); err == nil && reused {
+		h.handleRefreshReuse(c.Request.Context(), reusedFamily, oldTokenID, userID)
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "refresh token reuse detected, all sessions of this login have been revoked"))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
 
-	if err := database.Delete(oldTokenID); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to delete old refresh token"))
+	exists, _, err := database.Get(oldTokenID)
+	if err != nil || !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "refresh token not found on whitelist"))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
@@ -654,46 +404,56 @@ func (h *AuthHandler) RefreshHandler(c *gin.Context) {
 		"type":     "access",
 		"exp":      time.Now().Add(time.Duration(config.JWT.Access_Exp) * time.Second).Unix(),
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	signedAccess, err := accessToken.SignedString([]byte(secret))
+	signedAccess, err := h.jwtKeys.Sign(accessClaims)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to sign access token"))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
 
 	refreshClaims := jwt.MapClaims{
-		"token_id": newTokenID,
-		"user_id":  userID,
-		"roles":    Roles,
-		"type":     "refresh",
-		"exp":      time.Now().Add(time.Duration(config.JWT.Refresh_Exp) * time.Second).Unix(),
-	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	signedRefresh, err := refreshToken.SignedString([]byte(secret))
+		"token_id":  newTokenID,
+		"family_id": familyID,
+		"user_id":   userID,
+		"roles":     Roles,
+		"type":      "refresh",
+		"exp":       time.Now().Add(time.Duration(config.JWT.Refresh_Exp) * time.Second).Unix(),
+	}
+	signedRefresh, err := h.jwtKeys.Sign(refreshClaims)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to sign refresh token"))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
 
 	tokenTTL := time.Duration(config.JWT.Refresh_Exp) * time.Second
 
-	if err := database.Set(newTokenID, userID, tokenTTL); err != nil {
-		logger.Error().Err(err).Str("token_id", newTokenID).Str("user_id", userID).Msg("Failed to store new refresh token")
+	rotated, err := database.RotateRefreshToken(familyID, oldTokenID, newTokenID, userID, c.ClientIP(), tokenTTL)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("token_id", newTokenID).Str("user_id", userID).Msg("Failed to store new refresh token")
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to store new refresh token"))
 		if err := database.DeleteLockKey(lockKey); err != nil {
-			logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+		} else {
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
+		}
+		return
+	}
+	if !rotated {
+		h.handleRefreshReuse(c.Request.Context(), familyID, oldTokenID, userID)
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "refresh token reuse detected, all sessions of this login have been revoked"))
+		if err := database.DeleteLockKey(lockKey); err != nil {
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 		} else {
-			logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+			logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 		}
 		return
 	}
@@ -703,24 +463,169 @@ func (h *AuthHandler) RefreshHandler(c *gin.Context) {
 		UserID:       userID,
 	}
 
-	respData, _ := json.Marshal(resp)
-	if err := database.SetCacheRequest(hashRequest, string(respData), 30*time.Second); err != nil {
-		logger.Error().Err(err).Str("hash_request", hashRequest).Msg("Failed to cache refresh response")
-	} else {
-		logger.Info().Str("hash_request", hashRequest).Msg("Refresh response cache saved successfully")
-	}
-
 	if err := database.DeleteLockKey(lockKey); err != nil {
-		logger.Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("lockKey", lockKey).Msg("Failed to release lock")
 	} else {
-		logger.Info().Str("lockKey", lockKey).Msg("Lock released")
+		logger.Ctx(c.Request.Context()).Info().Str("lockKey", lockKey).Msg("Lock released")
 	}
 
-	logger.Info().
+	logger.Ctx(c.Request.Context()).Info().
 		Str("user_id", userID).
 		Str("old_token_id", oldTokenID).
 		Str("new_token_id", newTokenID).
+		Str("family_id", familyID).
 		Msg("Token refreshed successfully")
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// handleRefreshReuse thu hồi cả họ refresh token khi phát hiện token cũ bị dùng lại và gửi mail cảnh báo cho người dùng
+func (h *AuthHandler) handleRefreshReuse(ctx context.Context, familyID, tokenID, userID string) {
+	logger.Ctx(ctx).Warn().
+		Str("user_id", userID).
+		Str("token_id", tokenID).
+		Str("family_id", familyID).
+		Msg("Refresh token reuse detected, revoking token family")
+	if err := database.RevokeRefreshFamily(familyID); err != nil {
+		logger.Ctx(ctx).Error().Err(err).Str("family_id", familyID).Msg("Failed to revoke refresh token family")
+	}
+
+	go func() {
+		user, err := h.userRepo.GetByID(context.Background(), userID)
+		if err != nil || user == nil || user.Email == "" {
+			logger.Ctx(ctx).Error().Err(err).Str("user_id", userID).Msg("Failed to load user for refresh reuse alert")
+			return
+		}
+		mail := h.cfg.MailGoogle
+		subject := "Cảnh báo bảo mật tài khoản ký túc xá"
+		body := fmt.Sprintf("Tài khoản %s vừa có một refresh token cũ được sử dụng lại lúc %s.\n"+
+			"Để an toàn, phiên đăng nhập liên quan đã bị đăng xuất. Nếu không phải bạn, vui lòng đổi mật khẩu ngay.",
+			user.Username, time.Now().Format("15:04 02/01/2006"))
+		if err := utils.SendMail(ctx, mail.Host, mail.Port, mail.Email, mail.Password, user.Email, subject, body); err != nil {
+			logger.Ctx(ctx).Error().Err(err).Str("user_id", userID).Msg("Failed to send refresh reuse alert")
+		}
+	}()
+}
+
+// newSession dựng metadata phiên đăng nhập từ request. Thiết bị lấy từ header X-Device-Name nếu FE gửi lên.
+func newSession(c *gin.Context, familyID, tokenID, userID string) *models.Session {
+	now := time.Now()
+	return &models.Session{
+		ID:         familyID,
+		UserID:     userID,
+		TokenID:    tokenID,
+		Device:     c.GetHeader("X-Device-Name"),
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+}
+
+// ListMySessions godoc
+// @Summary List active sessions
+// @Description List active login sessions (refresh token families) of the current user with device/IP/user-agent metadata
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Router /api/v1/protected/sessions/me [get]
+func (h *AuthHandler) ListMySessions(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	sessions, err := database.ListSessions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to list sessions"))
+		return
+	}
+	currentTokenID := ""
+	if claims, ok := c.Get("user"); ok {
+		currentTokenID, _ = claims.(jwt.MapClaims)["token_id"].(string)
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].TokenID == currentTokenID
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(sessions))
+}
+
+// RevokeMySession godoc
+// @Summary Revoke a session
+// @Description Revoke one login session of the current user; its access and refresh tokens stop working immediately
+// @Tags Auth
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Failure 404 {object} models.Response
+// @Router /api/v1/protected/sessions/me/{id} [delete]
+func (h *AuthHandler) RevokeMySession(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	session, err := database.GetSession(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to get session"))
+		return
+	}
+	if session == nil || session.UserID != userID {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(http.StatusNotFound, "session not found"))
+		return
+	}
+	if err := database.RevokeRefreshFamily(session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to revoke session"))
+		return
+	}
+	logger.Ctx(c.Request.Context()).Info().Str("user_id", userID).Str("family_id", session.ID).Msg("Session revoked by user")
+	c.JSON(http.StatusOK, models.SuccessResponseWithMessage("Session revoked", nil))
+}
+
+// issueLoginTokens sinh cặp access/refresh token cho một phiên đăng nhập mới và lưu vào whitelist
+func (h *AuthHandler) issueLoginTokens(c *gin.Context, userInfo models.LoginUserInfo) (*models.LoginResponse, error) {
+	config := h.cfg
+
+	tokenID := uuid.NewString()
+	accessClaims := jwt.MapClaims{
+		"token_id": tokenID,
+		"user_id":  userInfo.UserID,
+		"roles":    userInfo.Roles,
+		"type":     "access",
+		"exp":      time.Now().Add(time.Duration(config.JWT.Access_Exp) * time.Second).Unix(),
+	}
+	signedAccess, err := h.jwtKeys.Sign(accessClaims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	familyID := uuid.NewString()
+	refreshClaims := jwt.MapClaims{
+		"token_id":  tokenID,
+		"family_id": familyID,
+		"user_id":   userInfo.UserID,
+		"roles":     userInfo.Roles,
+		"type":      "refresh",
+		"exp":       time.Now().Add(time.Duration(config.JWT.Refresh_Exp) * time.Second).Unix(),
+	}
+	signedRefresh, err := h.jwtKeys.Sign(refreshClaims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign refresh token: %w", err)
+	}
+
+	tokenTTL := time.Duration(config.JWT.Refresh_Exp) * time.Second
+	if err := database.Set(tokenID, userInfo.UserID, tokenTTL); err != nil {
+		return nil, fmt.Errorf("failed to store token: %w", err)
+	}
+	if err := database.StartRefreshFamily(newSession(c, familyID, tokenID, userInfo.UserID), tokenTTL); err != nil {
+		return nil, fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return &models.LoginResponse{
+		AccessToken:  signedAccess,
+		RefreshToken: signedRefresh,
+		User:         userInfo,
+	}, nil
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/database"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newRefreshTestHandler(t *testing.T) *AuthHandler {
+	t.Helper()
+	setupLoginGuardRedis(t)
+	cfg := &config.Config{JWT: config.JWTConfig{Secret: "refresh-test-secret", Access_Exp: 600, Refresh_Exp: 3600}}
+	keys, err := service.NewJWTKeySet(cfg.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cảnh báo dùng lại token tra user trong Postgres, ở đây không có DB nên lookup lỗi và bỏ qua gửi mail
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewAuthHandler(cfg, keys, repository.NewUserRepository(db, "public"), nil, nil, nil, nil)
+}
+
+func loginForRefresh(t *testing.T, h *AuthHandler) string {
+	t.Helper()
+	c, _ := newGuardContext("10.0.0.1")
+	resp, err := h.issueLoginTokens(c, models.LoginUserInfo{UserID: "u-1", Roles: []string{"student"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.RefreshToken
+}
+
+func refreshToken(h *AuthHandler, token string) (int, models.RefreshResponse) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(`{"refresh_token":"`+token+`"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.RefreshHandler(c)
+	var resp models.RefreshResponse
+	if w.Code == http.StatusOK {
+		json.Unmarshal(w.Body.Bytes(), &resp)
+	}
+	return w.Code, resp
+}
+
+func refreshClaims(t *testing.T, h *AuthHandler, token string) jwt.MapClaims {
+	t.Helper()
+	parsed, err := h.jwtKeys.Parse(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Claims.(jwt.MapClaims)
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	h := newRefreshTestHandler(t)
+	first := loginForRefresh(t, h)
+
+	code, resp := refreshToken(h, first)
+	if code != http.StatusOK || resp.RefreshToken == "" || resp.AccessToken == "" {
+		t.Fatalf("refresh status = %d, resp = %+v", code, resp)
+	}
+	old, rotated := refreshClaims(t, h, first), refreshClaims(t, h, resp.RefreshToken)
+	if rotated["token_id"] == old["token_id"] || rotated["family_id"] != old["family_id"] {
+		t.Fatalf("rotated claims = %v, old = %v: want new token_id in the same family", rotated, old)
+	}
+	if ok, _, _ := database.Get(old["token_id"].(string)); ok {
+		t.Fatal("old refresh token still on whitelist")
+	}
+
+	// Token mới tiếp tục xoay được
+	if code, _ := refreshToken(h, resp.RefreshToken); code != http.StatusOK {
+		t.Fatalf("second refresh status = %d", code)
+	}
+}
+
+func TestRefreshReplayRevokesFamily(t *testing.T) {
+	h := newRefreshTestHandler(t)
+	first := loginForRefresh(t, h)
+	familyID := refreshClaims(t, h, first)["family_id"].(string)
+
+	code, resp := refreshToken(h, first)
+	if code != http.StatusOK {
+		t.Fatalf("refresh status = %d", code)
+	}
+
+	// Gửi lại token cũ ngay sau khi xoay: không được trả lại cặp token vừa cấp
+	if code, replay := refreshToken(h, first); code != http.StatusUnauthorized {
+		t.Fatalf("replay status = %d (resp %+v), want 401", code, replay)
+	}
+	if s, err := database.GetSession(familyID); err != nil || s != nil {
+		t.Fatalf("session after replay = %+v, %v: want family revoked", s, err)
+	}
+	if code, _ := refreshToken(h, resp.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("refresh with token of revoked family status = %d, want 401", code)
+	}
+}
+
+func TestRefreshConcurrentSameToken(t *testing.T) {
+	h := newRefreshTestHandler(t)
+	first := loginForRefresh(t, h)
+	familyID := refreshClaims(t, h, first)["family_id"].(string)
+
+	const n = 3
+	codes := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i], _ = refreshToken(h, first)
+		}(i)
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusUnauthorized:
+		default:
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	// Chỉ một request được xoay token, các request còn lại là dùng lại token đã xoay
+	if ok != 1 {
+		t.Fatalf("successful refreshes = %d (codes %v), want exactly 1", ok, codes)
+	}
+	if s, _ := database.GetSession(familyID); s != nil {
+		t.Fatal("family not revoked after concurrent reuse")
+	}
+}
@@ -14,6 +14,7 @@ import (
 type BackupHandler struct {
 	config   *config.Config
 	BackRepo *repository.BackUpRepository
+	Audit    *repository.AuditRepository
 }
 
 func NewBackupHandler(cfg *config.Config, backRepo *repository.BackUpRepository) *BackupHandler {
@@ -23,7 +24,7 @@ func NewBackupHandler(cfg *config.Config, backRepo *repository.BackUpRepository)
 func (h *BackupHandler) BackUpData(c *gin.Context) {
 	claimsAny, exists := c.Get("user")
 	if !exists {
-		logger.Warn().Msg("Unauthorized: missing user claims in context")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: missing user claims in context")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized"))
 		return
 	}
@@ -44,7 +45,7 @@ func (h *BackupHandler) BackUpData(c *gin.Context) {
 	}
 
 	if !isAdminSystem {
-		logger.Warn().Msg("Forbidden: user is not admin_system")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Forbidden: user is not admin_system")
 		c.JSON(403, models.ErrorResponse(403, "Forbidden"))
 		return
 	}
@@ -54,6 +55,7 @@ func (h *BackupHandler) BackUpData(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Backup failed"})
 		return
 	}
+	recordAudit(c, h.Audit, "backup.download", "backup", "", nil, gin.H{"size": len(zipBytes)})
 	c.Header("Content-Type", "application/zip")
 	c.Header("Content-Disposition", "attachment; filename=backup_data.zip")
 	c.Data(http.StatusOK, "application/zip", zipBytes)
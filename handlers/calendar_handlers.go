@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Lấy lại ca trực trong 30 ngày gần nhất để lịch không bị trống phần đã qua
+const calendarDutyLookbackDays = 30
+
+const defaultBillDueDay = 10
+
+type CalendarHandler struct {
+	Repo             *repository.CalendarFeedRepository
+	UserRepo         *repository.UserRepository
+	DutyRepo         *repository.DutyScheduleRepository
+	ContractRepo     *repository.ContractRepository
+	ElectricBillRepo *repository.ElectricBillRepository
+	cfg              *config.Config
+}
+
+func NewCalendarHandler(repo *repository.CalendarFeedRepository, userRepo *repository.UserRepository, dutyRepo *repository.DutyScheduleRepository, contractRepo *repository.ContractRepository, electricBillRepo *repository.ElectricBillRepository, cfg *config.Config) *CalendarHandler {
+	return &CalendarHandler{
+		Repo:             repo,
+		UserRepo:         userRepo,
+		DutyRepo:         dutyRepo,
+		ContractRepo:     contractRepo,
+		ElectricBillRepo: electricBillRepo,
+		cfg:              cfg,
+	}
+}
+
+// feedURL dựng link .ics công khai cho calendar app
+func (h *CalendarHandler) feedURL(c *gin.Context, feedID string) string {
+	base := strings.TrimRight(h.cfg.Calendar.PublicBaseURL, "/")
+	if base == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+			scheme = proto
+		}
+		base = scheme + "://" + c.Request.Host
+	}
+	return base + "/api/v1/calendar/" + service.SignCalendarToken(feedID, h.cfg.SignedTokens.Secret) + ".ics"
+}
+
+// GET /api/v1/protected/calendar-feeds/me
+// Lấy link lịch hiện tại của user (data = null nếu chưa tạo)
+func (h *CalendarHandler) GetMyFeed(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	feed, err := h.Repo.GetActiveByUserID(context.Background(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get calendar feed", "details": err.Error()})
+		return
+	}
+	if feed != nil {
+		feed.URL = h.feedURL(c, feed.ID)
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": feed})
+}
+
+// POST /api/v1/protected/calendar-feeds/me
+// Tạo link lịch mới, link cũ (nếu có) bị thu hồi
+func (h *CalendarHandler) RotateMyFeed(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	feed := &models.CalendarFeed{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	if err := h.Repo.Rotate(context.Background(), feed); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create calendar feed", "details": err.Error()})
+		return
+	}
+	feed.URL = h.feedURL(c, feed.ID)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": feed})
+}
+
+// DELETE /api/v1/protected/calendar-feeds/me
+// Thu hồi link lịch, calendar app sẽ không đồng bộ được nữa
+func (h *CalendarHandler) RevokeMyFeed(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if err := h.Repo.RevokeByUserID(context.Background(), userID, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke calendar feed", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Đã thu hồi link lịch"})
+}
+
+// GET /api/v1/calendar/:token (token.ics)
+// Link công khai cho Google/Outlook Calendar, xác thực bằng chữ ký trên token thay cho Bearer header
+func (h *CalendarHandler) GetFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+	feedID, ok := service.VerifyCalendarToken(token, h.cfg.SignedTokens.Secret)
+	if !ok {
+		c.String(http.StatusNotFound, "calendar not found")
+		return
+	}
+	ctx := context.Background()
+	feed, err := h.Repo.GetActiveByID(ctx, feedID)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("feed_id", feedID).Msg("Failed to get calendar feed")
+		c.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	if feed == nil {
+		c.String(http.StatusNotFound, "calendar not found")
+		return
+	}
+	roles, err := h.UserRepo.GetRolesByUserID(ctx, feed.UserID)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("user_id", feed.UserID).Msg("Failed to get roles for calendar feed")
+		c.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	var events []service.ICalEvent
+	for _, role := range roles {
+		var roleEvents []service.ICalEvent
+		switch role {
+		case "manager":
+			roleEvents, err = h.dutyEvents(ctx, feed.UserID)
+		case "student":
+			roleEvents, err = h.studentEvents(ctx, feed.UserID)
+		}
+		if err != nil {
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("user_id", feed.UserID).Str("role", role).Msg("Failed to build calendar events")
+			c.String(http.StatusInternalServerError, "internal error")
+			return
+		}
+		events = append(events, roleEvents...)
+	}
+
+	c.Header("Cache-Control", "private, max-age=900")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(service.BuildICalendar("Ký túc xá PTIT", events)))
+}
+
+// dutyEvents sinh sự kiện cho các ca trực của quản túc
+func (h *CalendarHandler) dutyEvents(ctx context.Context, staffID string) ([]service.ICalEvent, error) {
+	schedules, err := h.DutyRepo.ListByStaffID(ctx, staffID, time.Now().AddDate(0, 0, -calendarDutyLookbackDays))
+	if err != nil {
+		return nil, err
+	}
+	events := make([]service.ICalEvent, 0, len(schedules))
+	for _, ds := range schedules {
+		events = append(events, service.ICalEvent{
+			UID:         "duty-" + ds.ID.String() + "@ptit-dorm",
+			Summary:     "Trực khu " + ds.AreaID,
+			Description: ds.Description,
+			Location:    ds.AreaID,
+			Start:       ds.StartTime,
+			End:         ds.EndTime,
+		})
+	}
+	return events, nil
+}
+
+// studentEvents sinh sự kiện ngày hết hạn hợp đồng và hạn đóng tiền điện của sinh viên
+func (h *CalendarHandler) studentEvents(ctx context.Context, studentID string) ([]service.ICalEvent, error) {
+	contracts, err := h.ContractRepo.GetContractByStudentID(ctx, studentID)
+	if err != nil {
+		return nil, err
+	}
+	dueDay := h.cfg.Calendar.BillDueDay
+	if dueDay <= 0 || dueDay > 28 {
+		dueDay = defaultBillDueDay
+	}
+	var events []service.ICalEvent
+	rooms := make(map[string]bool)
+	for _, ct := range contracts {
+		if ct.Status != models.ContractStatusApproved {
+			continue
+		}
+		if ct.EndDate != nil {
+			events = append(events, service.ICalEvent{
+				UID:         "contract-end-" + ct.ID.String() + "@ptit-dorm",
+				Summary:     "Hết hạn hợp đồng phòng " + ct.Room,
+				Description: "Hợp đồng ở ký túc xá hết hạn, gia hạn hoặc làm thủ tục trả phòng.",
+				Location:    ct.Room,
+				Start:       *ct.EndDate,
+				AllDay:      true,
+			})
+		}
+		if ct.Room == "" || rooms[ct.Room] {
+			continue
+		}
+		rooms[ct.Room] = true
+		bills, err := h.ElectricBillRepo.ListUnpaidByRoom(ctx, ct.Room)
+		if err != nil {
+			return nil, err
+		}
+		for _, bill := range bills {
+			period, err := time.Parse("2006-01", bill.Month)
+			if err != nil {
+				continue
+			}
+			// Hóa đơn tháng N hết hạn vào ngày dueDay của tháng N+1
+			due := time.Date(period.Year(), period.Month()+1, dueDay, 0, 0, 0, 0, time.Local)
+			events = append(events, service.ICalEvent{
+				UID:         "electric-bill-" + bill.ID + "@ptit-dorm",
+				Summary:     fmt.Sprintf("Hạn đóng tiền điện %s phòng %s", bill.Month, bill.RoomID),
+				Description: fmt.Sprintf("Số tiền: %d VND", bill.Amount),
+				Location:    bill.RoomID,
+				Start:       due,
+				AllDay:      true,
+			})
+		}
+	}
+	return events, nil
+}
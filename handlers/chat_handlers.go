@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultChatPageSize = 50
+	maxChatPageSize     = 200
+	maxChatMessageLen   = 4000
+)
+
+// chatStaffRoles được vào mọi channel phòng và channel khu
+var chatStaffRoles = []string{"manager", "admin_system"}
+
+// authorizeChatChannel kiểm tra user được tham gia channel: sinh viên chỉ vào phòng mình có hợp đồng approved trong đúng khu
+// và hội thoại hỗ trợ mình mở, cán bộ vào được channel khu, channel phòng (khu phải tồn tại) và mọi hội thoại hỗ trợ
+func authorizeChatChannel(c *gin.Context, contractRepo *repository.ContractRepository, areaRepo *repository.DormAreaRepository, supportRepo *repository.SupportThreadRepository, userID, channel string) (bool, error) {
+	isStaff := utils.HasAnyRole(c, chatStaffRoles...)
+	switch {
+	case strings.HasPrefix(channel, models.ChatChannelRoomPrefix):
+		areaID, room, ok := models.ParseChatRoomChannel(channel)
+		if !ok {
+			return false, nil
+		}
+		if isStaff {
+			if areaRepo == nil {
+				return false, nil
+			}
+			area, err := areaRepo.GetByID(c.Request.Context(), areaID)
+			return area != nil, err
+		}
+		return contractRepo.HasApprovedContractInRoom(c.Request.Context(), userID, areaID, room)
+	case strings.HasPrefix(channel, models.ChatChannelAreaPrefix):
+		areaID := strings.TrimPrefix(channel, models.ChatChannelAreaPrefix)
+		if !isStaff || areaID == "" || areaRepo == nil {
+			return false, nil
+		}
+		area, err := areaRepo.GetByID(c.Request.Context(), areaID)
+		return area != nil, err
+	case strings.HasPrefix(channel, models.ChatChannelSupportPrefix):
+		if supportRepo == nil {
+			return false, nil
+		}
+		thread, err := supportRepo.GetByID(c.Request.Context(), strings.TrimPrefix(channel, models.ChatChannelSupportPrefix))
+		if err != nil || thread == nil {
+			return false, err
+		}
+		return isStaff || thread.StudentID == userID, nil
+	}
+	return false, nil
+}
+
+type ChatHandler struct {
+	Repo         *repository.ChatRepository
+	ContractRepo *repository.ContractRepository
+	AreaRepo     *repository.DormAreaRepository
+	SupportRepo  *repository.SupportThreadRepository
+	WS           *service.WSService // phát read_receipt tới client đang online và tra cứu trạng thái online
+}
+
+func NewChatHandler(repo *repository.ChatRepository, contractRepo *repository.ContractRepository, areaRepo *repository.DormAreaRepository, ws *service.WSService) *ChatHandler {
+	return &ChatHandler{Repo: repo, ContractRepo: contractRepo, AreaRepo: areaRepo, WS: ws}
+}
+
+// channelFromPath đọc channel trên URL và kiểm tra quyền, đã trả lỗi nếu không được phép
+func (h *ChatHandler) channelFromPath(c *gin.Context) (string, string, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return "", "", false
+	}
+	channel := models.NormalizeChatChannel(c.Param("channel"))
+	ok, err := authorizeChatChannel(c, h.ContractRepo, h.AreaRepo, h.SupportRepo, userID, channel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", "", false
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you are not a member of this channel"})
+		return "", "", false
+	}
+	return userID, channel, true
+}
+
+// GET /api/v1/protected/chat/channels/:channel/messages?before=<message_id>&limit=
+// Lịch sử chat, mới nhất trước. Trang tiếp theo dùng next_before.
+func (h *ChatHandler) ListMessages(c *gin.Context) {
+	_, channel, ok := h.channelFromPath(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultChatPageSize
+	}
+	if limit > maxChatPageSize {
+		limit = maxChatPageSize
+	}
+	messages, err := h.Repo.ListMessages(c.Request.Context(), channel, c.Query("before"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var nextBefore string
+	if len(messages) == limit {
+		nextBefore = messages[len(messages)-1].ID
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": messages, "next_before": nextBefore})
+}
+
+// GET /api/v1/protected/chat/channels/:channel/read-receipts
+func (h *ChatHandler) ListReadReceipts(c *gin.Context) {
+	_, channel, ok := h.channelFromPath(c)
+	if !ok {
+		return
+	}
+	receipts, err := h.Repo.ListReadReceipts(c.Request.Context(), channel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": receipts})
+}
+
+// GET /api/v1/protected/chat/channels/:channel/presence
+// Thành viên đang online trong channel, tính trên mọi instance
+func (h *ChatHandler) ListPresence(c *gin.Context) {
+	_, channel, ok := h.channelFromPath(c)
+	if !ok {
+		return
+	}
+	online, err := h.WS.OnlineUsers(c.Request.Context(), channel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": online})
+}
+
+type markChatReadRequest struct {
+	MessageID string `json:"message_id" binding:"required"`
+}
+
+// POST /api/v1/protected/chat/channels/:channel/read
+// Đánh dấu đã đọc tới message_id (dùng khi client mở lịch sử qua REST)
+func (h *ChatHandler) MarkRead(c *gin.Context) {
+	userID, channel, ok := h.channelFromPath(c)
+	if !ok {
+		return
+	}
+	var req markChatReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	receipt, status, errMsg := markChatRead(c, h.Repo, channel, userID, req.MessageID)
+	if receipt == nil {
+		c.JSON(status, gin.H{"error": errMsg})
+		return
+	}
+	h.WS.BroadcastToRoom(channel, readReceiptEvent(receipt), nil)
+	pushUnread(c, h.WS, h.Repo, channel, userID)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": receipt})
+}
+
+// markChatRead kiểm tra tin nhắn thuộc channel rồi ghi xác nhận đã đọc
+func markChatRead(c *gin.Context, repo *repository.ChatRepository, channel, userID, messageID string) (*models.ChatReadReceipt, int, string) {
+	msg, err := repo.GetMessage(c.Request.Context(), messageID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "internal_error"
+	}
+	if msg == nil || msg.Channel != channel {
+		return nil, http.StatusNotFound, "message_not_found"
+	}
+	now := time.Now()
+	if err := repo.MarkRead(c.Request.Context(), channel, userID, messageID, now); err != nil {
+		return nil, http.StatusInternalServerError, "internal_error"
+	}
+	return &models.ChatReadReceipt{Channel: channel, UserID: userID, LastReadMessageID: messageID, ReadAt: now}, http.StatusOK, ""
+}
+
+func readReceiptEvent(r *models.ChatReadReceipt) gin.H {
+	return gin.H{"type": "read_receipt", "room": r.Channel, "user_id": r.UserID, "message_id": r.LastReadMessageID, "read_at": r.ReadAt}
+}
+
+func chatMessageEvent(m *models.ChatMessage) gin.H {
+	return gin.H{"type": "chat_message", "room": m.Channel, "id": m.ID, "from": m.SenderID, "content": m.Content, "created_at": m.CreatedAt}
+}
+
+// pushUnread gửi số tin chưa đọc của channel tới kênh riêng của user (mọi thiết bị đang mở)
+func pushUnread(c *gin.Context, ws *service.WSService, repo *repository.ChatRepository, channel, userID string) {
+	n, err := repo.UnreadCount(c.Request.Context(), channel, userID)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("channel", channel).Str("user_id", userID).Msg("Failed to count unread chat messages")
+		return
+	}
+	ws.BroadcastToRoom(models.ChatUserChannel(userID), gin.H{"type": "unread", "room": channel, "count": n}, nil)
+}
+
+// notifySupportMessage cập nhật hộp thư khi có tin mới trong hội thoại hỗ trợ: sắp xếp lại hội thoại và
+// đẩy số tin chưa đọc tới sinh viên và cán bộ phụ trách (trừ người gửi)
+func notifySupportMessage(c *gin.Context, ws *service.WSService, chatRepo *repository.ChatRepository, supportRepo *repository.SupportThreadRepository, thread *models.SupportThread, m *models.ChatMessage) {
+	if err := supportRepo.TouchLastMessage(c.Request.Context(), thread.ID, m.CreatedAt); err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("thread_id", thread.ID).Msg("Failed to update support thread last message time")
+	}
+	for _, userID := range []string{thread.StudentID, thread.AssignedStaffID} {
+		if userID != "" && userID != m.SenderID {
+			pushUnread(c, ws, chatRepo, thread.Channel, userID)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"Backend_Dorm_PTIT/config"
 	"Backend_Dorm_PTIT/models"
 	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/utils"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -61,16 +62,12 @@ func (h *ChatbotHandler) ensureManagerOrAdmin(c *gin.Context) bool {
 // @Produce json
 // @Success 200 {object} models.Response
 // @Failure 401 {object} models.Response
+// @Failure 403 {object} models.Response "API client is missing scope chatbot:read"
 // @Failure 500 {object} models.Response
 // @Router /api/v1/chatbot/datasets [get]
-// @Param API-key header string true "Chatbot service API key"
+// @Param API-key header string true "API client key with scope chatbot:read (or api_key.chatbot_service while accept_legacy_chatbot_key is on)"
 func (h *ChatbotHandler) GetDatasets(c *gin.Context) {
-	apiKey := c.GetHeader("API-key")
-	if apiKey == "" || apiKey != h.cfg.APIKey.ChatbotService {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "Invalid API key"))
-		return
-	}
-
+	// API key và scope đã được middleware.APIClientAuth (hoặc khoá cũ qua LegacyAPIKeyOr) kiểm tra
 	ctx := c.Request.Context()
 
 	documents, err := h.repo.GetDocuments(ctx)
@@ -324,7 +321,7 @@ func (h *ChatbotHandler) SyncDataset(c *gin.Context) {
 	reqPrompts.Header.Set("Content-Type", "application/json")
 	reqPrompts.Header.Set("API-key", h.cfg.APIKey.ChatbotService)
 
-	respPrompts, err := http.DefaultClient.Do(reqPrompts)
+	respPrompts, err := utils.OutboundHTTPClient.Do(reqPrompts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, fmt.Sprintf("failed to call chatbot prompts sync: %v", err)))
 		return
@@ -363,7 +360,7 @@ func (h *ChatbotHandler) SyncDataset(c *gin.Context) {
 	reqDocs.Header.Set("Content-Type", "application/json")
 	reqDocs.Header.Set("API-key", h.cfg.APIKey.ChatbotService)
 
-	respDocs, err := http.DefaultClient.Do(reqDocs)
+	respDocs, err := utils.OutboundHTTPClient.Do(reqDocs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, fmt.Sprintf("failed to call chatbot documents sync: %v", err)))
 		return
@@ -6,6 +6,7 @@ import (
 	"Backend_Dorm_PTIT/repository"
 	"Backend_Dorm_PTIT/utils"
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
@@ -18,14 +19,19 @@ type ContractCancelRequestHandler struct {
 	Repo         *repository.ContractCancelRequestRepository
 	ContractRepo *repository.ContractRepository
 	UserRepo     *repository.UserRepository
+	MoveOutRepo  *repository.MoveOutRepository
+	RefundRepo   *repository.RefundRepository
+	Audit        *repository.AuditRepository
 	cfg          *config.Config
 }
 
-func NewContractCancelRequestHandler(repo *repository.ContractCancelRequestRepository, contractRepo *repository.ContractRepository, userRepo *repository.UserRepository, cfg *config.Config) *ContractCancelRequestHandler {
+func NewContractCancelRequestHandler(repo *repository.ContractCancelRequestRepository, contractRepo *repository.ContractRepository, userRepo *repository.UserRepository, moveOutRepo *repository.MoveOutRepository, refundRepo *repository.RefundRepository, cfg *config.Config) *ContractCancelRequestHandler {
 	return &ContractCancelRequestHandler{
 		Repo:         repo,
 		ContractRepo: contractRepo,
 		UserRepo:     userRepo,
+		MoveOutRepo:  moveOutRepo,
+		RefundRepo:   refundRepo,
 		cfg:          cfg,
 	}
 }
@@ -172,11 +178,14 @@ func (h *ContractCancelRequestHandler) GetByID(c *gin.Context) {
 }
 
 type verifyCancelRequestInput struct {
-	Status      string `json:"status" binding:"required"`
-	ManagerNote string `json:"manager_note"`
+	Status       string `json:"status" binding:"required"`
+	ManagerNote  string `json:"manager_note"`
+	CheckoutDate string `json:"checkout_date"` // YYYY-MM-DD, chỉ dùng khi approved
 }
 
-// Manager verifies (approve/reject) cancel request
+// Manager verifies (approve/reject) cancel request.
+// Duyệt yêu cầu không kết thúc hợp đồng ngay mà mở quy trình trả phòng (move-out checklist);
+// hợp đồng chỉ chuyển sang finished khi toàn bộ checklist hoàn tất.
 func (h *ContractCancelRequestHandler) Verify(c *gin.Context) {
 	claimsAny, exists := c.Get("user")
 	if !exists {
@@ -219,27 +228,88 @@ func (h *ContractCancelRequestHandler) Verify(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Request already processed"})
 		return
 	}
+	ctx := context.Background()
+	var moveOut *models.MoveOutProcess
+	var refund *models.RefundLedgerEntry
+	if input.Status == "approved" {
+		checkoutDate, err := parseCheckoutDate(input.CheckoutDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid checkout_date format, must be YYYY-MM-DD"})
+			return
+		}
+		contract, err := h.ContractRepo.GetContractByID(ctx, req.ContractID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get contract", "details": err.Error()})
+			return
+		}
+		if contract == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "contract not found"})
+			return
+		}
+		if contract.Status != models.ContractStatusApproved {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only approved contracts can be cancelled"})
+			return
+		}
+		active, err := h.MoveOutRepo.GetActiveByContractID(ctx, req.ContractID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check move-out process", "details": err.Error()})
+			return
+		}
+		if active != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "There is already a move-out process for this contract"})
+			return
+		}
+		moveOut = newMoveOutProcess(contract, req.ID, checkoutDate)
+
+		// Báo giá hoàn phí tính từ ngày gửi yêu cầu hủy tới ngày trả phòng, chờ quản lý duyệt
+		refund, err = newRefundEntry(ctx, h.cfg.Refund, contract, checkoutDate, req.CreatedAt, models.RefundSourceCancelRequest, moveOut.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to calculate refund quote", "details": err.Error()})
+			return
+		}
+		if refund != nil {
+			for i := range moveOut.Items {
+				if moveOut.Items[i].ItemType == models.MoveOutItemFeeRefund {
+					moveOut.Items[i].Amount = refund.RefundAmount
+				}
+			}
+		}
+	}
 	now := time.Now()
+	before := gin.H{"status": req.Status, "manager_note": req.ManagerNote}
 	req.Status = input.Status
 	req.ManagerNote = input.ManagerNote
 	req.UpdatedAt = now
 	req.ProcessedAt = now
-	if err := h.Repo.Update(context.Background(), req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	if input.Status == "approved" {
-		ctx := context.Background()
-		// Kết thúc hợp đồng giống logic API /contracts/:id/finish
-		if err := h.ContractRepo.FinishContract(ctx, req.ContractID, req.Reason); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to finish contract from cancel request", "details": err.Error()})
+	if moveOut != nil {
+		// Duyệt yêu cầu, mở quy trình trả phòng và lưu báo giá cùng lúc, không để yêu cầu approved mà thiếu move-out
+		approved, err := h.Repo.Approve(ctx, req, moveOut, refund)
+		if errors.Is(err, repository.ErrContractNotApproved) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only approved contracts can be cancelled"})
 			return
 		}
-		// Switch user role to guest (hủy/kết thúc hợp đồng -> trở về guest)
-		if err := h.UserRepo.SetUserRoleByName(ctx, req.StudentID, "guest"); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user role to guest", "details": err.Error()})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start move-out process", "details": err.Error()})
 			return
 		}
+		if !approved {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Request already processed"})
+			return
+		}
+		after := gin.H{"status": req.Status, "manager_note": req.ManagerNote, "move_out_id": moveOut.ID}
+		if refund != nil {
+			after["refund_id"] = refund.ID
+			after["refund_amount"] = refund.RefundAmount
+		}
+		recordAudit(c, h.Audit, "contract_cancel_request.verify", "contract_cancel_request", req.ID, before, after)
+		c.JSON(http.StatusOK, gin.H{"request": req, "move_out": moveOut, "refund": refund})
+		return
+	}
+	if err := h.Repo.Update(ctx, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	recordAudit(c, h.Audit, "contract_cancel_request.verify", "contract_cancel_request", req.ID, before,
+		gin.H{"status": req.Status, "manager_note": req.ManagerNote})
 	c.JSON(http.StatusOK, req)
 }
@@ -7,6 +7,7 @@ import (
 	"Backend_Dorm_PTIT/repository"
 	"Backend_Dorm_PTIT/utils"
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
@@ -16,9 +17,13 @@ import (
 )
 
 type ContractHandler struct {
-	Repo     *repository.ContractRepository
-	UserRepo *repository.UserRepository
-	cfg      *config.Config
+	Repo        *repository.ContractRepository
+	UserRepo    *repository.UserRepository
+	RefundRepo  *repository.RefundRepository
+	MoveOutRepo *repository.MoveOutRepository
+	Audit       *repository.AuditRepository
+	Notifier    *Notifier
+	cfg         *config.Config
 }
 
 func NewContractHandler(repo *repository.ContractRepository, cfg *config.Config) *ContractHandler {
@@ -29,7 +34,7 @@ func NewContractHandler(repo *repository.ContractRepository, cfg *config.Config)
 func (h *ContractHandler) GetMyContract(c *gin.Context) {
 	claimsAny, exists := c.Get("user")
 	if !exists {
-		logger.Warn().Msg("Unauthorized: missing user claims in context")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: missing user claims in context")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, missing user claims"})
 		return
 	}
@@ -101,7 +106,7 @@ func (h *ContractHandler) GetMyRoomMembers(c *gin.Context) {
 func (h *ContractHandler) ConfirmContract(c *gin.Context) {
 	_, exists := c.Get("user")
 	if !exists {
-		logger.Warn().Msg("Unauthorized: missing user claims in context")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: missing user claims in context")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, missing user claims"})
 		return
 	}
@@ -121,7 +126,7 @@ func (h *ContractHandler) ConfirmContract(c *gin.Context) {
 	}
 	folder := "dorm_application"
 	publicID := uuid.New().String()
-	imageURL, uploadErr := utils.UploadToCloudinary(file, fileHeader, cloudName, apiKey, apiSecret, folder, publicID)
+	imageURL, uploadErr := utils.UploadToCloudinary(c.Request.Context(), file, fileHeader, cloudName, apiKey, apiSecret, folder, publicID)
 	if uploadErr != nil {
 		c.JSON(500, gin.H{"error": "failed to upload image", "details": uploadErr.Error()})
 		return
@@ -245,11 +250,21 @@ func (h *ContractHandler) VerifyContract(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "invalid request", "details": err.Error()})
 		return
 	}
-	err := h.Repo.VerifyContract(context.Background(), id, req.Status, req.Note)
+	contract, err := h.Repo.GetContractByID(context.Background(), id)
+	if err != nil || contract == nil {
+		c.JSON(404, gin.H{"ok": false, "error": "contract not found"})
+		return
+	}
+	err = h.Repo.VerifyContract(context.Background(), id, req.Status, req.Note)
 	if err != nil {
 		c.JSON(500, gin.H{"ok": false, "error": "failed to verify contract", "details": err.Error()})
 		return
 	}
+	recordAudit(c, h.Audit, "contract.verify", "contract", id,
+		gin.H{"status": contract.Status, "note": contract.Note},
+		gin.H{"status": req.Status, "note": req.Note})
+	h.Notifier.Notify(c.Request.Context(), []string{contract.StudentID}, models.NotificationContractVerified,
+		"Hợp đồng đã được xử lý", "Trạng thái hợp đồng: "+req.Status, "contract", id, gin.H{"status": req.Status, "note": req.Note})
 	c.JSON(200, gin.H{"ok": true, "message": "Xác nhận hợp đồng thành công"})
 }
 
@@ -297,6 +312,8 @@ func (h *ContractHandler) GetResidentsByRoom(c *gin.Context) {
 // Kết thúc hợp đồng: set status = "finished" và chuyển user role sang guest
 type finishContractRequest struct {
 	Reason string `json:"reason" binding:"required"`
+	// Ngày sinh viên báo kết thúc (YYYY-MM-DD). Để trống khi ban quản lý chủ động kết thúc: không tính phạt báo trễ.
+	NoticeDate string `json:"notice_date"`
 }
 
 func (h *ContractHandler) FinishContract(c *gin.Context) {
@@ -351,21 +368,61 @@ func (h *ContractHandler) FinishContract(c *gin.Context) {
 		return
 	}
 
-	// 1. Set contract status = "finished"
-	err = h.Repo.FinishContract(ctx, contractID, req.Reason)
+	// Hợp đồng đang làm thủ tục trả phòng sẽ tự kết thúc khi checklist hoàn tất, báo giá hoàn phí đã lập ở bước duyệt hủy
+	moveOut, err := h.MoveOutRepo.GetActiveByContractID(ctx, contractID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "failed to check move-out process", "details": err.Error()})
+		return
+	}
+	if moveOut != nil {
+		c.JSON(http.StatusConflict, gin.H{"ok": false, "error": "Contract has a move-out process in progress, complete its checklist instead", "move_out_id": moveOut.ID})
+		return
+	}
+	existing, err := h.RefundRepo.GetActiveByContractID(ctx, contractID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "failed to finish contract", "details": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "failed to check refunds", "details": err.Error()})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"ok": false, "error": "Contract already has a refund entry", "refund": existing})
 		return
 	}
 
-	// 2. Chuyển user role sang guest
-	err = h.UserRepo.SetUserRoleByName(ctx, contract.StudentID, "guest")
+	// Kết thúc trước hạn thì lập báo giá hoàn phí chờ quản lý duyệt
+	now := time.Now()
+	noticeDate := now.AddDate(0, 0, -h.cfg.Refund.NoticePeriodDays)
+	if req.NoticeDate != "" {
+		noticeDate, err = time.Parse("2006-01-02", req.NoticeDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "invalid notice_date format, must be YYYY-MM-DD"})
+			return
+		}
+	}
+	refund, err := newRefundEntry(ctx, h.cfg.Refund, contract, now, noticeDate, models.RefundSourceFinishContract, "")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "failed to set user role to guest", "details": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "failed to calculate refund quote", "details": err.Error()})
+		return
+	}
+
+	// Kết thúc hợp đồng, chuyển user role sang guest và lưu báo giá trong cùng transaction
+	if err := h.Repo.Finish(ctx, contractID, req.Reason, refund); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrContractNotApproved):
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Only approved contracts can be finished"})
+		case errors.Is(err, repository.ErrMoveOutInProgress):
+			c.JSON(http.StatusConflict, gin.H{"ok": false, "error": "Contract has a move-out process in progress, complete its checklist instead"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "failed to finish contract", "details": err.Error()})
+		}
 		return
 	}
+	recordAudit(c, h.Audit, "contract.finish", "contract", contractID,
+		gin.H{"status": contract.Status},
+		gin.H{"status": models.ContractStatusFinished, "reason": req.Reason})
+	h.Notifier.Notify(ctx, []string{contract.StudentID}, models.NotificationContractFinished,
+		"Hợp đồng đã kết thúc", req.Reason, "contract", contractID, gin.H{"reason": req.Reason})
 
-	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Hợp đồng đã kết thúc", "contract_id": contractID})
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Hợp đồng đã kết thúc", "contract_id": contractID, "refund": refund})
 }
 
 // PATCH /api/v1/protected/contracts/:id/extend (student)
@@ -19,8 +19,10 @@ import (
 )
 
 type DormApplicationHandler struct {
-	config *config.Config
-	Repo   *repository.DormApplicationRepository
+	config   *config.Config
+	Repo     *repository.DormApplicationRepository
+	Audit    *repository.AuditRepository
+	Notifier *Notifier
 }
 
 func NewDormApplicationHandler(repo *repository.DormApplicationRepository, config *config.Config) *DormApplicationHandler {
@@ -171,7 +173,7 @@ func (h *DormApplicationHandler) CreateDormApplication(c *gin.Context) {
 			return "", err
 		}
 		defer file.Close()
-		return utils.UploadToCloudinary(file, fileHeader, cloudName, apiKey, apiSecret, folder, publicID)
+		return utils.UploadToCloudinary(c.Request.Context(), file, fileHeader, cloudName, apiKey, apiSecret, folder, publicID)
 	}
 	var imgErr error
 	folder := "dorm_application"
@@ -221,15 +223,17 @@ func (h *DormApplicationHandler) UpdateDormApplicationStatus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
 		return
 	}
+	app, err := h.Repo.GetByID(context.Background(), id)
+	if err != nil || app == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
+		return
+	}
+	before := gin.H{"status": app.Status}
+	after := gin.H{"status": req.Status}
+	action := "dorm_application.update_status"
+
 	// Nếu duyệt (approved), thực hiện quy trình tự động
 	if req.Status == "approved" {
-		// 1. Lấy thông tin đơn nguyện vọng
-		app, err := h.Repo.GetByID(context.Background(), id)
-		if err != nil || app == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
-			return
-		}
-
 		var userID string
 		var password string
 		var emailSubject string
@@ -335,28 +339,51 @@ func (h *DormApplicationHandler) UpdateDormApplicationStatus(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create contract", "details": err.Error()})
 			return
 		}
+		action = "dorm_application.approve"
+		after["student_id"] = userID
+		after["room"] = req.RoomID
+		after["contract_id"] = contract.ID.String()
 
 		// Gửi mail
 		smtpHost := h.config.MailGoogle.Host
 		smtpPort := h.config.MailGoogle.Port
 		sender := h.config.MailGoogle.Email
 		passwordMail := h.config.MailGoogle.Password
-		_ = utils.SendMail(smtpHost, smtpPort, sender, passwordMail, app.Email, emailSubject, emailBody)
+		_ = utils.SendMail(c.Request.Context(), smtpHost, smtpPort, sender, passwordMail, app.Email, emailSubject, emailBody)
 	}
 	// Cập nhật status đơn nguyện vọng
-	err := h.Repo.UpdateStatus(context.Background(), id, req.Status)
+	err = h.Repo.UpdateStatus(context.Background(), id, req.Status)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update status", "details": err.Error()})
 		return
 	}
+	recordAudit(c, h.Audit, action, "dorm_application", id, before, after)
+	h.notifyApplicant(c, app, req.Status, after)
 	c.JSON(http.StatusOK, gin.H{"id": id, "status": req.Status})
 }
 
+// notifyApplicant báo kết quả xét đơn cho người nộp, chỉ khi email của đơn đã có tài khoản
+func (h *DormApplicationHandler) notifyApplicant(c *gin.Context, app *models.DormApplication, status string, data gin.H) {
+	if h.Notifier == nil {
+		return
+	}
+	userID, _ := data["student_id"].(string)
+	if userID == "" {
+		var err error
+		userID, err = h.Repo.GetStudentIDByEmail(c.Request.Context(), app.Email)
+		if err != nil || userID == "" {
+			return
+		}
+	}
+	h.Notifier.Notify(c.Request.Context(), []string{userID}, models.NotificationDormApplicationStatus,
+		"Đơn đăng ký ký túc xá đã được xử lý", "Trạng thái đơn: "+status, "dorm_application", app.ID.String(), data)
+}
+
 // GET /dorm-applications
 func (h *DormApplicationHandler) GetAllDormApplications(c *gin.Context) {
 	claimsAny, exists := c.Get("user")
 	if !exists {
-		logger.Warn().Msg("Unauthorized: missing user claims in context")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: missing user claims in context")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized, missing user claims"))
 		return
 	}
@@ -376,7 +403,7 @@ func (h *DormApplicationHandler) GetAllDormApplications(c *gin.Context) {
 		}
 	}
 	if !isAdmin {
-		logger.Warn().Msg("Unauthorized: user does not have admin or manager role")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: user does not have admin or manager role")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized, you do not have the required permissions"))
 		return
 	}
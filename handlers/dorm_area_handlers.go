@@ -11,7 +11,8 @@ import (
 )
 
 type DormAreaHandler struct {
-	Repo *repository.DormAreaRepository
+	Repo  *repository.DormAreaRepository
+	Audit *repository.AuditRepository
 }
 
 func NewDormAreaHandler(repo *repository.DormAreaRepository) *DormAreaHandler {
@@ -31,6 +32,7 @@ func (h *DormAreaHandler) CreateDormArea(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordAudit(c, h.Audit, "dorm_area.create", "dorm_area", area.ID, nil, area)
 	c.JSON(http.StatusCreated, area)
 }
 
@@ -47,19 +49,39 @@ func (h *DormAreaHandler) UpdateDormArea(c *gin.Context) {
 	}
 	// Đảm bảo luôn cập nhật theo id trên URL, không phụ thuộc body
 	area.ID = id
+	prev, err := h.Repo.GetByID(context.Background(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if prev == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "dorm area not found"})
+		return
+	}
 	if err := h.Repo.Update(context.Background(), &area); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordAudit(c, h.Audit, "dorm_area.update", "dorm_area", id, prev, area)
 	c.JSON(http.StatusOK, area)
 }
 
 func (h *DormAreaHandler) DeleteDormArea(c *gin.Context) {
 	id := c.Param("id")
+	prev, err := h.Repo.GetByID(context.Background(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if prev == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "dorm area not found"})
+		return
+	}
 	if err := h.Repo.Delete(context.Background(), id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordAudit(c, h.Audit, "dorm_area.delete", "dorm_area", id, prev, nil)
 	c.JSON(http.StatusOK, gin.H{"deleted": id})
 }
 
@@ -3,7 +3,9 @@ package handlers
 import (
 	"Backend_Dorm_PTIT/models"
 	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/utils"
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -11,18 +13,81 @@ import (
 	"github.com/google/uuid"
 )
 
+// Lịch trực lặp lại tối đa trong một năm
+const maxRotationDays = 366
+
 type DutyScheduleHandler struct {
-	Repo *repository.DutyScheduleRepository
+	Repo     *repository.DutyScheduleRepository
+	AreaRepo *repository.DormAreaRepository
+	Audit    *repository.AuditRepository
+}
+
+func NewDutyScheduleHandler(repo *repository.DutyScheduleRepository, areaRepo *repository.DormAreaRepository) *DutyScheduleHandler {
+	return &DutyScheduleHandler{Repo: repo, AreaRepo: areaRepo}
 }
 
-func NewDutyScheduleHandler(repo *repository.DutyScheduleRepository) *DutyScheduleHandler {
-	return &DutyScheduleHandler{Repo: repo}
+// shiftBounds ghép ngày với giờ bắt đầu/kết thúc (HH:MM).
+// Để trống thì trực cả ngày; giờ kết thúc không sau giờ bắt đầu nghĩa là ca qua đêm.
+func shiftBounds(date time.Time, startHHMM, endHHMM string) (time.Time, time.Time, error) {
+	if startHHMM == "" {
+		startHHMM = "00:00"
+	}
+	if endHHMM == "" {
+		endHHMM = startHHMM
+	}
+	st, err := time.Parse("15:04", startHHMM)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start_time format, must be HH:MM")
+	}
+	et, err := time.Parse("15:04", endHHMM)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end_time format, must be HH:MM")
+	}
+	y, m, d := date.Date()
+	start := time.Date(y, m, d, st.Hour(), st.Minute(), 0, 0, time.Local)
+	end := time.Date(y, m, d, et.Hour(), et.Minute(), 0, 0, time.Local)
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+// checkShift kiểm tra quản túc, khu trực và trùng lịch. Trả về status 0 nếu hợp lệ.
+func (h *DutyScheduleHandler) checkShift(ctx context.Context, staffID uuid.UUID, areaID string, start, end time.Time, excludeIDs ...uuid.UUID) (int, gin.H) {
+	isManager, err := h.Repo.IsManager(ctx, staffID)
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Check staff failed"}
+	}
+	if !isManager {
+		return http.StatusBadRequest, gin.H{"error": "Staff is not a manager"}
+	}
+	area, err := h.AreaRepo.GetByID(ctx, areaID)
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Check dorm area failed"}
+	}
+	if area == nil {
+		return http.StatusBadRequest, gin.H{"error": "Dorm area not found"}
+	}
+	conflicts, err := h.Repo.FindConflicts(ctx, staffID, areaID, start, end, excludeIDs...)
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Check duty conflicts failed"}
+	}
+	if len(conflicts) > 0 {
+		return http.StatusConflict, gin.H{"error": "Duty schedule conflicts with existing shifts", "conflicts": conflicts}
+	}
+	return 0, nil
 }
 
 // POST /api/v1/duty-schedules
 func (h *DutyScheduleHandler) CreateDutySchedule(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
 	var input struct {
 		Date        string `json:"date" binding:"required"`
+		StartTime   string `json:"start_time"` // HH:MM
+		EndTime     string `json:"end_time"`   // HH:MM
 		AreaID      string `json:"area_id" binding:"required"`
 		Description string `json:"description"`
 		StaffID     string `json:"staff_id" binding:"required"` // user_id quản túc
@@ -41,18 +106,31 @@ func (h *DutyScheduleHandler) CreateDutySchedule(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff id"})
 		return
 	}
+	start, end, err := shiftBounds(date, input.StartTime, input.EndTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := context.Background()
+	if status, body := h.checkShift(ctx, staffID, input.AreaID, start, end); status != 0 {
+		c.JSON(status, body)
+		return
+	}
 	ds := &models.DutySchedule{
 		ID:          uuid.New(),
 		Date:        date,
+		StartTime:   start,
+		EndTime:     end,
 		AreaID:      input.AreaID,
 		Description: input.Description,
 		StaffID:     staffID,
 	}
-	if err := h.Repo.CreateDutySchedule(context.Background(), ds); err != nil {
+	if err := h.Repo.CreateDutySchedule(ctx, ds); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Create duty schedule failed"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Tạo lịch trực thành công"})
+	recordAudit(c, h.Audit, "duty_schedule.create", "duty_schedule", ds.ID.String(), nil, ds)
+	c.JSON(http.StatusOK, gin.H{"message": "Tạo lịch trực thành công", "data": ds})
 }
 
 // GET /api/v1/duty-schedules
@@ -65,6 +143,30 @@ func (h *DutyScheduleHandler) ListDutySchedules(c *gin.Context) {
 	c.JSON(http.StatusOK, ds)
 }
 
+// GET /api/v1/duty-schedules/on-duty?area_id=A1
+// Ai đang trực ở khu A1 lúc này (sinh viên cũng gọi được)
+func (h *DutyScheduleHandler) ListOnDuty(c *gin.Context) {
+	ctx := context.Background()
+	areaID := c.Query("area_id")
+	if areaID != "" {
+		area, err := h.AreaRepo.GetByID(ctx, areaID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Check dorm area failed"})
+			return
+		}
+		if area == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dorm area not found"})
+			return
+		}
+	}
+	ds, err := h.Repo.ListOnDuty(ctx, areaID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Get on-duty staff failed"})
+		return
+	}
+	c.JSON(http.StatusOK, ds)
+}
+
 // GET /api/v1/duty-schedules/:id
 func (h *DutyScheduleHandler) GetDutyScheduleDetail(c *gin.Context) {
 	id := c.Param("id")
@@ -83,6 +185,10 @@ func (h *DutyScheduleHandler) GetDutyScheduleDetail(c *gin.Context) {
 
 // PUT /api/v1/duty-schedules/:id
 func (h *DutyScheduleHandler) UpdateDutySchedule(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
 	id := c.Param("id")
 	uid, err := uuid.Parse(id)
 	if err != nil {
@@ -91,6 +197,8 @@ func (h *DutyScheduleHandler) UpdateDutySchedule(c *gin.Context) {
 	}
 	var input struct {
 		Date        string `json:"date"`
+		StartTime   string `json:"start_time"`
+		EndTime     string `json:"end_time"`
 		AreaID      string `json:"area_id"`
 		Description string `json:"description"`
 		StaffID     string `json:"staff_id"`
@@ -99,13 +207,19 @@ func (h *DutyScheduleHandler) UpdateDutySchedule(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	ds, err := h.Repo.GetDutyScheduleByID(context.Background(), uid)
+	ctx := context.Background()
+	ds, err := h.Repo.GetDutyScheduleByID(ctx, uid)
 	if err != nil || ds == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Duty schedule not found"})
 		return
 	}
+	before := *ds
 	if input.Date != "" {
-		ds.Date, _ = time.Parse("2006-01-02", input.Date)
+		ds.Date, err = time.Parse("2006-01-02", input.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+			return
+		}
 	}
 	if input.AreaID != "" {
 		ds.AreaID = input.AreaID
@@ -121,24 +235,426 @@ func (h *DutyScheduleHandler) UpdateDutySchedule(c *gin.Context) {
 		}
 		ds.StaffID = staffID
 	}
-	if err := h.Repo.UpdateDutySchedule(context.Background(), ds); err != nil {
+	// Giữ giờ trực cũ nếu không truyền giờ mới
+	startHHMM, endHHMM := input.StartTime, input.EndTime
+	if startHHMM == "" {
+		startHHMM = ds.StartTime.In(time.Local).Format("15:04")
+	}
+	if endHHMM == "" {
+		endHHMM = ds.EndTime.In(time.Local).Format("15:04")
+	}
+	ds.StartTime, ds.EndTime, err = shiftBounds(ds.Date, startHHMM, endHHMM)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if status, body := h.checkShift(ctx, ds.StaffID, ds.AreaID, ds.StartTime, ds.EndTime, ds.ID); status != 0 {
+		c.JSON(status, body)
+		return
+	}
+	if err := h.Repo.UpdateDutySchedule(ctx, ds); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Update duty schedule failed"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Cập nhật lịch trực thành công"})
+	recordAudit(c, h.Audit, "duty_schedule.update", "duty_schedule", ds.ID.String(), before, ds)
+	c.JSON(http.StatusOK, gin.H{"message": "Cập nhật lịch trực thành công", "data": ds})
 }
 
 // DELETE /api/v1/duty-schedules/:id
 func (h *DutyScheduleHandler) DeleteDutySchedule(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
 	id := c.Param("id")
 	uid, err := uuid.Parse(id)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
 		return
 	}
-	if err := h.Repo.DeleteDutySchedule(context.Background(), uid); err != nil {
+	ctx := context.Background()
+	prev, err := h.Repo.GetDutyScheduleByID(ctx, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Get duty schedule failed"})
+		return
+	}
+	if prev == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Duty schedule not found"})
+		return
+	}
+	if err := h.Repo.DeleteDutySchedule(ctx, uid); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Delete duty schedule failed"})
 		return
 	}
+	recordAudit(c, h.Audit, "duty_schedule.delete", "duty_schedule", id, prev, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "Xóa lịch trực thành công"})
 }
+
+// POST /api/v1/duty-rotations
+// Tạo lịch trực lặp lại hàng tuần cho cả học kỳ. Nếu có ca bị trùng thì không tạo ca nào.
+func (h *DutyScheduleHandler) CreateRotation(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	userID, _ := utils.GetUserIDFromContext(c)
+	var input struct {
+		AreaID        string `json:"area_id" binding:"required"`
+		StaffID       string `json:"staff_id" binding:"required"`
+		Weekdays      []int  `json:"weekdays" binding:"required"` // 0 = Chủ nhật ... 6 = Thứ bảy
+		StartTime     string `json:"start_time" binding:"required"`
+		EndTime       string `json:"end_time" binding:"required"`
+		SemesterStart string `json:"semester_start" binding:"required"`
+		SemesterEnd   string `json:"semester_end" binding:"required"`
+		Description   string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	staffID, err := uuid.Parse(input.StaffID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff id"})
+		return
+	}
+	semesterStart, err := time.Parse("2006-01-02", input.SemesterStart)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid semester_start format"})
+		return
+	}
+	semesterEnd, err := time.Parse("2006-01-02", input.SemesterEnd)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid semester_end format"})
+		return
+	}
+	if semesterEnd.Before(semesterStart) || semesterEnd.Sub(semesterStart).Hours()/24 > maxRotationDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("semester_end must be after semester_start and within %d days", maxRotationDays)})
+		return
+	}
+	weekdays := make(map[time.Weekday]bool)
+	for _, d := range input.Weekdays {
+		if d < 0 || d > 6 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "weekdays must be between 0 (Sunday) and 6 (Saturday)"})
+			return
+		}
+		weekdays[time.Weekday(d)] = true
+	}
+	if len(weekdays) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "weekdays must not be empty"})
+		return
+	}
+	if _, _, err := shiftBounds(semesterStart, input.StartTime, input.EndTime); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rot := &models.DutyRotation{
+		ID:            uuid.New().String(),
+		AreaID:        input.AreaID,
+		StaffID:       staffID.String(),
+		Weekdays:      input.Weekdays,
+		ShiftStart:    input.StartTime,
+		ShiftEnd:      input.EndTime,
+		SemesterStart: semesterStart,
+		SemesterEnd:   semesterEnd,
+		Description:   input.Description,
+		CreatedBy:     userID,
+		CreatedAt:     time.Now(),
+	}
+	var schedules []models.DutySchedule
+	for d := semesterStart; !d.After(semesterEnd); d = d.AddDate(0, 0, 1) {
+		if !weekdays[d.Weekday()] {
+			continue
+		}
+		start, end, _ := shiftBounds(d, input.StartTime, input.EndTime)
+		schedules = append(schedules, models.DutySchedule{
+			ID:          uuid.New(),
+			Date:        d,
+			StartTime:   start,
+			EndTime:     end,
+			AreaID:      input.AreaID,
+			Description: input.Description,
+			StaffID:     staffID,
+			RotationID:  rot.ID,
+		})
+	}
+	if len(schedules) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rotation does not generate any shift"})
+		return
+	}
+
+	ctx := context.Background()
+	var conflicts []models.DutySchedule
+	for i, ds := range schedules {
+		if i == 0 {
+			// Kiểm tra quản túc và khu một lần, các ca sau chỉ cần kiểm tra trùng lịch
+			status, body := h.checkShift(ctx, staffID, input.AreaID, ds.StartTime, ds.EndTime)
+			if status != 0 && status != http.StatusConflict {
+				c.JSON(status, body)
+				return
+			}
+		}
+		found, err := h.Repo.FindConflicts(ctx, staffID, input.AreaID, ds.StartTime, ds.EndTime)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Check duty conflicts failed"})
+			return
+		}
+		conflicts = append(conflicts, found...)
+	}
+	if len(conflicts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Duty rotation conflicts with existing shifts", "conflicts": conflicts})
+		return
+	}
+	if err := h.Repo.CreateRotation(ctx, rot, schedules); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Create duty rotation failed"})
+		return
+	}
+	recordAudit(c, h.Audit, "duty_rotation.create", "duty_rotation", rot.ID, nil, gin.H{"rotation": rot, "shifts": len(schedules)})
+	c.JSON(http.StatusOK, gin.H{"message": "Tạo lịch trực lặp lại thành công", "data": rot, "shifts": len(schedules)})
+}
+
+// GET /api/v1/duty-rotations
+func (h *DutyScheduleHandler) ListRotations(c *gin.Context) {
+	rotations, err := h.Repo.ListRotations(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Get list duty rotations failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rotations)
+}
+
+// DELETE /api/v1/duty-rotations/:id
+// Xóa lịch lặp cùng các ca chưa diễn ra
+func (h *DutyScheduleHandler) DeleteRotation(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	ctx := context.Background()
+	prev, err := h.Repo.GetRotationByID(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Get duty rotation failed"})
+		return
+	}
+	if prev == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Duty rotation not found"})
+		return
+	}
+	removed, err := h.Repo.DeleteRotation(ctx, id, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Delete duty rotation failed"})
+		return
+	}
+	recordAudit(c, h.Audit, "duty_rotation.delete", "duty_rotation", id, gin.H{"rotation": prev}, gin.H{"shifts_removed": removed})
+	c.JSON(http.StatusOK, gin.H{"message": "Xóa lịch trực lặp lại thành công"})
+}
+
+// POST /api/v1/duty-swap-requests
+// Quản túc xin đổi ca của mình với quản túc khác (hoặc nhường ca nếu không có target_schedule_id)
+func (h *DutyScheduleHandler) CreateSwapRequest(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, only managers can request a shift swap"})
+		return
+	}
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var input struct {
+		ScheduleID       string `json:"schedule_id" binding:"required"`
+		TargetStaffID    string `json:"target_staff_id" binding:"required"`
+		TargetScheduleID string `json:"target_schedule_id"`
+		Reason           string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	scheduleID, err := uuid.Parse(input.ScheduleID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule id"})
+		return
+	}
+	targetStaffID, err := uuid.Parse(input.TargetStaffID)
+	if err != nil || input.TargetStaffID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target staff id"})
+		return
+	}
+	ctx := context.Background()
+	ds, err := h.Repo.GetDutyScheduleByID(ctx, scheduleID)
+	if err != nil || ds == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Duty schedule not found"})
+		return
+	}
+	if ds.StaffID.String() != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only swap your own shifts"})
+		return
+	}
+	isManager, err := h.Repo.IsManager(ctx, targetStaffID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Check staff failed"})
+		return
+	}
+	if !isManager {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target staff is not a manager"})
+		return
+	}
+	if input.TargetScheduleID != "" {
+		targetScheduleID, err := uuid.Parse(input.TargetScheduleID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target schedule id"})
+			return
+		}
+		target, err := h.Repo.GetDutyScheduleByID(ctx, targetScheduleID)
+		if err != nil || target == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Target duty schedule not found"})
+			return
+		}
+		if target.StaffID != targetStaffID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Target schedule does not belong to target staff"})
+			return
+		}
+	}
+	now := time.Now()
+	req := &models.DutySwapRequest{
+		ID:               uuid.New().String(),
+		ScheduleID:       input.ScheduleID,
+		RequesterID:      userID,
+		TargetStaffID:    input.TargetStaffID,
+		TargetScheduleID: input.TargetScheduleID,
+		Reason:           input.Reason,
+		Status:           models.DutySwapStatusPending,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := h.Repo.CreateSwapRequest(ctx, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Create swap request failed"})
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+// GET /api/v1/duty-swap-requests?status=pending
+// Quản túc xem yêu cầu đổi ca đã gửi/nhận, admin xem tất cả
+func (h *DutyScheduleHandler) ListSwapRequests(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	userID, _ := utils.GetUserIDFromContext(c)
+	if utils.HasAnyRole(c, "admin_system") {
+		userID = ""
+	}
+	requests, err := h.Repo.ListSwapRequests(context.Background(), userID, c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Get list swap requests failed"})
+		return
+	}
+	c.JSON(http.StatusOK, requests)
+}
+
+// PATCH /api/v1/duty-swap-requests/:id
+// Quản túc nhận đổi ca (hoặc admin) duyệt/từ chối; người gửi có thể hủy (cancelled)
+func (h *DutyScheduleHandler) ReviewSwapRequest(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var input struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := context.Background()
+	req, err := h.Repo.GetSwapRequestByID(ctx, c.Param("id"))
+	if err != nil || req == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Swap request not found"})
+		return
+	}
+	if req.Status != models.DutySwapStatusPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Swap request already processed"})
+		return
+	}
+	isAdmin := utils.HasAnyRole(c, "admin_system")
+	switch input.Status {
+	case models.DutySwapStatusApproved, models.DutySwapStatusRejected:
+		if req.TargetStaffID != userID && !isAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the target manager can review this swap request"})
+			return
+		}
+	case models.DutySwapStatusCancelled:
+		if req.RequesterID != userID && !isAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the requester can cancel this swap request"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be 'approved', 'rejected' or 'cancelled'"})
+		return
+	}
+
+	if input.Status == models.DutySwapStatusApproved {
+		// Sau khi đổi, mỗi người không được trùng ca khác của chính mình
+		scheduleID, _ := uuid.Parse(req.ScheduleID)
+		ds, err := h.Repo.GetDutyScheduleByID(ctx, scheduleID)
+		if err != nil || ds == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Duty schedule not found"})
+			return
+		}
+		if ds.StaffID.String() != req.RequesterID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duty schedule has been reassigned since the request was made"})
+			return
+		}
+		excludes := []uuid.UUID{ds.ID}
+		var target *models.DutySchedule
+		if req.TargetScheduleID != "" {
+			targetID, _ := uuid.Parse(req.TargetScheduleID)
+			target, err = h.Repo.GetDutyScheduleByID(ctx, targetID)
+			if err != nil || target == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Target duty schedule not found"})
+				return
+			}
+			if target.StaffID.String() != req.TargetStaffID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Target duty schedule has been reassigned since the request was made"})
+				return
+			}
+			excludes = append(excludes, target.ID)
+		}
+		targetStaffID, _ := uuid.Parse(req.TargetStaffID)
+		// Khu trực không đổi nên chỉ cần kiểm tra trùng theo người trực
+		conflicts, err := h.Repo.FindConflicts(ctx, targetStaffID, "", ds.StartTime, ds.EndTime, excludes...)
+		if err == nil && target != nil && len(conflicts) == 0 {
+			conflicts, err = h.Repo.FindConflicts(ctx, ds.StaffID, "", target.StartTime, target.EndTime, excludes...)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Check duty conflicts failed"})
+			return
+		}
+		if len(conflicts) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Swap would create overlapping shifts", "conflicts": conflicts})
+			return
+		}
+	}
+
+	now := time.Now()
+	if err := h.Repo.ReviewSwapRequest(ctx, req, input.Status, userID, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Review swap request failed"})
+		return
+	}
+	recordAudit(c, h.Audit, "duty_swap_request.review", "duty_swap_request", req.ID,
+		gin.H{"status": req.Status},
+		gin.H{"status": input.Status, "schedule_id": req.ScheduleID, "target_schedule_id": req.TargetScheduleID, "target_staff_id": req.TargetStaffID})
+	req.Status = input.Status
+	req.ReviewedBy = userID
+	req.ReviewedAt = &now
+	req.UpdatedAt = now
+	c.JSON(http.StatusOK, req)
+}
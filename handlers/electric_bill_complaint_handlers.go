@@ -38,7 +38,7 @@ func (h *ElectricBillComplaintHandler) Create(c *gin.Context) {
 
 	file, fileHeader, err := c.Request.FormFile("proof")
 	if err == nil && file != nil {
-		url, err := utils.UploadToCloudinary(
+		url, err := utils.UploadToCloudinary(c.Request.Context(), 
 			file, fileHeader,
 			h.cfg.Cloudinary.CloudName,
 			h.cfg.Cloudinary.Apikey,
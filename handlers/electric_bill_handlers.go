@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/logger"
 	"Backend_Dorm_PTIT/models"
 	"Backend_Dorm_PTIT/repository"
 	"Backend_Dorm_PTIT/utils"
 	"context"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,8 +17,10 @@ import (
 )
 
 type ElectricBillHandler struct {
-	Repo *repository.ElectricBillRepository
-	cfg  *config.Config
+	Repo         *repository.ElectricBillRepository
+	ContractRepo *repository.ContractRepository // tìm sinh viên trong phòng để gửi thông báo
+	Notifier     *Notifier
+	cfg          *config.Config
 }
 
 func NewElectricBillHandler(repo *repository.ElectricBillRepository, cfg *config.Config) *ElectricBillHandler {
@@ -79,9 +83,29 @@ func (h *ElectricBillHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.notifyResidents(c, &req)
 	c.JSON(http.StatusOK, req)
 }
 
+// notifyResidents báo hoá đơn điện mới cho các sinh viên đang ở phòng
+func (h *ElectricBillHandler) notifyResidents(c *gin.Context, bill *models.ElectricBill) {
+	if h.Notifier == nil || h.ContractRepo == nil {
+		return
+	}
+	residents, err := h.ContractRepo.GetResidentsFromApprovedContractsByRoom(c.Request.Context(), bill.RoomID)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("room", bill.RoomID).Msg("Failed to list residents for electric bill notification")
+		return
+	}
+	userIDs := make([]string, 0, len(residents))
+	for _, r := range residents {
+		userIDs = append(userIDs, r.StudentID)
+	}
+	h.Notifier.Notify(c.Request.Context(), userIDs, models.NotificationElectricBillCreated,
+		"Hoá đơn điện tháng "+bill.Month, "Phòng "+bill.RoomID+": "+strconv.Itoa(bill.Amount)+" VND", "electric_bill", bill.ID,
+		gin.H{"room_id": bill.RoomID, "month": bill.Month, "amount": bill.Amount})
+}
+
 func (h *ElectricBillHandler) GetByID(c *gin.Context) {
 	id := c.Param("id")
 	bill, err := h.Repo.GetByID(context.Background(), id)
@@ -303,7 +327,7 @@ func (h *ElectricBillHandler) ConfirmByStudent(c *gin.Context) {
 	apiSecret := h.cfg.Cloudinary.Secret
 	folder := "electric_bills"
 	publicID := uuid.New().String()
-	url, err := utils.UploadToCloudinary(f, paymentFile, cloudName, apiKey, apiSecret, folder, publicID)
+	url, err := utils.UploadToCloudinary(c.Request.Context(), f, paymentFile, cloudName, apiKey, apiSecret, folder, publicID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image"})
 		return
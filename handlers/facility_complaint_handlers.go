@@ -17,6 +17,7 @@ import (
 type FacilityComplaintHandler struct {
 	Repo         *repository.FacilityComplaintRepository
 	ContractRepo *repository.ContractRepository
+	Notifier     *Notifier
 	cfg          *config.Config
 }
 
@@ -68,7 +69,7 @@ func (h *FacilityComplaintHandler) Create(c *gin.Context) {
 
 	file, fileHeader, err := c.Request.FormFile("proof")
 	if err == nil && file != nil {
-		url, err := utils.UploadToCloudinary(
+		url, err := utils.UploadToCloudinary(c.Request.Context(), 
 			file, fileHeader,
 			h.cfg.Cloudinary.CloudName,
 			h.cfg.Cloudinary.Apikey,
@@ -178,6 +179,11 @@ func (h *FacilityComplaintHandler) Update(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if body.Status != existing.Status {
+			h.Notifier.Notify(c.Request.Context(), []string{existing.StudentID}, models.NotificationFacilityComplaintState,
+				"Khiếu nại cơ sở vật chất đã được cập nhật", existing.Title+": "+body.Status, "facility_complaint", id,
+				gin.H{"status": body.Status, "previous_status": existing.Status})
+		}
 		// Trả về bản ghi sau khi cập nhật
 		updated, _ := h.Repo.GetByID(context.Background(), id)
 		c.JSON(http.StatusOK, updated)
@@ -348,7 +354,7 @@ func (h *FacilityComplaintHandler) UpdateProof(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "proof file is required"})
 		return
 	}
-	url, err := utils.UploadToCloudinary(
+	url, err := utils.UploadToCloudinary(c.Request.Context(), 
 		file, fileHeader,
 		h.cfg.Cloudinary.CloudName,
 		h.cfg.Cloudinary.Apikey,
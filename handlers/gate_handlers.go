@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultGateOpenTime = "05:00"
+	maxGateEventsLimit  = 200
+)
+
+type GateHandler struct {
+	Repo         *repository.GateRepository
+	ContractRepo *repository.ContractRepository
+	Audit        *repository.AuditRepository
+	cfg          *config.Config
+}
+
+func NewGateHandler(repo *repository.GateRepository, contractRepo *repository.ContractRepository, cfg *config.Config) *GateHandler {
+	return &GateHandler{Repo: repo, ContractRepo: contractRepo, cfg: cfg}
+}
+
+func (h *GateHandler) openTime() string {
+	if h.cfg.Gate.OpenTime != "" {
+		return h.cfg.Gate.OpenTime
+	}
+	return defaultGateOpenTime
+}
+
+// findApprovedContract lấy hợp đồng đang hiệu lực của sinh viên
+func findApprovedContract(ctx context.Context, repo *repository.ContractRepository, studentID string) (*models.Contract, error) {
+	contracts, err := repo.GetContractByStudentID(ctx, studentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ct := range contracts {
+		if ct.Status == models.ContractStatusApproved {
+			return ct, nil
+		}
+	}
+	return nil, nil
+}
+
+// GET /api/v1/protected/gate/qr (student)
+// Trả về nội dung mã QR của sinh viên (frontend tự vẽ QR từ qr_token).
+// Mã gắn với hợp đồng đang hiệu lực nên tự mất hiệu lực khi hợp đồng kết thúc.
+func (h *GateHandler) GetMyQR(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	contract, err := findApprovedContract(context.Background(), h.ContractRepo, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get contract", "details": err.Error()})
+		return
+	}
+	if contract == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You do not have an approved contract"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": gin.H{
+		"contract_id": contract.ID.String(),
+		"room":        contract.Room,
+		"qr_token":    service.SignToken("gate", contract.ID.String(), h.cfg.SignedTokens.Secret),
+	}})
+}
+
+type gateScanInput struct {
+	QRToken   string `json:"qr_token" binding:"required"`
+	Direction string `json:"direction" binding:"required"`
+	AreaID    string `json:"area_id" binding:"required"`
+	Note      string `json:"note"`
+}
+
+// POST /api/v1/protected/gate/scan (manager)
+// Quản túc quét mã QR của sinh viên ở cổng
+func (h *GateHandler) Scan(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	var input gateScanInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	contractID, ok := service.VerifyToken("gate", input.QRToken, h.cfg.SignedTokens.Secret)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid QR code"})
+		return
+	}
+	ctx := context.Background()
+	contract, err := h.ContractRepo.GetContractByID(ctx, contractID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get contract", "details": err.Error()})
+		return
+	}
+	if contract == nil || contract.Status != models.ContractStatusApproved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code is no longer valid, contract is not active"})
+		return
+	}
+	h.record(c, contract, input.Direction, input.AreaID, input.Note)
+}
+
+type gateManualInput struct {
+	StudentID string `json:"student_id" binding:"required"`
+	Direction string `json:"direction" binding:"required"`
+	AreaID    string `json:"area_id" binding:"required"`
+	Note      string `json:"note"`
+}
+
+// POST /api/v1/protected/gate/events (manager)
+// Ghi nhận ra/vào thủ công khi sinh viên không có mã QR
+func (h *GateHandler) CreateEvent(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	var input gateManualInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	contract, err := findApprovedContract(context.Background(), h.ContractRepo, input.StudentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get contract", "details": err.Error()})
+		return
+	}
+	if contract == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Student does not have an approved contract"})
+		return
+	}
+	h.record(c, contract, input.Direction, input.AreaID, input.Note)
+}
+
+// record lưu lượt ra/vào và đánh dấu về muộn nếu vào cổng trong giờ giới nghiêm
+func (h *GateHandler) record(c *gin.Context, contract *models.Contract, direction, areaID, note string) {
+	if direction != models.GateDirectionIn && direction != models.GateDirectionOut {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "direction must be 'in' or 'out'"})
+		return
+	}
+	ctx := context.Background()
+	curfew, found, err := h.Repo.GetCurfew(ctx, areaID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get curfew", "details": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dorm area not found"})
+		return
+	}
+	if curfew == "" {
+		curfew = h.cfg.Gate.DefaultCurfew
+	}
+	managerID, _ := utils.GetUserIDFromContext(c)
+	event := &models.GateEvent{
+		ID:         uuid.New().String(),
+		StudentID:  contract.StudentID,
+		ContractID: contract.ID.String(),
+		AreaID:     areaID,
+		Direction:  direction,
+		OccurredAt: time.Now(),
+		RecordedBy: managerID,
+		Note:       note,
+	}
+	if direction == models.GateDirectionIn {
+		event.IsLate, err = service.IsAfterCurfew(event.OccurredAt, curfew, h.openTime())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid curfew configuration", "details": err.Error()})
+			return
+		}
+	}
+	if err := h.Repo.Create(ctx, event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": event, "room": contract.Room})
+}
+
+// parseGateFilter đọc các tham số lọc chung của nhật ký ra/vào
+func parseGateFilter(c *gin.Context) (repository.GateEventFilter, bool) {
+	f := repository.GateEventFilter{
+		AreaID:   c.Query("area_id"),
+		LateOnly: c.Query("late") == "true",
+	}
+	for key, dst := range map[string]**time.Time{"from": &f.From, "to": &f.To} {
+		if raw := c.Query(key); raw != "" {
+			t, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + key + " format, must be YYYY-MM-DD"})
+				return f, false
+			}
+			if key == "to" {
+				t = t.AddDate(0, 0, 1) // bao gồm cả ngày "to"
+			}
+			*dst = &t
+		}
+	}
+	f.Limit, _ = strconv.Atoi(c.Query("limit"))
+	if f.Limit > maxGateEventsLimit {
+		f.Limit = maxGateEventsLimit
+	}
+	f.Offset, _ = strconv.Atoi(c.Query("offset"))
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	return f, true
+}
+
+// GET /api/v1/protected/gate/events?student_id=&area_id=&from=&to=&late=true&limit=&offset= (manager)
+func (h *GateHandler) ListEvents(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	f, ok := parseGateFilter(c)
+	if !ok {
+		return
+	}
+	f.StudentID = c.Query("student_id")
+	events, err := h.Repo.List(context.Background(), f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": events})
+}
+
+// GET /api/v1/protected/gate/events/me (student)
+func (h *GateHandler) ListMyEvents(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	f, ok := parseGateFilter(c)
+	if !ok {
+		return
+	}
+	f.StudentID = userID
+	events, err := h.Repo.List(context.Background(), f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": events})
+}
+
+// GET /api/v1/protected/gate/overnight-absences?date=YYYY-MM-DD&area_id= (manager)
+// Sinh viên vắng qua đêm: đã ra cổng và chưa quay lại trước giờ mở cổng sáng hôm sau
+func (h *GateHandler) ListOvernightAbsences(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	// Mặc định là đêm hôm qua
+	night := time.Now().AddDate(0, 0, -1)
+	if raw := c.Query("date"); raw != "" {
+		t, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date format, must be YYYY-MM-DD"})
+			return
+		}
+		night = t
+	}
+	open, err := time.Parse("15:04", h.openTime())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid gate open_time configuration"})
+		return
+	}
+	y, m, d := night.Date()
+	cutoff := time.Date(y, m, d+1, open.Hour(), open.Minute(), 0, 0, time.Local)
+	absences, err := h.Repo.ListOvernightAbsences(context.Background(), cutoff, c.Query("area_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "date": night.Format("2006-01-02"), "data": absences})
+}
+
+type setCurfewInput struct {
+	Curfew string `json:"curfew"` // HH:MM, để trống để dùng giờ mặc định
+}
+
+// PATCH /api/v1/protected/dorm-area/:id/curfew (manager/admin)
+func (h *GateHandler) SetCurfew(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	var input setCurfewInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Curfew != "" {
+		if err := service.ValidateClock(input.Curfew); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ctx := context.Background()
+	areaID := c.Param("id")
+	prev, found, err := h.Repo.GetCurfew(ctx, areaID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dorm area not found"})
+		return
+	}
+	if err := h.Repo.SetCurfew(ctx, areaID, input.Curfew); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, h.Audit, "dorm_area.set_curfew", "dorm_area", areaID, gin.H{"curfew": prev}, gin.H{"curfew": input.Curfew})
+	effective := input.Curfew
+	if effective == "" {
+		effective = h.cfg.Gate.DefaultCurfew
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "area_id": areaID, "curfew": input.Curfew, "effective_curfew": effective})
+}
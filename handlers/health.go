@@ -1,9 +1,20 @@
 package handlers
 
 import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/database"
+	"Backend_Dorm_PTIT/logger"
 	"Backend_Dorm_PTIT/models"
+	"context"
+	"errors"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,4 +32,198 @@ func Health(c *gin.Context) {
 		Message: "PTIT Dorm Backend Server is running version 1.15.0",
 		Time:    time.Now().Format(time.RFC3339),
 	})
-}
\ No newline at end of file
+}
+
+const readinessCheckTimeout = 2 * time.Second
+
+// shuttingDown được bật khi server bắt đầu tắt: /health/ready trả 503 để load balancer ngừng gửi request mới
+var shuttingDown atomic.Bool
+
+// MarkShuttingDown cho readiness báo lỗi, gọi trước srv.Shutdown
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// Live godoc
+// @Summary Liveness check
+// @Description Process đang chạy, không kiểm tra phụ thuộc
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.HealthResponse
+// @Router /health/live [get]
+func Live(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthResponse{
+		Status:  "ok",
+		Message: "alive",
+		Time:    time.Now().Format(time.RFC3339),
+	})
+}
+
+type HealthHandler struct {
+	cfg *config.Config
+}
+
+func NewHealthHandler(cfg *config.Config) *HealthHandler {
+	return &HealthHandler{cfg: cfg}
+}
+
+// Ready godoc
+// @Summary Readiness check
+// @Description Kiểm tra Postgres, Redis, file log ghi được và cấu hình bắt buộc (JWT, Cloudinary, SMTP). 503 khi có phụ thuộc lỗi hoặc server đang tắt.
+// @Description Endpoint công khai chỉ trả trạng thái và độ trễ từng phụ thuộc, chi tiết lỗi được ghi log và xem ở /health/ready/details.
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.ReadinessResponse
+// @Failure 503 {object} models.ReadinessResponse
+// @Router /health/ready [get]
+func (h *HealthHandler) Ready(c *gin.Context) {
+	resp, status := h.readiness(c.Request.Context())
+	if resp.Status != "ok" {
+		event := logger.Ctx(c.Request.Context()).Warn()
+		for name, result := range resp.Checks {
+			if result.Status == "fail" {
+				event = event.Interface(name, result)
+			}
+		}
+		event.Msg("Readiness check failed")
+	}
+	// Lỗi kết nối và tên cấu hình còn thiếu không được lộ ra ngoài
+	for name, result := range resp.Checks {
+		result.Error = ""
+		result.Missing = nil
+		resp.Checks[name] = result
+	}
+	c.JSON(status, resp)
+}
+
+// ReadyDetails godoc
+// @Summary Readiness check with error details
+// @Description Giống /health/ready nhưng kèm lỗi và cấu hình còn thiếu, chỉ truy cập được như /metrics (allowlist IP hoặc token)
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.ReadinessResponse
+// @Failure 503 {object} models.ReadinessResponse
+// @Router /health/ready/details [get]
+func (h *HealthHandler) ReadyDetails(c *gin.Context) {
+	resp, status := h.readiness(c.Request.Context())
+	c.JSON(status, resp)
+}
+
+// readiness chạy song song các check và trả kết quả đầy đủ kèm HTTP status
+func (h *HealthHandler) readiness(parent context.Context) (models.ReadinessResponse, int) {
+	checks := map[string]func(ctx context.Context) models.DependencyStatus{
+		"postgres": func(ctx context.Context) models.DependencyStatus {
+			return timedCheck(func() error {
+				if database.GetDB() == nil {
+					return errors.New("database is not initialized")
+				}
+				return database.GetDB().PingContext(ctx)
+			})
+		},
+		"redis": func(ctx context.Context) models.DependencyStatus {
+			return timedCheck(func() error {
+				if database.RedisClient == nil {
+					return errors.New("redis is not initialized")
+				}
+				return database.RedisClient.Ping(ctx).Err()
+			})
+		},
+		"log_file": func(ctx context.Context) models.DependencyStatus {
+			if h.cfg.Logging.Output != "file" {
+				return models.DependencyStatus{Status: "skipped"}
+			}
+			return timedCheck(func() error { return checkLogFileWritable(h.cfg.Logging.FilePath) })
+		},
+		"config": func(ctx context.Context) models.DependencyStatus {
+			missing := h.missingConfig()
+			if len(missing) > 0 {
+				return models.DependencyStatus{Status: "fail", Error: "required configuration is missing", Missing: missing}
+			}
+			return models.DependencyStatus{Status: "ok"}
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(parent, readinessCheckTimeout)
+	defer cancel()
+	resp := models.ReadinessResponse{Status: "ok", Checks: map[string]models.DependencyStatus{}, Time: time.Now().Format(time.RFC3339)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) models.DependencyStatus) {
+			defer wg.Done()
+			result := check(ctx)
+			mu.Lock()
+			resp.Checks[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	if shuttingDown.Load() {
+		resp.Checks["server"] = models.DependencyStatus{Status: "fail", Error: "shutting down"}
+	}
+	for _, result := range resp.Checks {
+		if result.Status == "fail" {
+			resp.Status = "fail"
+		}
+	}
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	return resp, status
+}
+
+// timedCheck chạy check và ghi thời gian phản hồi
+func timedCheck(check func() error) models.DependencyStatus {
+	start := time.Now()
+	err := check()
+	result := models.DependencyStatus{Status: "ok", LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = "fail"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// checkLogFileWritable mở file log để ghi nối (không ghi gì), chưa có file thì thử tạo file tạm trong thư mục log
+func checkLogFileWritable(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err == nil {
+		return f.Close()
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".health-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// missingConfig liệt kê cấu hình bắt buộc còn trống
+func (h *HealthHandler) missingConfig() []string {
+	missing := []string{}
+	if h.cfg.JWT.Secret == "" && h.cfg.JWT.SigningKeyID == "" {
+		missing = append(missing, "jwt.secret")
+	}
+	for key, value := range map[string]string{
+		"signed_tokens.secret": h.cfg.SignedTokens.Secret,
+		"cloudinary.cloudname": h.cfg.Cloudinary.CloudName,
+		"cloudinary.apikey":    h.cfg.Cloudinary.Apikey,
+		"cloudinary.secret":    h.cfg.Cloudinary.Secret,
+		"mail_google.host":     h.cfg.MailGoogle.Host,
+		"mail_google.port":     h.cfg.MailGoogle.Port,
+		"mail_google.email":    h.cfg.MailGoogle.Email,
+		"mail_google.password": h.cfg.MailGoogle.Password,
+	} {
+		if value == "" {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
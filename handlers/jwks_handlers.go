@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSHandler godoc
+// @Summary Public keys for verifying access tokens
+// @Description JWK Set chứa khoá công khai của mọi khoá ký còn hiệu lực. Service khác chọn khoá theo kid trong header token.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} service.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKSHandler(c *gin.Context) {
+	// Cache ngắn để bên nhận thấy khoá mới sớm khi xoay khoá
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.jwtKeys.JWKS())
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLogPageSize  = 100
+	maxLogPageSize      = 1000
+	maxLogExportEntries = 100000
+)
+
+var errLogExportLimit = errors.New("log export limit reached")
+
+// LogHandler tìm và tải log trong file đang ghi và các file đã xoay vòng (admin_system)
+type LogHandler struct {
+	Search    *service.LogSearchService
+	AuditRepo *repository.AuditRepository
+}
+
+func NewLogHandler(search *service.LogSearchService) *LogHandler {
+	return &LogHandler{Search: search}
+}
+
+// authorize kiểm tra quyền admin và log có ghi ra file, đã trả lỗi nếu không
+func (h *LogHandler) authorize(c *gin.Context) bool {
+	if !utils.HasAnyRole(c, "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return false
+	}
+	if !h.Search.Enabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "log files are not available, logging.output is not file"})
+		return false
+	}
+	return true
+}
+
+// GET /api/v1/protected/logs/files (admin)
+// Danh sách file log (cũ trước) và chính sách giữ log
+func (h *LogHandler) Files(c *gin.Context) {
+	if !h.authorize(c) {
+		return
+	}
+	files, err := h.Search.Files()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": files, "retention": h.Search.Retention()})
+}
+
+// GET /api/v1/protected/logs/search?level=&path=&user_id=&status_min=&status_max=&since=&until=&q=&limit=&offset= (admin)
+// Kết quả theo thứ tự thời gian, mỗi entry là một object JSON nguyên dòng log. Trang tiếp theo dùng next_offset.
+func (h *LogHandler) SearchLogs(c *gin.Context) {
+	if !h.authorize(c) {
+		return
+	}
+	filter, _, err := logFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultLogPageSize
+	}
+	if limit > maxLogPageSize {
+		limit = maxLogPageSize
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	entries, more, err := h.Search.Search(c.Request.Context(), filter, offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	data := make([]json.RawMessage, 0, len(entries))
+	for _, e := range entries {
+		data = append(data, e.Raw)
+	}
+	resp := gin.H{"ok": true, "data": data, "limit": limit, "offset": offset, "has_more": more}
+	if more {
+		resp["next_offset"] = offset + len(entries)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GET /api/v1/protected/logs/export?... (admin)
+// Tải các entry khớp filter dạng NDJSON (mỗi dòng một object), tối đa 100000 dòng
+func (h *LogHandler) Export(c *gin.Context) {
+	if !h.authorize(c) {
+		return
+	}
+	filter, _, err := logFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, h.AuditRepo, "logs.export", "logs", "", nil, gin.H{"query": c.Request.URL.RawQuery})
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", "attachment; filename=logs-"+time.Now().Format("20060102-150405")+".ndjson")
+	c.Status(http.StatusOK)
+	count := 0
+	err = h.Search.Each(c.Request.Context(), filter, func(e *service.LogEntry) error {
+		if count == maxLogExportEntries {
+			return errLogExportLimit
+		}
+		count++
+		if _, err := c.Writer.Write(append(e.Raw, '\n')); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLogExportLimit) {
+		// header đã gửi, chỉ ghi log
+		logger.Ctx(c.Request.Context()).Error().Err(err).Int("entries", count).Msg("Log export interrupted")
+	}
+}
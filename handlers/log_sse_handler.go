@@ -1,40 +1,112 @@
 package handlers
 
-// Khởi động tail log file qua service, truyền callback là LogHub.Broadcast
 import (
 	"Backend_Dorm_PTIT/service"
-	"context"
+	"Backend_Dorm_PTIT/utils"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
 )
 
-// Khởi động tail log file qua service, truyền callback là LogHub.Broadcast
-func StartTailLogFile(logPath string) {
-	service.StartTailLogFile(context.Background(), logPath, service.GetLogHub().Broadcast)
+const (
+	defaultLogBackfill = 100
+	logStreamKeepAlive = 30 * time.Second
+)
+
+// logFilterFromQuery đọc filter log từ query: level (tối thiểu), path (tiền tố), user_id,
+// status_min, status_max, since, until (RFC3339), q (chuỗi tự do) và backfill (số dòng cũ gửi trước, mặc định 100)
+func logFilterFromQuery(c *gin.Context) (service.LogFilter, int, error) {
+	var f service.LogFilter
+	if level := c.Query("level"); level != "" {
+		l, err := zerolog.ParseLevel(level)
+		if err != nil || l == zerolog.NoLevel {
+			return f, 0, fmt.Errorf("invalid level %q", level)
+		}
+		f.MinLevel = l
+	} else {
+		f.MinLevel = zerolog.TraceLevel
+	}
+	f.Path = c.Query("path")
+	f.UserID = c.Query("user_id")
+	f.Text = strings.TrimSpace(c.Query("q"))
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"status_min", &f.StatusMin}, {"status_max", &f.StatusMax}} {
+		if v := c.Query(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 100 || n > 599 {
+				return f, 0, fmt.Errorf("invalid %s, expected an HTTP status code", p.name)
+			}
+			*p.dst = n
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := c.Query(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, 0, fmt.Errorf("invalid %s, expected RFC3339", p.name)
+			}
+			*p.dst = t
+		}
+	}
+	backfill := defaultLogBackfill
+	if v := c.Query("backfill"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return f, 0, fmt.Errorf("invalid backfill")
+		}
+		backfill = n
+	}
+	return f, backfill, nil
 }
 
-// SSE endpoint cho admin
+// GET /api/v1/protected/logs/stream (admin_system)
+// SSE: gửi backfill các dòng log gần nhất khớp filter rồi stream log mới, mỗi event là một object JSON
 func StreamLogSSE(c *gin.Context) {
+	if !utils.HasAnyRole(c, "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	filter, backfill, err := logFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache")
 	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Flush()
 
-	ch := make(chan string, 100)
 	hub := service.GetLogHub()
-	hub.AddClient(ch)
-	defer hub.RemoveClient(ch)
+	entries, sub := hub.Subscribe(filter, backfill)
+	defer hub.Unsubscribe(sub)
 
-	// Gửi log mới cho client
+	for _, e := range entries {
+		fmt.Fprintf(c.Writer, "data: %s\n\n", e.Raw)
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(logStreamKeepAlive)
+	defer keepAlive.Stop()
 	for {
 		select {
-		case line, ok := <-ch:
+		case e, ok := <-sub.C:
 			if !ok {
 				return
 			}
-			fmt.Fprintf(c.Writer, "data: %s\n\n", line)
+			fmt.Fprintf(c.Writer, "data: %s\n\n", e.Raw)
+			c.Writer.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
 			c.Writer.Flush()
 		case <-c.Request.Context().Done():
 			return
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/database"
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultLoginMaxFailures      = 5
+	defaultLoginMaxFailuresPerIP = 20
+	defaultLoginFailureWindow    = 15 * time.Minute
+	defaultLoginBaseLockout      = time.Minute
+	defaultLoginMaxLockout       = time.Hour
+)
+
+// loginGuard chặn dò mật khẩu: đếm số lần sai theo username và IP, khoá tạm thời và yêu cầu CAPTCHA khi vượt ngưỡng
+type loginGuard struct {
+	cfg         config.LoginGuardConfig
+	lockoutRepo *repository.LoginLockoutRepository
+	captcha     service.CaptchaVerifier // nil = không dùng CAPTCHA
+}
+
+func newLoginGuard(cfg config.LoginGuardConfig, lockoutRepo *repository.LoginLockoutRepository, captcha service.CaptchaVerifier) *loginGuard {
+	return &loginGuard{
+		cfg:         cfg,
+		lockoutRepo: lockoutRepo,
+		captcha:     captcha,
+	}
+}
+
+func intOr(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+func secondsOr(v int, def time.Duration) time.Duration {
+	if v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return def
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+type loginSubject struct {
+	scope   string
+	subject string
+	limit   int // số lần sai trước khi khoá
+}
+
+// subjects trả về username và IP cần kiểm tra cho một lượt đăng nhập
+func (g *loginGuard) subjects(username, ip string) []loginSubject {
+	return []loginSubject{
+		{models.LoginLockScopeUser, normalizeUsername(username), intOr(g.cfg.MaxFailures, defaultLoginMaxFailures)},
+		{models.LoginLockScopeIP, ip, intOr(g.cfg.MaxFailuresPerIP, defaultLoginMaxFailuresPerIP)},
+	}
+}
+
+// allow kiểm tra khoá và CAPTCHA trước khi xác thực mật khẩu. Trả về false và tự ghi response nếu bị chặn.
+// Redis lỗi thì cho qua (fail-open) để không khoá toàn bộ hệ thống đăng nhập.
+func (g *loginGuard) allow(c *gin.Context, username, captchaToken string) bool {
+	ip := c.ClientIP()
+	maxFailures := 0
+	for _, s := range g.subjects(username, ip) {
+		remaining, err := database.GetLoginLock(s.scope, s.subject)
+		if err != nil {
+			continue
+		}
+		if remaining > 0 {
+			retryAfter := int(math.Ceil(remaining.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, models.Response{
+				Code:    http.StatusTooManyRequests,
+				Message: fmt.Sprintf("too many failed login attempts, try again in %d seconds", retryAfter),
+				Data:    gin.H{"retry_after": retryAfter},
+			})
+			return false
+		}
+		if n, err := database.GetLoginFailures(s.scope, s.subject); err == nil && n > maxFailures {
+			maxFailures = n
+		}
+	}
+
+	if g.captcha == nil || g.cfg.CaptchaThreshold <= 0 || maxFailures < g.cfg.CaptchaThreshold {
+		return true
+	}
+	if captchaToken == "" {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "captcha required",
+			Data:    gin.H{"captcha_required": true},
+		})
+		return false
+	}
+	ok, err := g.captcha.Verify(c.Request.Context(), captchaToken, ip)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("ip", ip).Msg("Failed to verify captcha")
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "captcha verification failed",
+			Data:    gin.H{"captcha_required": true},
+		})
+		return false
+	}
+	return true
+}
+
+// onFailure ghi nhận một lần sai mật khẩu, khoá username/IP khi vượt ngưỡng và ghi nhật ký khoá
+func (g *loginGuard) onFailure(c *gin.Context, username string) {
+	ip := c.ClientIP()
+	window := secondsOr(g.cfg.FailureWindowSeconds, defaultLoginFailureWindow)
+	base := secondsOr(g.cfg.BaseLockoutSeconds, defaultLoginBaseLockout)
+	maxLock := secondsOr(g.cfg.MaxLockoutSeconds, defaultLoginMaxLockout)
+	for _, s := range g.subjects(username, ip) {
+		n, err := database.RecordLoginFailure(s.scope, s.subject, window)
+		if err != nil {
+			continue
+		}
+		if n < s.limit {
+			continue
+		}
+		dur, err := database.LockLogin(s.scope, s.subject, base, maxLock)
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+		until := now.Add(dur)
+		g.record(c, &models.LoginLockoutEvent{
+			ID:          uuid.New().String(),
+			Scope:       s.scope,
+			Subject:     s.subject,
+			Event:       models.LoginLockEventLocked,
+			Failures:    n,
+			LockedUntil: &until,
+			IP:          ip,
+			CreatedAt:   now,
+		})
+	}
+}
+
+// onSuccess xoá bộ đếm sai của username sau khi đăng nhập đúng.
+// Bộ đếm theo IP để tự hết hạn, nếu không kẻ dò mật khẩu chỉ cần đăng nhập xen kẽ bằng một tài khoản của mình là reset được giới hạn IP.
+func (g *loginGuard) onSuccess(c *gin.Context, username string) {
+	subject := normalizeUsername(username)
+	if err := database.ClearLoginFailures(models.LoginLockScopeUser, subject); err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("scope", models.LoginLockScopeUser).Str("subject", subject).Msg("Failed to clear login failures")
+	}
+}
+
+func (g *loginGuard) record(c *gin.Context, e *models.LoginLockoutEvent) {
+	if g.lockoutRepo == nil {
+		return
+	}
+	if err := g.lockoutRepo.Create(context.Background(), e); err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("scope", e.Scope).Str("subject", e.Subject).Str("event", e.Event).Msg("Failed to record login lockout event")
+	}
+}
+
+// GET /api/v1/protected/login-lockouts?subject=&limit=&offset= (admin)
+// Xem nhật ký khoá/mở khoá đăng nhập
+func (h *AuthHandler) ListLoginLockouts(c *gin.Context) {
+	if !utils.HasAnyRole(c, "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	events, err := h.guard.lockoutRepo.List(context.Background(), strings.TrimSpace(c.Query("subject")), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": events})
+}
+
+type clearLoginLockInput struct {
+	Scope   string `json:"scope" binding:"required"`   // user|ip
+	Subject string `json:"subject" binding:"required"` // username hoặc IP
+}
+
+// DELETE /api/v1/protected/login-lockouts (admin)
+// Mở khoá đăng nhập cho username/IP trước khi hết hạn
+func (h *AuthHandler) ClearLoginLock(c *gin.Context) {
+	if !utils.HasAnyRole(c, "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	adminID, _ := utils.GetUserIDFromContext(c)
+	var input clearLoginLockInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	subject := strings.TrimSpace(input.Subject)
+	switch input.Scope {
+	case models.LoginLockScopeUser:
+		subject = normalizeUsername(subject)
+	case models.LoginLockScopeIP:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be 'user' or 'ip'"})
+		return
+	}
+	cleared, err := database.UnlockLogin(input.Scope, subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear login lock"})
+		return
+	}
+	if !cleared {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No lock or failed attempts found"})
+		return
+	}
+	h.guard.record(c, &models.LoginLockoutEvent{
+		ID:        uuid.New().String(),
+		Scope:     input.Scope,
+		Subject:   subject,
+		Event:     models.LoginLockEventUnlocked,
+		IP:        c.ClientIP(),
+		ActorID:   adminID,
+		CreatedAt: time.Now(),
+	})
+	recordAudit(c, h.Audit, "login_lock.clear", "login_lock", input.Scope+":"+subject, nil, gin.H{"scope": input.Scope, "subject": subject})
+	logger.Ctx(c.Request.Context()).Info().Str("admin_id", adminID).Str("scope", input.Scope).Str("subject", subject).Msg("Login lock cleared by admin")
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/database"
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeCaptcha ghi lại token/IP nhận được và trả kết quả cố định
+type fakeCaptcha struct {
+	mu     sync.Mutex
+	ok     bool
+	tokens []string
+	ips    []string
+}
+
+func (f *fakeCaptcha) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens = append(f.tokens, token)
+	f.ips = append(f.ips, remoteIP)
+	return f.ok, nil
+}
+
+func setupLoginGuardRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	prev := database.RedisClient
+	database.RedisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		database.RedisClient.Close()
+		database.RedisClient = prev
+	})
+	return mr
+}
+
+func newGuardContext(ip string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	c.Request.RemoteAddr = ip + ":40000"
+	return c, w
+}
+
+func testGuardConfig() config.LoginGuardConfig {
+	return config.LoginGuardConfig{
+		MaxFailures:          3,
+		MaxFailuresPerIP:     5,
+		FailureWindowSeconds: 900,
+		BaseLockoutSeconds:   60,
+		MaxLockoutSeconds:    600,
+	}
+}
+
+func failLogin(g *loginGuard, username, ip string, times int) {
+	for i := 0; i < times; i++ {
+		c, _ := newGuardContext(ip)
+		g.onFailure(c, username)
+	}
+}
+
+func allowLogin(g *loginGuard, username, ip, captchaToken string) (bool, *httptest.ResponseRecorder) {
+	c, w := newGuardContext(ip)
+	return g.allow(c, username, captchaToken), w
+}
+
+func TestLoginGuardLocksUsernameAtThreshold(t *testing.T) {
+	setupLoginGuardRedis(t)
+	g := newLoginGuard(testGuardConfig(), nil, nil)
+
+	failLogin(g, "Alice", "10.0.0.1", 2)
+	if ok, _ := allowLogin(g, "alice", "10.0.0.1", ""); !ok {
+		t.Fatal("login blocked before reaching max failures")
+	}
+
+	failLogin(g, "alice", "10.0.0.1", 1)
+	ok, w := allowLogin(g, " ALICE ", "10.0.0.2", "")
+	if ok {
+		t.Fatal("username not locked after max failures")
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("Retry-After = %q, want 60", w.Header().Get("Retry-After"))
+	}
+	if ok, _ := allowLogin(g, "bob", "10.0.0.1", ""); !ok {
+		t.Fatal("other username blocked by username lock")
+	}
+}
+
+func TestLoginGuardLockoutBacksOff(t *testing.T) {
+	mr := setupLoginGuardRedis(t)
+	g := newLoginGuard(testGuardConfig(), nil, nil)
+
+	failLogin(g, "alice", "10.0.0.1", 3)
+	if ttl := mr.TTL("login_lock:" + models.LoginLockScopeUser + ":alice"); ttl.Seconds() != 60 {
+		t.Fatalf("first lock = %v, want 60s", ttl)
+	}
+	mr.FastForward(61 * time.Second)
+	failLogin(g, "alice", "10.0.0.1", 3)
+	if ttl := mr.TTL("login_lock:" + models.LoginLockScopeUser + ":alice"); ttl.Seconds() != 120 {
+		t.Fatalf("second lock = %v, want 120s", ttl)
+	}
+}
+
+func TestLoginGuardLocksIPAcrossUsernames(t *testing.T) {
+	setupLoginGuardRedis(t)
+	g := newLoginGuard(testGuardConfig(), nil, nil)
+
+	for _, u := range []string{"u1", "u2", "u3", "u4", "u5"} {
+		failLogin(g, u, "10.0.0.9", 1)
+	}
+	ok, w := allowLogin(g, "someone-else", "10.0.0.9", "")
+	if ok || w.Code != http.StatusTooManyRequests {
+		t.Fatalf("ip not locked after max failures per ip: ok=%v status=%d", ok, w.Code)
+	}
+	if ok, _ := allowLogin(g, "someone-else", "10.0.0.10", ""); !ok {
+		t.Fatal("other ip blocked by ip lock")
+	}
+}
+
+func TestLoginGuardSuccessKeepsIPCounter(t *testing.T) {
+	setupLoginGuardRedis(t)
+	g := newLoginGuard(testGuardConfig(), nil, nil)
+
+	// Kẻ tấn công xen kẽ đăng nhập thành công bằng tài khoản của mình giữa các lần dò mật khẩu
+	for _, victim := range []string{"v1", "v2", "v3", "v4", "v5"} {
+		failLogin(g, victim, "10.0.0.7", 1)
+		c, _ := newGuardContext("10.0.0.7")
+		g.onSuccess(c, "attacker")
+	}
+	if ok, _ := allowLogin(g, "attacker", "10.0.0.7", ""); ok {
+		t.Fatal("successful logins reset the per-ip failure counter")
+	}
+
+	failLogin(g, "carol", "10.0.0.8", 2)
+	c, _ := newGuardContext("10.0.0.8")
+	g.onSuccess(c, "Carol")
+	if n, _ := database.GetLoginFailures(models.LoginLockScopeUser, "carol"); n != 0 {
+		t.Fatalf("user failures after success = %d, want 0", n)
+	}
+	if n, _ := database.GetLoginFailures(models.LoginLockScopeIP, "10.0.0.8"); n != 2 {
+		t.Fatalf("ip failures after success = %d, want 2", n)
+	}
+}
+
+func TestLoginGuardRequiresCaptchaAfterThreshold(t *testing.T) {
+	setupLoginGuardRedis(t)
+	cfg := testGuardConfig()
+	cfg.CaptchaThreshold = 2
+	captcha := &fakeCaptcha{}
+	g := newLoginGuard(cfg, nil, captcha)
+
+	failLogin(g, "alice", "10.0.0.1", 1)
+	if ok, _ := allowLogin(g, "alice", "10.0.0.1", ""); !ok {
+		t.Fatal("captcha required before threshold")
+	}
+
+	failLogin(g, "alice", "10.0.0.1", 1)
+	ok, w := allowLogin(g, "alice", "10.0.0.1", "")
+	if ok || w.Code != http.StatusUnauthorized {
+		t.Fatalf("missing captcha accepted: ok=%v status=%d", ok, w.Code)
+	}
+	if len(captcha.tokens) != 0 {
+		t.Fatal("verifier called without a token")
+	}
+
+	ok, w = allowLogin(g, "alice", "10.0.0.1", "bad-token")
+	if ok || w.Code != http.StatusUnauthorized {
+		t.Fatalf("rejected captcha accepted: ok=%v status=%d", ok, w.Code)
+	}
+
+	captcha.ok = true
+	if ok, _ := allowLogin(g, "alice", "10.0.0.1", "good-token"); !ok {
+		t.Fatal("valid captcha rejected")
+	}
+	if got := captcha.tokens; len(got) != 2 || got[1] != "good-token" || captcha.ips[1] != "10.0.0.1" {
+		t.Fatalf("verifier calls = %v %v", captcha.tokens, captcha.ips)
+	}
+}
+
+func TestLoginGuardWithoutCaptchaVerifier(t *testing.T) {
+	setupLoginGuardRedis(t)
+	cfg := testGuardConfig()
+	cfg.CaptchaThreshold = 1
+	g := newLoginGuard(cfg, nil, nil)
+
+	failLogin(g, "alice", "10.0.0.1", 2)
+	if ok, _ := allowLogin(g, "alice", "10.0.0.1", ""); !ok {
+		t.Fatal("captcha required although no verifier is configured")
+	}
+}
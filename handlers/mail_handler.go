@@ -4,12 +4,16 @@ import (
 	"Backend_Dorm_PTIT/config"
 	"Backend_Dorm_PTIT/database"
 	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/metrics"
 	"Backend_Dorm_PTIT/models"
 	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/utils"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	mathrand "math/rand"
+	"math/big"
+	"net/http"
 	"net/smtp"
 	"strings"
 	"time"
@@ -17,6 +21,16 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// OTPActionResetPassword là action OTP cho luồng quên mật khẩu
+const OTPActionResetPassword = "reset_password"
+
+const (
+	defaultOTPMaxPerEmail       = 5
+	defaultOTPMaxPerIP          = 20
+	defaultOTPWindow            = 15 * time.Minute
+	defaultOTPMaxVerifyAttempts = 10
+)
+
 func NewMailHandler(cfg *config.Config, repo *repository.UserRepository) *MailHandler {
 	return &MailHandler{cfg: cfg, repo: repo}
 }
@@ -34,6 +48,14 @@ func (h *MailHandler) VerifyOTPHandler(c *gin.Context) {
 		return
 	}
 
+	// Giới hạn số lần nhập OTP để tránh dò mã 6 số
+	window := secondsOr(h.cfg.OTP.WindowSeconds, defaultOTPWindow)
+	attempts, err := database.IncrRateLimit(fmt.Sprintf("otp_verify:%s:%s", req.Action, strings.ToLower(req.Email)), window)
+	if err == nil && attempts > intOr(h.cfg.OTP.MaxVerifyAttempts, defaultOTPMaxVerifyAttempts) {
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse(http.StatusTooManyRequests, "Nhập sai OTP quá nhiều lần, vui lòng thử lại sau"))
+		return
+	}
+
 	key := fmt.Sprintf("otp:%s:%s:%s", req.Action, strings.ToLower(req.Email), req.OTP)
 
 	exists, _, err := database.Get(key)
@@ -53,7 +75,12 @@ func (h *MailHandler) VerifyOTPHandler(c *gin.Context) {
 	token := hex.EncodeToString(tokenBytes)
 
 	tokenKey := fmt.Sprintf("token:%s:%s", req.Action, strings.ToLower(req.Email))
-	err = database.Set(tokenKey, token, 1*time.Minute)
+	// Đặt lại mật khẩu cần thời gian nhập mật khẩu mới nên token sống lâu hơn
+	tokenTTL := 1 * time.Minute
+	if req.Action == OTPActionResetPassword {
+		tokenTTL = 5 * time.Minute
+	}
+	err = database.Set(tokenKey, token, tokenTTL)
 	if err != nil {
 		c.JSON(500, models.ErrorResponse(500, "failed to store token: "+err.Error()))
 		return
@@ -74,7 +101,7 @@ type OTPRequest struct {
 }
 
 func (h *MailHandler) SendOTPEmailHandler(c *gin.Context) {
-	logger.Info().Msg("Send OTP email request received")
+	logger.Ctx(c.Request.Context()).Info().Msg("Send OTP email request received")
 
 	var req OTPRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -82,6 +109,16 @@ func (h *MailHandler) SendOTPEmailHandler(c *gin.Context) {
 		return
 	}
 
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if !h.allowOTPRequest(c, req.Action, req.Email) {
+		return
+	}
+
+	if req.Action == OTPActionResetPassword {
+		h.sendResetPasswordOTP(c, req.Email)
+		return
+	}
+
 	ctx := c.Request.Context()
 	// Kiểm tra email đã tồn tại chưa bằng GetByEmail
 	user, err := h.repo.GetByEmail(ctx, req.Email)
@@ -109,33 +146,161 @@ func (h *MailHandler) SendOTPEmailHandler(c *gin.Context) {
 		}
 	}
 
-	// Sinh OTP 6 số
-	otp := fmt.Sprintf("%06d", mathrand.Intn(1000000))
-	key := fmt.Sprintf("otp:%s:%s:%s", req.Action, strings.ToLower(req.Email), otp)
-	err = database.Set(key, otp, 3*time.Minute)
+	otp, err := h.storeOTP(req.Action, req.Email)
 	if err != nil {
 		c.JSON(500, models.ErrorResponse(500, "failed to store otp: "+err.Error()))
 		return
 	}
 
 	// Gửi OTP về email
+	body := fmt.Sprintf("Mã OTP của bạn là: %s. Có hiệu lực trong 3 phút.", otp)
+	if err := h.sendOTPMail(c.Request.Context(), req.Email, "Mã OTP xác thực đăng ký ký túc xá", body); err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Failed to send OTP email")
+		c.JSON(500, models.ErrorResponse(500, "Failed to send OTP email: "+err.Error()))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "OTP sent to email (if not already registered)"})
+}
+
+// sendResetPasswordOTP gửi OTP quên mật khẩu. Luôn trả cùng một thông báo để không lộ email nào đã đăng ký.
+func (h *MailHandler) sendResetPasswordOTP(c *gin.Context, email string) {
+	const message = "If the email is registered, an OTP has been sent"
+	user, err := h.repo.GetByEmail(c.Request.Context(), email)
+	if err != nil {
+		c.JSON(500, models.ErrorResponse(500, "internal error: "+err.Error()))
+		return
+	}
+	if user == nil || user.Status == "inactive" {
+		logger.Ctx(c.Request.Context()).Info().Str("email", email).Msg("Reset password OTP requested for unknown or inactive account")
+		c.JSON(200, gin.H{"message": message})
+		return
+	}
+
+	otp, err := h.storeOTP(OTPActionResetPassword, email)
+	if err != nil {
+		c.JSON(500, models.ErrorResponse(500, "failed to store otp: "+err.Error()))
+		return
+	}
+	body := fmt.Sprintf("Mã OTP đặt lại mật khẩu tài khoản %s là: %s. Có hiệu lực trong 3 phút.\n"+
+		"Nếu bạn không yêu cầu đặt lại mật khẩu, hãy bỏ qua email này.", user.Username, otp)
+	if err := h.sendOTPMail(c.Request.Context(), email, "Mã OTP đặt lại mật khẩu ký túc xá", body); err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Failed to send reset password OTP email")
+		c.JSON(500, models.ErrorResponse(500, "Failed to send OTP email: "+err.Error()))
+		return
+	}
+	c.JSON(200, gin.H{"message": message})
+}
+
+// allowOTPRequest giới hạn số OTP gửi tới một email và từ một IP trong cửa sổ thời gian
+func (h *MailHandler) allowOTPRequest(c *gin.Context, action, email string) bool {
+	window := secondsOr(h.cfg.OTP.WindowSeconds, defaultOTPWindow)
+	limits := []struct {
+		key   string
+		limit int
+	}{
+		{fmt.Sprintf("otp_rate:email:%s:%s", action, email), intOr(h.cfg.OTP.MaxPerEmail, defaultOTPMaxPerEmail)},
+		{"otp_rate:ip:" + c.ClientIP(), intOr(h.cfg.OTP.MaxPerIP, defaultOTPMaxPerIP)},
+	}
+	for _, l := range limits {
+		n, err := database.IncrRateLimit(l.key, window)
+		if err != nil {
+			continue
+		}
+		if n > l.limit {
+			logger.Ctx(c.Request.Context()).Warn().Str("key", l.key).Int("count", n).Msg("OTP request rate limited")
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse(http.StatusTooManyRequests, "Bạn đã yêu cầu OTP quá nhiều lần, vui lòng thử lại sau"))
+			return false
+		}
+	}
+	return true
+}
+
+// storeOTP sinh OTP 6 số và lưu vào Redis trong 3 phút
+func (h *MailHandler) storeOTP(action, email string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	otp := fmt.Sprintf("%06d", n.Int64())
+	key := fmt.Sprintf("otp:%s:%s:%s", action, email, otp)
+	if err := database.Set(key, otp, 3*time.Minute); err != nil {
+		return "", err
+	}
+	return otp, nil
+}
+
+func (h *MailHandler) sendOTPMail(ctx context.Context, recipient, subject, body string) error {
 	smtpHost := h.cfg.MailGoogle.Host
 	smtpPort := h.cfg.MailGoogle.Port
 	sender := h.cfg.MailGoogle.Email
 	password := h.cfg.MailGoogle.Password
 
-	subject := "Subject: Mã OTP xác thực đăng ký ký túc xá\r\n"
-	body := fmt.Sprintf("Mã OTP của bạn là: %s. Có hiệu lực trong 3 phút.", otp)
-	msg := []byte(subject + "\r\n" + body)
-
+	header := "Subject: " + subject + "\r\n"
+	if id := logger.RequestID(ctx); id != "" {
+		header += logger.RequestIDHeader + ": " + id + "\r\n"
+	}
+	msg := []byte(header + "\r\n" + body)
 	auth := smtp.PlainAuth("", sender, password, smtpHost)
+	if err := smtp.SendMail(smtpHost+":"+smtpPort, auth, sender, []string{recipient}, msg); err != nil {
+		metrics.ExternalFailure(metrics.ServiceSMTP)
+		return err
+	}
+	return nil
+}
 
-	err = smtp.SendMail(smtpHost+":"+smtpPort, auth, sender, []string{req.Email}, msg)
+type ResetPasswordRequest struct {
+	Email       string `json:"email" binding:"required,email"`
+	Token       string `json:"token" binding:"required"` // token nhận được từ /verify-otp với action reset_password
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ResetPasswordHandler đổi token quên mật khẩu lấy mật khẩu mới và thu hồi mọi phiên đăng nhập
+// POST /api/v1/reset-password
+func (h *MailHandler) ResetPasswordHandler(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, models.ErrorResponse(400, "invalid request: "+err.Error()))
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	tokenKey := fmt.Sprintf("token:%s:%s", OTPActionResetPassword, email)
+	exists, tokenInRedis, err := database.Get(tokenKey)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to send OTP email")
-		c.JSON(500, models.ErrorResponse(500, "Failed to send OTP email: "+err.Error()))
+		c.JSON(500, models.ErrorResponse(500, "Lỗi hệ thống: "+err.Error()))
+		return
+	}
+	if !exists || tokenInRedis != req.Token {
+		c.JSON(401, models.ErrorResponse(401, "Token đặt lại mật khẩu đã hết hiệu lực hoặc không hợp lệ"))
+		return
+	}
+	// Token chỉ dùng một lần
+	if err := database.Delete(tokenKey); err != nil {
+		c.JSON(500, models.ErrorResponse(500, "failed to delete token: "+err.Error()))
 		return
 	}
 
-	c.JSON(200, gin.H{"message": "OTP sent to email (if not already registered)"})
+	ctx := c.Request.Context()
+	user, err := h.repo.GetByEmail(ctx, email)
+	if err != nil || user == nil {
+		c.JSON(404, models.ErrorResponse(404, "User not found"))
+		return
+	}
+	newHash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(500, models.ErrorResponse(500, "Failed to hash new password"))
+		return
+	}
+	if err := h.repo.UpdatePassword(ctx, user.ID, newHash); err != nil {
+		c.JSON(500, models.ErrorResponse(500, err.Error()))
+		return
+	}
+	// Mật khẩu đổi thì đăng xuất mọi phiên, kể cả phiên của người đã dò được mật khẩu cũ
+	if err := database.DeleteAllTokensByUserID(user.ID); err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("user_id", user.ID).Msg("Failed to revoke sessions after password reset")
+	}
+
+	logger.Ctx(c.Request.Context()).Info().Str("user_id", user.ID).Msg("Password reset via email OTP")
+	c.JSON(200, models.SuccessResponseWithMessage("Password has been reset, please log in again", nil))
 }
@@ -17,6 +17,7 @@ import (
 type ManagerHandler struct {
 	ManagerRepo *repository.ManagerRepository
 	UserRepo    *repository.UserRepository
+	Audit       *repository.AuditRepository
 	cfg         *config.Config
 }
 
@@ -59,7 +60,7 @@ func (h *ManagerHandler) CreateManager(c *gin.Context) {
 		apiSecret := h.cfg.Cloudinary.Secret
 		folder := "avatar"
 		publicID := uuid.New().String()
-		url, err := utils.UploadToCloudinary(f, avatarFile, cloudName, apiKey, apiSecret, folder, publicID)
+		url, err := utils.UploadToCloudinary(c.Request.Context(), f, avatarFile, cloudName, apiKey, apiSecret, folder, publicID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Upload avatar failed"})
 			return
@@ -113,10 +114,11 @@ func (h *ManagerHandler) CreateManager(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Create manager failed"})
 		return
 	}
+	recordAudit(c, h.Audit, "manager.create", "manager", userID, nil, gin.H{"manager": manager, "email": user.Email, "username": user.Username})
 
 	subject := "Tài khoản quản lý ký túc xá"
 	body := fmt.Sprintf("Tài khoản: %s\nMật khẩu: %s", input.Username, password)
-	err = utils.SendMail(h.cfg.MailGoogle.Host, h.cfg.MailGoogle.Port, h.cfg.MailGoogle.Email, h.cfg.MailGoogle.Password, input.Email, subject, body)
+	err = utils.SendMail(c.Request.Context(), h.cfg.MailGoogle.Host, h.cfg.MailGoogle.Port, h.cfg.MailGoogle.Email, h.cfg.MailGoogle.Password, input.Email, subject, body)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gửi email thất bại"})
 		return
@@ -167,6 +169,7 @@ func (h *ManagerHandler) UpdateManager(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Manager not found"})
 		return
 	}
+	before := *manager
 	if input.FullName != "" {
 		manager.FullName = input.FullName
 	}
@@ -198,7 +201,7 @@ func (h *ManagerHandler) UpdateManager(c *gin.Context) {
 			apiSecret := h.cfg.Cloudinary.Secret
 			folder := "avatar"
 			publicID := uuid.New().String()
-			url, err := utils.UploadToCloudinary(f, avatarFile, cloudName, apiKey, apiSecret, folder, publicID)
+			url, err := utils.UploadToCloudinary(c.Request.Context(), f, avatarFile, cloudName, apiKey, apiSecret, folder, publicID)
 			if err == nil {
 				manager.Avatar = url
 			}
@@ -210,16 +213,19 @@ func (h *ManagerHandler) UpdateManager(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Update manager failed"})
 		return
 	}
+	recordAudit(c, h.Audit, "manager.update", "manager", id, before, manager)
 	c.JSON(http.StatusOK, gin.H{"message": "Cập nhật cán bộ quản túc thành công"})
 }
 
 // DELETE /api/v1/managers/:id (delete user, cascade all)
 func (h *ManagerHandler) DeleteManager(c *gin.Context) {
 	id := c.Param("id")
+	prev, _ := h.ManagerRepo.GetManagerByID(context.Background(), id)
 	if err := h.UserRepo.Delete(context.Background(), id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Delete user failed"})
 		return
 	}
+	recordAudit(c, h.Audit, "manager.delete", "manager", id, prev, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "Xóa cán bộ quản túc thành công"})
 }
 
@@ -0,0 +1,599 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/database"
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMFAIssuer      = "PTIT Dorm"
+	defaultMFATokenTTL    = 5 * time.Minute
+	mfaMaxAttempts        = 5
+	mfaTOTPSkew           = 1 // chấp nhận lệch ±1 bước (30 giây)
+	mfaRecoveryCodeCount  = 10
+	mfaPendingKeyPrefix   = "mfa_pending:"
+	mfaAttemptsKeyPrefix  = "mfa_attempts:"
+	mfaUserAttemptsPrefix = "mfa_attempts_user:"
+	mfaUsedCodeKeyPattern = "totp_used:%s:%d"
+)
+
+var (
+	errMFANotEnabled  = errors.New("two-factor authentication is not enabled")
+	errMFAInvalidCode = errors.New("invalid two-factor code")
+)
+
+// mfaPending là trạng thái đăng nhập đã qua bước mật khẩu, chờ mã 2FA (hoặc chờ đăng ký 2FA nếu bắt buộc)
+type mfaPending struct {
+	User   models.LoginUserInfo `json:"user"`
+	Enroll bool                 `json:"enroll"`
+}
+
+func (h *AuthHandler) mfaTokenTTL() time.Duration {
+	return secondsOr(h.cfg.MFA.TokenTTLSeconds, defaultMFATokenTTL)
+}
+
+// mfaEnforced cho biết tài khoản có vai trò bắt buộc bật 2FA hay không
+func (h *AuthHandler) mfaEnforced(roles []string) bool {
+	for _, enforced := range h.cfg.MFA.EnforcedRoles {
+		for _, r := range roles {
+			if r == enforced {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// completeLogin được gọi sau khi đã xác thực mật khẩu: trả token nếu không cần 2FA,
+// ngược lại trả mfa_token để đổi lấy token sau khi nhập đúng mã.
+func (h *AuthHandler) completeLogin(c *gin.Context, userInfo models.LoginUserInfo) {
+	mfa, err := h.mfaRepo.Get(c.Request.Context(), userInfo.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to get two-factor status"))
+		return
+	}
+	enabled := mfa != nil && mfa.Enabled
+	if !enabled && !h.mfaEnforced(userInfo.Roles) {
+		resp, err := h.issueLoginTokens(c, userInfo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	pending := mfaPending{User: userInfo, Enroll: !enabled}
+	data, _ := json.Marshal(pending)
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to create mfa token"))
+		return
+	}
+	mfaToken := hex.EncodeToString(b)
+	ttl := h.mfaTokenTTL()
+	if err := database.Set(mfaPendingKeyPrefix+mfaToken, string(data), ttl); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to store mfa token"))
+		return
+	}
+	c.JSON(http.StatusOK, models.MFAChallengeResponse{
+		MFARequired:        true,
+		EnrollmentRequired: pending.Enroll,
+		MFAToken:           mfaToken,
+		ExpiresIn:          int(ttl.Seconds()),
+	})
+}
+
+// loadPending đọc mfa_token, đếm số lần thử và huỷ token khi thử sai quá nhiều. Tự ghi response nếu không hợp lệ.
+func (h *AuthHandler) loadPending(c *gin.Context, mfaToken string, enroll bool) (*mfaPending, bool) {
+	exists, data, err := database.Get(mfaPendingKeyPrefix + mfaToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to get mfa token"))
+		return nil, false
+	}
+	var pending mfaPending
+	if !exists || json.Unmarshal([]byte(data), &pending) != nil || pending.Enroll != enroll {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "mfa token is invalid or expired"))
+		return nil, false
+	}
+	attempts, err := database.IncrRateLimit(mfaAttemptsKeyPrefix+mfaToken, h.mfaTokenTTL())
+	if err == nil && attempts > mfaMaxAttempts {
+		_ = database.Delete(mfaPendingKeyPrefix + mfaToken)
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse(http.StatusTooManyRequests, "too many invalid codes, please log in again"))
+		return nil, false
+	}
+	return &pending, true
+}
+
+// allowMFAAttempt đếm số lần nhập mã 2FA theo tài khoản, dùng chung cho mọi đường nhập mã (đăng nhập, xác nhận đăng ký,
+// tạo lại mã khôi phục, tắt 2FA). Bộ đếm theo mfa_token không đủ vì đăng nhập lại bằng mật khẩu là có token mới.
+// Tự ghi response nếu bị chặn.
+func (h *AuthHandler) allowMFAAttempt(c *gin.Context, userID string) bool {
+	attempts, err := database.IncrRateLimit(mfaUserAttemptsPrefix+userID, h.mfaTokenTTL())
+	if err == nil && attempts > mfaMaxAttempts {
+		logger.Ctx(c.Request.Context()).Warn().Str("user_id", userID).Int("attempts", attempts).Msg("Too many two-factor attempts")
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse(http.StatusTooManyRequests, "too many invalid codes, please try again later"))
+		return false
+	}
+	return true
+}
+
+// resetMFAAttempts xoá bộ đếm theo tài khoản sau khi nhập đúng mã
+func resetMFAAttempts(userID string) {
+	_ = database.Delete(mfaUserAttemptsPrefix + userID)
+}
+
+// checkTOTP kiểm tra mã TOTP và chặn dùng lại cùng một mã trong khoảng lệch giờ cho phép
+func checkTOTP(userID, secret, code string) bool {
+	counter, ok := service.ValidateTOTP(secret, code, time.Now(), mfaTOTPSkew)
+	if !ok {
+		return false
+	}
+	ttl := time.Duration(30*(2*mfaTOTPSkew+1)) * time.Second
+	fresh, err := database.SetLockKey(fmt.Sprintf(mfaUsedCodeKeyPattern, userID, counter), "1", ttl)
+	if err != nil {
+		// Redis lỗi thì vẫn chấp nhận mã hợp lệ, chỉ mất chống replay
+		return true
+	}
+	return fresh
+}
+
+// verifySecondFactor kiểm tra mã TOTP hoặc mã khôi phục của tài khoản đã bật 2FA
+func (h *AuthHandler) verifySecondFactor(ctx context.Context, userID, code, recoveryCode string) error {
+	mfa, err := h.mfaRepo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return errMFANotEnabled
+	}
+	if code != "" {
+		if checkTOTP(userID, mfa.TOTPSecret, code) {
+			return nil
+		}
+		return errMFAInvalidCode
+	}
+	if recoveryCode == "" {
+		return errMFAInvalidCode
+	}
+	codes, err := h.mfaRepo.ListUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return err
+	}
+	normalized := service.NormalizeRecoveryCode(recoveryCode)
+	for _, rc := range codes {
+		if utils.ComparePassword(rc.CodeHash, normalized) != nil {
+			continue
+		}
+		used, err := h.mfaRepo.MarkRecoveryCodeUsed(ctx, rc.ID, time.Now())
+		if err != nil {
+			return err
+		}
+		if used {
+			logger.Ctx(ctx).Warn().Str("user_id", userID).Msg("Recovery code used for two-factor authentication")
+			return nil
+		}
+	}
+	return errMFAInvalidCode
+}
+
+// newRecoveryCodes sinh bộ mã khôi phục mới, trả về mã gốc (chỉ hiển thị một lần) và hash để lưu
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := service.GenerateRecoveryCodes(mfaRecoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		if hashes[i], err = utils.HashPassword(code); err != nil {
+			return nil, nil, err
+		}
+	}
+	return codes, hashes, nil
+}
+
+// startEnrollment tạo secret mới chờ xác nhận
+func (h *AuthHandler) startEnrollment(ctx context.Context, userID, account string) (*models.MFAEnrollResponse, error) {
+	secret, err := service.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := h.mfaRepo.StartEnrollment(ctx, userID, secret, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+	issuer := h.cfg.MFA.Issuer
+	if issuer == "" {
+		issuer = defaultMFAIssuer
+	}
+	return &models.MFAEnrollResponse{Secret: secret, OTPAuthURL: service.TOTPURI(issuer, account, secret)}, nil
+}
+
+// confirmEnrollment bật 2FA khi mã đầu tiên hợp lệ, trả về bộ mã khôi phục
+func (h *AuthHandler) confirmEnrollment(ctx context.Context, userID, code string) ([]string, error) {
+	mfa, err := h.mfaRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, errors.New("two-factor enrollment has not been started")
+	}
+	if mfa.Enabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+	if !checkTOTP(userID, mfa.TOTPSecret, code) {
+		return nil, errMFAInvalidCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.mfaRepo.Enable(ctx, userID, hashes, time.Now()); err != nil {
+		return nil, err
+	}
+	logger.Ctx(ctx).Info().Str("user_id", userID).Msg("Two-factor authentication enabled")
+	return codes, nil
+}
+
+func mfaAccountName(u models.LoginUserInfo) string {
+	if u.Email != "" {
+		return u.Email
+	}
+	return u.Username
+}
+
+type mfaVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// MFAVerifyHandler godoc
+// @Summary Complete login with a two-factor code
+// @Description Exchange mfa_token from /login and a TOTP or recovery code for access/refresh tokens
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.LoginResponse
+// @Failure 401 {object} models.Response
+// @Failure 429 {object} models.Response
+// @Router /mfa/verify [post]
+func (h *AuthHandler) MFAVerifyHandler(c *gin.Context) {
+	var req mfaVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, "missing mfa_token and code or recovery_code"))
+		return
+	}
+	pending, ok := h.loadPending(c, req.MFAToken, false)
+	if !ok {
+		return
+	}
+	if !h.allowMFAAttempt(c, pending.User.UserID) {
+		return
+	}
+	if err := h.verifySecondFactor(c.Request.Context(), pending.User.UserID, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, errMFAInvalidCode) || errors.Is(err, errMFANotEnabled) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	resetMFAAttempts(pending.User.UserID)
+	_ = database.Delete(mfaPendingKeyPrefix + req.MFAToken)
+	resp, err := h.issueLoginTokens(c, pending.User)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+type mfaTokenRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// MFAEnrollHandler godoc
+// @Summary Start required two-factor enrollment during login
+// @Description For accounts whose role requires 2FA but have not enrolled yet: returns a TOTP secret and otpauth URL
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.MFAEnrollResponse
+// @Failure 401 {object} models.Response
+// @Router /mfa/enroll [post]
+func (h *AuthHandler) MFAEnrollHandler(c *gin.Context) {
+	var req mfaTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, "missing mfa_token"))
+		return
+	}
+	pending, ok := h.loadPending(c, req.MFAToken, true)
+	if !ok {
+		return
+	}
+	resp, err := h.startEnrollment(c.Request.Context(), pending.User.UserID, mfaAccountName(pending.User))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(resp))
+}
+
+type mfaConfirmRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFAEnrollConfirmHandler godoc
+// @Summary Confirm required two-factor enrollment during login
+// @Description Confirm the first TOTP code, enable 2FA and return recovery codes together with access/refresh tokens
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response
+// @Failure 401 {object} models.Response
+// @Router /mfa/enroll/confirm [post]
+func (h *AuthHandler) MFAEnrollConfirmHandler(c *gin.Context) {
+	var req mfaConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.MFAToken == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, "missing mfa_token or code"))
+		return
+	}
+	pending, ok := h.loadPending(c, req.MFAToken, true)
+	if !ok {
+		return
+	}
+	if !h.allowMFAAttempt(c, pending.User.UserID) {
+		return
+	}
+	codes, err := h.confirmEnrollment(c.Request.Context(), pending.User.UserID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, err.Error()))
+		return
+	}
+	resetMFAAttempts(pending.User.UserID)
+	_ = database.Delete(mfaPendingKeyPrefix + req.MFAToken)
+	resp, err := h.issueLoginTokens(c, pending.User)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"access_token":   resp.AccessToken,
+		"refresh_token":  resp.RefreshToken,
+		"user":           resp.User,
+		"recovery_codes": codes,
+	}))
+}
+
+// GetMyMFA godoc
+// @Summary Get two-factor status
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} models.Response
+// @Router /api/v1/protected/mfa/me [get]
+func (h *AuthHandler) GetMyMFA(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	ctx := c.Request.Context()
+	mfa, err := h.mfaRepo.Get(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	roles, err := h.userRepo.GetRolesByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	status := gin.H{"enabled": false, "enforced": h.mfaEnforced(roles), "recovery_codes_left": 0}
+	if mfa != nil && mfa.Enabled {
+		codes, err := h.mfaRepo.ListUnusedRecoveryCodes(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		status["enabled"] = true
+		status["enabled_at"] = mfa.EnabledAt
+		status["recovery_codes_left"] = len(codes)
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(status))
+}
+
+// StartMyMFAEnrollment godoc
+// @Summary Start optional two-factor enrollment
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} models.MFAEnrollResponse
+// @Router /api/v1/protected/mfa/me/enroll [post]
+func (h *AuthHandler) StartMyMFAEnrollment(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	user, err := h.userRepo.GetByID(c.Request.Context(), userID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(http.StatusNotFound, "User not found"))
+		return
+	}
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+	resp, err := h.startEnrollment(c.Request.Context(), userID, account)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(resp))
+}
+
+// ConfirmMyMFAEnrollment godoc
+// @Summary Confirm optional two-factor enrollment
+// @Description Confirm the first TOTP code and return recovery codes (shown only once)
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response
+// @Router /api/v1/protected/mfa/me/enroll/confirm [post]
+func (h *AuthHandler) ConfirmMyMFAEnrollment(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	var req mfaConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, "missing code"))
+		return
+	}
+	if !h.allowMFAAttempt(c, userID) {
+		return
+	}
+	codes, err := h.confirmEnrollment(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, err.Error()))
+		return
+	}
+	resetMFAAttempts(userID)
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{"recovery_codes": codes}))
+}
+
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// RegenerateMyRecoveryCodes godoc
+// @Summary Regenerate two-factor recovery codes
+// @Description Requires a valid TOTP code; previous recovery codes stop working
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response
+// @Router /api/v1/protected/mfa/me/recovery-codes [post]
+func (h *AuthHandler) RegenerateMyRecoveryCodes(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, "missing code"))
+		return
+	}
+	ctx := c.Request.Context()
+	if !h.allowMFAAttempt(c, userID) {
+		return
+	}
+	if err := h.verifySecondFactor(ctx, userID, req.Code, ""); err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, err.Error()))
+		return
+	}
+	resetMFAAttempts(userID)
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	if err := h.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{"recovery_codes": codes}))
+}
+
+// DisableMyMFA godoc
+// @Summary Disable two-factor authentication
+// @Description Requires a valid TOTP or recovery code. Not allowed for roles where 2FA is enforced.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response
+// @Failure 403 {object} models.Response
+// @Router /api/v1/protected/mfa/me [delete]
+func (h *AuthHandler) DisableMyMFA(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, "missing code or recovery_code"))
+		return
+	}
+	ctx := c.Request.Context()
+	roles, err := h.userRepo.GetRolesByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	if h.mfaEnforced(roles) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse(http.StatusForbidden, "two-factor authentication is required for your role"))
+		return
+	}
+	if !h.allowMFAAttempt(c, userID) {
+		return
+	}
+	if err := h.verifySecondFactor(ctx, userID, req.Code, req.RecoveryCode); err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, err.Error()))
+		return
+	}
+	resetMFAAttempts(userID)
+	if err := h.mfaRepo.Disable(ctx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	logger.Ctx(c.Request.Context()).Info().Str("user_id", userID).Msg("Two-factor authentication disabled")
+	c.JSON(http.StatusOK, models.SuccessResponseWithMessage("Two-factor authentication disabled", nil))
+}
+
+// ResetUserMFA godoc
+// @Summary Reset two-factor authentication of a user (admin_system only)
+// @Description For users who lost both their authenticator and recovery codes. Also revokes all of their sessions.
+// @Tags Auth
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.Response
+// @Router /api/v1/protected/mfa/users/{id} [delete]
+func (h *AuthHandler) ResetUserMFA(c *gin.Context) {
+	if !utils.HasAnyRole(c, "admin_system") {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "Unauthorized, you do not have the required permissions"))
+		return
+	}
+	adminID, _ := utils.GetUserIDFromContext(c)
+	userID := c.Param("id")
+	if err := h.mfaRepo.Disable(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	if err := database.DeleteAllTokensByUserID(userID); err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("user_id", userID).Msg("Failed to revoke sessions after MFA reset")
+	}
+	recordAudit(c, h.Audit, "user.reset_mfa", "user", userID, nil, gin.H{"mfa_enabled": false, "sessions_revoked": true})
+	logger.Ctx(c.Request.Context()).Warn().Str("admin_id", adminID).Str("user_id", userID).Msg("Two-factor authentication reset by admin")
+	c.JSON(http.StatusOK, models.SuccessResponseWithMessage("Two-factor authentication reset", nil))
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Số ngày mặc định từ lúc duyệt hủy hợp đồng tới ngày trả phòng
+const defaultCheckoutAfterDays = 7
+
+type MoveOutHandler struct {
+	Repo              *repository.MoveOutRepository
+	ContractRepo      *repository.ContractRepository
+	UserRepo          *repository.UserRepository
+	ElectricBillRepo  *repository.ElectricBillRepository
+	RefundRepo        *repository.RefundRepository
+	CancelRequestRepo *repository.ContractCancelRequestRepository
+	Audit             *repository.AuditRepository
+	cfg               *config.Config
+}
+
+func NewMoveOutHandler(repo *repository.MoveOutRepository, contractRepo *repository.ContractRepository, userRepo *repository.UserRepository, electricBillRepo *repository.ElectricBillRepository, refundRepo *repository.RefundRepository, cfg *config.Config) *MoveOutHandler {
+	return &MoveOutHandler{
+		Repo:             repo,
+		ContractRepo:     contractRepo,
+		UserRepo:         userRepo,
+		ElectricBillRepo: electricBillRepo,
+		RefundRepo:       refundRepo,
+		cfg:              cfg,
+	}
+}
+
+// newMoveOutProcess khởi tạo quy trình trả phòng với đầy đủ các bước ở trạng thái pending
+func newMoveOutProcess(contract *models.Contract, cancelRequestID string, checkoutDate time.Time) *models.MoveOutProcess {
+	now := time.Now()
+	p := &models.MoveOutProcess{
+		ID:              uuid.New().String(),
+		ContractID:      contract.ID.String(),
+		CancelRequestID: cancelRequestID,
+		StudentID:       contract.StudentID,
+		Room:            contract.Room,
+		CheckoutDate:    checkoutDate,
+		Status:          models.MoveOutStatusInProgress,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	for _, t := range models.MoveOutItemTypes {
+		p.Items = append(p.Items, models.MoveOutChecklistItem{
+			ID:       uuid.New().String(),
+			ItemType: t,
+			Status:   models.MoveOutItemStatusPending,
+		})
+	}
+	p.Progress = models.MoveOutProgress{Completed: 0, Total: len(p.Items)}
+	return p
+}
+
+// parseCheckoutDate đọc ngày trả phòng (YYYY-MM-DD), để trống thì lấy mặc định
+func parseCheckoutDate(raw string) (time.Time, error) {
+	if raw == "" {
+		y, m, d := time.Now().AddDate(0, 0, defaultCheckoutAfterDays).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.Local), nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
+
+// GET /api/v1/protected/move-outs/me (student)
+// Sinh viên xem tiến độ trả phòng của mình
+func (h *MoveOutHandler) ListMyMoveOuts(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	processes, err := h.Repo.ListByStudentID(context.Background(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get move-out processes", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": processes})
+}
+
+// GET /api/v1/protected/move-outs?status=in_progress (manager)
+func (h *MoveOutHandler) List(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	processes, err := h.Repo.List(context.Background(), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get move-out processes", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": processes})
+}
+
+// GET /api/v1/protected/move-outs/:id (owner or manager)
+func (h *MoveOutHandler) GetByID(c *gin.Context) {
+	process, err := h.Repo.GetByID(context.Background(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get move-out process", "details": err.Error()})
+		return
+	}
+	if process == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	userID, _ := utils.GetUserIDFromContext(c)
+	if !utils.HasAnyRole(c, "manager", "admin_system") && process.StudentID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this move-out process"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": process})
+}
+
+type scheduleCheckoutInput struct {
+	CheckoutDate string `json:"checkout_date" binding:"required"`
+}
+
+// PATCH /api/v1/protected/move-outs/:id/checkout-date (manager)
+// Đặt lại lịch trả phòng
+func (h *MoveOutHandler) ScheduleCheckout(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	var input scheduleCheckoutInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	checkoutDate, err := time.Parse("2006-01-02", input.CheckoutDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid checkout_date format, must be YYYY-MM-DD"})
+		return
+	}
+	ctx := context.Background()
+	process, err := h.Repo.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get move-out process", "details": err.Error()})
+		return
+	}
+	if process == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if process.Status != models.MoveOutStatusInProgress {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Move-out process already completed"})
+		return
+	}
+	if err := h.Repo.UpdateCheckoutDate(ctx, process.ID, checkoutDate); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	process.CheckoutDate = checkoutDate
+
+	// Báo giá hoàn phí chưa duyệt thì tính lại theo ngày trả phòng mới
+	if err := h.requoteRefund(ctx, process); err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Str("move_out_id", process.ID).Msg("Failed to update refund quote")
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": process})
+}
+
+// requoteRefund tính lại báo giá hoàn phí (nếu còn ở trạng thái quoted) và số tiền ở bước fee_refund
+func (h *MoveOutHandler) requoteRefund(ctx context.Context, process *models.MoveOutProcess) error {
+	refund, err := h.RefundRepo.GetByMoveOutID(ctx, process.ID)
+	if err != nil || refund == nil || refund.Status != models.RefundStatusQuoted {
+		return err
+	}
+	contract, err := h.ContractRepo.GetContractByID(ctx, process.ContractID)
+	if err != nil || contract == nil {
+		return err
+	}
+	quote, err := service.CalculateRefund(contract, process.CheckoutDate, refund.NoticeDate, h.cfg.Refund)
+	if err != nil {
+		return err
+	}
+	if err := h.RefundRepo.UpdateQuote(ctx, refund.ID, quote); err != nil {
+		return err
+	}
+	if err := h.Repo.UpdateItemAmount(ctx, process.ID, models.MoveOutItemFeeRefund, quote.RefundAmount); err != nil {
+		return err
+	}
+	for i := range process.Items {
+		if process.Items[i].ItemType == models.MoveOutItemFeeRefund {
+			process.Items[i].Amount = quote.RefundAmount
+		}
+	}
+	return nil
+}
+
+// quoteMissingRefund lập báo giá hoàn phí cho quy trình trả phòng chưa có bản ghi trong sổ, nil nếu không có gì để hoàn
+func (h *MoveOutHandler) quoteMissingRefund(ctx context.Context, process *models.MoveOutProcess) (*models.RefundLedgerEntry, error) {
+	contract, err := h.ContractRepo.GetContractByID(ctx, process.ContractID)
+	if err != nil || contract == nil {
+		return nil, err
+	}
+	noticeDate := process.CreatedAt
+	if process.CancelRequestID != "" {
+		req, err := h.CancelRequestRepo.GetByID(ctx, process.CancelRequestID)
+		if err != nil {
+			return nil, err
+		}
+		noticeDate = req.CreatedAt
+	}
+	return createRefundQuote(ctx, h.RefundRepo, h.cfg.Refund, contract, process.CheckoutDate, noticeDate, models.RefundSourceCancelRequest, process.ID)
+}
+
+type completeMoveOutItemInput struct {
+	Amount float64 `json:"amount"`
+	Note   string  `json:"note"`
+}
+
+// PATCH /api/v1/protected/move-outs/:id/items/:item_type (manager)
+// Quản lý xác nhận hoàn thành một bước trong checklist.
+// Khi tất cả các bước hoàn thành, hợp đồng được kết thúc và sinh viên chuyển về guest.
+func (h *MoveOutHandler) CompleteItem(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	managerID, err := utils.GetUserIDFromContext(c)
+	if err != nil || managerID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var input completeMoveOutItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must not be negative"})
+		return
+	}
+
+	ctx := context.Background()
+	process, err := h.Repo.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get move-out process", "details": err.Error()})
+		return
+	}
+	if process == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if process.Status != models.MoveOutStatusInProgress {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Move-out process already completed"})
+		return
+	}
+
+	itemType := c.Param("item_type")
+	var item *models.MoveOutChecklistItem
+	for i := range process.Items {
+		if process.Items[i].ItemType == itemType {
+			item = &process.Items[i]
+			break
+		}
+	}
+	if item == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "checklist item not found"})
+		return
+	}
+	if item.Status == models.MoveOutItemStatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Checklist item already completed"})
+		return
+	}
+
+	amount := input.Amount
+	var refund *models.RefundLedgerEntry
+	switch itemType {
+	case models.MoveOutItemElectricBills:
+		// Phòng còn hóa đơn điện chưa thanh toán thì chưa thể xác nhận bước này
+		unpaid, err := h.ElectricBillRepo.ListUnpaidByRoom(ctx, process.Room)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check electric bills", "details": err.Error()})
+			return
+		}
+		if len(unpaid) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Room still has unpaid electric bills", "unpaid_bills": unpaid})
+			return
+		}
+	case models.MoveOutItemFeeRefund:
+		// Báo giá hoàn phí phải được quản lý duyệt (hoặc từ chối) trước khi chi trả
+		refund, err = h.RefundRepo.GetByMoveOutID(ctx, process.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get refund", "details": err.Error()})
+			return
+		}
+		if refund == nil {
+			// Chưa có bản ghi hoàn phí: tính lại, nếu có tiền hoàn thì lập báo giá chờ duyệt.
+			// Không bao giờ chi trả theo số tiền nhập tay mà không có bản ghi trong sổ.
+			refund, err = h.quoteMissingRefund(ctx, process)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to calculate refund quote", "details": err.Error()})
+				return
+			}
+		}
+		if refund == nil {
+			// Hợp đồng không có gì để hoàn (chưa thanh toán, trả phòng đúng hạn...)
+			amount = 0
+		} else {
+			switch refund.Status {
+			case models.RefundStatusQuoted:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Refund quote must be reviewed before completing this step", "refund": refund})
+				return
+			case models.RefundStatusApproved, models.RefundStatusPaid:
+				amount = refund.RefundAmount
+			case models.RefundStatusRejected:
+				amount = 0
+			}
+		}
+	}
+
+	completion := repository.MoveOutItemCompletion{
+		ProcessID:   process.ID,
+		ItemType:    itemType,
+		Amount:      amount,
+		Note:        input.Note,
+		CompletedBy: managerID,
+		CompletedAt: time.Now(),
+	}
+	if itemType == models.MoveOutItemFeeRefund && refund != nil && refund.Status == models.RefundStatusApproved {
+		completion.PaidRefundID = refund.ID
+		completion.PayoutReference = input.Note
+		if completion.PayoutReference == "" {
+			completion.PayoutReference = "move_out:" + process.ID
+		}
+	}
+	// Bước cuối cùng sẽ kết thúc hợp đồng và chuyển sinh viên về guest trong cùng transaction
+	finished, err := h.Repo.CompleteItem(ctx, completion, "Hoàn tất thủ tục trả phòng")
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrMoveOutItemCompleted):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Checklist item already completed"})
+		case errors.Is(err, repository.ErrMoveOutNotInProgress):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Move-out process already completed"})
+		case errors.Is(err, repository.ErrRefundNotApproved):
+			c.JSON(http.StatusConflict, gin.H{"error": "Refund is no longer approved, reload and try again"})
+		default:
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("move_out_id", process.ID).Str("item_type", itemType).Msg("Failed to complete move-out checklist item")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to complete checklist item", "details": err.Error()})
+		}
+		return
+	}
+	after := gin.H{"item_type": itemType, "status": models.MoveOutItemStatusCompleted, "amount": amount, "note": input.Note, "process_finished": finished}
+	if completion.PaidRefundID != "" {
+		after["paid_refund_id"] = completion.PaidRefundID
+		after["payout_reference"] = completion.PayoutReference
+	}
+	recordAudit(c, h.Audit, "move_out.complete_item", "move_out", process.ID,
+		gin.H{"item_type": itemType, "status": item.Status, "amount": item.Amount}, after)
+	process, err = h.Repo.GetByID(ctx, process.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get move-out process", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": process})
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultNotificationPageSize = 20
+	maxNotificationPageSize     = 100
+)
+
+// Notifier lưu thông báo vào hộp thư và đẩy ngay tới kênh riêng user:<id> trên WebSocket
+// (cả /ws/v1/notifications và /ws/v1/chat đều nhận). Notifier nil thì không gửi gì.
+type Notifier struct {
+	Repo *repository.NotificationRepository
+	WS   *service.WSService
+}
+
+func NewNotifier(repo *repository.NotificationRepository, ws *service.WSService) *Notifier {
+	return &Notifier{Repo: repo, WS: ws}
+}
+
+// Notify gửi một thông báo cho từng user trong userIDs. data là struct/map bất kỳ, được lưu dạng JSON.
+// Lỗi chỉ được ghi log, không làm hỏng thao tác đã thành công.
+func (n *Notifier) Notify(ctx context.Context, userIDs []string, notifType, title, body, entityType, entityID string, data interface{}) {
+	if n == nil {
+		return
+	}
+	var raw json.RawMessage
+	if data != nil {
+		raw, _ = json.Marshal(data)
+	}
+	now := time.Now()
+	for _, userID := range userIDs {
+		if userID == "" {
+			continue
+		}
+		notif := &models.Notification{
+			ID:         uuid.NewString(),
+			UserID:     userID,
+			Type:       notifType,
+			Title:      title,
+			Body:       body,
+			EntityType: entityType,
+			EntityID:   entityID,
+			Data:       raw,
+			CreatedAt:  now,
+		}
+		if err := n.Repo.Create(ctx, notif); err != nil {
+			logger.Ctx(ctx).Error().Err(err).Str("user_id", userID).Str("type", notifType).Msg("Failed to save notification")
+			continue
+		}
+		event := gin.H{"type": "notification", "notification": notif}
+		if unread, err := n.Repo.CountUnread(ctx, userID); err == nil {
+			event["unread_count"] = unread
+		}
+		n.WS.BroadcastToRoom(models.ChatUserChannel(userID), event, nil)
+	}
+}
+
+type NotificationHandler struct {
+	Repo *repository.NotificationRepository
+	WS   *service.WSService
+}
+
+func NewNotificationHandler(repo *repository.NotificationRepository, ws *service.WSService) *NotificationHandler {
+	return &NotificationHandler{Repo: repo, WS: ws}
+}
+
+// GET /api/v1/protected/notifications?unread=true&limit=&offset=
+func (h *NotificationHandler) List(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultNotificationPageSize
+	}
+	if limit > maxNotificationPageSize {
+		limit = maxNotificationPageSize
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	list, err := h.Repo.ListByUser(c.Request.Context(), userID, c.Query("unread") == "true", limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	unread, err := h.Repo.CountUnread(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": list, "unread_count": unread, "limit": limit, "offset": offset})
+}
+
+// GET /api/v1/protected/notifications/unread-count
+func (h *NotificationHandler) UnreadCount(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	unread, err := h.Repo.CountUnread(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": gin.H{"unread_count": unread}})
+}
+
+type markNotificationsReadInput struct {
+	IDs []string `json:"ids"` // bỏ trống = đánh dấu tất cả
+}
+
+// POST /api/v1/protected/notifications/read
+func (h *NotificationHandler) MarkRead(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var input markNotificationsReadInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	updated, err := h.Repo.MarkRead(c.Request.Context(), userID, input.IDs, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	unread, err := h.Repo.CountUnread(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Đồng bộ số chưa đọc sang các thiết bị khác đang mở
+	h.WS.BroadcastToRoom(models.ChatUserChannel(userID), gin.H{"type": "notifications_read", "ids": input.IDs, "unread_count": unread}, nil)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": gin.H{"updated": updated, "unread_count": unread}})
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// OIDCCallback godoc
+// @Summary Login with an OpenID Connect provider
+// @Description FE đăng nhập ở nhà cung cấp (Microsoft, ...) rồi gửi id_token lên. BE kiểm tra chữ ký qua JWKS, iss, aud, exp,
+// @Description sau đó chọn vai trò theo domain email trong cấu hình oidc. Tài khoản có sẵn cùng email chỉ được liên kết tự động khi email đã được nhà cung cấp xác minh.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name in config (e.g. microsoft)"
+// @Param OIDCLoginRequest body models.OIDCLoginRequest true "ID token from provider"
+// @Success 200 {object} models.LoginResponse
+// @Failure 401 {object} models.Response "Invalid id_token"
+// @Failure 403 {object} models.Response "Email domain or account role not allowed"
+// @Failure 404 {object} models.Response "Unknown provider"
+// @Failure 409 {object} models.Response "Account already linked to another identity"
+// @Router /oauth/{provider}/callback [post]
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	var req models.OIDCLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(http.StatusBadRequest, "invalid request: "+err.Error()))
+		return
+	}
+	ctx := c.Request.Context()
+	providerName := c.Param("provider")
+
+	identity, err := h.oidc.Verify(ctx, providerName, req.IDToken, req.Nonce)
+	if errors.Is(err, service.ErrOIDCUnknownProvider) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(http.StatusNotFound, "unknown login provider"))
+		return
+	}
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Warn().Err(err).Str("provider", providerName).Str("ip", c.ClientIP()).Msg("OIDC id_token rejected")
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, err.Error()))
+		return
+	}
+	provider, _ := h.oidc.Provider(providerName)
+	rule := provider.DomainRule(identity.Email)
+	if rule == nil {
+		c.JSON(http.StatusForbidden, models.ErrorResponse(http.StatusForbidden, "email domain is not allowed for "+providerName+" login"))
+		return
+	}
+
+	userRecord, err := h.resolveOIDCUser(ctx, identity)
+	if errors.Is(err, errOIDCEmailNotVerified) {
+		logger.Ctx(ctx).Warn().Str("provider", providerName).Str("subject", identity.Subject).Str("email", identity.Email).Msg("OIDC login with unverified email matches an existing account")
+		c.JSON(http.StatusConflict, models.ErrorResponse(http.StatusConflict, "an account with this email already exists but the provider did not verify the email, contact the dormitory office to link it"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to get user: "+err.Error()))
+		return
+	}
+	created := false
+	if userRecord == nil {
+		if rule.CreateRole == "" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse(http.StatusForbidden, "no account found for this email, contact the dormitory office"))
+			return
+		}
+		if userRecord, err = h.createOIDCUser(ctx, identity, rule.CreateRole); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to create user: "+err.Error()))
+			return
+		}
+		created = true
+	}
+	if userRecord.Status == "inactive" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "user account is inactive"))
+		return
+	}
+
+	// Chỉ giữ các vai trò domain này được phép, vd. email sinh viên không đăng nhập được quyền quản lý
+	roles, err := h.userRepo.GetRolesByUserID(ctx, userRecord.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to get user roles: "+err.Error()))
+		return
+	}
+	loginRoles := oidcLoginRoles(roles, rule)
+	if len(loginRoles) == 0 {
+		c.JSON(http.StatusForbidden, models.ErrorResponse(http.StatusForbidden, "account role is not allowed for "+providerName+" login"))
+		return
+	}
+
+	// Liên kết danh tính với tài khoản. Tài khoản đã liên kết với sub khác trên cùng provider thì không tự ghi đè.
+	linked, err := h.identityRepo.GetByUser(ctx, userRecord.ID, providerName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to get linked identity: "+err.Error()))
+		return
+	}
+	if linked != nil && linked.Subject != identity.Subject {
+		logger.Ctx(c.Request.Context()).Warn().Str("provider", providerName).Str("user_id", userRecord.ID).Str("subject", identity.Subject).Msg("OIDC login for account linked to another identity")
+		c.JSON(http.StatusConflict, models.ErrorResponse(http.StatusConflict, "account is already linked to another "+providerName+" identity"))
+		return
+	}
+	now := time.Now()
+	if err := h.identityRepo.Link(ctx, &models.UserIdentity{
+		ID:          uuid.NewString(),
+		UserID:      userRecord.ID,
+		Provider:    providerName,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to link identity: "+err.Error()))
+		return
+	}
+	if linked == nil && !created {
+		logger.Ctx(c.Request.Context()).Info().Str("provider", providerName).Str("user_id", userRecord.ID).Str("email", identity.Email).Msg("OIDC identity linked to existing account")
+	}
+
+	userInfo := models.LoginUserInfo{
+		UserID:      userRecord.ID,
+		Email:       userRecord.Email,
+		Username:    userRecord.Username,
+		DisplayName: identity.Name,
+		Roles:       loginRoles,
+	}
+	// Lấy thông tin hiển thị từ hệ thống nếu có
+	if uInfo, err := h.userRepo.GetUserInfo(ctx, userRecord.Username); err == nil && uInfo != nil {
+		userInfo.DisplayName = uInfo.DisplayName
+		userInfo.Avatar = uInfo.Avatar
+	}
+
+	// Sinh cặp access/refresh token giống luồng login thường (qua bước 2FA nếu cần)
+	h.completeLogin(c, userInfo)
+}
+
+var errOIDCEmailNotVerified = errors.New("oidc email is not verified")
+
+// resolveOIDCUser tìm tài khoản theo danh tính đã liên kết, chưa liên kết thì theo email đã được xác minh.
+// Email chưa xác minh trùng tài khoản có sẵn trả về errOIDCEmailNotVerified (không liên kết, không tạo tài khoản trùng).
+func (h *AuthHandler) resolveOIDCUser(ctx context.Context, identity *service.OIDCIdentity) (*models.User, error) {
+	linked, err := h.identityRepo.GetBySubject(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if linked != nil {
+		return h.userRepo.GetByID(ctx, linked.UserID)
+	}
+	user, err := h.userRepo.GetByEmail(ctx, identity.Email)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	if !identity.EmailVerified {
+		return nil, errOIDCEmailNotVerified
+	}
+	return user, nil
+}
+
+// createOIDCUser tạo tài khoản mới không mật khẩu cho người đăng nhập lần đầu
+func (h *AuthHandler) createOIDCUser(ctx context.Context, identity *service.OIDCIdentity, role string) (*models.User, error) {
+	now := time.Now()
+	user := &models.User{
+		ID:           uuid.NewString(),
+		Email:        identity.Email,
+		Username:     strings.SplitN(strings.ToLower(identity.Email), "@", 2)[0],
+		PasswordHash: "", // không dùng password cho OAuth
+		Status:       "active",
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := h.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := h.userRepo.SetUserRoleByName(ctx, user.ID, role); err != nil {
+		return nil, err
+	}
+	logger.Ctx(ctx).Info().Str("provider", identity.Provider).Str("user_id", user.ID).Str("role", role).Msg("Account created from OIDC login")
+	return user, nil
+}
+
+// oidcLoginRoles giữ lại các vai trò domain cho phép. Tài khoản chưa có vai trò nào nhận vai trò mặc định của domain.
+func oidcLoginRoles(roles []string, rule *config.OIDCDomainRule) []string {
+	var out []string
+	for _, r := range roles {
+		for _, allowed := range rule.Roles {
+			if r == allowed {
+				out = append(out, r)
+				break
+			}
+		}
+	}
+	if len(roles) == 0 && rule.CreateRole != "" {
+		out = []string{rule.CreateRole}
+	}
+	return out
+}
+
+// ListMyIdentities godoc
+// @Summary List linked login providers of current user
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} models.Response
+// @Router /api/v1/protected/identities/me [get]
+func (h *AuthHandler) ListMyIdentities(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	list, err := h.identityRepo.ListByUser(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "failed to list identities"))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(list))
+}
+
+// UnlinkUserIdentity godoc
+// @Summary Unlink a login provider from an account (admin)
+// @Description Gỡ liên kết để tài khoản liên kết lại với danh tính mới (vd. email được cấp lại ở tenant)
+// @Tags Auth
+// @Produce json
+// @Param id path string true "User ID"
+// @Param provider path string true "Provider name"
+// @Success 200 {object} models.Response
+// @Router /api/v1/protected/users/{id}/identities/{provider} [delete]
+func (h *AuthHandler) UnlinkUserIdentity(c *gin.Context) {
+	if !utils.HasAnyRole(c, "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	adminID, _ := utils.GetUserIDFromContext(c)
+	userID, provider := c.Param("id"), c.Param("provider")
+	removed, err := h.identityRepo.DeleteByUser(c.Request.Context(), userID, provider)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlink identity"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		return
+	}
+	recordAudit(c, h.Audit, "user.unlink_identity", "user", userID, gin.H{"provider": provider}, nil)
+	logger.Ctx(c.Request.Context()).Info().Str("admin_id", adminID).Str("user_id", userID).Str("provider", provider).Msg("OIDC identity unlinked by admin")
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
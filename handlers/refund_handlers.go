@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RefundHandler struct {
+	Repo         *repository.RefundRepository
+	ContractRepo *repository.ContractRepository
+	Audit        *repository.AuditRepository
+	cfg          *config.Config
+}
+
+func NewRefundHandler(repo *repository.RefundRepository, contractRepo *repository.ContractRepository, cfg *config.Config) *RefundHandler {
+	return &RefundHandler{Repo: repo, ContractRepo: contractRepo, cfg: cfg}
+}
+
+// newRefundEntry tính báo giá hoàn phí cho hợp đồng kết thúc sớm, chưa lưu vào sổ.
+// Trả về nil nếu hợp đồng không có gì để hoàn (chưa thanh toán, kết thúc đúng hạn...).
+func newRefundEntry(ctx context.Context, rules config.RefundConfig, contract *models.Contract, terminationDate, noticeDate time.Time, source, moveOutID string) (*models.RefundLedgerEntry, error) {
+	quote, err := service.CalculateRefund(contract, terminationDate, noticeDate, rules)
+	if err != nil {
+		if errors.Is(err, service.ErrRefundContractNotPaid) || errors.Is(err, service.ErrRefundInvalidTermDate) {
+			logger.Ctx(ctx).Info().Str("contract_id", contract.ID.String()).Err(err).Msg("Skip refund quote")
+			return nil, nil
+		}
+		return nil, err
+	}
+	if quote.UnusedDays <= 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	return &models.RefundLedgerEntry{
+		ID:          uuid.New().String(),
+		StudentID:   contract.StudentID,
+		MoveOutID:   moveOutID,
+		Source:      source,
+		RefundQuote: *quote,
+		Status:      models.RefundStatusQuoted,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// createRefundQuote tính và lưu báo giá hoàn phí, nil nếu không có gì để hoàn
+func createRefundQuote(ctx context.Context, repo *repository.RefundRepository, rules config.RefundConfig, contract *models.Contract, terminationDate, noticeDate time.Time, source, moveOutID string) (*models.RefundLedgerEntry, error) {
+	entry, err := newRefundEntry(ctx, rules, contract, terminationDate, noticeDate, source, moveOutID)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	if err := repo.Create(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GET /api/v1/protected/contracts/:id/refund-quote?termination_date=YYYY-MM-DD&notice_date=YYYY-MM-DD (manager)
+// Xem trước số tiền hoàn, không lưu vào sổ
+func (h *RefundHandler) PreviewQuote(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	terminationDate := time.Now()
+	if raw := c.Query("termination_date"); raw != "" {
+		t, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid termination_date format, must be YYYY-MM-DD"})
+			return
+		}
+		terminationDate = t
+	}
+	noticeDate := time.Now()
+	if raw := c.Query("notice_date"); raw != "" {
+		t, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notice_date format, must be YYYY-MM-DD"})
+			return
+		}
+		noticeDate = t
+	}
+	contract, err := h.ContractRepo.GetContractByID(context.Background(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get contract", "details": err.Error()})
+		return
+	}
+	if contract == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "contract not found"})
+		return
+	}
+	quote, err := service.CalculateRefund(contract, terminationDate, noticeDate, h.cfg.Refund)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": quote})
+}
+
+// GET /api/v1/protected/refunds?status=quoted (manager)
+func (h *RefundHandler) List(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	entries, err := h.Repo.List(context.Background(), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": entries})
+}
+
+// GET /api/v1/protected/refunds/me (student)
+func (h *RefundHandler) ListMyRefunds(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	entries, err := h.Repo.ListByStudentID(context.Background(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": entries})
+}
+
+// GET /api/v1/protected/refunds/:id (owner or manager)
+func (h *RefundHandler) GetByID(c *gin.Context) {
+	entry, err := h.Repo.GetByID(context.Background(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if entry == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	userID, _ := utils.GetUserIDFromContext(c)
+	if !utils.HasAnyRole(c, "manager", "admin_system") && entry.StudentID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this refund"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": entry})
+}
+
+type reviewRefundInput struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note"`
+}
+
+// PATCH /api/v1/protected/refunds/:id/review (manager)
+// Quản lý duyệt (approved) hoặc từ chối (rejected) báo giá hoàn phí
+func (h *RefundHandler) Review(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	reviewerID, _ := utils.GetUserIDFromContext(c)
+	var input reviewRefundInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	status := models.RefundStatus(input.Status)
+	if status != models.RefundStatusApproved && status != models.RefundStatusRejected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be 'approved' or 'rejected'"})
+		return
+	}
+	ctx := context.Background()
+	entry, err := h.Repo.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if entry == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if entry.Status != models.RefundStatusQuoted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund already reviewed"})
+		return
+	}
+	now := time.Now()
+	reviewed, err := h.Repo.Review(ctx, entry.ID, status, input.Note, reviewerID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !reviewed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Refund already reviewed"})
+		return
+	}
+	recordAudit(c, h.Audit, "refund.review", "refund", entry.ID,
+		gin.H{"status": entry.Status, "refund_amount": entry.RefundAmount},
+		gin.H{"status": status, "note": input.Note})
+	entry.Status = status
+	entry.Note = input.Note
+	entry.ApprovedBy = reviewerID
+	entry.ApprovedAt = &now
+	entry.UpdatedAt = now
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": entry})
+}
+
+type markRefundPaidInput struct {
+	PayoutReference string `json:"payout_reference" binding:"required"`
+}
+
+// PATCH /api/v1/protected/refunds/:id/paid (manager)
+// Ghi nhận đã chuyển tiền hoàn cho sinh viên
+func (h *RefundHandler) MarkPaid(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	var input markRefundPaidInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := context.Background()
+	entry, err := h.Repo.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if entry == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if entry.Status != models.RefundStatusApproved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only approved refunds can be marked as paid"})
+		return
+	}
+	now := time.Now()
+	paid, err := h.Repo.MarkPaid(ctx, entry.ID, input.PayoutReference, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !paid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Refund is no longer approved or already paid"})
+		return
+	}
+	recordAudit(c, h.Audit, "refund.mark_paid", "refund", entry.ID,
+		gin.H{"status": entry.Status},
+		gin.H{"status": models.RefundStatusPaid, "refund_amount": entry.RefundAmount, "payout_reference": input.PayoutReference})
+	entry.Status = models.RefundStatusPaid
+	entry.PayoutReference = input.PayoutReference
+	entry.PaidAt = &now
+	entry.UpdatedAt = now
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": entry})
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SupportThreadHandler quản lý hội thoại hỗ trợ 1:1 giữa sinh viên và cán bộ.
+// Tin nhắn gửi/nhận qua WebSocket chat (join_room "support:<id>"), lịch sử qua /chat/channels/support:<id>/messages.
+type SupportThreadHandler struct {
+	Repo         *repository.SupportThreadRepository
+	ChatRepo     *repository.ChatRepository
+	ContractRepo *repository.ContractRepository
+	AreaRepo     *repository.DormAreaRepository
+	DutyRepo     *repository.DutyScheduleRepository
+	WS           *service.WSService
+}
+
+func NewSupportThreadHandler(repo *repository.SupportThreadRepository, chatRepo *repository.ChatRepository, contractRepo *repository.ContractRepository,
+	areaRepo *repository.DormAreaRepository, dutyRepo *repository.DutyScheduleRepository, ws *service.WSService) *SupportThreadHandler {
+	return &SupportThreadHandler{Repo: repo, ChatRepo: chatRepo, ContractRepo: contractRepo, AreaRepo: areaRepo, DutyRepo: dutyRepo, WS: ws}
+}
+
+// threadEvent báo hội thoại thay đổi (mở mới, đổi cán bộ, đóng) để client cập nhật hộp thư
+func threadEvent(eventType string, t *models.SupportThread) gin.H {
+	return gin.H{"type": eventType, "room": t.Channel, "thread": t}
+}
+
+// notifyThreadParticipants gửi event tới kênh riêng của sinh viên và cán bộ phụ trách
+func (h *SupportThreadHandler) notifyThreadParticipants(event gin.H, t *models.SupportThread, extra ...string) {
+	sent := map[string]bool{}
+	for _, userID := range append([]string{t.StudentID, t.AssignedStaffID}, extra...) {
+		if userID != "" && !sent[userID] {
+			sent[userID] = true
+			h.WS.BroadcastToRoom(models.ChatUserChannel(userID), event, nil)
+		}
+	}
+}
+
+// loadThread lấy hội thoại theo :id và kiểm tra quyền xem (sinh viên mở hội thoại hoặc cán bộ), đã trả lỗi nếu không được
+func (h *SupportThreadHandler) loadThread(c *gin.Context) (*models.SupportThread, string, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, "", false
+	}
+	thread, err := h.Repo.GetByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+	if thread == nil || (thread.StudentID != userID && !utils.HasAnyRole(c, chatStaffRoles...)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "support thread not found"})
+		return nil, "", false
+	}
+	return thread, userID, true
+}
+
+type createSupportThreadInput struct {
+	Subject string `json:"subject" binding:"required"`
+	Content string `json:"content" binding:"required"` // tin nhắn đầu tiên
+}
+
+// POST /api/v1/protected/support-threads (student)
+// Mở hội thoại hỗ trợ, giao cho cán bộ đang trực ở khu. Không ai trực thì hội thoại chờ trong hộp thư chung của cán bộ.
+// Khu lấy theo preferred_dorm của đơn đã được duyệt thành hợp đồng, không tin khu do client gửi.
+func (h *SupportThreadHandler) Create(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var input createSupportThreadInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	subject := strings.TrimSpace(input.Subject)
+	content := strings.TrimSpace(input.Content)
+	if subject == "" || len(subject) > 200 || content == "" || len(content) > maxChatMessageLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "subject (max 200) and content (max 4000) are required"})
+		return
+	}
+	ctx := c.Request.Context()
+	contract, err := findApprovedContract(ctx, h.ContractRepo, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get contract", "details": err.Error()})
+		return
+	}
+	if contract == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only residents with an approved contract can open support threads"})
+		return
+	}
+	var area *models.DormArea
+	if contract.DormApplication != nil && contract.DormApplication.PreferredDorm != "" {
+		area, err = h.AreaRepo.GetByIDOrName(ctx, contract.DormApplication.PreferredDorm)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if area == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your contract is not linked to a dorm area"})
+		return
+	}
+
+	now := time.Now()
+	thread := &models.SupportThread{
+		ID:        uuid.NewString(),
+		StudentID: userID,
+		AreaID:    area.ID,
+		Subject:   subject,
+		Status:    models.SupportThreadStatusOpen,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	thread.Channel = models.ChatSupportChannel(thread.ID)
+	onDuty, err := h.DutyRepo.ListOnDuty(ctx, area.ID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check duty schedule", "details": err.Error()})
+		return
+	}
+	for _, ds := range onDuty {
+		if ds.Staff != nil {
+			thread.AssignedStaffID = ds.Staff.ID
+			break
+		}
+	}
+	if err := h.Repo.Create(ctx, thread); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	m := &models.ChatMessage{ID: uuid.NewString(), Channel: thread.Channel, SenderID: userID, Content: content, CreatedAt: now}
+	if err := h.ChatRepo.CreateMessage(ctx, m); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	thread.LastMessageAt = &m.CreatedAt
+	h.notifyThreadParticipants(threadEvent("support_thread_opened", thread), thread)
+	notifySupportMessage(c, h.WS, h.ChatRepo, h.Repo, thread, m)
+	if thread.AssignedStaffID == "" {
+		// Chưa ai nhận: báo cho cán bộ đang ở channel của khu
+		h.WS.BroadcastToRoom(models.ChatAreaChannel(area.ID), threadEvent("support_thread_waiting", thread), nil)
+	}
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "data": thread})
+}
+
+// GET /api/v1/protected/support-threads?all=true
+// Hộp thư hỗ trợ kèm số tin chưa đọc. Cán bộ: hội thoại mình phụ trách và hội thoại chưa ai nhận, all=true xem mọi hội thoại.
+func (h *SupportThreadHandler) Inbox(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	isStaff := utils.HasAnyRole(c, chatStaffRoles...)
+	threads, err := h.Repo.ListInbox(c.Request.Context(), userID, isStaff, isStaff && c.Query("all") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	unread := 0
+	for _, t := range threads {
+		unread += t.UnreadCount
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": threads, "unread_total": unread})
+}
+
+// GET /api/v1/protected/support-threads/:id
+func (h *SupportThreadHandler) Get(c *gin.Context) {
+	thread, userID, ok := h.loadThread(c)
+	if !ok {
+		return
+	}
+	n, err := h.ChatRepo.UnreadCount(c.Request.Context(), thread.Channel, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	thread.UnreadCount = n
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": thread})
+}
+
+// POST /api/v1/protected/support-threads/:id/take-over (manager/admin)
+// Cán bộ nhận hội thoại (chưa ai nhận hoặc đang do cán bộ khác phụ trách)
+func (h *SupportThreadHandler) TakeOver(c *gin.Context) {
+	if !utils.HasAnyRole(c, chatStaffRoles...) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	thread, userID, ok := h.loadThread(c)
+	if !ok {
+		return
+	}
+	if thread.Status != models.SupportThreadStatusOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": "support thread is closed"})
+		return
+	}
+	if thread.AssignedStaffID == userID {
+		c.JSON(http.StatusOK, gin.H{"ok": true, "data": thread})
+		return
+	}
+	previous := thread.AssignedStaffID
+	now := time.Now()
+	if err := h.Repo.Assign(c.Request.Context(), thread.ID, userID, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	thread.AssignedStaffID = userID
+	thread.UpdatedAt = now
+	event := threadEvent("support_thread_assigned", thread)
+	event["previous_staff_id"] = previous
+	h.WS.BroadcastToRoom(thread.Channel, event, nil)
+	h.notifyThreadParticipants(event, thread, previous)
+	pushUnread(c, h.WS, h.ChatRepo, thread.Channel, userID)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": thread})
+}
+
+// POST /api/v1/protected/support-threads/:id/close (sinh viên mở hội thoại hoặc cán bộ)
+func (h *SupportThreadHandler) Close(c *gin.Context) {
+	thread, _, ok := h.loadThread(c)
+	if !ok {
+		return
+	}
+	if thread.Status == models.SupportThreadStatusClosed {
+		c.JSON(http.StatusOK, gin.H{"ok": true, "data": thread})
+		return
+	}
+	now := time.Now()
+	if err := h.Repo.Close(c.Request.Context(), thread.ID, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	thread.Status = models.SupportThreadStatusClosed
+	thread.ClosedAt = &now
+	thread.UpdatedAt = now
+	event := threadEvent("support_thread_closed", thread)
+	h.WS.BroadcastToRoom(thread.Channel, event, nil)
+	h.notifyThreadParticipants(event, thread)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": thread})
+}
@@ -23,10 +23,10 @@ func NewTestHandler(cfg *config.Config, repo *repository.UserRepository) *testHa
 }
 
 func (h *testHandler) GetProfileHandler(c *gin.Context) {
-	logger.Info().Msg("Get profile request received")
+	logger.Ctx(c.Request.Context()).Info().Msg("Get profile request received")
 	claimsAny, exists := c.Get("user")
 	if !exists {
-		logger.Warn().Msg("Unauthorized: missing user claims in context")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: missing user claims in context")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized"))
 		return
 	}
@@ -48,33 +48,33 @@ func (h *testHandler) GetProfileHandler(c *gin.Context) {
 	}
 
 	if isAdmin {
-		logger.Info().Str("user_id", userID).Msg("Fetching manager profile")
+		logger.Ctx(c.Request.Context()).Info().Str("user_id", userID).Msg("Fetching manager profile")
 		profile, err := h.repo.GetManagerProfileByUserID(c.Request.Context(), userID)
 		if err != nil {
-			logger.Error().Err(err).Str("user_id", userID).Msg("Cannot get manager profile")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("user_id", userID).Msg("Cannot get manager profile")
 			c.JSON(500, models.ErrorResponse(500, "Cannot get manager profile"))
 			return
 		}
-		logger.Info().Str("user_id", userID).Msg("Manager profile fetched successfully")
+		logger.Ctx(c.Request.Context()).Info().Str("user_id", userID).Msg("Manager profile fetched successfully")
 		c.JSON(200, profile)
 	} else {
-		logger.Info().Str("user_id", userID).Msg("Fetching student profile")
+		logger.Ctx(c.Request.Context()).Info().Str("user_id", userID).Msg("Fetching student profile")
 		profile, err := h.repo.GetStudentProfileByUserID(c.Request.Context(), userID)
 		if err != nil {
-			logger.Error().Err(err).Str("user_id", userID).Msg("Cannot get student profile")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("user_id", userID).Msg("Cannot get student profile")
 			c.JSON(500, models.ErrorResponse(500, "Cannot get student profile"))
 			return
 		}
-		logger.Info().Str("user_id", userID).Msg("Student profile fetched successfully")
+		logger.Ctx(c.Request.Context()).Info().Str("user_id", userID).Msg("Student profile fetched successfully")
 		c.JSON(200, profile)
 	}
 }
 
 func (h *testHandler) SendEmailHandler(c *gin.Context) {
-	logger.Info().Msg("Send email request received")
+	logger.Ctx(c.Request.Context()).Info().Msg("Send email request received")
 	claimsAny, exists := c.Get("user")
 	if !exists {
-		logger.Warn().Msg("Unauthorized: missing user claims in context")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: missing user claims in context")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized"))
 		return
 	}
@@ -97,7 +97,7 @@ func (h *testHandler) SendEmailHandler(c *gin.Context) {
 
 	if isAdmin {
 		//  thực thi việc gửi email
-		logger.Info().Str("user_id", userID).Msg("User has permission to send emails")
+		logger.Ctx(c.Request.Context()).Info().Str("user_id", userID).Msg("User has permission to send emails")
 		//  Gửi email sử dụng cấu hình từ h.cfg.MailGoogle
 		// Thông tin cấu hình Gmail
 		smtpHost := h.cfg.MailGoogle.Host
@@ -108,7 +108,7 @@ func (h *testHandler) SendEmailHandler(c *gin.Context) {
 		// Tài khoản nhận cố định
 		recipient := "TrongNV.B21CN726@stu.ptit.edu.vn" // Thay bằng email thật
 
-		subject := "Subject: Test Email from Go\r\n"
+		subject := "Subject: Test Email from Go\r\n" + logger.RequestIDHeader + ": " + logger.RequestID(c.Request.Context()) + "\r\n"
 		body := "This is a test email sent from Go using Gmail SMTP."
 		msg := []byte(subject + "\r\n" + body)
 
@@ -116,12 +116,12 @@ func (h *testHandler) SendEmailHandler(c *gin.Context) {
 
 		err := smtp.SendMail(smtpHost+":"+smtpPort, auth, sender, []string{recipient}, msg)
 		if err != nil {
-			logger.Error().Err(err).Msg("Failed to send email")
+			logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Failed to send email")
 			c.JSON(500, models.ErrorResponse(500, "Failed to send email: "+err.Error()))
 			return
 		}
 
-		logger.Info().Str("user_id", userID).Msg("Email sent successfully")
+		logger.Ctx(c.Request.Context()).Info().Str("user_id", userID).Msg("Email sent successfully")
 		c.JSON(200, gin.H{"message": "Email sent successfully"})
 	} else {
 		//  user không có quyền gửi email
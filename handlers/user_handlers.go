@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/database"
 	"Backend_Dorm_PTIT/models"
 	"Backend_Dorm_PTIT/repository"
 	"Backend_Dorm_PTIT/utils"
@@ -15,6 +16,7 @@ import (
 type UserHandler struct {
 	config   *config.Config
 	userRepo *repository.UserRepository
+	Audit    *repository.AuditRepository
 }
 
 func NewUserHandler(cfg *config.Config, userRepo *repository.UserRepository) *UserHandler {
@@ -32,7 +34,7 @@ func (h *UserHandler) ListAllUsers(c *gin.Context) {
 
     claimsAny, exists := c.Get("user")
 	if !exists {
-		logger.Warn().Msg("Unauthorized: missing user claims in context")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: missing user claims in context")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized, missing user claims"))
 		return
 	}
@@ -52,7 +54,7 @@ func (h *UserHandler) ListAllUsers(c *gin.Context) {
 		}
 	}
 	if !isAdmin {
-		logger.Warn().Msg("Unauthorized: user does not have admin or manager role")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: user does not have admin or manager role")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized, you do not have the required permissions"))
 		return
 	}
@@ -104,7 +106,7 @@ func (h *UserHandler) UpdateAvatar(c *gin.Context) {
 	apiSecret := config.Cloudinary.Secret
 	folder := "avatars"
 	publicID := userID
-	url, err := utils.UploadToCloudinary(file, fileHeader, cloudName, apiKey, apiSecret, folder, publicID)
+	url, err := utils.UploadToCloudinary(c.Request.Context(), file, fileHeader, cloudName, apiKey, apiSecret, folder, publicID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "Upload avatar failed: "+err.Error()))
 		return
@@ -193,7 +195,7 @@ func (h *UserHandler) UpdateOwnManagerProfile(c *gin.Context) {
 	}
     claimsAny, exists := c.Get("user")
 	if !exists {
-		logger.Warn().Msg("Unauthorized: missing user claims in context")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: missing user claims in context")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized, missing user claims"))
 		return
 	}
@@ -213,7 +215,7 @@ func (h *UserHandler) UpdateOwnManagerProfile(c *gin.Context) {
 		}
 	}
 	if !isAdmin {
-		logger.Warn().Msg("Unauthorized: user does not have admin or manager role")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: user does not have admin or manager role")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized, you do not have the required permissions"))
 		return
 	}
@@ -276,7 +278,7 @@ type UpdateUserStatusRequest struct {
 func (h *UserHandler) UpdateUserStatus(c *gin.Context) {
 	claimsAny, exists := c.Get("user")
 	if !exists {
-		logger.Warn().Msg("Unauthorized: missing user claims in context")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: missing user claims in context")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized, missing user claims"))
 		return
 	}
@@ -296,7 +298,7 @@ func (h *UserHandler) UpdateUserStatus(c *gin.Context) {
 		}
 	}
 	if !isAdmin {
-		logger.Warn().Msg("Unauthorized: user does not have admin or manager role")
+		logger.Ctx(c.Request.Context()).Warn().Msg("Unauthorized: user does not have admin or manager role")
 		c.JSON(401, models.ErrorResponse(401, "Unauthorized, you do not have the required permissions"))
 		return
 	}
@@ -311,11 +313,20 @@ func (h *UserHandler) UpdateUserStatus(c *gin.Context) {
 		c.JSON(http.StatusNotFound, models.ErrorResponse(http.StatusNotFound, "User not found"))
 		return
 	}
+	prevStatus := user.Status
 	user.Status = req.Status
 	user.UpdatedAt = utils.Now()
 	if err := h.userRepo.UpdateStatus(c.Request.Context(), userID, user.Status, user.UpdatedAt); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, err.Error()))
 		return
 	}
+	// Tài khoản bị khoá thì thu hồi mọi phiên đăng nhập đang hoạt động
+	if user.Status != "active" {
+		if err := database.DeleteAllTokensByUserID(userID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse(http.StatusInternalServerError, "User status updated but failed to revoke sessions"))
+			return
+		}
+	}
+	recordAudit(c, h.Audit, "user.update_status", "user", userID, gin.H{"status": prevStatus}, gin.H{"status": user.Status})
 	c.JSON(http.StatusOK, models.SuccessResponseWithMessage("User status updated", nil))
 }
@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultVisitingStart    = "07:00"
+	defaultVisitingEnd      = "21:30"
+	defaultPassEarlyMinutes = 30
+	defaultMaxVisitHours    = 24
+)
+
+type VisitorHandler struct {
+	Repo         *repository.VisitorRepository
+	ContractRepo *repository.ContractRepository
+	DutyRepo     *repository.DutyScheduleRepository
+	Audit        *repository.AuditRepository
+	cfg          *config.Config
+}
+
+func NewVisitorHandler(repo *repository.VisitorRepository, contractRepo *repository.ContractRepository, dutyRepo *repository.DutyScheduleRepository, cfg *config.Config) *VisitorHandler {
+	return &VisitorHandler{Repo: repo, ContractRepo: contractRepo, DutyRepo: dutyRepo, cfg: cfg}
+}
+
+// parseVisitTime nhận YYYY-MM-DDTHH:MM (giờ địa phương) hoặc RFC3339
+func parseVisitTime(raw string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02T15:04", raw, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// policy ghép quy định riêng của khu với cấu hình mặc định. found = false nếu khu không tồn tại.
+func (h *VisitorHandler) policy(ctx context.Context, areaID string) (service.VisitPolicy, bool, error) {
+	rules, found, err := h.Repo.GetRules(ctx, areaID)
+	if err != nil || !found {
+		return service.VisitPolicy{}, found, err
+	}
+	def := h.cfg.Visitor
+	p := service.VisitPolicy{
+		VisitingStart:     firstNonEmpty(rules.VisitingStart, def.VisitingStart, defaultVisitingStart),
+		VisitingEnd:       firstNonEmpty(rules.VisitingEnd, def.VisitingEnd, defaultVisitingEnd),
+		OvernightGuestCap: def.OvernightGuestCap,
+		MaxDuration:       time.Duration(defaultMaxVisitHours) * time.Hour,
+	}
+	if rules.OvernightGuestCap >= 0 {
+		p.OvernightGuestCap = rules.OvernightGuestCap
+	}
+	if def.MaxVisitDurationHrs > 0 {
+		p.MaxDuration = time.Duration(def.MaxVisitDurationHrs) * time.Hour
+	}
+	return p, true, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// checkOvernightCap kiểm tra số khách ở qua đêm trong khu còn chỗ hay không
+func (h *VisitorHandler) checkOvernightCap(ctx context.Context, v *models.VisitorRequest, p service.VisitPolicy) (bool, error) {
+	if !v.Overnight {
+		return true, nil
+	}
+	n, err := h.Repo.CountOvernightGuests(ctx, v.AreaID, v.VisitStart, v.VisitEnd, v.ID)
+	if err != nil {
+		return false, err
+	}
+	return n < p.OvernightGuestCap, nil
+}
+
+type createVisitorInput struct {
+	AreaID     string `json:"area_id" binding:"required"`
+	GuestName  string `json:"guest_name" binding:"required"`
+	GuestCCCD  string `json:"guest_cccd" binding:"required"`
+	GuestPhone string `json:"guest_phone"`
+	VisitStart string `json:"visit_start" binding:"required"` // YYYY-MM-DDTHH:MM
+	VisitEnd   string `json:"visit_end" binding:"required"`
+}
+
+// POST /api/v1/protected/visitors (student)
+// Sinh viên đăng ký trước khách thăm
+func (h *VisitorHandler) Create(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var input createVisitorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, err := parseVisitTime(input.VisitStart)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid visit_start format, must be YYYY-MM-DDTHH:MM"})
+		return
+	}
+	end, err := parseVisitTime(input.VisitEnd)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid visit_end format, must be YYYY-MM-DDTHH:MM"})
+		return
+	}
+
+	ctx := context.Background()
+	contract, err := findApprovedContract(ctx, h.ContractRepo, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get contract", "details": err.Error()})
+		return
+	}
+	if contract == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only residents with an approved contract can register visitors"})
+		return
+	}
+	p, found, err := h.policy(ctx, input.AreaID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get visiting rules", "details": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dorm area not found"})
+		return
+	}
+	overnight, err := service.CheckVisitWindow(start, end, time.Now(), p)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	v := &models.VisitorRequest{
+		ID:         uuid.New().String(),
+		StudentID:  userID,
+		ContractID: contract.ID.String(),
+		AreaID:     input.AreaID,
+		Room:       contract.Room,
+		GuestName:  strings.TrimSpace(input.GuestName),
+		GuestCCCD:  strings.TrimSpace(input.GuestCCCD),
+		GuestPhone: input.GuestPhone,
+		VisitStart: start,
+		VisitEnd:   end,
+		Overnight:  overnight,
+		Status:     models.VisitorStatusPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	ok, err := h.checkOvernightCap(ctx, v, p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "Overnight guest limit reached for this area"})
+		return
+	}
+	if err := h.Repo.Create(ctx, v); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": v})
+}
+
+// GET /api/v1/protected/visitors/me (student)
+func (h *VisitorHandler) ListMine(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	visitors, err := h.Repo.ListByStudentID(context.Background(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": visitors})
+}
+
+// GET /api/v1/protected/visitors?status=pending&area_id= (manager)
+func (h *VisitorHandler) List(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	visitors, err := h.Repo.List(context.Background(), c.Query("status"), c.Query("area_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": visitors})
+}
+
+// PATCH /api/v1/protected/visitors/:id/cancel (student)
+func (h *VisitorHandler) Cancel(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil || userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	ctx := context.Background()
+	v, err := h.Repo.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if v == nil || v.StudentID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if v.Status != models.VisitorStatusPending && v.Status != models.VisitorStatusApproved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only pending or approved visits can be cancelled"})
+		return
+	}
+	now := time.Now()
+	if err := h.Repo.UpdateStatus(ctx, v.ID, models.VisitorStatusCancelled, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	v.Status = models.VisitorStatusCancelled
+	v.UpdatedAt = now
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": v})
+}
+
+type reviewVisitorInput struct {
+	Status      string `json:"status" binding:"required"`
+	ManagerNote string `json:"manager_note"`
+}
+
+// PATCH /api/v1/protected/visitors/:id/review (manager on duty)
+// Chỉ quản túc đang trực ở khu (theo lịch trực) được duyệt; duyệt thì cấp mã vào cổng
+func (h *VisitorHandler) Review(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	managerID, _ := utils.GetUserIDFromContext(c)
+	var input reviewVisitorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Status != models.VisitorStatusApproved && input.Status != models.VisitorStatusRejected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be 'approved' or 'rejected'"})
+		return
+	}
+	ctx := context.Background()
+	v, err := h.Repo.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if v == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if v.Status != models.VisitorStatusPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request already processed"})
+		return
+	}
+
+	if !utils.HasAnyRole(c, "admin_system") {
+		onDuty, err := h.DutyRepo.ListOnDuty(ctx, v.AreaID, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check duty schedule", "details": err.Error()})
+			return
+		}
+		isOnDuty := false
+		for _, ds := range onDuty {
+			if ds.Staff != nil && ds.Staff.ID == managerID {
+				isOnDuty = true
+				break
+			}
+		}
+		if !isOnDuty {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the manager on duty in this area can review visitor requests"})
+			return
+		}
+	}
+
+	if input.Status == models.VisitorStatusApproved {
+		p, _, err := h.policy(ctx, v.AreaID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get visiting rules", "details": err.Error()})
+			return
+		}
+		ok, err := h.checkOvernightCap(ctx, v, p)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusConflict, gin.H{"error": "Overnight guest limit reached for this area"})
+			return
+		}
+		v.PassCode, err = service.GeneratePassCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate pass code"})
+			return
+		}
+	}
+
+	now := time.Now()
+	v.Status = input.Status
+	v.ReviewedBy = managerID
+	v.ReviewedAt = &now
+	v.ManagerNote = input.ManagerNote
+	v.UpdatedAt = now
+	updated, err := h.Repo.Review(ctx, v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !updated {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request already processed"})
+		return
+	}
+	// Không ghi pass code vào nhật ký, đó là mã vào cổng
+	recordAudit(c, h.Audit, "visitor_request.review", "visitor_request", v.ID,
+		gin.H{"status": models.VisitorStatusPending},
+		gin.H{"status": v.Status, "manager_note": v.ManagerNote, "reviewed_by": v.ReviewedBy})
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": v})
+}
+
+type visitorPassInput struct {
+	PassCode string `json:"pass_code" binding:"required"`
+}
+
+// bindPass đọc mã vào cổng và lấy đăng ký tương ứng, tự trả lỗi nếu không hợp lệ
+func (h *VisitorHandler) bindPass(c *gin.Context) *models.VisitorRequest {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return nil
+	}
+	var input visitorPassInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil
+	}
+	v, err := h.Repo.GetByPassCode(context.Background(), strings.ToUpper(strings.TrimSpace(input.PassCode)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if v == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid pass code"})
+		return nil
+	}
+	return v
+}
+
+// POST /api/v1/protected/visitors/check-in (manager)
+// Ghi nhận khách đến, mã chỉ dùng được trong khung giờ đã đăng ký
+func (h *VisitorHandler) CheckIn(c *gin.Context) {
+	v := h.bindPass(c)
+	if v == nil {
+		return
+	}
+	if v.Status != models.VisitorStatusApproved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pass is not valid for check-in", "status": v.Status})
+		return
+	}
+	early := h.cfg.Visitor.PassEarlyMinutes
+	if early <= 0 {
+		early = defaultPassEarlyMinutes
+	}
+	now := time.Now()
+	if now.Before(v.VisitStart.Add(-time.Duration(early)*time.Minute)) || !now.Before(v.VisitEnd) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pass is outside of the registered visit window", "visit_start": v.VisitStart, "visit_end": v.VisitEnd})
+		return
+	}
+	if err := h.Repo.MarkArrived(context.Background(), v.ID, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	v.Status = models.VisitorStatusCheckedIn
+	v.ArrivedAt = &now
+	v.UpdatedAt = now
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": v})
+}
+
+// POST /api/v1/protected/visitors/check-out (manager)
+func (h *VisitorHandler) CheckOut(c *gin.Context) {
+	v := h.bindPass(c)
+	if v == nil {
+		return
+	}
+	if v.Status != models.VisitorStatusCheckedIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Visitor has not checked in", "status": v.Status})
+		return
+	}
+	now := time.Now()
+	if err := h.Repo.MarkDeparted(context.Background(), v.ID, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if now.After(v.VisitEnd) {
+		logger.Ctx(c.Request.Context()).Warn().Str("visitor_id", v.ID).Time("visit_end", v.VisitEnd).Msg("Visitor checked out after registered visit window")
+	}
+	v.Status = models.VisitorStatusCheckedOut
+	v.DepartedAt = &now
+	v.UpdatedAt = now
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": v, "overstayed": now.After(v.VisitEnd)})
+}
+
+type setVisitingRulesInput struct {
+	VisitingStart     string `json:"visiting_start"` // HH:MM, để trống dùng mặc định
+	VisitingEnd       string `json:"visiting_end"`
+	OvernightGuestCap *int   `json:"overnight_guest_cap"` // null dùng mặc định, 0 = không cho ở qua đêm
+}
+
+// PATCH /api/v1/protected/dorm-area/:id/visiting-rules (manager/admin)
+func (h *VisitorHandler) SetRules(c *gin.Context) {
+	if !utils.HasAnyRole(c, "manager", "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	var input setVisitingRulesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, hhmm := range []string{input.VisitingStart, input.VisitingEnd} {
+		if hhmm == "" {
+			continue
+		}
+		if err := service.ValidateClock(hhmm); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	rules := &models.VisitingRules{
+		AreaID:            c.Param("id"),
+		VisitingStart:     input.VisitingStart,
+		VisitingEnd:       input.VisitingEnd,
+		OvernightGuestCap: -1,
+	}
+	if input.OvernightGuestCap != nil {
+		if *input.OvernightGuestCap < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "overnight_guest_cap must not be negative"})
+			return
+		}
+		rules.OvernightGuestCap = *input.OvernightGuestCap
+	}
+	ctx := context.Background()
+	prev, found, err := h.Repo.GetRules(ctx, rules.AreaID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dorm area not found"})
+		return
+	}
+	if err := h.Repo.SetRules(ctx, rules); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, h.Audit, "dorm_area.set_visiting_rules", "dorm_area", rules.AreaID, prev, rules)
+	p, _, err := h.policy(ctx, rules.AreaID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": rules, "effective": gin.H{
+		"visiting_start":      p.VisitingStart,
+		"visiting_end":        p.VisitingEnd,
+		"overnight_guest_cap": p.OvernightGuestCap,
+	}})
+}
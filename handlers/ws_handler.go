@@ -4,16 +4,18 @@ import (
 	"Backend_Dorm_PTIT/config"
 	"Backend_Dorm_PTIT/constants"
 	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
 	"Backend_Dorm_PTIT/repository"
 	"Backend_Dorm_PTIT/service"
 	"Backend_Dorm_PTIT/utils"
 	"context"
 	"encoding/json"
 	"net/http"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -21,6 +23,10 @@ type WSHandler struct {
 	cfg          *config.Config
 	wsSvc        *service.WSService
 	contractRepo *repository.ContractRepository
+	ChatRepo     *repository.ChatRepository
+	AreaRepo     *repository.DormAreaRepository
+	SupportRepo  *repository.SupportThreadRepository
+	NotifyRepo   *repository.NotificationRepository
 }
 
 func NewWSHandler(cfg *config.Config, wsSvc *service.WSService, contractRepo *repository.ContractRepository) *WSHandler {
@@ -33,144 +39,173 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// newClient bọc connection đã upgrade: cài deadline đọc theo pong và chạy goroutine ghi duy nhất (WritePump).
+// Sau đó chỉ goroutine đọc được dùng connection trực tiếp, mọi thao tác ghi đi qua client.
+func (h *WSHandler) newClient(c *gin.Context, conn *websocket.Conn, userID string) *service.WSClient {
+	client := service.NewWSClient(c.Request.Context(), conn, userID, h.cfg.WebSocket)
+	pongWait := time.Duration(h.cfg.WebSocket.PongWait) * time.Second
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	go client.WritePump()
+	return client
+}
+
+// HandleWSAdmin stream log hệ thống cho admin_system từ LogHub. Filter lấy từ query như GET /logs/stream:
+// gửi backfill các dòng gần nhất khớp filter rồi từng dòng mới, mỗi message là một object JSON.
 func (h *WSHandler) HandleWSAdmin(c *gin.Context) {
+	if !utils.HasAnyRole(c, "admin_system") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you do not have the required permissions"})
+		return
+	}
+	filter, backfill, err := logFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		logger.Error().Err(err).Msg("WebSocket upgrade failed")
+		logger.Ctx(c.Request.Context()).Error().Err(err).Msg("WebSocket upgrade failed")
 		return
 	}
 	defer conn.Close()
 	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
-		logger.Error().Err(err).Msg("Unauthorized WebSocket connection attempt")
+		logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Unauthorized WebSocket connection attempt")
 		conn.WriteMessage(websocket.TextMessage, []byte("Unauthorized: "+err.Error()))
 		return
 	}
 
-	conn.SetReadDeadline(time.Now().Add(time.Duration(h.cfg.WebSocket.PongWait) * time.Second))
-	conn.SetPongHandler(func(string) error {
-		logger.Info().Msgf("Pong received from user %s", userID)
-		conn.SetReadDeadline(time.Now().Add(time.Duration(h.cfg.WebSocket.PongWait) * time.Second))
-		return nil
-	})
-
-	h.wsSvc.AddConnection(userID, conn)
+	client := h.newClient(c, conn, userID)
+	h.wsSvc.AddConnection(userID, client)
 	defer func() {
-		h.wsSvc.RemoveConnection(userID, conn)
+		h.wsSvc.RemoveConnection(userID, client)
 	}()
 
-	done := make(chan struct{})
-	var onceClose sync.Once
+	hub := service.GetLogHub()
+	entries, sub := hub.Subscribe(filter, backfill)
+	defer hub.Unsubscribe(sub)
+	for _, e := range entries {
+		client.Send(e.Raw)
+	}
 
-	// Goroutine: gửi ping định kỳ
+	// Goroutine: chuyển log mới từ hub sang client, dừng khi client bị ngắt hoặc huỷ đăng ký
 	go func() {
-		ticker := time.NewTicker(time.Duration(h.cfg.WebSocket.PingPeriod) * time.Second)
-		defer ticker.Stop()
 		for {
 			select {
-			case <-ticker.C:
-				conn.SetWriteDeadline(time.Now().Add(time.Duration(h.cfg.WebSocket.WriteWait) * time.Second))
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					logger.Error().Err(err).Msg("Ping failed, closing connection")
-					onceClose.Do(func() { close(done) })
+			case e, ok := <-sub.C:
+				if !ok || !client.Send(e.Raw) {
 					return
-				} else {
-					logger.Info().Msgf("Ping sent to user %s", userID)
 				}
-			case <-done:
+			case <-client.Done():
 				return
 			}
 		}
 	}()
 
-	// Goroutine: stream log hệ thống về client, dừng bằng context
-	logPath := h.cfg.Logging.FilePath
-	ctx, cancel := context.WithCancel(c.Request.Context())
-	defer cancel()
-	go service.StartTailLogFile(ctx, logPath, func(line string) {
-		conn.SetWriteDeadline(time.Now().Add(time.Duration(h.cfg.WebSocket.WriteWait) * time.Second))
-		if err := conn.WriteMessage(websocket.TextMessage, []byte(line)); err != nil {
-			logger.Error().Err(err).Msg("Send log to ws client failed")
-			onceClose.Do(func() { cancel(); close(done) })
-		}
-	})
-
 	for {
 		messageType, message, err := conn.ReadMessage()
 		if err != nil {
-			logger.Info().Msgf("User %s disconnected", userID)
-			onceClose.Do(func() { cancel(); close(done) })
+			logger.Ctx(c.Request.Context()).Info().Msgf("User %s disconnected", userID)
 			return
 		}
 		if messageType == websocket.TextMessage && string(message) == constants.HeartbeatCheck {
-			conn.WriteMessage(websocket.TextMessage, []byte(constants.HeartbeatAck))
+			client.Send([]byte(constants.HeartbeatAck))
 			continue
 		}
 	}
 }
 
+// --- Notifications over WebSocket ---
+
+// HandleWSNotifications chỉ nhận thông báo (kênh riêng user:<id>), dành cho client không mở chat.
+// Khi kết nối gửi ngay số thông báo chưa đọc, sau đó mỗi thông báo mới là một event "notification".
+func (h *WSHandler) HandleWSNotifications(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Msg("WebSocket upgrade failed (notifications)")
+		return
+	}
+	defer conn.Close()
+
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Unauthorized WebSocket notification connection attempt")
+		conn.WriteMessage(websocket.TextMessage, []byte("Unauthorized: "+err.Error()))
+		return
+	}
+
+	client := h.newClient(c, conn, userID)
+	h.wsSvc.JoinRoom(models.ChatUserChannel(userID), userID, client)
+	defer func() {
+		h.wsSvc.LeaveAllRooms(client)
+		client.Close()
+	}()
+
+	if h.NotifyRepo != nil {
+		if unread, err := h.NotifyRepo.CountUnread(c.Request.Context(), userID); err == nil {
+			client.SendJSON(gin.H{"type": "unread_notifications", "unread_count": unread})
+		}
+	}
+
+	for {
+		messageType, payload, err := conn.ReadMessage()
+		if err != nil {
+			logger.Ctx(c.Request.Context()).Info().Msgf("Notification WS user %s disconnected: %v", userID, err)
+			return
+		}
+		if messageType == websocket.TextMessage && string(payload) == constants.HeartbeatCheck {
+			client.Send([]byte(constants.HeartbeatAck))
+		}
+	}
+}
+
 // --- Chat over WebSocket ---
 
 type ChatClientMessage struct {
-	Type    string `json:"type"` // join_room, leave_room, chat_message
-	Room    string `json:"room"`
-	Content string `json:"content"`
+	Type      string `json:"type"` // join_room, leave_room, chat_message, typing, read, edit_message, delete_message
+	Room      string `json:"room"` // channel: room:<id khu>:<phòng>, area:<id khu> hoặc support:<id>
+	Content   string `json:"content"`
+	MessageID string `json:"message_id"` // dùng cho read, edit_message, delete_message
 }
 
 // HandleWSChat quản lý kết nối chat (nhiều room trên 1 connection)
 func (h *WSHandler) HandleWSChat(c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		logger.Error().Err(err).Msg("WebSocket upgrade failed (chat)")
+		logger.Ctx(c.Request.Context()).Error().Err(err).Msg("WebSocket upgrade failed (chat)")
 		return
 	}
 	defer conn.Close()
 
 	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
-		logger.Error().Err(err).Msg("Unauthorized WebSocket chat connection attempt")
+		logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Unauthorized WebSocket chat connection attempt")
 		conn.WriteMessage(websocket.TextMessage, []byte("Unauthorized: "+err.Error()))
 		return
 	}
 
-	conn.SetReadDeadline(time.Now().Add(time.Duration(h.cfg.WebSocket.PongWait) * time.Second))
-	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(time.Duration(h.cfg.WebSocket.PongWait) * time.Second))
-		return nil
-	})
+	client := h.newClient(c, conn, userID)
 
-	done := make(chan struct{})
-	var onceClose sync.Once
+	// Kênh riêng nhận số tin chưa đọc và thông báo hộp thư
+	h.wsSvc.JoinRoom(models.ChatUserChannel(userID), userID, client)
 
-	// Goroutine: gửi ping định kỳ
-	go func() {
-		ticker := time.NewTicker(time.Duration(h.cfg.WebSocket.PingPeriod) * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				conn.SetWriteDeadline(time.Now().Add(time.Duration(h.cfg.WebSocket.WriteWait) * time.Second))
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					logger.Error().Err(err).Msg("Ping failed, closing chat connection")
-					onceClose.Do(func() { close(done) })
-					return
-				}
-			case <-done:
-				return
+	defer func() {
+		for _, room := range h.wsSvc.LeaveAllRooms(client) {
+			if !strings.HasPrefix(room, models.ChatChannelUserPrefix) {
+				h.broadcastOffline(c.Request.Context(), room, userID)
 			}
 		}
-	}()
-
-	defer func() {
-		h.wsSvc.LeaveAllRooms(conn)
-		onceClose.Do(func() { close(done) })
+		client.Close()
 	}()
 
 	for {
 		messageType, payload, err := conn.ReadMessage()
 		if err != nil {
-			logger.Info().Msgf("Chat WS user %s disconnected: %v", userID, err)
+			logger.Ctx(c.Request.Context()).Info().Msgf("Chat WS user %s disconnected: %v", userID, err)
 			return
 		}
 		if messageType != websocket.TextMessage {
@@ -179,56 +214,163 @@ func (h *WSHandler) HandleWSChat(c *gin.Context) {
 
 		// Heartbeat đơn giản
 		if string(payload) == constants.HeartbeatCheck {
-			conn.WriteMessage(websocket.TextMessage, []byte(constants.HeartbeatAck))
+			client.Send([]byte(constants.HeartbeatAck))
 			continue
 		}
 
 		var msg ChatClientMessage
 		if err := json.Unmarshal(payload, &msg); err != nil {
-			logger.Error().Err(err).Msg("Invalid chat message JSON")
-			conn.WriteJSON(map[string]string{
+			logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Invalid chat message JSON")
+			client.SendJSON(map[string]string{
 				"type":  "error",
 				"error": "invalid_message",
 			})
 			continue
 		}
 
+		msg.Room = models.NormalizeChatChannel(msg.Room)
+		if strings.HasPrefix(msg.Room, models.ChatChannelUserPrefix) {
+			client.SendJSON(map[string]string{"type": "error", "error": "not_allowed", "room": msg.Room})
+			continue
+		}
+		if msg.Type != "join_room" && msg.Type != "leave_room" && !h.wsSvc.InRoom(msg.Room, client) {
+			client.SendJSON(map[string]string{"type": "error", "error": "not_joined", "room": msg.Room})
+			continue
+		}
+
 		switch msg.Type {
 		case "join_room":
 			if msg.Room == "" {
-				conn.WriteJSON(map[string]string{"type": "error", "error": "room_required"})
+				client.SendJSON(map[string]string{"type": "error", "error": "room_required"})
 				continue
 			}
-			// Chỉ sinh viên có hợp đồng approved ở phòng đó mới được join
-			ok, err := h.contractRepo.HasApprovedContractInRoom(c.Request.Context(), userID, msg.Room)
+			// Sinh viên chỉ vào phòng mình có hợp đồng approved, cán bộ vào channel khu
+			ok, err := authorizeChatChannel(c, h.contractRepo, h.AreaRepo, h.SupportRepo, userID, msg.Room)
 			if err != nil {
-				logger.Error().Err(err).Msg("check HasApprovedContractInRoom failed")
-				conn.WriteJSON(map[string]string{"type": "error", "error": "internal_error"})
+				logger.Ctx(c.Request.Context()).Error().Err(err).Str("room", msg.Room).Msg("authorize chat channel failed")
+				client.SendJSON(map[string]string{"type": "error", "error": "internal_error"})
 				continue
 			}
 			if !ok {
-				conn.WriteJSON(map[string]string{"type": "error", "error": "not_allowed"})
+				client.SendJSON(map[string]string{"type": "error", "error": "not_allowed", "room": msg.Room})
 				continue
 			}
-			h.wsSvc.JoinRoom(msg.Room, userID, conn)
-			conn.WriteJSON(map[string]string{"type": "joined", "room": msg.Room})
+			h.wsSvc.JoinRoom(msg.Room, userID, client)
+			online, err := h.wsSvc.OnlineUsers(c.Request.Context(), msg.Room)
+			if err != nil {
+				logger.Ctx(c.Request.Context()).Error().Err(err).Str("room", msg.Room).Msg("list room presence failed")
+			}
+			client.SendJSON(gin.H{"type": "joined", "room": msg.Room, "online": online})
+			h.wsSvc.BroadcastToRoom(msg.Room, map[string]string{"type": "presence", "room": msg.Room, "user_id": userID, "status": "online"}, client)
 
 		case "leave_room":
 			if msg.Room == "" {
 				continue
 			}
-			h.wsSvc.LeaveRoom(msg.Room, conn)
-			conn.WriteJSON(map[string]string{"type": "left", "room": msg.Room})
+			h.wsSvc.LeaveRoom(msg.Room, client)
+			client.SendJSON(map[string]string{"type": "left", "room": msg.Room})
+			h.broadcastOffline(c.Request.Context(), msg.Room, userID)
 
 		case "chat_message":
-			if msg.Room == "" || msg.Content == "" {
+			content := strings.TrimSpace(msg.Content)
+			if content == "" {
+				continue
+			}
+			if len(content) > maxChatMessageLen {
+				client.SendJSON(map[string]string{"type": "error", "error": "message_too_long"})
+				continue
+			}
+			var thread *models.SupportThread
+			if strings.HasPrefix(msg.Room, models.ChatChannelSupportPrefix) {
+				thread, err = h.SupportRepo.GetByID(c.Request.Context(), strings.TrimPrefix(msg.Room, models.ChatChannelSupportPrefix))
+				if err != nil || thread == nil {
+					client.SendJSON(map[string]string{"type": "error", "error": "internal_error"})
+					continue
+				}
+				if thread.Status == models.SupportThreadStatusClosed {
+					client.SendJSON(map[string]string{"type": "error", "error": "thread_closed", "room": msg.Room})
+					continue
+				}
+			}
+			m := &models.ChatMessage{ID: uuid.NewString(), Channel: msg.Room, SenderID: userID, Content: content, CreatedAt: time.Now()}
+			if err := h.ChatRepo.CreateMessage(c.Request.Context(), m); err != nil {
+				logger.Ctx(c.Request.Context()).Error().Err(err).Str("room", msg.Room).Msg("save chat message failed")
+				client.SendJSON(map[string]string{"type": "error", "error": "internal_error"})
+				continue
+			}
+			h.wsSvc.BroadcastToRoom(msg.Room, chatMessageEvent(m), nil)
+			if thread != nil {
+				notifySupportMessage(c, h.wsSvc, h.ChatRepo, h.SupportRepo, thread, m)
+			}
+
+		case "typing":
+			// Không lưu, chỉ báo cho những người khác trong room
+			h.wsSvc.BroadcastToRoom(msg.Room, map[string]string{"type": "typing", "room": msg.Room, "from": userID}, client)
+
+		case "read":
+			receipt, _, errMsg := markChatRead(c, h.ChatRepo, msg.Room, userID, msg.MessageID)
+			if receipt == nil {
+				client.SendJSON(map[string]string{"type": "error", "error": errMsg})
 				continue
 			}
-			// Không cần check lại quyền nếu đã join room, nhưng có thể check bổ sung nếu muốn
-			h.wsSvc.BroadcastToRoom(msg.Room, userID, msg.Content)
+			h.wsSvc.BroadcastToRoom(msg.Room, readReceiptEvent(receipt), nil)
+			pushUnread(c, h.wsSvc, h.ChatRepo, msg.Room, userID)
+
+		case "edit_message", "delete_message":
+			existing, err := h.ChatRepo.GetMessage(c.Request.Context(), msg.MessageID)
+			if err != nil {
+				logger.Ctx(c.Request.Context()).Error().Err(err).Msg("get chat message failed")
+				client.SendJSON(map[string]string{"type": "error", "error": "internal_error"})
+				continue
+			}
+			if existing == nil || existing.Channel != msg.Room || existing.DeletedAt != nil {
+				client.SendJSON(map[string]string{"type": "error", "error": "message_not_found"})
+				continue
+			}
+			// Chỉ người gửi được sửa; người gửi hoặc cán bộ được xoá
+			if existing.SenderID != userID && (msg.Type == "edit_message" || !utils.HasAnyRole(c, chatStaffRoles...)) {
+				client.SendJSON(map[string]string{"type": "error", "error": "not_allowed"})
+				continue
+			}
+			now := time.Now()
+			if msg.Type == "edit_message" {
+				content := strings.TrimSpace(msg.Content)
+				if content == "" || len(content) > maxChatMessageLen {
+					client.SendJSON(map[string]string{"type": "error", "error": "invalid_content"})
+					continue
+				}
+				err = h.ChatRepo.EditMessage(c.Request.Context(), existing.ID, content, now)
+				if err == nil {
+					h.wsSvc.BroadcastToRoom(msg.Room, gin.H{"type": "message_edited", "room": msg.Room, "id": existing.ID, "content": content, "edited_at": now}, nil)
+				}
+			} else {
+				err = h.ChatRepo.DeleteMessage(c.Request.Context(), existing.ID, now)
+				if err == nil {
+					h.wsSvc.BroadcastToRoom(msg.Room, gin.H{"type": "message_deleted", "room": msg.Room, "id": existing.ID, "deleted_by": userID, "deleted_at": now}, nil)
+				}
+			}
+			if err != nil {
+				logger.Ctx(c.Request.Context()).Error().Err(err).Str("message_id", existing.ID).Msg("update chat message failed")
+				client.SendJSON(map[string]string{"type": "error", "error": "internal_error"})
+			}
 
 		default:
-			conn.WriteJSON(map[string]string{"type": "error", "error": "unknown_type"})
+			client.SendJSON(map[string]string{"type": "error", "error": "unknown_type"})
+		}
+	}
+}
+
+// broadcastOffline báo user đã rời room, bỏ qua nếu user còn connection khác trong room (kể cả ở instance khác)
+func (h *WSHandler) broadcastOffline(ctx context.Context, room, userID string) {
+	online, err := h.wsSvc.OnlineUsers(context.Background(), room)
+	if err != nil {
+		logger.Ctx(ctx).Error().Err(err).Str("room", room).Msg("list room presence failed")
+		return
+	}
+	for _, id := range online {
+		if id == userID {
+			return
 		}
 	}
+	h.wsSvc.BroadcastToRoom(room, map[string]string{"type": "presence", "room": room, "user_id": userID, "status": "offline"}, nil)
 }
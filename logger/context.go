@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+// RequestIDHeader is the header carrying the request correlation ID (incoming, response and outbound calls)
+const RequestIDHeader = "X-Request-ID"
+
+type requestScopeKey struct{}
+
+type requestScope struct {
+	id     string
+	logger zerolog.Logger
+}
+
+// WithRequestID returns a context carrying the request ID and a logger that adds request_id to every entry
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestScopeKey{}, &requestScope{
+		id:     requestID,
+		logger: Logger.With().Str("request_id", requestID).Logger(),
+	})
+}
+
+// RequestID returns the request ID stored in ctx, or "" outside a request
+func RequestID(ctx context.Context) string {
+	if scope, ok := ctx.Value(requestScopeKey{}).(*requestScope); ok {
+		return scope.id
+	}
+	return ""
+}
+
+// Ctx returns the request-scoped logger stored in ctx, or the global logger outside a request
+func Ctx(ctx context.Context) *zerolog.Logger {
+	if ctx != nil {
+		if scope, ok := ctx.Value(requestScopeKey{}).(*requestScope); ok {
+			return &scope.logger
+		}
+	}
+	return &Logger
+}
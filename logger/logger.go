@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -20,6 +21,54 @@ type LogConfig struct {
 	FilePath string `mapstructure:"file_path"` // path to log file (when output=file)
 	MaxSize  int    `mapstructure:"max_size"`  // max size in megabytes before rotation (default: 100MB)
 	MaxAge   int    `mapstructure:"max_age"`   // max age in days to retain old log files (default: 30 days)
+	Backlog  int    `mapstructure:"backlog"`   // number of recent entries kept in memory for admin log streaming (default: 1000)
+}
+
+// MaxBackups is the number of rotated log files kept (older ones are deleted)
+const MaxBackups = 10
+
+// Rotation returns max size (MB) and max age (days) of log files with defaults applied
+func (cfg *LogConfig) Rotation() (maxSize, maxAge int) {
+	maxSize = cfg.MaxSize
+	if maxSize == 0 {
+		maxSize = 100 // 100MB default
+	}
+	maxAge = cfg.MaxAge
+	if maxAge == 0 {
+		maxAge = 30 // 30 days default
+	}
+	return maxSize, maxAge
+}
+
+// sinkWriter forwards a copy of every JSON log line to the registered sinks.
+// zerolog hooks cannot read the fields already added to an event, so sinks tap the writer instead.
+type sinkWriter struct {
+	mu    sync.RWMutex
+	sinks []func([]byte)
+}
+
+var sinks = &sinkWriter{}
+
+func (w *sinkWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if len(w.sinks) == 0 {
+		return len(p), nil
+	}
+	// zerolog reuses the buffer after Write returns
+	line := make([]byte, len(p))
+	copy(line, p)
+	for _, sink := range w.sinks {
+		sink(line)
+	}
+	return len(p), nil
+}
+
+// AddSink registers fn to receive every log line (one JSON object). fn must not block and must not log.
+func AddSink(fn func([]byte)) {
+	sinks.mu.Lock()
+	defer sinks.mu.Unlock()
+	sinks.sinks = append(sinks.sinks, fn)
 }
 
 // InitLogger initializes the global logger with the provided configuration
@@ -56,29 +105,22 @@ func InitLogger(cfg *LogConfig) error {
 		}
 
 		// Set default values for rotation
-		maxSize := cfg.MaxSize
-		if maxSize == 0 {
-			maxSize = 100 // 100MB default
-		}
-		maxAge := cfg.MaxAge
-		if maxAge == 0 {
-			maxAge = 30 // 30 days default
-		}
+		maxSize, maxAge := cfg.Rotation()
 
 		// Use lumberjack for log rotation
 		writer = &lumberjack.Logger{
 			Filename:   cfg.FilePath,
-			MaxSize:    maxSize, // megabytes
-			MaxAge:     maxAge,  // days
-			MaxBackups: 10,      // keep max 10 old log files
-			Compress:   true,    // compress old log files
+			MaxSize:    maxSize,    // megabytes
+			MaxAge:     maxAge,     // days
+			MaxBackups: MaxBackups, // keep max 10 old log files
+			Compress:   true,       // compress old log files
 		}
 	default:
 		return fmt.Errorf("invalid output type: %s (must be 'stdout' or 'file')", cfg.Output)
 	}
 
 	// Initialize logger
-	Logger = zerolog.New(writer).With().Timestamp().Caller().Logger()
+	Logger = zerolog.New(zerolog.MultiLevelWriter(writer, sinks)).With().Timestamp().Caller().Logger()
 	log.Logger = Logger
 
 	Logger.Info().
@@ -4,9 +4,11 @@ import (
 	"context"
 	"Backend_Dorm_PTIT/config"
 	"Backend_Dorm_PTIT/database"
+	"Backend_Dorm_PTIT/handlers"
 	"Backend_Dorm_PTIT/logger"
 	"Backend_Dorm_PTIT/middleware"
 	"Backend_Dorm_PTIT/routers"
+	"Backend_Dorm_PTIT/service"
 	"flag"
 	"fmt"
 	"log"
@@ -48,6 +50,10 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Log hub cho admin xem log trực tiếp (WS /ws/v1/admin-connect, SSE /logs/stream), nạp thẳng từ logger
+	service.GetLogHub().SetBacklog(cfg.Logging.Backlog)
+	logger.AddSink(service.GetLogHub().Ingest)
+
 	// Initialize logger
 	if err := logger.InitLogger(&cfg.Logging); err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
@@ -70,13 +76,26 @@ func main() {
 		logger.Fatal().Err(err).Msg("Failed to initialize Redis whitelist")
 	}
 
+	// Khoá ký JWT (HS256 bằng secret hoặc khoá bất đối xứng theo kid)
+	jwtKeys, err := service.NewJWTKeySet(cfg.JWT)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load JWT signing keys")
+	}
+
+	// Mã QR cổng và link lịch ký HMAC bằng khoá riêng, thiếu khoá thì ai cũng giả mạo được
+	if cfg.SignedTokens.Secret == "" {
+		logger.Fatal().Msg("signed_tokens.secret is not configured")
+	}
+
 	r := gin.New()
 
 	r.Use(gin.Recovery())
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Metrics())
 	r.Use(middleware.Logger())
 	r.Use(middleware.Cors)
 
-	routes.SetupRoutes(r, cfg)
+	routes.SetupRoutes(r, cfg, jwtKeys)
 
 
 	addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
@@ -100,6 +119,12 @@ func main() {
 
 	logger.Info().Msg("Shutting down server...")
 
+	// Readiness báo lỗi trước để load balancer ngừng gửi request mới, rồi mới dừng nhận kết nối
+	handlers.MarkShuttingDown()
+	if cfg.Server.ShutdownDelay > 0 {
+		time.Sleep(time.Duration(cfg.Server.ShutdownDelay) * time.Second)
+	}
+
 
 
 	// Shutdown server with timeout
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+)
+
+const namespace = "dorm"
+
+// Tên dịch vụ ngoài dùng cho nhãn service của external_failures_total
+const (
+	ServiceSMTP       = "smtp"
+	ServiceCloudinary = "cloudinary"
+)
+
+// businessScrapeTimeout giới hạn thời gian truy vấn DB mỗi lần Prometheus scrape
+const businessScrapeTimeout = 5 * time.Second
+
+// Registry riêng của ứng dụng (không dùng registry mặc định để không lộ metric của thư viện khác)
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	ExternalFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "external_failures_total",
+		Help:      "Failed calls to external services (SMTP, Cloudinary).",
+	}, []string{"service"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestDuration,
+		ExternalFailures,
+	)
+	// Khởi tạo sẵn để dashboard thấy 0 thay vì không có series
+	ExternalFailures.WithLabelValues(ServiceSMTP)
+	ExternalFailures.WithLabelValues(ServiceCloudinary)
+}
+
+// Handler trả về handler /metrics của Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ExternalFailure đếm một lần gọi dịch vụ ngoài thất bại
+func ExternalFailure(service string) {
+	ExternalFailures.WithLabelValues(service).Inc()
+}
+
+// RegisterDB xuất thống kê connection pool Postgres
+func RegisterDB(db *sql.DB) {
+	if db == nil {
+		return
+	}
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+// RegisterRedis xuất thống kê connection pool Redis
+func RegisterRedis(client *redis.Client) {
+	if client == nil {
+		return
+	}
+	Registry.MustRegister(&redisPoolCollector{client: client})
+}
+
+// RegisterWebSocket xuất số connection WebSocket và số room chat đang mở trên instance này
+func RegisterWebSocket(stats func() (connections, rooms int)) {
+	Registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ws_connections_active",
+			Help:      "Open WebSocket connections on this instance.",
+		}, func() float64 {
+			n, _ := stats()
+			return float64(n)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ws_chat_rooms_active",
+			Help:      "Chat rooms with at least one connection on this instance (private user channels excluded).",
+		}, func() float64 {
+			_, n := stats()
+			return float64(n)
+		}),
+	)
+}
+
+// BusinessStatsSource đọc số liệu nghiệp vụ, gọi mỗi lần scrape
+type BusinessStatsSource interface {
+	BusinessStats(ctx context.Context) (*models.BusinessStats, error)
+}
+
+// RegisterBusiness xuất các gauge nghiệp vụ: đơn chờ duyệt, hoá đơn điện chưa thanh toán, số sinh viên đang ở theo khu
+func RegisterBusiness(source BusinessStatsSource) {
+	Registry.MustRegister(&businessCollector{source: source})
+}
+
+var (
+	redisHitsDesc     = prometheus.NewDesc(namespace+"_redis_pool_hits_total", "Times a free connection was found in the pool.", nil, nil)
+	redisMissesDesc   = prometheus.NewDesc(namespace+"_redis_pool_misses_total", "Times a free connection was not found in the pool.", nil, nil)
+	redisTimeoutsDesc = prometheus.NewDesc(namespace+"_redis_pool_timeouts_total", "Times a wait for a connection timed out.", nil, nil)
+	redisTotalDesc    = prometheus.NewDesc(namespace+"_redis_pool_connections", "Connections in the pool.", nil, nil)
+	redisIdleDesc     = prometheus.NewDesc(namespace+"_redis_pool_idle_connections", "Idle connections in the pool.", nil, nil)
+	redisStaleDesc    = prometheus.NewDesc(namespace+"_redis_pool_stale_connections_total", "Stale connections removed from the pool.", nil, nil)
+)
+
+type redisPoolCollector struct {
+	client *redis.Client
+}
+
+func (c *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- redisHitsDesc
+	ch <- redisMissesDesc
+	ch <- redisTimeoutsDesc
+	ch <- redisTotalDesc
+	ch <- redisIdleDesc
+	ch <- redisStaleDesc
+}
+
+func (c *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(redisHitsDesc, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(redisMissesDesc, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(redisTimeoutsDesc, prometheus.CounterValue, float64(s.Timeouts))
+	ch <- prometheus.MustNewConstMetric(redisTotalDesc, prometheus.GaugeValue, float64(s.TotalConns))
+	ch <- prometheus.MustNewConstMetric(redisIdleDesc, prometheus.GaugeValue, float64(s.IdleConns))
+	ch <- prometheus.MustNewConstMetric(redisStaleDesc, prometheus.CounterValue, float64(s.StaleConns))
+}
+
+var (
+	pendingApplicationsDesc = prometheus.NewDesc(namespace+"_applications_pending", "Dorm applications waiting for review.", nil, nil)
+	unpaidBillsDesc         = prometheus.NewDesc(namespace+"_electric_bills_unpaid", "Electric bills not paid yet.", nil, nil)
+	unpaidAmountDesc        = prometheus.NewDesc(namespace+"_electric_bills_unpaid_amount", "Total amount of unpaid electric bills.", nil, nil)
+	areaResidentsDesc       = prometheus.NewDesc(namespace+"_area_residents", "Students with an active approved contract per dorm area.", []string{"area_id", "area_name"}, nil)
+	businessUpDesc          = prometheus.NewDesc(namespace+"_business_stats_up", "1 if business stats were read from the database on this scrape.", nil, nil)
+)
+
+type businessCollector struct {
+	source BusinessStatsSource
+}
+
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pendingApplicationsDesc
+	ch <- unpaidBillsDesc
+	ch <- unpaidAmountDesc
+	ch <- areaResidentsDesc
+	ch <- businessUpDesc
+}
+
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), businessScrapeTimeout)
+	defer cancel()
+	stats, err := c.source.BusinessStats(ctx)
+	if err != nil {
+		// Không xuất số cũ, chỉ báo lỗi để alert theo business_stats_up
+		ch <- prometheus.MustNewConstMetric(businessUpDesc, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(businessUpDesc, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(pendingApplicationsDesc, prometheus.GaugeValue, float64(stats.PendingApplications))
+	ch <- prometheus.MustNewConstMetric(unpaidBillsDesc, prometheus.GaugeValue, float64(stats.UnpaidBills))
+	ch <- prometheus.MustNewConstMetric(unpaidAmountDesc, prometheus.GaugeValue, float64(stats.UnpaidBillAmount))
+	for _, a := range stats.AreaResidents {
+		ch <- prometheus.MustNewConstMetric(areaResidentsDesc, prometheus.GaugeValue, float64(a.Residents), a.AreaID, a.AreaName)
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/repository"
+	"Backend_Dorm_PTIT/service"
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIClientAuth xác thực service gọi API bằng header API-key và yêu cầu client có đủ các scope.
+// Client đã xác thực được lưu ở c.Get("api_client").
+func APIClientAuth(repo *repository.APIClientRepository, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := c.GetHeader("API-key")
+		prefix, ok := service.ParseAPIKeyPrefix(apiKey)
+		if !ok {
+			abortWithError(c, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		key, client, err := repo.GetKeyByPrefix(c.Request.Context(), prefix)
+		if err != nil {
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("prefix", prefix).Msg("Failed to look up API key")
+			abortWithError(c, http.StatusInternalServerError, "failed to verify API key")
+			return
+		}
+		now := time.Now()
+		if key == nil || subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(service.HashAPIKey(apiKey))) != 1 ||
+			!key.Active(now) || client.Status != models.APIClientStatusActive {
+			logger.Ctx(c.Request.Context()).Warn().Str("prefix", prefix).Str("ip", c.ClientIP()).Msg("Rejected API key")
+			abortWithError(c, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		for _, scope := range scopes {
+			if !client.HasScope(scope) {
+				abortWithError(c, http.StatusForbidden, "API client is missing scope "+scope)
+				return
+			}
+		}
+		if err := repo.TouchKey(context.Background(), key.ID, now); err != nil {
+			logger.Ctx(c.Request.Context()).Error().Err(err).Str("key_id", key.ID).Msg("Failed to update API key last used")
+		}
+		c.Set("api_client", client)
+		c.Next()
+	}
+}
+
+// LegacyAPIKeyOr cho request mang khoá tĩnh cũ (api_key trong config) đi qua trong lúc chuyển sang API client,
+// các request khác do next kiểm tra. legacyKey rỗng thì chỉ dùng next.
+func LegacyAPIKeyOr(legacyKey string, next gin.HandlerFunc) gin.HandlerFunc {
+	if legacyKey == "" {
+		return next
+	}
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("API-key")), []byte(legacyKey)) == 1 {
+			logger.Ctx(c.Request.Context()).Warn().Str("ip", c.ClientIP()).Str("path", c.FullPath()).
+				Msg("Legacy API key used, issue an API client via /api-clients and disable the legacy key")
+			c.Next()
+			return
+		}
+		next(c)
+	}
+}
@@ -7,12 +7,13 @@ import (
 	"Backend_Dorm_PTIT/constants"
 	"Backend_Dorm_PTIT/database"
 	"Backend_Dorm_PTIT/models"
+	"Backend_Dorm_PTIT/service"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // Authentication returns a middleware that validates JWT tokens and checks whitelist
-func Authentication(jwtSecret string) gin.HandlerFunc {
+func Authentication(keys *service.JWTKeySet) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.Request.Method == "OPTIONS" {
 			c.Next()
@@ -24,12 +25,7 @@ func Authentication(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
-		if jwtSecret == "" {
-			abortWithError(c, http.StatusInternalServerError, "JWT secret not configured")
-			return
-		}
-
-		token, err := parseToken(tokenString, jwtSecret)
+		token, err := parseToken(tokenString, keys)
 		if err != nil {
 			abortWithError(c, http.StatusUnauthorized, constants.ErrInvalidToken)
 			return
@@ -51,57 +47,47 @@ func Authentication(jwtSecret string) gin.HandlerFunc {
 	}
 }
 
-func AuthenticateWS(jwtSecret string) gin.HandlerFunc {
+func AuthenticateWS(keys *service.JWTKeySet) gin.HandlerFunc {
        return func(c *gin.Context) {
 	       tokenString := c.Query("token")
 	       if tokenString == "" {
-			   logger.Error().Msg("Missing token in query param")
+			   logger.Ctx(c.Request.Context()).Error().Msg("Missing token in query param")
 		       c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
 			   return 
 	       }
-	       if jwtSecret == "" {
-			   	logger.Error().Msg("JWT secret not configured")
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "JWT secret not configured"})
-				return
-			}
-	       token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		       if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			       return nil, jwt.ErrSignatureInvalid
-		       }
-		       return []byte(jwtSecret), nil
-	       })
+	       token, err := parseToken(tokenString, keys)
 	       if err != nil {
-			   logger.Error().Err(err).Msg("Invalid token")	
+			   logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Invalid token")	
 		       c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			   return
 	       }
 	       claims, ok := token.Claims.(jwt.MapClaims)
 	       if !ok || !token.Valid {
-			   logger.Error().Msg("Invalid claims in token")
+			   logger.Ctx(c.Request.Context()).Error().Msg("Invalid claims in token")
 		       c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid claims"})
 			   return
 	       }
 
 	       tokenType, _ := claims["type"].(string)
 	       if tokenType != "access" {
-			   logger.Error().Msg("Token is not an access token")
+			   logger.Ctx(c.Request.Context()).Error().Msg("Token is not an access token")
 		       c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token is not an access token"})
 		       return
 	       }
 	       tokenID, _ := claims["token_id"].(string)
 	       if tokenID == "" {
-			   logger.Error().Msg("Token is missing token_id")
+			   logger.Ctx(c.Request.Context()).Error().Msg("Token is missing token_id")
 		       c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token is missing token_id"})
 		       return
 	       }
 		   ok, _, err = database.Get(tokenID)
 	       if err != nil {
-			   logger.Error().Err(err).Msg("Error checking whitelist")
+			   logger.Ctx(c.Request.Context()).Error().Err(err).Msg("Error checking whitelist")
 		       c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error checking whitelist"})
 		       return
 	       }
 	       if !ok {
-			   logger.Error().Msg("Token is not in whitelist")
+			   logger.Ctx(c.Request.Context()).Error().Msg("Token is not in whitelist")
 		       c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token is not in whitelist"})
 		       return
 	       }
@@ -120,14 +106,9 @@ func extractBearerToken(c *gin.Context) string {
 	return ""
 }
 
-// parseToken parses and validates the JWT token
-func parseToken(tokenString, secret string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(secret), nil
-	})
+// parseToken parses and validates the JWT token, selecting the verification key by its kid header
+func parseToken(tokenString string, keys *service.JWTKeySet) (*jwt.Token, error) {
+	return keys.Parse(tokenString)
 }
 
 // validateClaims validates the token claims
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func Logger() gin.HandlerFunc {
@@ -28,8 +29,8 @@ func Logger() gin.HandlerFunc {
 			path = path + "?" + raw
 		}
 
-		// Log with structured fields
-		logEvent := logger.Info().
+		// Log with structured fields (request_id comes from the request-scoped logger)
+		logEvent := logger.Ctx(c.Request.Context()).Info().
 			Str("client_ip", clientIP).
 			Str("method", method).
 			Str("path", path).
@@ -43,9 +44,13 @@ func Logger() gin.HandlerFunc {
 			logEvent = logEvent.Str("error", errorMessage)
 		}
 
-		// Add user_id if authenticated
-		if userID, exists := c.Get("user_id"); exists {
-			logEvent = logEvent.Str("user_id", userID.(string))
+		// Add user_id if authenticated (authentication middleware stores the JWT claims under "user")
+		if claims, exists := c.Get("user"); exists {
+			if mc, ok := claims.(jwt.MapClaims); ok {
+				if userID, _ := mc["user_id"].(string); userID != "" {
+					logEvent = logEvent.Str("user_id", userID)
+				}
+			}
 		}
 
 		// Log based on status code
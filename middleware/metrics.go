@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/metrics"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics đo thời gian xử lý request theo route template (c.FullPath) để số series không tăng theo ID trên URL
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// MetricsAccess chỉ cho scrape /metrics từ IP trong allowlist hoặc khi có đúng token
+func MetricsAccess(cfg config.MetricsConfig) gin.HandlerFunc {
+	allowed := make([]*net.IPNet, 0, len(cfg.AllowedIPs))
+	for _, entry := range cfg.AllowedIPs {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			logger.Error().Err(err).Str("entry", entry).Msg("Invalid metrics allowed_ips entry, ignored")
+			continue
+		}
+		allowed = append(allowed, ipNet)
+	}
+	localOnly := len(allowed) == 0 && cfg.Token == ""
+
+	return func(c *gin.Context) {
+		// RemoteIP là địa chỉ kết nối trực tiếp, X-Forwarded-For do client tự đặt được
+		ip := net.ParseIP(c.RemoteIP())
+		if ip != nil {
+			if localOnly && ip.IsLoopback() {
+				c.Next()
+				return
+			}
+			for _, ipNet := range allowed {
+				if ipNet.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+		if cfg.Token != "" {
+			token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "metrics access denied"})
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"bytes"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxRequestIDLen = 128
+
+// RequestID nhận X-Request-ID từ client (hoặc sinh mới), gắn logger theo request vào context (logger.Ctx),
+// trả lại trong header response và thêm request_id vào body JSON của response lỗi
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(logger.RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), id))
+		c.Header(logger.RequestIDHeader, id)
+		c.Writer = &requestIDWriter{ResponseWriter: c.Writer, requestID: id}
+		c.Next()
+	}
+}
+
+// validRequestID chỉ nhận ID ngắn gồm chữ, số và - _ . : để không ghi nội dung tuỳ ý của client vào log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDWriter thêm "request_id" vào object JSON của response lỗi (status >= 400).
+// c.JSON ghi cả body trong một lần Write nên chỉ cần chèn vào đầu object.
+type requestIDWriter struct {
+	gin.ResponseWriter
+	requestID string
+}
+
+func (w *requestIDWriter) Write(data []byte) (int, error) {
+	if w.Status() < 400 || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(data)
+	}
+	body := bytes.TrimSpace(data)
+	if len(body) < 2 || body[0] != '{' || bytes.Contains(body, []byte(`"request_id"`)) {
+		return w.ResponseWriter.Write(data)
+	}
+	field := `"request_id":"` + w.requestID + `"`
+	if len(bytes.TrimSpace(body[1:len(body)-1])) > 0 {
+		field += ","
+	}
+	patched := make([]byte, 0, len(body)+len(field))
+	patched = append(patched, '{')
+	patched = append(patched, field...)
+	patched = append(patched, body[1:]...)
+	if _, err := w.ResponseWriter.Write(patched); err != nil {
+		return 0, err
+	}
+	// caller chỉ biết độ dài body gốc
+	return len(data), nil
+}
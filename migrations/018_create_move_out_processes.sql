@@ -0,0 +1,28 @@
+-- Quy trình trả phòng (tạo khi duyệt yêu cầu hủy hợp đồng)
+CREATE TABLE IF NOT EXISTS move_out_processes (
+    id UUID PRIMARY KEY,
+    contract_id UUID NOT NULL REFERENCES contracts(id),
+    cancel_request_id UUID REFERENCES contract_cancel_requests(id),
+    student_id UUID NOT NULL REFERENCES students(id),
+    room TEXT NOT NULL,
+    checkout_date DATE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'in_progress', -- in_progress|completed
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_move_out_processes_active_contract
+    ON move_out_processes(contract_id) WHERE status = 'in_progress';
+
+-- Các bước trong checklist trả phòng
+CREATE TABLE IF NOT EXISTS move_out_checklist_items (
+    id UUID PRIMARY KEY,
+    process_id UUID NOT NULL REFERENCES move_out_processes(id) ON DELETE CASCADE,
+    item_type VARCHAR(32) NOT NULL, -- room_inspection|key_return|electric_bills|damage_charges|fee_refund
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending|completed
+    amount DOUBLE PRECISION NOT NULL DEFAULT 0,
+    note TEXT,
+    completed_by UUID REFERENCES users(id),
+    completed_at TIMESTAMP,
+    UNIQUE (process_id, item_type)
+);
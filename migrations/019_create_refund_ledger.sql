@@ -0,0 +1,32 @@
+-- Sổ hoàn phí khi hợp đồng kết thúc sớm (finish hoặc duyệt yêu cầu hủy)
+CREATE TABLE IF NOT EXISTS refund_ledger_entries (
+    id UUID PRIMARY KEY,
+    contract_id UUID NOT NULL REFERENCES contracts(id),
+    student_id UUID NOT NULL REFERENCES students(id),
+    move_out_id UUID REFERENCES move_out_processes(id),
+    source VARCHAR(32) NOT NULL, -- finish_contract|cancel_request
+    termination_date DATE NOT NULL,
+    notice_date DATE NOT NULL,
+    total_days INT NOT NULL,
+    occupied_days INT NOT NULL,
+    unused_days INT NOT NULL,
+    daily_rate DOUBLE PRECISION NOT NULL,
+    unused_amount DOUBLE PRECISION NOT NULL,
+    deposit_deduction DOUBLE PRECISION NOT NULL DEFAULT 0,
+    notice_shortfall_days INT NOT NULL DEFAULT 0,
+    notice_penalty DOUBLE PRECISION NOT NULL DEFAULT 0,
+    refund_amount DOUBLE PRECISION NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'quoted', -- quoted|approved|rejected|paid
+    note TEXT,
+    approved_by UUID REFERENCES users(id),
+    approved_at TIMESTAMP,
+    paid_at TIMESTAMP,
+    payout_reference TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_refund_ledger_contract_id ON refund_ledger_entries(contract_id);
+CREATE INDEX IF NOT EXISTS idx_refund_ledger_student_id ON refund_ledger_entries(student_id);
+-- Mỗi hợp đồng chỉ có một bản ghi hoàn phí còn hiệu lực, tránh hoàn tiền hai lần
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refund_ledger_active_contract
+    ON refund_ledger_entries(contract_id) WHERE status <> 'rejected';
@@ -0,0 +1,42 @@
+-- Ca trực có giờ bắt đầu/kết thúc, lịch trực lặp theo tuần và yêu cầu đổi ca
+
+-- Lịch trực lặp lại hàng tuần trong một học kỳ
+CREATE TABLE IF NOT EXISTS duty_rotations (
+    id UUID PRIMARY KEY,
+    area_id TEXT NOT NULL,
+    staff_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    weekdays INT[] NOT NULL, -- 0 = Chủ nhật ... 6 = Thứ bảy
+    shift_start VARCHAR(5) NOT NULL, -- HH:MM
+    shift_end VARCHAR(5) NOT NULL, -- HH:MM, nhỏ hơn shift_start nghĩa là ca qua đêm
+    semester_start DATE NOT NULL,
+    semester_end DATE NOT NULL,
+    description TEXT,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Lịch trực cũ chỉ có ngày, coi như trực cả ngày
+ALTER TABLE duty_schedules ADD COLUMN IF NOT EXISTS start_time TIMESTAMP;
+ALTER TABLE duty_schedules ADD COLUMN IF NOT EXISTS end_time TIMESTAMP;
+ALTER TABLE duty_schedules ADD COLUMN IF NOT EXISTS rotation_id UUID REFERENCES duty_rotations(id) ON DELETE SET NULL;
+UPDATE duty_schedules SET start_time = date::timestamp, end_time = date::timestamp + INTERVAL '1 day' WHERE start_time IS NULL;
+ALTER TABLE duty_schedules ALTER COLUMN start_time SET NOT NULL;
+ALTER TABLE duty_schedules ALTER COLUMN end_time SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_duty_schedules_staff_time ON duty_schedules(staff_id, start_time, end_time);
+CREATE INDEX IF NOT EXISTS idx_duty_schedules_area_time ON duty_schedules(area_id, start_time, end_time);
+
+-- Yêu cầu đổi ca giữa hai quản túc
+CREATE TABLE IF NOT EXISTS duty_swap_requests (
+    id UUID PRIMARY KEY,
+    schedule_id UUID NOT NULL REFERENCES duty_schedules(id) ON DELETE CASCADE,
+    requester_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_staff_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_schedule_id UUID REFERENCES duty_schedules(id) ON DELETE CASCADE, -- ca đổi lại (bỏ trống = nhường ca)
+    reason TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending|approved|rejected|cancelled
+    reviewed_by UUID REFERENCES users(id),
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_duty_swap_requests_target ON duty_swap_requests(target_staff_id, status);
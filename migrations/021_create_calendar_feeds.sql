@@ -0,0 +1,9 @@
+-- Link lịch iCal (.ics) của từng user, thu hồi bằng revoked_at
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP
+);
+-- Mỗi user chỉ có một link đang hoạt động
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_calendar_feeds_active_user ON calendar_feeds(user_id) WHERE revoked_at IS NULL;
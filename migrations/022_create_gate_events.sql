@@ -0,0 +1,17 @@
+-- Giờ giới nghiêm riêng của từng khu (HH:MM), NULL thì dùng cấu hình mặc định
+ALTER TABLE dorm_areas ADD COLUMN IF NOT EXISTS curfew VARCHAR(5);
+
+-- Nhật ký ra/vào cổng ký túc xá
+CREATE TABLE IF NOT EXISTS gate_events (
+    id UUID PRIMARY KEY,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    contract_id UUID NOT NULL REFERENCES contracts(id),
+    area_id VARCHAR NOT NULL,
+    direction VARCHAR(3) NOT NULL, -- in|out
+    occurred_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    is_late BOOLEAN NOT NULL DEFAULT FALSE, -- vào cổng sau giờ giới nghiêm
+    recorded_by UUID REFERENCES users(id),
+    note TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_gate_events_student_time ON gate_events(student_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_gate_events_area_time ON gate_events(area_id, occurred_at DESC);
@@ -0,0 +1,31 @@
+-- Quy định tiếp khách riêng của từng khu, NULL thì dùng cấu hình mặc định
+ALTER TABLE dorm_areas ADD COLUMN IF NOT EXISTS visiting_start VARCHAR(5); -- HH:MM
+ALTER TABLE dorm_areas ADD COLUMN IF NOT EXISTS visiting_end VARCHAR(5);   -- HH:MM
+ALTER TABLE dorm_areas ADD COLUMN IF NOT EXISTS overnight_guest_cap INT;   -- số khách ở qua đêm tối đa mỗi đêm trong khu
+
+-- Đăng ký khách thăm của sinh viên
+CREATE TABLE IF NOT EXISTS visitor_requests (
+    id UUID PRIMARY KEY,
+    student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    contract_id UUID NOT NULL REFERENCES contracts(id),
+    area_id VARCHAR NOT NULL,
+    room VARCHAR,
+    guest_name VARCHAR(255) NOT NULL,
+    guest_cccd VARCHAR(20) NOT NULL,
+    guest_phone VARCHAR(20),
+    visit_start TIMESTAMP NOT NULL,
+    visit_end TIMESTAMP NOT NULL,
+    overnight BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending|approved|rejected|cancelled|checked_in|checked_out
+    pass_code VARCHAR(12),
+    reviewed_by UUID REFERENCES users(id),
+    reviewed_at TIMESTAMP,
+    manager_note TEXT,
+    arrived_at TIMESTAMP,
+    departed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_visitor_requests_pass_code ON visitor_requests(pass_code) WHERE pass_code IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_visitor_requests_student ON visitor_requests(student_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_visitor_requests_area_window ON visitor_requests(area_id, visit_start, visit_end);
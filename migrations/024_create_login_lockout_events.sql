@@ -0,0 +1,14 @@
+-- Nhật ký khoá/mở khoá đăng nhập do nhập sai mật khẩu nhiều lần
+CREATE TABLE IF NOT EXISTS login_lockout_events (
+    id UUID PRIMARY KEY,
+    scope VARCHAR(8) NOT NULL, -- user|ip
+    subject VARCHAR(255) NOT NULL, -- username hoặc địa chỉ IP
+    event VARCHAR(10) NOT NULL, -- locked|unlocked
+    failures INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    ip VARCHAR(64),
+    actor_id UUID REFERENCES users(id), -- admin mở khoá, NULL nếu do hệ thống
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_login_lockout_events_subject ON login_lockout_events(scope, subject, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_lockout_events_time ON login_lockout_events(created_at DESC);
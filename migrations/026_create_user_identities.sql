@@ -0,0 +1,12 @@
+-- Liên kết tài khoản với danh tính ở nhà cung cấp OpenID Connect (provider + sub)
+CREATE TABLE IF NOT EXISTS user_identities (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL, -- tên provider trong cấu hình oidc
+    subject VARCHAR(255) NOT NULL, -- claim sub của ID token
+    email VARCHAR(255) NOT NULL, -- email lúc liên kết/đăng nhập gần nhất
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider) -- mỗi tài khoản chỉ liên kết một danh tính trên mỗi provider
+);
@@ -0,0 +1,24 @@
+-- Service gọi API của hệ thống (chatbot, công cụ nhập hoá đơn, ...), phân quyền theo scope
+CREATE TABLE IF NOT EXISTS api_clients (
+    id UUID PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT,
+    scopes TEXT[] NOT NULL DEFAULT '{}', -- vd. chatbot:read, bills:import
+    status VARCHAR(20) NOT NULL DEFAULT 'active', -- active|revoked
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Khoá của client, chỉ lưu hash. Xoay khoá: tạo khoá mới, khoá cũ hết hạn sau thời gian ân hạn.
+CREATE TABLE IF NOT EXISTS api_client_keys (
+    id UUID PRIMARY KEY,
+    client_id UUID NOT NULL REFERENCES api_clients(id) ON DELETE CASCADE,
+    prefix VARCHAR(16) NOT NULL UNIQUE, -- phần đầu của khoá để tra cứu, được phép hiển thị
+    key_hash VARCHAR(64) NOT NULL, -- sha256 hex của khoá đầy đủ
+    expires_at TIMESTAMP, -- NULL = không hết hạn
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_api_client_keys_client ON api_client_keys(client_id);
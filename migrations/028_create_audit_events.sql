@@ -0,0 +1,30 @@
+-- Nhật ký thao tác quản trị, chỉ được thêm, không sửa/xoá
+CREATE TABLE IF NOT EXISTS audit_events (
+    id UUID PRIMARY KEY,
+    actor_type VARCHAR(20) NOT NULL DEFAULT 'user', -- user|api_client|system
+    actor_id VARCHAR(100), -- không dùng khoá ngoại để nhật ký còn lại khi tài khoản bị xoá
+    actor_roles TEXT[] NOT NULL DEFAULT '{}',
+    action VARCHAR(100) NOT NULL, -- vd. dorm_application.approve, contract.verify
+    entity_type VARCHAR(50) NOT NULL,
+    entity_id VARCHAR(100),
+    before JSONB, -- chỉ các trường thay đổi
+    after JSONB,
+    ip VARCHAR(64),
+    user_agent TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created ON audit_events(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_entity ON audit_events(entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_audit_events_append_only ON audit_events;
+CREATE TRIGGER trg_audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
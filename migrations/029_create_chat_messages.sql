@@ -0,0 +1,20 @@
+-- Tin nhắn chat qua WebSocket. channel: room:<phòng> (sinh viên cùng phòng), area:<id khu> (cán bộ của khu)
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id UUID PRIMARY KEY,
+    channel VARCHAR(150) NOT NULL,
+    sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    edited_at TIMESTAMP,
+    deleted_at TIMESTAMP -- xoá mềm, nội dung được xoá trắng
+);
+CREATE INDEX IF NOT EXISTS idx_chat_messages_channel_created ON chat_messages(channel, created_at DESC, id DESC);
+
+-- Tin nhắn cuối cùng mỗi người đã đọc trong channel
+CREATE TABLE IF NOT EXISTS chat_read_receipts (
+    channel VARCHAR(150) NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_message_id UUID NOT NULL REFERENCES chat_messages(id) ON DELETE CASCADE,
+    read_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (channel, user_id)
+);
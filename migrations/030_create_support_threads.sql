@@ -0,0 +1,16 @@
+-- Hội thoại hỗ trợ 1:1 giữa sinh viên và cán bộ quản túc. Tin nhắn nằm ở chat_messages với channel support:<id>.
+CREATE TABLE IF NOT EXISTS support_threads (
+    id UUID PRIMARY KEY,
+    student_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    area_id TEXT NOT NULL,
+    assigned_staff_id UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL = chưa có cán bộ nhận (không ai trực lúc mở)
+    subject VARCHAR(200) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open|closed
+    last_message_at TIMESTAMP,
+    closed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_support_threads_student ON support_threads(student_id);
+CREATE INDEX IF NOT EXISTS idx_support_threads_staff ON support_threads(assigned_staff_id);
+CREATE INDEX IF NOT EXISTS idx_support_threads_status_area ON support_threads(status, area_id);
@@ -0,0 +1,16 @@
+-- Hộp thư thông báo của user (đơn được duyệt, hợp đồng được xác nhận, hoá đơn điện mới, khiếu nại đổi trạng thái, ...).
+-- User đang online nhận ngay qua WebSocket, user offline đọc lại khi đăng nhập.
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(100) NOT NULL, -- vd. contract.verified, electric_bill.created
+    title VARCHAR(255) NOT NULL,
+    body TEXT,
+    entity_type VARCHAR(50),
+    entity_id VARCHAR(100),
+    data JSONB,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_unread ON notifications(user_id) WHERE read_at IS NULL;
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Scope của API client
+const (
+	APIScopeChatbotRead = "chatbot:read" // đọc tài liệu/prompt cho chatbot service
+	APIScopeBillsImport = "bills:import" // nhập hoá đơn điện từ hệ thống đo đếm
+)
+
+// APIScopes là danh sách scope hợp lệ khi tạo/sửa client
+var APIScopes = []string{APIScopeChatbotRead, APIScopeBillsImport}
+
+const (
+	APIClientStatusActive  = "active"
+	APIClientStatusRevoked = "revoked"
+)
+
+// APIClient là một service được cấp khoá để gọi API
+type APIClient struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Scopes      []string       `json:"scopes"`
+	Status      string         `json:"status"`
+	CreatedBy   string         `json:"created_by,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Keys        []APIClientKey `json:"keys,omitempty"`
+}
+
+// HasScope kiểm tra client có scope
+func (c *APIClient) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIClientKey là một khoá của client (không bao giờ trả hash ra ngoài)
+type APIClientKey struct {
+	ID         string     `json:"id"`
+	ClientID   string     `json:"client_id"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active cho biết khoá còn dùng được tại thời điểm at
+func (k *APIClientKey) Active(at time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || at.Before(*k.ExpiresAt))
+}
+
+// APIClientKeyResponse trả về khoá đầy đủ, chỉ hiển thị một lần khi tạo
+type APIClientKeyResponse struct {
+	ClientID  string     `json:"client_id"`
+	KeyID     string     `json:"key_id"`
+	APIKey    string     `json:"api_key"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActorUser      = "user"
+	AuditActorAPIClient = "api_client"
+	AuditActorSystem    = "system"
+)
+
+// AuditEvent là một dòng nhật ký thao tác quản trị. Before/After chỉ chứa các trường thay đổi.
+type AuditEvent struct {
+	ID         string          `json:"id"`
+	ActorType  string          `json:"actor_type"`
+	ActorID    string          `json:"actor_id,omitempty"`
+	ActorRoles []string        `json:"actor_roles"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditEventFilter là điều kiện tìm kiếm nhật ký, trường rỗng là bỏ qua
+type AuditEventFilter struct {
+	ActorID    string
+	Action     string // khớp tiền tố, vd. "contract." lấy mọi thao tác trên hợp đồng
+	EntityType string
+	EntityID   string
+	Query      string // tìm trong entity_id và nội dung before/after
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
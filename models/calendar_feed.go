@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// CalendarFeed là link lịch iCal cá nhân, calendar app gọi không cần Bearer token
+type CalendarFeed struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	URL       string     `json:"url,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Tiền tố channel chat
+const (
+	ChatChannelRoomPrefix    = "room:"    // room:<id khu>:<phòng>, sinh viên có hợp đồng approved ở phòng, và cán bộ
+	ChatChannelAreaPrefix    = "area:"    // cán bộ quản lý khu ký túc xá
+	ChatChannelSupportPrefix = "support:" // hội thoại hỗ trợ giữa sinh viên và cán bộ
+	ChatChannelUserPrefix    = "user:"    // kênh riêng của từng user (số tin chưa đọc, hộp thư), client không gửi vào được
+)
+
+// ChatRoomChannel trả về channel chat của một phòng. Tên phòng chỉ duy nhất trong một khu nên channel gồm cả id khu
+func ChatRoomChannel(areaID, room string) string {
+	return ChatChannelRoomPrefix + areaID + ":" + room
+}
+
+// ParseChatRoomChannel tách id khu và phòng từ channel room:<id khu>:<phòng>
+func ParseChatRoomChannel(channel string) (areaID, room string, ok bool) {
+	rest, found := strings.CutPrefix(channel, ChatChannelRoomPrefix)
+	if !found {
+		return "", "", false
+	}
+	areaID, room, found = strings.Cut(rest, ":")
+	if !found || areaID == "" || room == "" {
+		return "", "", false
+	}
+	return areaID, room, true
+}
+
+// ChatAreaChannel trả về channel chat của cán bộ một khu
+func ChatAreaChannel(areaID string) string {
+	return ChatChannelAreaPrefix + areaID
+}
+
+// ChatSupportChannel trả về channel của một hội thoại hỗ trợ
+func ChatSupportChannel(threadID string) string {
+	return ChatChannelSupportPrefix + threadID
+}
+
+// ChatUserChannel trả về kênh riêng của user, mọi connection chat của user tự động tham gia
+func ChatUserChannel(userID string) string {
+	return ChatChannelUserPrefix + userID
+}
+
+// NormalizeChatChannel chuẩn hoá tên channel, tên không có tiền tố được hiểu là phòng (client cũ gửi tên phòng).
+// Tên phòng trần không có id khu nên vẫn bị từ chối khi kiểm tra quyền.
+func NormalizeChatChannel(channel string) string {
+	channel = strings.TrimSpace(channel)
+	if channel == "" || strings.Contains(channel, ":") {
+		return channel
+	}
+	return ChatChannelRoomPrefix + channel
+}
+
+type ChatMessage struct {
+	ID        string     `json:"id"`
+	Channel   string     `json:"channel"`
+	SenderID  string     `json:"sender_id"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type ChatReadReceipt struct {
+	Channel           string    `json:"channel"`
+	UserID            string    `json:"user_id"`
+	LastReadMessageID string    `json:"last_read_message_id"`
+	ReadAt            time.Time `json:"read_at"`
+}
+
+const (
+	SupportThreadStatusOpen   = "open"
+	SupportThreadStatusClosed = "closed"
+)
+
+// SupportThread là hội thoại hỗ trợ, cán bộ khác có thể nhận lại (take over) khi cán bộ đang phụ trách hết ca
+type SupportThread struct {
+	ID              string     `json:"id"`
+	Channel         string     `json:"channel"`
+	StudentID       string     `json:"student_id"`
+	AreaID          string     `json:"area_id"`
+	AssignedStaffID string     `json:"assigned_staff_id,omitempty"`
+	Subject         string     `json:"subject"`
+	Status          string     `json:"status"`
+	LastMessageAt   *time.Time `json:"last_message_at,omitempty"`
+	ClosedAt        *time.Time `json:"closed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	// Chỉ có khi lấy theo hộp thư của một user
+	UnreadCount int `json:"unread_count"`
+}
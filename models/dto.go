@@ -9,8 +9,9 @@ type LogoutRequest struct {
 }
 
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username     string `json:"username" binding:"required"`
+	Password     string `json:"password" binding:"required"`
+	CaptchaToken string `json:"captcha_token"` // bắt buộc sau nhiều lần nhập sai nếu bật CAPTCHA
 }
 
 type LoginResponse struct {
@@ -61,8 +62,9 @@ type ProfileManagerResponse struct {
 }
 
 type LogoutAllSessionsRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username     string `json:"username" binding:"required"`
+	Password     string `json:"password" binding:"required"`
+	CaptchaToken string `json:"captcha_token"`
 }
 
 // Dùng cho API nhận multipart/form-data khi tạo application
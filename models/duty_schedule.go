@@ -9,7 +9,48 @@ import (
 type DutySchedule struct {
 	ID          uuid.UUID `json:"id"`
 	Date        time.Time `json:"date"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
 	AreaID      string    `json:"area_id"`
 	Description string    `json:"description"`
 	StaffID     uuid.UUID `json:"staff_id"`
+	RotationID  string    `json:"rotation_id,omitempty"`
+}
+
+// DutyRotation là lịch trực lặp lại hàng tuần trong một học kỳ
+type DutyRotation struct {
+	ID            string    `json:"id"`
+	AreaID        string    `json:"area_id"`
+	StaffID       string    `json:"staff_id"`
+	Weekdays      []int     `json:"weekdays"`    // 0 = Chủ nhật ... 6 = Thứ bảy
+	ShiftStart    string    `json:"shift_start"` // HH:MM
+	ShiftEnd      string    `json:"shift_end"`   // HH:MM, nhỏ hơn shift_start nghĩa là ca qua đêm
+	SemesterStart time.Time `json:"semester_start"`
+	SemesterEnd   time.Time `json:"semester_end"`
+	Description   string    `json:"description"`
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+const (
+	DutySwapStatusPending   = "pending"
+	DutySwapStatusApproved  = "approved"
+	DutySwapStatusRejected  = "rejected"
+	DutySwapStatusCancelled = "cancelled"
+)
+
+// DutySwapRequest là yêu cầu đổi ca giữa hai quản túc.
+// TargetScheduleID để trống nghĩa là nhường ca cho TargetStaffID.
+type DutySwapRequest struct {
+	ID               string     `json:"id"`
+	ScheduleID       string     `json:"schedule_id"`
+	RequesterID      string     `json:"requester_id"`
+	TargetStaffID    string     `json:"target_staff_id"`
+	TargetScheduleID string     `json:"target_schedule_id,omitempty"`
+	Reason           string     `json:"reason"`
+	Status           string     `json:"status"` // pending, approved, rejected, cancelled
+	ReviewedBy       string     `json:"reviewed_by,omitempty"`
+	ReviewedAt       *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
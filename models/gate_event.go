@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	GateDirectionIn  = "in"
+	GateDirectionOut = "out"
+)
+
+// GateEvent là một lượt ra/vào cổng của sinh viên do quản túc ghi nhận
+type GateEvent struct {
+	ID         string    `json:"id"`
+	StudentID  string    `json:"student_id"`
+	ContractID string    `json:"contract_id"`
+	AreaID     string    `json:"area_id"`
+	Direction  string    `json:"direction"` // in, out
+	OccurredAt time.Time `json:"occurred_at"`
+	IsLate     bool      `json:"is_late"`
+	RecordedBy string    `json:"recorded_by"`
+	Note       string    `json:"note"`
+}
+
+// GateEventWithStudent kèm thông tin sinh viên để hiển thị ở trang quản lý
+type GateEventWithStudent struct {
+	GateEvent
+	FullName string `json:"fullname"`
+	Room     string `json:"room"`
+}
+
+// OvernightAbsence là sinh viên đã ra cổng và chưa quay lại qua đêm
+type OvernightAbsence struct {
+	StudentID string    `json:"student_id"`
+	FullName  string    `json:"fullname"`
+	Room      string    `json:"room"`
+	AreaID    string    `json:"area_id"`
+	LeftAt    time.Time `json:"left_at"`
+}
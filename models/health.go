@@ -0,0 +1,16 @@
+package models
+
+// DependencyStatus là kết quả kiểm tra một phụ thuộc trong /health/ready
+type DependencyStatus struct {
+	Status    string   `json:"status"` // ok, fail, skipped
+	LatencyMs float64  `json:"latency_ms"`
+	Error     string   `json:"error,omitempty"`
+	Missing   []string `json:"missing,omitempty"` // cấu hình bắt buộc còn thiếu (check config)
+}
+
+// ReadinessResponse là kết quả /health/ready, status = ok khi mọi phụ thuộc ok hoặc skipped
+type ReadinessResponse struct {
+	Status string                      `json:"status"`
+	Checks map[string]DependencyStatus `json:"checks"`
+	Time   string                      `json:"time"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	LoginLockScopeUser = "user"
+	LoginLockScopeIP   = "ip"
+
+	LoginLockEventLocked   = "locked"
+	LoginLockEventUnlocked = "unlocked"
+)
+
+// LoginLockoutEvent là một lần khoá/mở khoá đăng nhập theo username hoặc IP
+type LoginLockoutEvent struct {
+	ID          string     `json:"id"`
+	Scope       string     `json:"scope"`   // user|ip
+	Subject     string     `json:"subject"` // username hoặc IP
+	Event       string     `json:"event"`   // locked|unlocked
+	Failures    int        `json:"failures"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	IP          string     `json:"ip,omitempty"`
+	ActorID     string     `json:"actor_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// BusinessStats là số liệu nghiệp vụ xuất ra /metrics
+type BusinessStats struct {
+	PendingApplications int
+	UnpaidBills         int
+	UnpaidBillAmount    int64
+	AreaResidents       []AreaResidents
+}
+
+// AreaResidents là số sinh viên đang ở (hợp đồng approved còn hiệu lực) của một khu
+type AreaResidents struct {
+	AreaID    string
+	AreaName  string
+	Residents int
+}
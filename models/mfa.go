@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// UserMFA là trạng thái xác thực hai lớp (TOTP) của một tài khoản
+type UserMFA struct {
+	UserID     string     `json:"user_id"`
+	TOTPSecret string     `json:"-"`
+	Enabled    bool       `json:"enabled"`
+	EnabledAt  *time.Time `json:"enabled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// MFARecoveryCode là mã khôi phục (chỉ lưu hash)
+type MFARecoveryCode struct {
+	ID       string
+	UserID   string
+	CodeHash string
+}
+
+// MFAChallengeResponse trả về khi đăng nhập đúng mật khẩu nhưng cần thêm bước xác thực hai lớp
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	EnrollmentRequired bool   `json:"enrollment_required"` // tài khoản thuộc vai trò bắt buộc 2FA nhưng chưa đăng ký
+	MFAToken           string `json:"mfa_token"`
+	ExpiresIn          int    `json:"expires_in"`
+}
+
+// MFAEnrollResponse là secret và link otpauth để người dùng thêm vào app xác thực
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
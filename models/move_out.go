@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+type MoveOutStatus string
+
+const (
+	MoveOutStatusInProgress MoveOutStatus = "in_progress"
+	MoveOutStatusCompleted  MoveOutStatus = "completed"
+)
+
+// Các bước bắt buộc trước khi hợp đồng được đánh dấu finished
+const (
+	MoveOutItemRoomInspection = "room_inspection"
+	MoveOutItemKeyReturn      = "key_return"
+	MoveOutItemElectricBills  = "electric_bills"
+	MoveOutItemDamageCharges  = "damage_charges"
+	MoveOutItemFeeRefund      = "fee_refund"
+)
+
+// MoveOutItemTypes giữ đúng thứ tự hiển thị checklist cho sinh viên
+var MoveOutItemTypes = []string{
+	MoveOutItemRoomInspection,
+	MoveOutItemKeyReturn,
+	MoveOutItemElectricBills,
+	MoveOutItemDamageCharges,
+	MoveOutItemFeeRefund,
+}
+
+const (
+	MoveOutItemStatusPending   = "pending"
+	MoveOutItemStatusCompleted = "completed"
+)
+
+type MoveOutChecklistItem struct {
+	ID          string     `json:"id"`
+	ProcessID   string     `json:"process_id"`
+	ItemType    string     `json:"item_type"`
+	Status      string     `json:"status"` // pending, completed
+	Amount      float64    `json:"amount"` // tiền phạt hư hỏng / tiền hoàn phí tùy loại bước
+	Note        string     `json:"note"`
+	CompletedBy string     `json:"completed_by,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+type MoveOutProcess struct {
+	ID              string                 `json:"id"`
+	ContractID      string                 `json:"contract_id"`
+	CancelRequestID string                 `json:"cancel_request_id,omitempty"`
+	StudentID       string                 `json:"student_id"`
+	Room            string                 `json:"room"`
+	CheckoutDate    time.Time              `json:"checkout_date"`
+	Status          MoveOutStatus          `json:"status"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+	CompletedAt     *time.Time             `json:"completed_at,omitempty"`
+	Items           []MoveOutChecklistItem `json:"items"`
+	Progress        MoveOutProgress        `json:"progress"`
+}
+
+// MoveOutProgress tóm tắt số bước đã hoàn thành để FE hiển thị thanh tiến độ
+type MoveOutProgress struct {
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Loại thông báo gửi tới user
+const (
+	NotificationDormApplicationStatus  = "dorm_application.status"
+	NotificationContractVerified       = "contract.verified"
+	NotificationContractFinished       = "contract.finished"
+	NotificationElectricBillCreated    = "electric_bill.created"
+	NotificationFacilityComplaintState = "facility_complaint.status"
+)
+
+type Notification struct {
+	ID         string          `json:"id"`
+	UserID     string          `json:"user_id"`
+	Type       string          `json:"type"`
+	Title      string          `json:"title"`
+	Body       string          `json:"body,omitempty"`
+	EntityType string          `json:"entity_type,omitempty"`
+	EntityID   string          `json:"entity_id,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	ReadAt     *time.Time      `json:"read_at,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
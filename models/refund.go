@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+type RefundStatus string
+
+const (
+	RefundStatusQuoted   RefundStatus = "quoted"
+	RefundStatusApproved RefundStatus = "approved"
+	RefundStatusRejected RefundStatus = "rejected"
+	RefundStatusPaid     RefundStatus = "paid"
+)
+
+const (
+	RefundSourceFinishContract = "finish_contract"
+	RefundSourceCancelRequest  = "cancel_request"
+)
+
+// RefundQuote là kết quả tính hoàn phí cho một hợp đồng kết thúc sớm
+type RefundQuote struct {
+	ContractID          string    `json:"contract_id"`
+	TerminationDate     time.Time `json:"termination_date"`
+	NoticeDate          time.Time `json:"notice_date"`
+	TotalDays           int       `json:"total_days"`
+	OccupiedDays        int       `json:"occupied_days"`
+	UnusedDays          int       `json:"unused_days"`
+	DailyRate           float64   `json:"daily_rate"`
+	UnusedAmount        float64   `json:"unused_amount"`
+	DepositDeduction    float64   `json:"deposit_deduction"`
+	NoticeShortfallDays int       `json:"notice_shortfall_days"`
+	NoticePenalty       float64   `json:"notice_penalty"`
+	RefundAmount        float64   `json:"refund_amount"`
+}
+
+// RefundLedgerEntry là bản ghi hoàn phí, theo dõi trạng thái tới khi chi trả xong
+type RefundLedgerEntry struct {
+	ID        string `json:"id"`
+	StudentID string `json:"student_id"`
+	MoveOutID string `json:"move_out_id,omitempty"`
+	Source    string `json:"source"`
+	RefundQuote
+	Status          RefundStatus `json:"status"`
+	Note            string       `json:"note"`
+	ApprovedBy      string       `json:"approved_by,omitempty"`
+	ApprovedAt      *time.Time   `json:"approved_at,omitempty"`
+	PaidAt          *time.Time   `json:"paid_at,omitempty"`
+	PayoutReference string       `json:"payout_reference,omitempty"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
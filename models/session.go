@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Session là một phiên đăng nhập (một họ refresh token) của người dùng
+type Session struct {
+	ID         string    `json:"id"` // family_id của họ refresh token
+	UserID     string    `json:"user_id"`
+	TokenID    string    `json:"-"` // token_id hiện tại trên whitelist
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
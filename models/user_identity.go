@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// UserIdentity là danh tính OpenID Connect (provider + sub) đã liên kết với tài khoản
+type UserIdentity struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// OIDCLoginRequest là body FE gửi lên sau khi đăng nhập ở nhà cung cấp OpenID Connect
+type OIDCLoginRequest struct {
+	IDToken string `json:"id_token" binding:"required"`
+	Nonce   string `json:"nonce"` // nonce FE đã gửi khi chuyển hướng đăng nhập, nếu có
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+const (
+	VisitorStatusPending    = "pending"
+	VisitorStatusApproved   = "approved"
+	VisitorStatusRejected   = "rejected"
+	VisitorStatusCancelled  = "cancelled"
+	VisitorStatusCheckedIn  = "checked_in"
+	VisitorStatusCheckedOut = "checked_out"
+)
+
+// VisitorRequest là đăng ký khách thăm của sinh viên, quản túc đang trực duyệt và cấp mã vào cổng
+type VisitorRequest struct {
+	ID          string     `json:"id"`
+	StudentID   string     `json:"student_id"`
+	ContractID  string     `json:"contract_id"`
+	AreaID      string     `json:"area_id"`
+	Room        string     `json:"room"`
+	GuestName   string     `json:"guest_name"`
+	GuestCCCD   string     `json:"guest_cccd"`
+	GuestPhone  string     `json:"guest_phone"`
+	VisitStart  time.Time  `json:"visit_start"`
+	VisitEnd    time.Time  `json:"visit_end"`
+	Overnight   bool       `json:"overnight"`
+	Status      string     `json:"status"` // pending, approved, rejected, cancelled, checked_in, checked_out
+	PassCode    string     `json:"pass_code,omitempty"`
+	ReviewedBy  string     `json:"reviewed_by,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+	ManagerNote string     `json:"manager_note,omitempty"`
+	ArrivedAt   *time.Time `json:"arrived_at,omitempty"`
+	DepartedAt  *time.Time `json:"departed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// VisitingRules là quy định tiếp khách của một khu
+type VisitingRules struct {
+	AreaID            string `json:"area_id"`
+	VisitingStart     string `json:"visiting_start"` // HH:MM
+	VisitingEnd       string `json:"visiting_end"`   // HH:MM
+	OvernightGuestCap int    `json:"overnight_guest_cap"`
+}
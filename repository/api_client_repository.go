@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type APIClientRepository struct {
+	DB *sql.DB
+}
+
+func NewAPIClientRepository(db *sql.DB) *APIClientRepository {
+	return &APIClientRepository{DB: db}
+}
+
+const (
+	apiClientColumns    = `c.id, c.name, COALESCE(c.description, ''), c.scopes, c.status, c.created_by, c.created_at, c.updated_at`
+	apiClientKeyColumns = `k.id, k.client_id, k.prefix, k.key_hash, k.expires_at, k.last_used_at, k.revoked_at, k.created_at`
+)
+
+func scanAPIClient(row rowScanner) (*models.APIClient, error) {
+	var c models.APIClient
+	var createdBy sql.NullString
+	if err := row.Scan(&c.ID, &c.Name, &c.Description, pq.Array(&c.Scopes), &c.Status, &createdBy, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	c.CreatedBy = createdBy.String
+	return &c, nil
+}
+
+func scanAPIClientKey(row rowScanner) (*models.APIClientKey, error) {
+	var k models.APIClientKey
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.ClientID, &k.Prefix, &k.KeyHash, &expiresAt, &lastUsedAt, &revokedAt, &k.CreatedAt); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	return &k, nil
+}
+
+func insertAPIClientKey(ctx context.Context, tx *sql.Tx, k *models.APIClientKey) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO api_client_keys (id, client_id, prefix, key_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		k.ID, k.ClientID, k.Prefix, k.KeyHash, k.ExpiresAt, k.CreatedAt)
+	return err
+}
+
+// Create tạo client cùng khoá đầu tiên trong một transaction
+func (r *APIClientRepository) Create(ctx context.Context, c *models.APIClient, key *models.APIClientKey) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO api_clients (id, name, description, scopes, status, created_by, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $7)`,
+		c.ID, c.Name, nullString(c.Description), pq.Array(c.Scopes), c.Status, nullString(c.CreatedBy), c.CreatedAt); err != nil {
+		return err
+	}
+	if err := insertAPIClientKey(ctx, tx, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetByID lấy client kèm danh sách khoá, nil nếu không tồn tại
+func (r *APIClientRepository) GetByID(ctx context.Context, id string) (*models.APIClient, error) {
+	c, err := scanAPIClient(r.DB.QueryRowContext(ctx, `SELECT `+apiClientColumns+` FROM api_clients c WHERE c.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys, err := r.listKeys(ctx, `WHERE k.client_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	c.Keys = keys
+	return c, nil
+}
+
+// List liệt kê mọi client kèm khoá
+func (r *APIClientRepository) List(ctx context.Context) ([]models.APIClient, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+apiClientColumns+` FROM api_clients c ORDER BY c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.APIClient{}
+	index := map[string]int{}
+	for rows.Next() {
+		c, err := scanAPIClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[c.ID] = len(list)
+		list = append(list, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	keys, err := r.listKeys(ctx, ``)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if i, ok := index[k.ClientID]; ok {
+			list[i].Keys = append(list[i].Keys, k)
+		}
+	}
+	return list, nil
+}
+
+func (r *APIClientRepository) listKeys(ctx context.Context, where string, args ...interface{}) ([]models.APIClientKey, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+apiClientKeyColumns+` FROM api_client_keys k `+where+` ORDER BY k.created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []models.APIClientKey{}
+	for rows.Next() {
+		k, err := scanAPIClientKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// Update sửa tên, mô tả và scope của client
+func (r *APIClientRepository) Update(ctx context.Context, c *models.APIClient) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE api_clients SET name = $1, description = $2, scopes = $3, updated_at = $4 WHERE id = $5`,
+		c.Name, nullString(c.Description), pq.Array(c.Scopes), c.UpdatedAt, c.ID)
+	return err
+}
+
+// Revoke vô hiệu hoá client và toàn bộ khoá của nó
+func (r *APIClientRepository) Revoke(ctx context.Context, id string, at time.Time) (bool, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE api_clients SET status = $1, updated_at = $2 WHERE id = $3 AND status <> $1`, models.APIClientStatusRevoked, at, id)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE api_client_keys SET revoked_at = $1 WHERE client_id = $2 AND revoked_at IS NULL`, at, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// RotateKey thêm khoá mới, các khoá đang hiệu lực của client hết hạn tại graceUntil (không kéo dài khoá sắp hết hạn)
+func (r *APIClientRepository) RotateKey(ctx context.Context, key *models.APIClientKey, graceUntil time.Time) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE api_client_keys SET expires_at = $1
+		WHERE client_id = $2 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $1)`, graceUntil, key.ClientID); err != nil {
+		return err
+	}
+	if err := insertAPIClientKey(ctx, tx, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeKey thu hồi ngay một khoá, trả về false nếu không tìm thấy hoặc đã thu hồi
+func (r *APIClientRepository) RevokeKey(ctx context.Context, clientID, keyID string, at time.Time) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `UPDATE api_client_keys SET revoked_at = $1 WHERE id = $2 AND client_id = $3 AND revoked_at IS NULL`, at, keyID, clientID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetKeyByPrefix tra cứu khoá cùng client khi xác thực request, nil nếu không có
+func (r *APIClientRepository) GetKeyByPrefix(ctx context.Context, prefix string) (*models.APIClientKey, *models.APIClient, error) {
+	row := r.DB.QueryRowContext(ctx, `SELECT `+apiClientKeyColumns+`, `+apiClientColumns+`
+		FROM api_client_keys k JOIN api_clients c ON c.id = k.client_id WHERE k.prefix = $1`, prefix)
+	var k models.APIClientKey
+	var c models.APIClient
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	var createdBy sql.NullString
+	err := row.Scan(&k.ID, &k.ClientID, &k.Prefix, &k.KeyHash, &expiresAt, &lastUsedAt, &revokedAt, &k.CreatedAt,
+		&c.ID, &c.Name, &c.Description, pq.Array(&c.Scopes), &c.Status, &createdBy, &c.CreatedAt, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	c.CreatedBy = createdBy.String
+	return &k, &c, nil
+}
+
+// TouchKey ghi thời điểm dùng gần nhất, tối đa một lần mỗi phút để không ghi DB ở mọi request
+func (r *APIClientRepository) TouchKey(ctx context.Context, keyID string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE api_client_keys SET last_used_at = $1 WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)`,
+		at, keyID, at.Add(-time.Minute))
+	return err
+}
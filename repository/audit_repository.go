@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type AuditRepository struct {
+	DB *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{DB: db}
+}
+
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
+
+// Create ghi một sự kiện, bảng chỉ cho phép thêm
+func (r *AuditRepository) Create(ctx context.Context, e *models.AuditEvent) error {
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO audit_events (id, actor_type, actor_id, actor_roles, action, entity_type, entity_id, before, after, ip, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		e.ID, e.ActorType, nullString(e.ActorID), pq.Array(e.ActorRoles), e.Action, e.EntityType, nullString(e.EntityID),
+		nullJSON(e.Before), nullJSON(e.After), e.IP, e.UserAgent, e.CreatedAt)
+	return err
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func auditWhere(f models.AuditEventFilter) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.ActorID != "" {
+		add("actor_id = $%d", f.ActorID)
+	}
+	if f.Action != "" {
+		add("action LIKE $%d", likeEscaper.Replace(f.Action)+"%")
+	}
+	if f.EntityType != "" {
+		add("entity_type = $%d", f.EntityType)
+	}
+	if f.EntityID != "" {
+		add("entity_id = $%d", f.EntityID)
+	}
+	if f.Query != "" {
+		add("(entity_id ILIKE $%[1]d OR before::text ILIKE $%[1]d OR after::text ILIKE $%[1]d)", "%"+likeEscaper.Replace(f.Query)+"%")
+	}
+	if f.From != nil {
+		add("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("created_at < $%d", *f.To)
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Count đếm số sự kiện khớp bộ lọc (bỏ qua limit/offset)
+func (r *AuditRepository) Count(ctx context.Context, f models.AuditEventFilter) (int, error) {
+	where, args := auditWhere(f)
+	var n int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_events`+where, args...).Scan(&n)
+	return n, err
+}
+
+// Each duyệt các sự kiện khớp bộ lọc, mới nhất trước, dùng cho cả danh sách và xuất CSV
+func (r *AuditRepository) Each(ctx context.Context, f models.AuditEventFilter, fn func(*models.AuditEvent) error) error {
+	where, args := auditWhere(f)
+	query := `SELECT id, actor_type, COALESCE(actor_id, ''), actor_roles, action, entity_type, COALESCE(entity_id, ''), before, after, COALESCE(ip, ''), COALESCE(user_agent, ''), created_at
+		FROM audit_events` + where + ` ORDER BY created_at DESC, id`
+	if f.Limit > 0 {
+		args = append(args, f.Limit, f.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e models.AuditEvent
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.ActorType, &e.ActorID, pq.Array(&e.ActorRoles), &e.Action, &e.EntityType, &e.EntityID, &before, &after, &e.IP, &e.UserAgent, &e.CreatedAt); err != nil {
+			return err
+		}
+		e.Before, e.After = before, after
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// List trả về một trang sự kiện
+func (r *AuditRepository) List(ctx context.Context, f models.AuditEventFilter) ([]models.AuditEvent, error) {
+	list := []models.AuditEvent{}
+	err := r.Each(ctx, f, func(e *models.AuditEvent) error {
+		list = append(list, *e)
+		return nil
+	})
+	return list, err
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type CalendarFeedRepository struct {
+	DB *sql.DB
+}
+
+func NewCalendarFeedRepository(db *sql.DB) *CalendarFeedRepository {
+	return &CalendarFeedRepository{DB: db}
+}
+
+// Rotate thu hồi link cũ (nếu có) và tạo link mới cho user trong một transaction
+func (r *CalendarFeedRepository) Rotate(ctx context.Context, feed *models.CalendarFeed) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE calendar_feeds SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`, feed.CreatedAt, feed.UserID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO calendar_feeds (id, user_id, created_at) VALUES ($1, $2, $3)`, feed.ID, feed.UserID, feed.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetActiveByID lấy link còn hiệu lực, link đã thu hồi trả về nil
+func (r *CalendarFeedRepository) GetActiveByID(ctx context.Context, id string) (*models.CalendarFeed, error) {
+	return r.getActive(ctx, `SELECT id, user_id, created_at FROM calendar_feeds WHERE id = $1 AND revoked_at IS NULL`, id)
+}
+
+func (r *CalendarFeedRepository) GetActiveByUserID(ctx context.Context, userID string) (*models.CalendarFeed, error) {
+	return r.getActive(ctx, `SELECT id, user_id, created_at FROM calendar_feeds WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+}
+
+func (r *CalendarFeedRepository) RevokeByUserID(ctx context.Context, userID string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE calendar_feeds SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`, at, userID)
+	return err
+}
+
+func (r *CalendarFeedRepository) getActive(ctx context.Context, query string, arg string) (*models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	err := r.DB.QueryRowContext(ctx, query, arg).Scan(&feed.ID, &feed.UserID, &feed.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
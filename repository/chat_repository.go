@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type ChatRepository struct {
+	DB *sql.DB
+}
+
+func NewChatRepository(db *sql.DB) *ChatRepository {
+	return &ChatRepository{DB: db}
+}
+
+const chatMessageColumns = `id, channel, sender_id, content, created_at, edited_at, deleted_at`
+
+func scanChatMessage(row rowScanner) (*models.ChatMessage, error) {
+	var m models.ChatMessage
+	var editedAt, deletedAt sql.NullTime
+	if err := row.Scan(&m.ID, &m.Channel, &m.SenderID, &m.Content, &m.CreatedAt, &editedAt, &deletedAt); err != nil {
+		return nil, err
+	}
+	if editedAt.Valid {
+		m.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		m.DeletedAt = &deletedAt.Time
+	}
+	return &m, nil
+}
+
+func (r *ChatRepository) CreateMessage(ctx context.Context, m *models.ChatMessage) error {
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO chat_messages (id, channel, sender_id, content, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		m.ID, m.Channel, m.SenderID, m.Content, m.CreatedAt)
+	return err
+}
+
+// GetMessage lấy một tin nhắn, nil nếu không tồn tại
+func (r *ChatRepository) GetMessage(ctx context.Context, id string) (*models.ChatMessage, error) {
+	m, err := scanChatMessage(r.DB.QueryRowContext(ctx, `SELECT `+chatMessageColumns+` FROM chat_messages WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return m, err
+}
+
+// ListMessages trả về tối đa limit tin nhắn của channel, mới nhất trước.
+// before là id tin nhắn làm mốc phân trang (lấy các tin cũ hơn), rỗng là từ mới nhất.
+func (r *ChatRepository) ListMessages(ctx context.Context, channel, before string, limit int) ([]models.ChatMessage, error) {
+	query := `SELECT ` + chatMessageColumns + ` FROM chat_messages WHERE channel = $1`
+	args := []interface{}{channel, limit}
+	if before != "" {
+		query += ` AND (created_at, id) < (SELECT created_at, id FROM chat_messages WHERE id = $3)`
+		args = append(args, before)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT $2`
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.ChatMessage{}
+	for rows.Next() {
+		m, err := scanChatMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *m)
+	}
+	return list, rows.Err()
+}
+
+// EditMessage sửa nội dung tin nhắn chưa bị xoá
+func (r *ChatRepository) EditMessage(ctx context.Context, id, content string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE chat_messages SET content = $1, edited_at = $2 WHERE id = $3 AND deleted_at IS NULL`, content, at, id)
+	return err
+}
+
+// DeleteMessage xoá mềm tin nhắn, giữ lại dòng để phân trang và xác nhận đã đọc không bị lệch
+func (r *ChatRepository) DeleteMessage(ctx context.Context, id string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE chat_messages SET content = '', deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`, at, id)
+	return err
+}
+
+// MarkRead ghi tin nhắn cuối cùng user đã đọc, không lùi về tin cũ hơn
+func (r *ChatRepository) MarkRead(ctx context.Context, channel, userID, messageID string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO chat_read_receipts (channel, user_id, last_read_message_id, read_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (channel, user_id) DO UPDATE SET last_read_message_id = EXCLUDED.last_read_message_id, read_at = EXCLUDED.read_at
+		WHERE (SELECT created_at FROM chat_messages WHERE id = chat_read_receipts.last_read_message_id)
+			<= (SELECT created_at FROM chat_messages WHERE id = EXCLUDED.last_read_message_id)`,
+		channel, userID, messageID, at)
+	return err
+}
+
+// ListReadReceipts liệt kê xác nhận đã đọc của mọi thành viên trong channel
+func (r *ChatRepository) ListReadReceipts(ctx context.Context, channel string) ([]models.ChatReadReceipt, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT channel, user_id, last_read_message_id, read_at FROM chat_read_receipts WHERE channel = $1 ORDER BY read_at DESC`, channel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.ChatReadReceipt{}
+	for rows.Next() {
+		var rr models.ChatReadReceipt
+		if err := rows.Scan(&rr.Channel, &rr.UserID, &rr.LastReadMessageID, &rr.ReadAt); err != nil {
+			return nil, err
+		}
+		list = append(list, rr)
+	}
+	return list, rows.Err()
+}
+
+// chatUnreadCountSQL trả về truy vấn con đếm tin người khác gửi sau tin cuối cùng user đã đọc.
+// channel và user là biểu thức SQL (tham số hoặc cột của truy vấn ngoài), không bao giờ là dữ liệu từ client.
+func chatUnreadCountSQL(channel, user string) string {
+	return `(SELECT COUNT(*) FROM chat_messages m
+	WHERE m.channel = ` + channel + ` AND m.sender_id::text <> ` + user + ` AND m.deleted_at IS NULL
+	  AND m.created_at > COALESCE((SELECT lm.created_at FROM chat_read_receipts rr JOIN chat_messages lm ON lm.id = rr.last_read_message_id
+		WHERE rr.channel = ` + channel + ` AND rr.user_id::text = ` + user + `), '-infinity'::timestamp))`
+}
+
+// chatUnreadQuery đếm tin chưa đọc của user trong một channel ($1 = channel, $2 = user)
+var chatUnreadQuery = `SELECT ` + chatUnreadCountSQL("$1", "$2")
+
+// UnreadCount số tin chưa đọc của user trong channel
+func (r *ChatRepository) UnreadCount(ctx context.Context, channel, userID string) (int, error) {
+	var n int
+	err := r.DB.QueryRowContext(ctx, chatUnreadQuery, channel, userID).Scan(&n)
+	return n, err
+}
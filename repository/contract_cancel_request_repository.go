@@ -89,6 +89,36 @@ func (r *ContractCancelRequestRepository) Update(ctx context.Context, req *model
 	return err
 }
 
+// Approve duyệt yêu cầu (chỉ khi còn pending), mở quy trình trả phòng và lưu báo giá hoàn phí (nếu có) trong cùng transaction.
+// Trả về false nếu yêu cầu đã được xử lý trước đó, ErrContractNotApproved nếu hợp đồng đã kết thúc.
+func (r *ContractCancelRequestRepository) Approve(ctx context.Context, req *models.ContractCancelRequest, moveOut *models.MoveOutProcess, refund *models.RefundLedgerEntry) (bool, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if _, err := lockApprovedContract(ctx, tx, moveOut.ContractID); err != nil {
+		return false, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE contract_cancel_requests SET status=$1, manager_note=$2, updated_at=$3, processed_at=$4 WHERE id=$5 AND status='pending'`,
+		req.Status, req.ManagerNote, req.UpdatedAt, req.ProcessedAt, req.ID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := insertMoveOutProcess(ctx, tx, moveOut); err != nil {
+		return false, err
+	}
+	if refund != nil {
+		if err := insertRefundEntry(ctx, tx, refund); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
 func (r *ContractCancelRequestRepository) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM contract_cancel_requests WHERE id = $1`
 	_, err := r.DB.ExecContext(ctx, query, id)
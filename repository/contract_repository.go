@@ -4,6 +4,7 @@ import (
 	"Backend_Dorm_PTIT/models"
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -234,11 +235,15 @@ func (r *ContractRepository) GetResidentsFromApprovedContractsByRoom(ctx context
 	return residents, nil
 }
 
-// HasApprovedContractInRoom kiểm tra user (sinh viên) có hợp đồng approved tại một phòng cụ thể hay không
-func (r *ContractRepository) HasApprovedContractInRoom(ctx context.Context, userID string, room string) (bool, error) {
-	query := `SELECT 1 FROM contracts WHERE student_id = $1 AND room = $2 AND status = 'approved' LIMIT 1`
+// HasApprovedContractInRoom kiểm tra user (sinh viên) có hợp đồng approved tại một phòng của một khu hay không.
+// Phòng không gắn với khu trong DB nên khu lấy theo preferred_dorm của đơn đã được duyệt thành hợp đồng.
+func (r *ContractRepository) HasApprovedContractInRoom(ctx context.Context, userID string, areaID string, room string) (bool, error) {
+	query := `SELECT 1 FROM contracts c
+		JOIN dorm_applications da ON da.id = c.dorm_application_id
+		JOIN dorm_areas a ON da.preferred_dorm IN (a.id, a.name)
+		WHERE c.student_id = $1 AND a.id = $2 AND c.room = $3 AND c.status = 'approved' LIMIT 1`
 	var tmp int
-	err := r.DB.QueryRowContext(ctx, query, userID, room).Scan(&tmp)
+	err := r.DB.QueryRowContext(ctx, query, userID, areaID, room).Scan(&tmp)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -250,8 +255,61 @@ func (r *ContractRepository) HasApprovedContractInRoom(ctx context.Context, user
 
 // FinishContract set contract status = "finished"
 func (r *ContractRepository) FinishContract(ctx context.Context, contractID string, reason string) error {
+	return finishContract(ctx, r.DB, contractID, reason)
+}
+
+var ErrContractNotApproved = errors.New("contract is not approved")
+
+// Finish kết thúc hợp đồng đang approved, chuyển sinh viên về guest và lưu báo giá hoàn phí (nếu có) trong cùng transaction.
+// Từ chối khi hợp đồng đang có quy trình trả phòng, vì hợp đồng đó sẽ được kết thúc khi checklist hoàn tất.
+func (r *ContractRepository) Finish(ctx context.Context, contractID string, reason string, refund *models.RefundLedgerEntry) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	studentID, err := lockApprovedContract(ctx, tx, contractID)
+	if err != nil {
+		return err
+	}
+	var moveOutActive bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM move_out_processes WHERE contract_id = $1 AND status = 'in_progress')`, contractID).Scan(&moveOutActive); err != nil {
+		return err
+	}
+	if moveOutActive {
+		return ErrMoveOutInProgress
+	}
+	if err := finishContract(ctx, tx, contractID, reason); err != nil {
+		return err
+	}
+	if err := setUserRoleByName(ctx, tx, studentID, "guest"); err != nil {
+		return err
+	}
+	if refund != nil {
+		if err := insertRefundEntry(ctx, tx, refund); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// lockApprovedContract khóa dòng hợp đồng tới hết transaction, trả về ErrContractNotApproved nếu hợp đồng không còn approved
+func lockApprovedContract(ctx context.Context, tx *sql.Tx, contractID string) (string, error) {
+	var studentID string
+	var status models.ContractStatus
+	err := tx.QueryRowContext(ctx, `SELECT student_id, status FROM contracts WHERE id = $1 FOR UPDATE`, contractID).Scan(&studentID, &status)
+	if err != nil {
+		return "", err
+	}
+	if status != models.ContractStatusApproved {
+		return "", ErrContractNotApproved
+	}
+	return studentID, nil
+}
+
+func finishContract(ctx context.Context, db dbExecutor, contractID string, reason string) error {
 	query := `UPDATE contracts SET status = 'finished', note = COALESCE(note, '') || ' | Kết thúc: ' || $1, updated_at = NOW() WHERE id = $2`
-	_, err := r.DB.ExecContext(ctx, query, reason, contractID)
+	_, err := db.ExecContext(ctx, query, reason, contractID)
 	return err
 }
 
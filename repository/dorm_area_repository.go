@@ -47,3 +47,30 @@ func (r *DormAreaRepository) GetAll(ctx context.Context) ([]*models.DormArea, er
 	}
 	return areas, nil
 }
+
+// GetByIDOrName tìm khu theo id hoặc tên, dùng cho preferred_dorm của đơn đăng ký (lưu id hoặc tên khu)
+func (r *DormAreaRepository) GetByIDOrName(ctx context.Context, key string) (*models.DormArea, error) {
+	var area models.DormArea
+	err := r.DB.QueryRowContext(ctx, `SELECT id, name, branch, address, fee, description, image, status FROM dorm_areas WHERE $1 IN (id, name) ORDER BY id = $1 DESC LIMIT 1`, key).
+		Scan(&area.ID, &area.Name, &area.Branch, &area.Address, &area.Fee, &area.Description, &area.Image, &area.Status)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &area, nil
+}
+
+func (r *DormAreaRepository) GetByID(ctx context.Context, id string) (*models.DormArea, error) {
+	var area models.DormArea
+	err := r.DB.QueryRowContext(ctx, `SELECT id, name, branch, address, fee, description, image, status FROM dorm_areas WHERE id=$1`, id).
+		Scan(&area.ID, &area.Name, &area.Branch, &area.Address, &area.Fee, &area.Description, &area.Image, &area.Status)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &area, nil
+}
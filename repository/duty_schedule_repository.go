@@ -7,13 +7,17 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type DutyScheduleWithStaff struct {
 	ID          uuid.UUID  `json:"id"`
 	Date        string     `json:"date"`
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     time.Time  `json:"end_time"`
 	AreaID      string     `json:"area_id"`
 	Description string     `json:"description"`
+	RotationID  string     `json:"rotation_id,omitempty"`
 	Staff       *StaffInfo `json:"staff"`
 }
 
@@ -33,13 +37,22 @@ func NewDutyScheduleRepository(db *sql.DB) *DutyScheduleRepository {
 	return &DutyScheduleRepository{db: db}
 }
 
+const dutyScheduleWithStaffQuery = `
+		 SELECT ds.id, ds.date, ds.start_time, ds.end_time, ds.area_id, ds.description, ds.rotation_id,
+			 u.id, u.email, u.username, m.fullname, m.avatar
+		 FROM duty_schedules ds
+		 JOIN managers m ON ds.staff_id = m.id
+		 JOIN users u ON m.id = u.id`
+
 func (r *DutyScheduleRepository) CreateDutySchedule(ctx context.Context, ds *models.DutySchedule) error {
-	_, err := r.db.ExecContext(ctx, `INSERT INTO duty_schedules (id, date, area_id, staff_id, description) VALUES ($1, $2, $3, $4, $5)`, ds.ID, ds.Date, ds.AreaID, ds.StaffID, ds.Description)
+	_, err := r.db.ExecContext(ctx, `INSERT INTO duty_schedules (id, date, start_time, end_time, area_id, staff_id, description, rotation_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		ds.ID, ds.Date, ds.StartTime, ds.EndTime, ds.AreaID, ds.StaffID, ds.Description, nullString(ds.RotationID))
 	return err
 }
 
 func (r *DutyScheduleRepository) UpdateDutySchedule(ctx context.Context, ds *models.DutySchedule) error {
-	_, err := r.db.ExecContext(ctx, `UPDATE duty_schedules SET date=$1, area_id=$2, staff_id=$3, description=$4 WHERE id=$5`, ds.Date, ds.AreaID, ds.StaffID, ds.Description, ds.ID)
+	_, err := r.db.ExecContext(ctx, `UPDATE duty_schedules SET date=$1, start_time=$2, end_time=$3, area_id=$4, staff_id=$5, description=$6 WHERE id=$7`,
+		ds.Date, ds.StartTime, ds.EndTime, ds.AreaID, ds.StaffID, ds.Description, ds.ID)
 	return err
 }
 
@@ -49,23 +62,220 @@ func (r *DutyScheduleRepository) DeleteDutySchedule(ctx context.Context, id uuid
 }
 
 func (r *DutyScheduleRepository) GetDutyScheduleByID(ctx context.Context, id uuid.UUID) (*models.DutySchedule, error) {
-	row := r.db.QueryRowContext(ctx, `SELECT id, date, area_id, staff_id, description FROM duty_schedules WHERE id=$1`, id)
-	var ds models.DutySchedule
-	err := row.Scan(&ds.ID, &ds.Date, &ds.AreaID, &ds.StaffID, &ds.Description)
+	row := r.db.QueryRowContext(ctx, `SELECT id, date, start_time, end_time, area_id, staff_id, description, rotation_id FROM duty_schedules WHERE id=$1`, id)
+	ds, err := scanDutySchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ds, err
+}
+
+func (r *DutyScheduleRepository) ListDutySchedules(ctx context.Context) ([]DutyScheduleWithStaff, error) {
+	return r.listWithStaff(ctx, dutyScheduleWithStaffQuery+` ORDER BY ds.start_time DESC`)
+}
+
+// ListOnDuty lấy các ca trực đang diễn ra tại thời điểm at, lọc theo khu nếu truyền areaID
+func (r *DutyScheduleRepository) ListOnDuty(ctx context.Context, areaID string, at time.Time) ([]DutyScheduleWithStaff, error) {
+	if areaID != "" {
+		return r.listWithStaff(ctx, dutyScheduleWithStaffQuery+` WHERE ds.area_id = $1 AND ds.start_time <= $2 AND ds.end_time > $2 ORDER BY ds.start_time`, areaID, at)
+	}
+	return r.listWithStaff(ctx, dutyScheduleWithStaffQuery+` WHERE ds.start_time <= $1 AND ds.end_time > $1 ORDER BY ds.area_id, ds.start_time`, at)
+}
+
+// ListByStaffID lấy các ca trực của một quản túc kết thúc sau thời điểm from
+func (r *DutyScheduleRepository) ListByStaffID(ctx context.Context, staffID string, from time.Time) ([]models.DutySchedule, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, date, start_time, end_time, area_id, staff_id, description, rotation_id FROM duty_schedules WHERE staff_id = $1 AND end_time > $2 ORDER BY start_time`, staffID, from)
 	if err != nil {
 		return nil, err
 	}
-	return &ds, nil
+	defer rows.Close()
+	var schedules []models.DutySchedule
+	for rows.Next() {
+		ds, err := scanDutySchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *ds)
+	}
+	return schedules, rows.Err()
 }
 
-func (r *DutyScheduleRepository) ListDutySchedules(ctx context.Context) ([]DutyScheduleWithStaff, error) {
+// FindConflicts tìm các ca trực bị trùng giờ với ca [start, end) của cùng quản túc hoặc cùng khu.
+// excludeIDs là các ca được bỏ qua (vd: chính ca đang sửa, hai ca đang đổi cho nhau).
+func (r *DutyScheduleRepository) FindConflicts(ctx context.Context, staffID uuid.UUID, areaID string, start, end time.Time, excludeIDs ...uuid.UUID) ([]models.DutySchedule, error) {
+	exclude := make([]string, 0, len(excludeIDs))
+	for _, id := range excludeIDs {
+		exclude = append(exclude, id.String())
+	}
 	rows, err := r.db.QueryContext(ctx, `
-		 SELECT ds.id, ds.date, ds.area_id, ds.description,
-			 u.id, u.email, u.username, m.fullname, m.avatar
-		 FROM duty_schedules ds
-		 JOIN managers m ON ds.staff_id = m.id
-		 JOIN users u ON m.id = u.id
-		 ORDER BY ds.date DESC`)
+		SELECT id, date, start_time, end_time, area_id, staff_id, description, rotation_id
+		FROM duty_schedules
+		WHERE (staff_id = $1 OR area_id = $2)
+		  AND start_time < $4 AND end_time > $3
+		  AND NOT (id::text = ANY($5))
+		ORDER BY start_time`, staffID, areaID, start, end, pq.Array(exclude))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var conflicts []models.DutySchedule
+	for rows.Next() {
+		ds, err := scanDutySchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, *ds)
+	}
+	return conflicts, rows.Err()
+}
+
+// CreateRotation lưu lịch trực lặp lại và toàn bộ ca trực sinh ra trong một transaction
+func (r *DutyScheduleRepository) CreateRotation(ctx context.Context, rot *models.DutyRotation, schedules []models.DutySchedule) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `INSERT INTO duty_rotations (id, area_id, staff_id, weekdays, shift_start, shift_end, semester_start, semester_end, description, created_by, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`,
+		rot.ID, rot.AreaID, rot.StaffID, pq.Array(rot.Weekdays), rot.ShiftStart, rot.ShiftEnd, rot.SemesterStart, rot.SemesterEnd, rot.Description, nullString(rot.CreatedBy), rot.CreatedAt)
+	if err != nil {
+		return err
+	}
+	for _, ds := range schedules {
+		_, err = tx.ExecContext(ctx, `INSERT INTO duty_schedules (id, date, start_time, end_time, area_id, staff_id, description, rotation_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			ds.ID, ds.Date, ds.StartTime, ds.EndTime, ds.AreaID, ds.StaffID, ds.Description, rot.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const dutyRotationColumns = `id, area_id, staff_id, weekdays, shift_start, shift_end, semester_start, semester_end, description, created_by, created_at`
+
+func (r *DutyScheduleRepository) ListRotations(ctx context.Context) ([]models.DutyRotation, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+dutyRotationColumns+` FROM duty_rotations ORDER BY semester_start DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rotations []models.DutyRotation
+	for rows.Next() {
+		rot, err := scanDutyRotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		rotations = append(rotations, *rot)
+	}
+	return rotations, rows.Err()
+}
+
+func (r *DutyScheduleRepository) GetRotationByID(ctx context.Context, id string) (*models.DutyRotation, error) {
+	rot, err := scanDutyRotation(r.db.QueryRowContext(ctx, `SELECT `+dutyRotationColumns+` FROM duty_rotations WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rot, err
+}
+
+// DeleteRotation xóa lịch lặp cùng các ca chưa bắt đầu, các ca đã qua được giữ lại làm lịch sử.
+// Trả về số ca đã xóa.
+func (r *DutyScheduleRepository) DeleteRotation(ctx context.Context, id string, from time.Time) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `DELETE FROM duty_schedules WHERE rotation_id = $1 AND start_time >= $2`, id, from)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM duty_rotations WHERE id = $1`, id); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// IsManager kiểm tra user có vai trò quản túc hay không
+func (r *DutyScheduleRepository) IsManager(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM user_roles ur
+			JOIN roles ro ON ur.role_id = ro.id
+			JOIN managers m ON m.id = ur.user_id
+			WHERE ur.user_id = $1 AND ro.name = 'manager'
+		)`, userID).Scan(&exists)
+	return exists, err
+}
+
+func (r *DutyScheduleRepository) CreateSwapRequest(ctx context.Context, req *models.DutySwapRequest) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO duty_swap_requests (id, schedule_id, requester_id, target_staff_id, target_schedule_id, reason, status, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		req.ID, req.ScheduleID, req.RequesterID, req.TargetStaffID, nullString(req.TargetScheduleID), req.Reason, req.Status, req.CreatedAt, req.UpdatedAt)
+	return err
+}
+
+const dutySwapColumns = `id, schedule_id, requester_id, target_staff_id, target_schedule_id, reason, status, reviewed_by, reviewed_at, created_at, updated_at`
+
+func (r *DutyScheduleRepository) GetSwapRequestByID(ctx context.Context, id string) (*models.DutySwapRequest, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+dutySwapColumns+` FROM duty_swap_requests WHERE id = $1`, id)
+	req, err := scanDutySwapRequest(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return req, err
+}
+
+// ListSwapRequests lấy yêu cầu đổi ca liên quan tới userID (gửi đi hoặc nhận), userID rỗng thì lấy tất cả
+func (r *DutyScheduleRepository) ListSwapRequests(ctx context.Context, userID string, status string) ([]models.DutySwapRequest, error) {
+	query := `SELECT ` + dutySwapColumns + ` FROM duty_swap_requests WHERE ($1 = '' OR requester_id::text = $1 OR target_staff_id::text = $1) AND ($2 = '' OR status = $2) ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var requests []models.DutySwapRequest
+	for rows.Next() {
+		req, err := scanDutySwapRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *req)
+	}
+	return requests, rows.Err()
+}
+
+// ReviewSwapRequest cập nhật trạng thái yêu cầu đổi ca.
+// Khi duyệt (approved), ca trực được đổi người trực trong cùng transaction.
+func (r *DutyScheduleRepository) ReviewSwapRequest(ctx context.Context, req *models.DutySwapRequest, status string, reviewerID string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if status == models.DutySwapStatusApproved {
+		if _, err := tx.ExecContext(ctx, `UPDATE duty_schedules SET staff_id = $1 WHERE id = $2`, req.TargetStaffID, req.ScheduleID); err != nil {
+			return err
+		}
+		if req.TargetScheduleID != "" {
+			if _, err := tx.ExecContext(ctx, `UPDATE duty_schedules SET staff_id = $1 WHERE id = $2`, req.RequesterID, req.TargetScheduleID); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE duty_swap_requests SET status = $1, reviewed_by = $2, reviewed_at = $3, updated_at = $3 WHERE id = $4`,
+		status, nullString(reviewerID), at, req.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *DutyScheduleRepository) listWithStaff(ctx context.Context, query string, args ...interface{}) ([]DutyScheduleWithStaff, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -75,8 +285,9 @@ func (r *DutyScheduleRepository) ListDutySchedules(ctx context.Context) ([]DutyS
 		var ds DutyScheduleWithStaff
 		var staff StaffInfo
 		var dateRaw interface{}
-		if err := rows.Scan(&ds.ID, &dateRaw, &ds.AreaID, &ds.Description,
-			&staff.ID, &staff.Email, &staff.Username, &staff.FullName, &staff.Avatar); err != nil {
+		var description, rotationID, avatar sql.NullString
+		if err := rows.Scan(&ds.ID, &dateRaw, &ds.StartTime, &ds.EndTime, &ds.AreaID, &description, &rotationID,
+			&staff.ID, &staff.Email, &staff.Username, &staff.FullName, &avatar); err != nil {
 			return nil, err
 		}
 		// Convert dateRaw to string (YYYY-MM-DD)
@@ -88,8 +299,58 @@ func (r *DutyScheduleRepository) ListDutySchedules(ctx context.Context) ([]DutyS
 		default:
 			ds.Date = ""
 		}
+		ds.Description = description.String
+		ds.RotationID = rotationID.String
+		staff.Avatar = avatar.String
 		ds.Staff = &staff
 		result = append(result, ds)
 	}
-	return result, nil
+	return result, rows.Err()
+}
+
+func scanDutySchedule(row rowScanner) (*models.DutySchedule, error) {
+	var ds models.DutySchedule
+	var description, rotationID sql.NullString
+	if err := row.Scan(&ds.ID, &ds.Date, &ds.StartTime, &ds.EndTime, &ds.AreaID, &ds.StaffID, &description, &rotationID); err != nil {
+		return nil, err
+	}
+	ds.Description = description.String
+	ds.RotationID = rotationID.String
+	return &ds, nil
+}
+
+func scanDutyRotation(row rowScanner) (*models.DutyRotation, error) {
+	var rot models.DutyRotation
+	var weekdays pq.Int64Array
+	var description, createdBy sql.NullString
+	if err := row.Scan(&rot.ID, &rot.AreaID, &rot.StaffID, &weekdays, &rot.ShiftStart, &rot.ShiftEnd, &rot.SemesterStart, &rot.SemesterEnd, &description, &createdBy, &rot.CreatedAt); err != nil {
+		return nil, err
+	}
+	for _, d := range weekdays {
+		rot.Weekdays = append(rot.Weekdays, int(d))
+	}
+	rot.Description = description.String
+	rot.CreatedBy = createdBy.String
+	return &rot, nil
+}
+
+func scanDutySwapRequest(row rowScanner) (*models.DutySwapRequest, error) {
+	var req models.DutySwapRequest
+	var targetScheduleID, reason, reviewedBy sql.NullString
+	var reviewedAt sql.NullTime
+	if err := row.Scan(&req.ID, &req.ScheduleID, &req.RequesterID, &req.TargetStaffID, &targetScheduleID, &reason, &req.Status, &reviewedBy, &reviewedAt, &req.CreatedAt, &req.UpdatedAt); err != nil {
+		return nil, err
+	}
+	req.TargetScheduleID = targetScheduleID.String
+	req.Reason = reason.String
+	req.ReviewedBy = reviewedBy.String
+	if reviewedAt.Valid {
+		req.ReviewedAt = &reviewedAt.Time
+	}
+	return &req, nil
+}
+
+// nullString chuyển chuỗi rỗng thành NULL khi ghi vào DB
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
@@ -97,4 +97,24 @@ func (r *ElectricBillRepository) ConfirmByStudent(ctx context.Context, id string
 	query := `UPDATE electric_bills SET is_confirmed=TRUE, updated_at=NOW() WHERE id=$1`
 	_, err := r.DB.ExecContext(ctx, query, id)
 	return err
-}
\ No newline at end of file
+}
+
+// ListUnpaidByRoom lấy các hóa đơn điện chưa thanh toán của một phòng
+func (r *ElectricBillRepository) ListUnpaidByRoom(ctx context.Context, roomID string) ([]models.ElectricBill, error) {
+	query := `SELECT id, room_id, month, prev_electric, curr_electric, amount, is_confirmed, payment_status, payment_proof, created_at, updated_at FROM electric_bills WHERE room_id = $1 AND payment_status <> 'paid' ORDER BY month ASC`
+	rows, err := r.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var bills []models.ElectricBill
+	for rows.Next() {
+		var bill models.ElectricBill
+		err := rows.Scan(&bill.ID, &bill.RoomID, &bill.Month, &bill.PrevElectric, &bill.CurrElectric, &bill.Amount, &bill.IsConfirmed, &bill.PaymentStatus, &bill.PaymentProof, &bill.CreatedAt, &bill.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		bills = append(bills, bill)
+	}
+	return bills, nil
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type GateRepository struct {
+	DB *sql.DB
+}
+
+func NewGateRepository(db *sql.DB) *GateRepository {
+	return &GateRepository{DB: db}
+}
+
+// GateEventFilter là điều kiện lọc nhật ký ra/vào, trường rỗng thì bỏ qua
+type GateEventFilter struct {
+	StudentID string
+	AreaID    string
+	From      *time.Time
+	To        *time.Time
+	LateOnly  bool
+	Limit     int
+	Offset    int
+}
+
+func (r *GateRepository) Create(ctx context.Context, e *models.GateEvent) error {
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO gate_events (id, student_id, contract_id, area_id, direction, occurred_at, is_late, recorded_by, note) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		e.ID, e.StudentID, e.ContractID, e.AreaID, e.Direction, e.OccurredAt, e.IsLate, nullString(e.RecordedBy), e.Note)
+	return err
+}
+
+// List lấy nhật ký ra/vào mới nhất trước, kèm tên sinh viên và phòng
+func (r *GateRepository) List(ctx context.Context, f GateEventFilter) ([]models.GateEventWithStudent, error) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, strings.Replace(cond, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+	if f.StudentID != "" {
+		add("g.student_id::text = ?", f.StudentID)
+	}
+	if f.AreaID != "" {
+		add("g.area_id = ?", f.AreaID)
+	}
+	if f.From != nil {
+		add("g.occurred_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		add("g.occurred_at < ?", *f.To)
+	}
+	if f.LateOnly {
+		conds = append(conds, "g.is_late = TRUE")
+	}
+	query := `SELECT g.id, g.student_id, g.contract_id, g.area_id, g.direction, g.occurred_at, g.is_late, g.recorded_by, g.note, s.fullname, c.room
+		FROM gate_events g
+		JOIN students s ON s.id = g.student_id
+		JOIN contracts c ON c.id = g.contract_id`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, f.Offset)
+	query += " ORDER BY g.occurred_at DESC LIMIT $" + strconv.Itoa(len(args)-1) + " OFFSET $" + strconv.Itoa(len(args))
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []models.GateEventWithStudent
+	for rows.Next() {
+		var e models.GateEventWithStudent
+		var recordedBy, note, room sql.NullString
+		if err := rows.Scan(&e.ID, &e.StudentID, &e.ContractID, &e.AreaID, &e.Direction, &e.OccurredAt, &e.IsLate, &recordedBy, &note, &e.FullName, &room); err != nil {
+			return nil, err
+		}
+		e.RecordedBy = recordedBy.String
+		e.Note = note.String
+		e.Room = room.String
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ListOvernightAbsences lấy sinh viên (còn hợp đồng approved) có lượt gần nhất trước cutoff là "out",
+// tức là đã ra cổng và chưa quay lại trước giờ mở cổng sáng hôm sau.
+func (r *GateRepository) ListOvernightAbsences(ctx context.Context, cutoff time.Time, areaID string) ([]models.OvernightAbsence, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT last.student_id, s.fullname, c.room, last.area_id, last.occurred_at
+		FROM (
+			SELECT DISTINCT ON (student_id) student_id, contract_id, area_id, direction, occurred_at
+			FROM gate_events
+			WHERE occurred_at < $1
+			ORDER BY student_id, occurred_at DESC
+		) last
+		JOIN students s ON s.id = last.student_id
+		JOIN contracts c ON c.id = last.contract_id AND c.status = 'approved'
+		WHERE last.direction = 'out' AND ($2 = '' OR last.area_id = $2)
+		ORDER BY last.occurred_at`, cutoff, areaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var absences []models.OvernightAbsence
+	for rows.Next() {
+		var a models.OvernightAbsence
+		var room sql.NullString
+		if err := rows.Scan(&a.StudentID, &a.FullName, &room, &a.AreaID, &a.LeftAt); err != nil {
+			return nil, err
+		}
+		a.Room = room.String
+		absences = append(absences, a)
+	}
+	return absences, rows.Err()
+}
+
+// GetCurfew lấy giờ giới nghiêm riêng của khu. found = false nếu khu không tồn tại.
+func (r *GateRepository) GetCurfew(ctx context.Context, areaID string) (curfew string, found bool, err error) {
+	var c sql.NullString
+	err = r.DB.QueryRowContext(ctx, `SELECT curfew FROM dorm_areas WHERE id = $1`, areaID).Scan(&c)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return c.String, true, nil
+}
+
+// SetCurfew đặt giờ giới nghiêm riêng cho khu, chuỗi rỗng để dùng giờ mặc định
+func (r *GateRepository) SetCurfew(ctx context.Context, areaID string, curfew string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE dorm_areas SET curfew = $1 WHERE id = $2`, nullString(curfew), areaID)
+	return err
+}
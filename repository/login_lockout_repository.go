@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+)
+
+type LoginLockoutRepository struct {
+	DB *sql.DB
+}
+
+func NewLoginLockoutRepository(db *sql.DB) *LoginLockoutRepository {
+	return &LoginLockoutRepository{DB: db}
+}
+
+func (r *LoginLockoutRepository) Create(ctx context.Context, e *models.LoginLockoutEvent) error {
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO login_lockout_events (id, scope, subject, event, failures, locked_until, ip, actor_id, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		e.ID, e.Scope, e.Subject, e.Event, e.Failures, e.LockedUntil, nullString(e.IP), nullString(e.ActorID), e.CreatedAt)
+	return err
+}
+
+// List lấy nhật ký khoá/mở khoá mới nhất trước, lọc theo subject (username/IP) nếu truyền vào
+func (r *LoginLockoutRepository) List(ctx context.Context, subject string, limit, offset int) ([]models.LoginLockoutEvent, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, scope, subject, event, failures, locked_until, ip, actor_id, created_at
+		FROM login_lockout_events WHERE ($1 = '' OR subject = $1) ORDER BY created_at DESC LIMIT $2 OFFSET $3`, subject, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []models.LoginLockoutEvent
+	for rows.Next() {
+		var e models.LoginLockoutEvent
+		var lockedUntil sql.NullTime
+		var ip, actorID sql.NullString
+		if err := rows.Scan(&e.ID, &e.Scope, &e.Subject, &e.Event, &e.Failures, &lockedUntil, &ip, &actorID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if lockedUntil.Valid {
+			e.LockedUntil = &lockedUntil.Time
+		}
+		e.IP = ip.String
+		e.ActorID = actorID.String
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
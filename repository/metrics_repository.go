@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+)
+
+// MetricsRepository đọc số liệu nghiệp vụ cho /metrics
+type MetricsRepository struct {
+	DB *sql.DB
+}
+
+func NewMetricsRepository(db *sql.DB) *MetricsRepository {
+	return &MetricsRepository{DB: db}
+}
+
+// BusinessStats đếm đơn chờ duyệt, hoá đơn điện chưa thanh toán và số sinh viên đang ở theo khu.
+// Phòng không gắn với khu trong DB nên khu của sinh viên lấy theo preferred_dorm của đơn đã được duyệt thành hợp đồng.
+func (r *MetricsRepository) BusinessStats(ctx context.Context) (*models.BusinessStats, error) {
+	stats := &models.BusinessStats{AreaResidents: []models.AreaResidents{}}
+	err := r.DB.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM dorm_applications WHERE status = 'pending'),
+		(SELECT COUNT(*) FROM electric_bills WHERE payment_status = 'unpaid'),
+		(SELECT COALESCE(SUM(amount), 0) FROM electric_bills WHERE payment_status = 'unpaid')`).
+		Scan(&stats.PendingApplications, &stats.UnpaidBills, &stats.UnpaidBillAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT a.id, a.name, COUNT(c.id)
+		FROM dorm_areas a
+		LEFT JOIN dorm_applications da ON da.preferred_dorm IN (a.id, a.name)
+		LEFT JOIN contracts c ON c.dorm_application_id = da.id AND c.status = 'approved'
+			AND c.start_date <= NOW() AND c.end_date > NOW()
+		GROUP BY a.id, a.name
+		ORDER BY a.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a models.AreaResidents
+		if err := rows.Scan(&a.AreaID, &a.AreaName, &a.Residents); err != nil {
+			return nil, err
+		}
+		stats.AreaResidents = append(stats.AreaResidents, a)
+	}
+	return stats, rows.Err()
+}
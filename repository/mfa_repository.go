@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MFARepository struct {
+	DB *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{DB: db}
+}
+
+// Get lấy trạng thái 2FA của người dùng, nil nếu chưa từng đăng ký
+func (r *MFARepository) Get(ctx context.Context, userID string) (*models.UserMFA, error) {
+	var m models.UserMFA
+	var enabledAt sql.NullTime
+	err := r.DB.QueryRowContext(ctx, `SELECT user_id, totp_secret, enabled, enabled_at, created_at, updated_at FROM user_mfa WHERE user_id = $1`, userID).
+		Scan(&m.UserID, &m.TOTPSecret, &m.Enabled, &enabledAt, &m.CreatedAt, &m.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		m.EnabledAt = &enabledAt.Time
+	}
+	return &m, nil
+}
+
+// StartEnrollment lưu secret mới chờ xác nhận. Không ghi đè khi 2FA đang bật, trả về false trong trường hợp đó.
+func (r *MFARepository) StartEnrollment(ctx context.Context, userID, secret string, at time.Time) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `INSERT INTO user_mfa (user_id, totp_secret, enabled, created_at, updated_at) VALUES ($1, $2, FALSE, $3, $3)
+		ON CONFLICT (user_id) DO UPDATE SET totp_secret = EXCLUDED.totp_secret, updated_at = EXCLUDED.updated_at WHERE user_mfa.enabled = FALSE`,
+		userID, secret, at)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Enable bật 2FA và thay toàn bộ mã khôi phục trong cùng một transaction
+func (r *MFARepository) Enable(ctx context.Context, userID string, codeHashes []string, at time.Time) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE user_mfa SET enabled = TRUE, enabled_at = $1, updated_at = $1 WHERE user_id = $2`, at, userID); err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes huỷ các mã khôi phục cũ và lưu bộ mã mới
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string, at time.Time) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string, codeHashes []string, at time.Time) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at) VALUES ($1, $2, $3, $4)`,
+			uuid.New().String(), userID, h, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListUnusedRecoveryCodes lấy các mã khôi phục chưa dùng
+func (r *MFARepository) ListUnusedRecoveryCodes(ctx context.Context, userID string) ([]models.MFARecoveryCode, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, user_id, code_hash FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var codes []models.MFARecoveryCode
+	for rows.Next() {
+		var code models.MFARecoveryCode
+		if err := rows.Scan(&code.ID, &code.UserID, &code.CodeHash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// MarkRecoveryCodeUsed đánh dấu mã đã dùng, trả về false nếu mã đã được dùng trước đó
+func (r *MFARepository) MarkRecoveryCodeUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `UPDATE mfa_recovery_codes SET used_at = $1 WHERE id = $2 AND used_at IS NULL`, at, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Disable tắt 2FA, xoá secret và mã khôi phục
+func (r *MFARepository) Disable(ctx context.Context, userID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrMoveOutNotInProgress = errors.New("move-out process already completed")
+	ErrMoveOutItemCompleted = errors.New("checklist item already completed")
+	ErrMoveOutInProgress    = errors.New("contract has a move-out process in progress")
+	ErrRefundNotApproved    = errors.New("refund is not approved")
+)
+
+type MoveOutRepository struct {
+	DB *sql.DB
+}
+
+func NewMoveOutRepository(db *sql.DB) *MoveOutRepository {
+	return &MoveOutRepository{DB: db}
+}
+
+const moveOutProcessColumns = `id, contract_id, cancel_request_id, student_id, room, checkout_date, status, created_at, updated_at, completed_at`
+
+// Create lưu quy trình trả phòng cùng toàn bộ checklist trong một transaction
+func (r *MoveOutRepository) Create(ctx context.Context, p *models.MoveOutProcess) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := insertMoveOutProcess(ctx, tx, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertMoveOutProcess(ctx context.Context, tx *sql.Tx, p *models.MoveOutProcess) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO move_out_processes (id, contract_id, cancel_request_id, student_id, room, checkout_date, status, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		p.ID, p.ContractID, nullString(p.CancelRequestID), p.StudentID, p.Room, p.CheckoutDate, p.Status, p.CreatedAt, p.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	for _, item := range p.Items {
+		_, err = tx.ExecContext(ctx, `INSERT INTO move_out_checklist_items (id, process_id, item_type, status, amount, note) VALUES ($1,$2,$3,$4,$5,$6)`,
+			item.ID, p.ID, item.ItemType, item.Status, item.Amount, item.Note)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MoveOutRepository) GetByID(ctx context.Context, id string) (*models.MoveOutProcess, error) {
+	row := r.DB.QueryRowContext(ctx, `SELECT `+moveOutProcessColumns+` FROM move_out_processes WHERE id = $1`, id)
+	p, err := scanMoveOutProcess(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := r.loadItems(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetActiveByContractID trả về quy trình trả phòng đang diễn ra của hợp đồng (nếu có)
+func (r *MoveOutRepository) GetActiveByContractID(ctx context.Context, contractID string) (*models.MoveOutProcess, error) {
+	row := r.DB.QueryRowContext(ctx, `SELECT `+moveOutProcessColumns+` FROM move_out_processes WHERE contract_id = $1 AND status = 'in_progress'`, contractID)
+	p, err := scanMoveOutProcess(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := r.loadItems(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (r *MoveOutRepository) ListByStudentID(ctx context.Context, studentID string) ([]*models.MoveOutProcess, error) {
+	return r.list(ctx, `SELECT `+moveOutProcessColumns+` FROM move_out_processes WHERE student_id = $1 ORDER BY created_at DESC`, studentID)
+}
+
+// List lấy danh sách quy trình trả phòng, lọc theo status nếu truyền vào
+func (r *MoveOutRepository) List(ctx context.Context, status string) ([]*models.MoveOutProcess, error) {
+	if status != "" {
+		return r.list(ctx, `SELECT `+moveOutProcessColumns+` FROM move_out_processes WHERE status = $1 ORDER BY checkout_date ASC`, status)
+	}
+	return r.list(ctx, `SELECT `+moveOutProcessColumns+` FROM move_out_processes ORDER BY checkout_date ASC`)
+}
+
+func (r *MoveOutRepository) UpdateCheckoutDate(ctx context.Context, id string, checkoutDate time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE move_out_processes SET checkout_date = $1, updated_at = NOW() WHERE id = $2`, checkoutDate, id)
+	return err
+}
+
+// MoveOutItemCompletion là dữ liệu quản lý xác nhận một bước trong checklist
+type MoveOutItemCompletion struct {
+	ProcessID   string
+	ItemType    string
+	Amount      float64
+	Note        string
+	CompletedBy string
+	CompletedAt time.Time
+	// Bản ghi hoàn phí đã duyệt được chi trả cùng bước fee_refund (để trống nếu không có)
+	PaidRefundID    string
+	PayoutReference string
+}
+
+// CompleteItem đánh dấu một bước trong checklist đã hoàn thành. Khi không còn bước nào pending,
+// hợp đồng được kết thúc, sinh viên chuyển về guest và quy trình đóng lại, tất cả trong cùng transaction.
+// Dòng move_out_processes được khóa để hai bước cuối hoàn thành đồng thời vẫn thấy đúng số bước còn lại.
+func (r *MoveOutRepository) CompleteItem(ctx context.Context, in MoveOutItemCompletion, finishReason string) (finished bool, err error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var contractID, studentID string
+	var status models.MoveOutStatus
+	err = tx.QueryRowContext(ctx, `SELECT contract_id, student_id, status FROM move_out_processes WHERE id = $1 FOR UPDATE`, in.ProcessID).
+		Scan(&contractID, &studentID, &status)
+	if err != nil {
+		return false, err
+	}
+	if status != models.MoveOutStatusInProgress {
+		return false, ErrMoveOutNotInProgress
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE move_out_checklist_items SET status = 'completed', amount = $1, note = $2, completed_by = $3, completed_at = $4
+		WHERE process_id = $5 AND item_type = $6 AND status = 'pending'`,
+		in.Amount, in.Note, in.CompletedBy, in.CompletedAt, in.ProcessID, in.ItemType)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, err
+	} else if n == 0 {
+		return false, ErrMoveOutItemCompleted
+	}
+	if in.PaidRefundID != "" {
+		res, err := tx.ExecContext(ctx, `UPDATE refund_ledger_entries SET status='paid', payout_reference=$1, paid_at=$2, updated_at=$2 WHERE id=$3 AND status='approved'`,
+			in.PayoutReference, in.CompletedAt, in.PaidRefundID)
+		if err != nil {
+			return false, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return false, err
+		} else if n == 0 {
+			return false, ErrRefundNotApproved
+		}
+	}
+
+	var pending int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM move_out_checklist_items WHERE process_id = $1 AND status <> 'completed'`, in.ProcessID).Scan(&pending); err != nil {
+		return false, err
+	}
+	if pending == 0 {
+		if err := finishContract(ctx, tx, contractID, finishReason); err != nil {
+			return false, err
+		}
+		if err := setUserRoleByName(ctx, tx, studentID, "guest"); err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE move_out_processes SET status = 'completed', completed_at = $1, updated_at = $1 WHERE id = $2`, in.CompletedAt, in.ProcessID); err != nil {
+			return false, err
+		}
+	}
+	return pending == 0, tx.Commit()
+}
+
+// UpdateItemAmount cập nhật số tiền dự kiến của một bước (vd: số tiền hoàn phí đã báo giá)
+func (r *MoveOutRepository) UpdateItemAmount(ctx context.Context, processID string, itemType string, amount float64) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE move_out_checklist_items SET amount = $1 WHERE process_id = $2 AND item_type = $3`, amount, processID, itemType)
+	return err
+}
+
+func (r *MoveOutRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.MoveOutProcess, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var processes []*models.MoveOutProcess
+	for rows.Next() {
+		p, err := scanMoveOutProcess(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		processes = append(processes, p)
+	}
+	rows.Close()
+	for _, p := range processes {
+		if err := r.loadItems(ctx, p); err != nil {
+			return nil, err
+		}
+	}
+	return processes, nil
+}
+
+func (r *MoveOutRepository) loadItems(ctx context.Context, p *models.MoveOutProcess) error {
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, process_id, item_type, status, amount, note, completed_by, completed_at FROM move_out_checklist_items WHERE process_id = $1`, p.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	byType := make(map[string]models.MoveOutChecklistItem)
+	for rows.Next() {
+		var item models.MoveOutChecklistItem
+		var note, completedBy sql.NullString
+		var completedAt sql.NullTime
+		if err := rows.Scan(&item.ID, &item.ProcessID, &item.ItemType, &item.Status, &item.Amount, &note, &completedBy, &completedAt); err != nil {
+			return err
+		}
+		item.Note = note.String
+		item.CompletedBy = completedBy.String
+		if completedAt.Valid {
+			item.CompletedAt = &completedAt.Time
+		}
+		byType[item.ItemType] = item
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// Sắp xếp theo thứ tự checklist cố định
+	p.Items = make([]models.MoveOutChecklistItem, 0, len(byType))
+	p.Progress = models.MoveOutProgress{}
+	for _, t := range models.MoveOutItemTypes {
+		item, ok := byType[t]
+		if !ok {
+			continue
+		}
+		p.Items = append(p.Items, item)
+		p.Progress.Total++
+		if item.Status == models.MoveOutItemStatusCompleted {
+			p.Progress.Completed++
+		}
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// dbExecutor là phần chung của *sql.DB và *sql.Tx, để câu lệnh dùng được cả trong và ngoài transaction
+type dbExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func scanMoveOutProcess(row rowScanner) (*models.MoveOutProcess, error) {
+	var p models.MoveOutProcess
+	var cancelRequestID sql.NullString
+	var completedAt sql.NullTime
+	if err := row.Scan(&p.ID, &p.ContractID, &cancelRequestID, &p.StudentID, &p.Room, &p.CheckoutDate, &p.Status, &p.CreatedAt, &p.UpdatedAt, &completedAt); err != nil {
+		return nil, err
+	}
+	p.CancelRequestID = cancelRequestID.String
+	if completedAt.Valid {
+		p.CompletedAt = &completedAt.Time
+	}
+	return &p, nil
+}
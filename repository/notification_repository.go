@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type NotificationRepository struct {
+	DB *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{DB: db}
+}
+
+func (r *NotificationRepository) Create(ctx context.Context, n *models.Notification) error {
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO notifications (id, user_id, type, title, body, entity_type, entity_id, data, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		n.ID, n.UserID, n.Type, n.Title, nullString(n.Body), nullString(n.EntityType), nullString(n.EntityID), nullJSON(n.Data), n.CreatedAt)
+	return err
+}
+
+// ListByUser liệt kê thông báo của user, mới nhất trước
+func (r *NotificationRepository) ListByUser(ctx context.Context, userID string, unreadOnly bool, limit, offset int) ([]models.Notification, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, user_id, type, title, COALESCE(body, ''), COALESCE(entity_type, ''), COALESCE(entity_id, ''), data, read_at, created_at
+		FROM notifications WHERE user_id::text = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC, id LIMIT $3 OFFSET $4`, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var data []byte
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Body, &n.EntityType, &n.EntityID, &data, &readAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.Data = data
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
+
+// CountUnread đếm thông báo chưa đọc của user
+func (r *NotificationRepository) CountUnread(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id::text = $1 AND read_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+// MarkRead đánh dấu đã đọc các thông báo của user, ids rỗng là đánh dấu tất cả. Trả về số thông báo được cập nhật.
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID string, ids []string, at time.Time) (int64, error) {
+	if ids == nil {
+		ids = []string{} // pq.Array(nil) là NULL, cần mảng rỗng
+	}
+	res, err := r.DB.ExecContext(ctx, `UPDATE notifications SET read_at = $1
+		WHERE user_id::text = $2 AND read_at IS NULL AND (cardinality($3::text[]) = 0 OR id::text = ANY($3))`,
+		at, userID, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type RefundRepository struct {
+	DB *sql.DB
+}
+
+func NewRefundRepository(db *sql.DB) *RefundRepository {
+	return &RefundRepository{DB: db}
+}
+
+const refundColumns = `id, contract_id, student_id, move_out_id, source, termination_date, notice_date, total_days, occupied_days, unused_days, daily_rate, unused_amount, deposit_deduction, notice_shortfall_days, notice_penalty, refund_amount, status, note, approved_by, approved_at, paid_at, payout_reference, created_at, updated_at`
+
+func (r *RefundRepository) Create(ctx context.Context, e *models.RefundLedgerEntry) error {
+	return insertRefundEntry(ctx, r.DB, e)
+}
+
+func insertRefundEntry(ctx context.Context, db dbExecutor, e *models.RefundLedgerEntry) error {
+	query := `INSERT INTO refund_ledger_entries (id, contract_id, student_id, move_out_id, source, termination_date, notice_date, total_days, occupied_days, unused_days, daily_rate, unused_amount, deposit_deduction, notice_shortfall_days, notice_penalty, refund_amount, status, note, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20)`
+	_, err := db.ExecContext(ctx, query,
+		e.ID, e.ContractID, e.StudentID, nullString(e.MoveOutID), e.Source, e.TerminationDate, e.NoticeDate, e.TotalDays, e.OccupiedDays, e.UnusedDays,
+		e.DailyRate, e.UnusedAmount, e.DepositDeduction, e.NoticeShortfallDays, e.NoticePenalty, e.RefundAmount, e.Status, e.Note, e.CreatedAt, e.UpdatedAt)
+	return err
+}
+
+func (r *RefundRepository) GetByID(ctx context.Context, id string) (*models.RefundLedgerEntry, error) {
+	row := r.DB.QueryRowContext(ctx, `SELECT `+refundColumns+` FROM refund_ledger_entries WHERE id = $1`, id)
+	e, err := scanRefund(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return e, err
+}
+
+// GetByMoveOutID lấy bản ghi hoàn phí gắn với quy trình trả phòng
+func (r *RefundRepository) GetByMoveOutID(ctx context.Context, moveOutID string) (*models.RefundLedgerEntry, error) {
+	row := r.DB.QueryRowContext(ctx, `SELECT `+refundColumns+` FROM refund_ledger_entries WHERE move_out_id = $1 ORDER BY created_at DESC LIMIT 1`, moveOutID)
+	e, err := scanRefund(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return e, err
+}
+
+// GetActiveByContractID lấy bản ghi hoàn phí chưa bị từ chối của hợp đồng (mỗi hợp đồng chỉ có tối đa một)
+func (r *RefundRepository) GetActiveByContractID(ctx context.Context, contractID string) (*models.RefundLedgerEntry, error) {
+	row := r.DB.QueryRowContext(ctx, `SELECT `+refundColumns+` FROM refund_ledger_entries WHERE contract_id = $1 AND status <> 'rejected'`, contractID)
+	e, err := scanRefund(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return e, err
+}
+
+func (r *RefundRepository) List(ctx context.Context, status string) ([]models.RefundLedgerEntry, error) {
+	if status != "" {
+		return r.list(ctx, `SELECT `+refundColumns+` FROM refund_ledger_entries WHERE status = $1 ORDER BY created_at DESC`, status)
+	}
+	return r.list(ctx, `SELECT `+refundColumns+` FROM refund_ledger_entries ORDER BY created_at DESC`)
+}
+
+func (r *RefundRepository) ListByStudentID(ctx context.Context, studentID string) ([]models.RefundLedgerEntry, error) {
+	return r.list(ctx, `SELECT `+refundColumns+` FROM refund_ledger_entries WHERE student_id = $1 ORDER BY created_at DESC`, studentID)
+}
+
+// UpdateQuote tính lại số liệu báo giá khi còn ở trạng thái quoted (vd: đổi ngày trả phòng)
+func (r *RefundRepository) UpdateQuote(ctx context.Context, id string, q *models.RefundQuote) error {
+	query := `UPDATE refund_ledger_entries SET termination_date=$1, total_days=$2, occupied_days=$3, unused_days=$4, daily_rate=$5, unused_amount=$6, deposit_deduction=$7, notice_shortfall_days=$8, notice_penalty=$9, refund_amount=$10, updated_at=NOW()
+		WHERE id=$11 AND status='quoted'`
+	_, err := r.DB.ExecContext(ctx, query,
+		q.TerminationDate, q.TotalDays, q.OccupiedDays, q.UnusedDays, q.DailyRate, q.UnusedAmount, q.DepositDeduction, q.NoticeShortfallDays, q.NoticePenalty, q.RefundAmount, id)
+	return err
+}
+
+// Review cập nhật kết quả duyệt (approved/rejected) của quản lý, chỉ khi báo giá còn quoted.
+// Trả về false nếu báo giá đã được xử lý bởi request khác.
+func (r *RefundRepository) Review(ctx context.Context, id string, status models.RefundStatus, note string, reviewerID string, at time.Time) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `UPDATE refund_ledger_entries SET status=$1, note=$2, approved_by=$3, approved_at=$4, updated_at=$4 WHERE id=$5 AND status='quoted'`,
+		status, note, reviewerID, at, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// MarkPaid ghi nhận đã chi trả tiền hoàn, chỉ khi khoản hoàn đang approved.
+// Trả về false nếu khoản hoàn đã được chi trả hoặc không còn approved.
+func (r *RefundRepository) MarkPaid(ctx context.Context, id string, payoutReference string, at time.Time) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `UPDATE refund_ledger_entries SET status='paid', payout_reference=$1, paid_at=$2, updated_at=$2 WHERE id=$3 AND status='approved'`,
+		payoutReference, at, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *RefundRepository) list(ctx context.Context, query string, args ...interface{}) ([]models.RefundLedgerEntry, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []models.RefundLedgerEntry
+	for rows.Next() {
+		e, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+func scanRefund(row rowScanner) (*models.RefundLedgerEntry, error) {
+	var e models.RefundLedgerEntry
+	var moveOutID, note, approvedBy, payoutRef sql.NullString
+	var approvedAt, paidAt sql.NullTime
+	err := row.Scan(&e.ID, &e.ContractID, &e.StudentID, &moveOutID, &e.Source, &e.TerminationDate, &e.NoticeDate, &e.TotalDays, &e.OccupiedDays, &e.UnusedDays,
+		&e.DailyRate, &e.UnusedAmount, &e.DepositDeduction, &e.NoticeShortfallDays, &e.NoticePenalty, &e.RefundAmount, &e.Status, &note, &approvedBy, &approvedAt, &paidAt, &payoutRef, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.MoveOutID = moveOutID.String
+	e.Note = note.String
+	e.ApprovedBy = approvedBy.String
+	e.PayoutReference = payoutRef.String
+	if approvedAt.Valid {
+		e.ApprovedAt = &approvedAt.Time
+	}
+	if paidAt.Valid {
+		e.PaidAt = &paidAt.Time
+	}
+	return &e, nil
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type SupportThreadRepository struct {
+	DB *sql.DB
+}
+
+func NewSupportThreadRepository(db *sql.DB) *SupportThreadRepository {
+	return &SupportThreadRepository{DB: db}
+}
+
+const supportThreadColumns = `t.id, t.student_id, t.area_id, t.assigned_staff_id, t.subject, t.status, t.last_message_at, t.closed_at, t.created_at, t.updated_at`
+
+func scanSupportThread(row rowScanner, extra ...interface{}) (*models.SupportThread, error) {
+	var t models.SupportThread
+	var staffID sql.NullString
+	var lastMessageAt, closedAt sql.NullTime
+	dest := append([]interface{}{&t.ID, &t.StudentID, &t.AreaID, &staffID, &t.Subject, &t.Status, &lastMessageAt, &closedAt, &t.CreatedAt, &t.UpdatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	t.Channel = models.ChatSupportChannel(t.ID)
+	t.AssignedStaffID = staffID.String
+	if lastMessageAt.Valid {
+		t.LastMessageAt = &lastMessageAt.Time
+	}
+	if closedAt.Valid {
+		t.ClosedAt = &closedAt.Time
+	}
+	return &t, nil
+}
+
+func (r *SupportThreadRepository) Create(ctx context.Context, t *models.SupportThread) error {
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO support_threads (id, student_id, area_id, assigned_staff_id, subject, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)`,
+		t.ID, t.StudentID, t.AreaID, nullString(t.AssignedStaffID), t.Subject, t.Status, t.CreatedAt)
+	return err
+}
+
+// GetByID lấy hội thoại, nil nếu không tồn tại
+func (r *SupportThreadRepository) GetByID(ctx context.Context, id string) (*models.SupportThread, error) {
+	t, err := scanSupportThread(r.DB.QueryRowContext(ctx, `SELECT `+supportThreadColumns+` FROM support_threads t WHERE t.id::text = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// Assign giao hội thoại cho cán bộ (nhận lại từ cán bộ khác)
+func (r *SupportThreadRepository) Assign(ctx context.Context, id, staffID string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE support_threads SET assigned_staff_id = $1, updated_at = $2 WHERE id = $3`, staffID, at, id)
+	return err
+}
+
+// Close đóng hội thoại, không nhận tin nhắn mới
+func (r *SupportThreadRepository) Close(ctx context.Context, id string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE support_threads SET status = $1, closed_at = $2, updated_at = $2 WHERE id = $3 AND status <> $1`,
+		models.SupportThreadStatusClosed, at, id)
+	return err
+}
+
+// TouchLastMessage ghi thời điểm tin nhắn mới nhất để sắp xếp hộp thư
+func (r *SupportThreadRepository) TouchLastMessage(ctx context.Context, id string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE support_threads SET last_message_at = $1 WHERE id = $2`, at, id)
+	return err
+}
+
+// ListInbox liệt kê hội thoại của user kèm số tin chưa đọc, mới hoạt động trước.
+// Sinh viên: hội thoại mình mở. Cán bộ: hội thoại mình phụ trách và hội thoại đang mở chưa ai nhận; all = mọi hội thoại.
+func (r *SupportThreadRepository) ListInbox(ctx context.Context, userID string, staff, all bool) ([]models.SupportThread, error) {
+	where := `t.student_id::text = $1`
+	if staff {
+		where = `(t.assigned_staff_id::text = $1 OR (t.assigned_staff_id IS NULL AND t.status = 'open'))`
+		if all {
+			where = `TRUE`
+		}
+	}
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+supportThreadColumns+`, `+chatUnreadCountSQL(`'support:' || t.id`, "$1")+` AS unread
+		FROM support_threads t WHERE `+where+`
+		ORDER BY COALESCE(t.last_message_at, t.created_at) DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.SupportThread{}
+	for rows.Next() {
+		var unread int
+		t, err := scanSupportThread(rows, &unread)
+		if err != nil {
+			return nil, err
+		}
+		t.UnreadCount = unread
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
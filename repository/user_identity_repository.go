@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+)
+
+type UserIdentityRepository struct {
+	DB *sql.DB
+}
+
+func NewUserIdentityRepository(db *sql.DB) *UserIdentityRepository {
+	return &UserIdentityRepository{DB: db}
+}
+
+const userIdentityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func scanUserIdentity(row rowScanner) (*models.UserIdentity, error) {
+	var i models.UserIdentity
+	err := row.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// GetBySubject tìm liên kết theo provider + sub, nil nếu chưa liên kết
+func (r *UserIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	return scanUserIdentity(r.DB.QueryRowContext(ctx, `SELECT `+userIdentityColumns+` FROM user_identities WHERE provider = $1 AND subject = $2`, provider, subject))
+}
+
+// GetByUser tìm liên kết của tài khoản trên một provider, nil nếu chưa liên kết
+func (r *UserIdentityRepository) GetByUser(ctx context.Context, userID, provider string) (*models.UserIdentity, error) {
+	return scanUserIdentity(r.DB.QueryRowContext(ctx, `SELECT `+userIdentityColumns+` FROM user_identities WHERE user_id = $1 AND provider = $2`, userID, provider))
+}
+
+// Link tạo liên kết mới hoặc cập nhật email và thời điểm đăng nhập gần nhất
+func (r *UserIdentityRepository) Link(ctx context.Context, i *models.UserIdentity) error {
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO user_identities (`+userIdentityColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (provider, subject) DO UPDATE SET email = EXCLUDED.email, last_login_at = EXCLUDED.last_login_at`,
+		i.ID, i.UserID, i.Provider, i.Subject, i.Email, i.CreatedAt, i.LastLoginAt)
+	return err
+}
+
+// DeleteByUser gỡ liên kết của tài khoản trên một provider
+func (r *UserIdentityRepository) DeleteByUser(ctx context.Context, userID, provider string) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`, userID, provider)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListByUser liệt kê các danh tính đã liên kết của tài khoản
+func (r *UserIdentityRepository) ListByUser(ctx context.Context, userID string) ([]models.UserIdentity, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+userIdentityColumns+` FROM user_identities WHERE user_id = $1 ORDER BY provider`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.UserIdentity{}
+	for rows.Next() {
+		i, err := scanUserIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *i)
+	}
+	return list, rows.Err()
+}
@@ -4,6 +4,7 @@ import (
 	"Backend_Dorm_PTIT/models"
 	"context"
 	"database/sql"
+	"strconv"
 	"time"
 
 	"github.com/lib/pq"
@@ -290,14 +291,18 @@ func (r *UserRepository) AssignRole(ctx context.Context, userID string, roleID s
 
 // SetUserRoleByName clears existing roles and assigns a single role by name (e.g. "guest")
 func (r *UserRepository) SetUserRoleByName(ctx context.Context, userID string, roleName string) error {
+	return setUserRoleByName(ctx, r.db, userID, roleName)
+}
+
+func setUserRoleByName(ctx context.Context, db dbExecutor, userID string, roleName string) error {
 	var roleID string
-	if err := r.db.QueryRowContext(ctx, `SELECT id FROM roles WHERE name = $1`, roleName).Scan(&roleID); err != nil {
+	if err := db.QueryRowContext(ctx, `SELECT id FROM roles WHERE name = $1`, roleName).Scan(&roleID); err != nil {
 		return err
 	}
-	if _, err := r.db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1`, userID); err != nil {
+	if _, err := db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1`, userID); err != nil {
 		return err
 	}
-	_, err := r.db.ExecContext(ctx, `INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2)`, userID, roleID)
+	_, err := db.ExecContext(ctx, `INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2)`, userID, roleID)
 	return err
 }
 
@@ -340,9 +345,9 @@ func joinComma(fields []string) string {
 	return out
 }
 
-// itoa converts int to string (no import strconv for brevity)
+// itoa converts int to string
 func itoa(i int) string {
-	return string('0' + i)
+	return strconv.Itoa(i)
 }
 
 func (r *UserRepository) UpdateStatus(ctx context.Context, userID string, status string, updatedAt time.Time) error {
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"Backend_Dorm_PTIT/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type VisitorRepository struct {
+	DB *sql.DB
+}
+
+func NewVisitorRepository(db *sql.DB) *VisitorRepository {
+	return &VisitorRepository{DB: db}
+}
+
+const visitorColumns = `id, student_id, contract_id, area_id, room, guest_name, guest_cccd, guest_phone, visit_start, visit_end, overnight, status, pass_code, reviewed_by, reviewed_at, manager_note, arrived_at, departed_at, created_at, updated_at`
+
+func (r *VisitorRepository) Create(ctx context.Context, v *models.VisitorRequest) error {
+	_, err := r.DB.ExecContext(ctx, `INSERT INTO visitor_requests (id, student_id, contract_id, area_id, room, guest_name, guest_cccd, guest_phone, visit_start, visit_end, overnight, status, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)`,
+		v.ID, v.StudentID, v.ContractID, v.AreaID, v.Room, v.GuestName, v.GuestCCCD, v.GuestPhone, v.VisitStart, v.VisitEnd, v.Overnight, v.Status, v.CreatedAt, v.UpdatedAt)
+	return err
+}
+
+func (r *VisitorRepository) GetByID(ctx context.Context, id string) (*models.VisitorRequest, error) {
+	v, err := scanVisitor(r.DB.QueryRowContext(ctx, `SELECT `+visitorColumns+` FROM visitor_requests WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+func (r *VisitorRepository) GetByPassCode(ctx context.Context, passCode string) (*models.VisitorRequest, error) {
+	v, err := scanVisitor(r.DB.QueryRowContext(ctx, `SELECT `+visitorColumns+` FROM visitor_requests WHERE pass_code = $1`, passCode))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// List lấy danh sách đăng ký khách, lọc theo status/khu nếu truyền vào
+func (r *VisitorRepository) List(ctx context.Context, status, areaID string) ([]models.VisitorRequest, error) {
+	return r.list(ctx, `SELECT `+visitorColumns+` FROM visitor_requests WHERE ($1 = '' OR status = $1) AND ($2 = '' OR area_id = $2) ORDER BY visit_start DESC`, status, areaID)
+}
+
+func (r *VisitorRepository) ListByStudentID(ctx context.Context, studentID string) ([]models.VisitorRequest, error) {
+	return r.list(ctx, `SELECT `+visitorColumns+` FROM visitor_requests WHERE student_id = $1 ORDER BY created_at DESC`, studentID)
+}
+
+// CountOvernightGuests đếm khách ở qua đêm đã được duyệt (hoặc đang ở) trong khu có khung giờ giao với [start, end)
+func (r *VisitorRepository) CountOvernightGuests(ctx context.Context, areaID string, start, end time.Time, excludeID string) (int, error) {
+	var n int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM visitor_requests
+		WHERE area_id = $1 AND overnight = TRUE AND status IN ('approved', 'checked_in')
+		  AND visit_start < $3 AND visit_end > $2 AND id::text <> $4`, areaID, start, end, excludeID).Scan(&n)
+	return n, err
+}
+
+// Review lưu kết quả duyệt, chỉ áp dụng khi đăng ký còn pending. Trả về false nếu đã được xử lý trước đó.
+func (r *VisitorRepository) Review(ctx context.Context, v *models.VisitorRequest) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `UPDATE visitor_requests SET status=$1, pass_code=$2, reviewed_by=$3, reviewed_at=$4, manager_note=$5, updated_at=$4 WHERE id=$6 AND status='pending'`,
+		v.Status, nullString(v.PassCode), v.ReviewedBy, v.ReviewedAt, v.ManagerNote, v.ID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *VisitorRepository) UpdateStatus(ctx context.Context, id string, status string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE visitor_requests SET status=$1, updated_at=$2 WHERE id=$3`, status, at, id)
+	return err
+}
+
+func (r *VisitorRepository) MarkArrived(ctx context.Context, id string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE visitor_requests SET status='checked_in', arrived_at=$1, updated_at=$1 WHERE id=$2`, at, id)
+	return err
+}
+
+func (r *VisitorRepository) MarkDeparted(ctx context.Context, id string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE visitor_requests SET status='checked_out', departed_at=$1, updated_at=$1 WHERE id=$2`, at, id)
+	return err
+}
+
+// GetRules lấy quy định tiếp khách riêng của khu (trường rỗng/âm là chưa đặt). found = false nếu khu không tồn tại.
+func (r *VisitorRepository) GetRules(ctx context.Context, areaID string) (rules *models.VisitingRules, found bool, err error) {
+	var start, end sql.NullString
+	var guestCap sql.NullInt64
+	err = r.DB.QueryRowContext(ctx, `SELECT visiting_start, visiting_end, overnight_guest_cap FROM dorm_areas WHERE id = $1`, areaID).Scan(&start, &end, &guestCap)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	rules = &models.VisitingRules{AreaID: areaID, VisitingStart: start.String, VisitingEnd: end.String, OvernightGuestCap: -1}
+	if guestCap.Valid {
+		rules.OvernightGuestCap = int(guestCap.Int64)
+	}
+	return rules, true, nil
+}
+
+// SetRules đặt quy định tiếp khách riêng của khu. Chuỗi rỗng / cap âm để dùng giá trị mặc định.
+func (r *VisitorRepository) SetRules(ctx context.Context, rules *models.VisitingRules) error {
+	var guestCap sql.NullInt64
+	if rules.OvernightGuestCap >= 0 {
+		guestCap = sql.NullInt64{Int64: int64(rules.OvernightGuestCap), Valid: true}
+	}
+	_, err := r.DB.ExecContext(ctx, `UPDATE dorm_areas SET visiting_start=$1, visiting_end=$2, overnight_guest_cap=$3 WHERE id=$4`,
+		nullString(rules.VisitingStart), nullString(rules.VisitingEnd), guestCap, rules.AreaID)
+	return err
+}
+
+func (r *VisitorRepository) list(ctx context.Context, query string, args ...interface{}) ([]models.VisitorRequest, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var visitors []models.VisitorRequest
+	for rows.Next() {
+		v, err := scanVisitor(rows)
+		if err != nil {
+			return nil, err
+		}
+		visitors = append(visitors, *v)
+	}
+	return visitors, rows.Err()
+}
+
+func scanVisitor(row rowScanner) (*models.VisitorRequest, error) {
+	var v models.VisitorRequest
+	var room, guestPhone, passCode, reviewedBy, managerNote sql.NullString
+	var reviewedAt, arrivedAt, departedAt sql.NullTime
+	err := row.Scan(&v.ID, &v.StudentID, &v.ContractID, &v.AreaID, &room, &v.GuestName, &v.GuestCCCD, &guestPhone, &v.VisitStart, &v.VisitEnd, &v.Overnight, &v.Status,
+		&passCode, &reviewedBy, &reviewedAt, &managerNote, &arrivedAt, &departedAt, &v.CreatedAt, &v.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	v.Room = room.String
+	v.GuestPhone = guestPhone.String
+	v.PassCode = passCode.String
+	v.ReviewedBy = reviewedBy.String
+	v.ManagerNote = managerNote.String
+	if reviewedAt.Valid {
+		v.ReviewedAt = &reviewedAt.Time
+	}
+	if arrivedAt.Valid {
+		v.ArrivedAt = &arrivedAt.Time
+	}
+	if departedAt.Valid {
+		v.DepartedAt = &departedAt.Time
+	}
+	return &v, nil
+}
@@ -5,11 +5,15 @@ import (
 	"Backend_Dorm_PTIT/database"
 	_ "Backend_Dorm_PTIT/docs" // Import docs to load swagger documentation
 	"Backend_Dorm_PTIT/handlers"
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/metrics"
 	"Backend_Dorm_PTIT/middleware"
+	"Backend_Dorm_PTIT/models"
 	"Backend_Dorm_PTIT/service"
 
 	// "Backend_Dorm_PTIT/middleware"
 	"Backend_Dorm_PTIT/repository"
+	"context"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -17,37 +21,87 @@ import (
 )
 
 // SetupRoutes configures all application routes with dependency injection
-func SetupRoutes(router *gin.Engine, cfg *config.Config) {
+func SetupRoutes(router *gin.Engine, cfg *config.Config, jwtKeys *service.JWTKeySet) {
 
 	// Health check endpoint
 	router.GET("/health", handlers.Health)
+	// Liveness (process còn chạy) và readiness (Postgres, Redis, file log, cấu hình bắt buộc)
+	router.GET("/health/live", handlers.Live)
+	healthHandler := handlers.NewHealthHandler(cfg)
+	router.GET("/health/ready", healthHandler.Ready)
+	// Chi tiết lỗi readiness giới hạn truy cập giống /metrics
+	router.GET("/health/ready/details", middleware.MetricsAccess(cfg.Metrics), healthHandler.ReadyDetails)
 
 	// Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	userRepo := repository.NewUserRepository(database.GetDB(), cfg.Database.Schema)
 	// Initialize auth handler with config
-	authHandler := handlers.NewAuthHandler(cfg, userRepo)
+	loginLockoutRepo := repository.NewLoginLockoutRepository(database.GetDB())
+	mfaRepo := repository.NewMFARepository(database.GetDB())
+	identityRepo := repository.NewUserIdentityRepository(database.GetDB())
+	captcha := service.NewSiteVerifyCaptcha(cfg.LoginGuard.CaptchaVerifyURL, cfg.LoginGuard.CaptchaSecret)
+	authHandler := handlers.NewAuthHandler(cfg, jwtKeys, userRepo, loginLockoutRepo, captcha, mfaRepo, identityRepo)
+
+	// Nhật ký thao tác quản trị
+	auditRepo := repository.NewAuditRepository(database.GetDB())
+	auditHandler := handlers.NewAuditHandler(auditRepo)
+	authHandler.Audit = auditRepo
 
 	// User handler
 	userHandler := handlers.NewUserHandler(cfg, userRepo)
+	userHandler.Audit = auditRepo
 
 	WSService := service.NewWSService()
+	// Nhiều instance sau load balancer: broadcast room và trạng thái online đi qua Redis
+	if err := WSService.UseRedis(context.Background(), database.RedisClient); err != nil {
+		logger.Error().Err(err).Msg("Failed to subscribe WebSocket rooms on Redis, chat only reaches this instance")
+	}
+
+	// Prometheus: pool Postgres/Redis, WebSocket và số liệu nghiệp vụ (chỉ IP trong allowlist hoặc có token)
+	metrics.RegisterDB(database.GetDB())
+	metrics.RegisterRedis(database.RedisClient)
+	metrics.RegisterWebSocket(WSService.Stats)
+	metrics.RegisterBusiness(repository.NewMetricsRepository(database.GetDB()))
+	router.GET("/metrics", middleware.MetricsAccess(cfg.Metrics), gin.WrapH(metrics.Handler()))
+
 	contractRepo := repository.NewContractRepository(database.GetDB())
+	dormAreaRepo := repository.NewDormAreaRepository(database.GetDB())
+	chatRepo := repository.NewChatRepository(database.GetDB())
+	supportThreadRepo := repository.NewSupportThreadRepository(database.GetDB())
+	chatHandler := handlers.NewChatHandler(chatRepo, contractRepo, dormAreaRepo, WSService)
+	chatHandler.SupportRepo = supportThreadRepo
+	// Thông báo realtime + hộp thư cho user offline
+	notificationRepo := repository.NewNotificationRepository(database.GetDB())
+	notifier := handlers.NewNotifier(notificationRepo, WSService)
+	notificationHandler := handlers.NewNotificationHandler(notificationRepo, WSService)
 	chatbotRepo := repository.NewChatbotRepository(database.GetDB())
 	chatbotHandler := handlers.NewChatbotHandler(cfg, chatbotRepo)
+	apiClientRepo := repository.NewAPIClientRepository(database.GetDB())
+	apiClientHandler := handlers.NewAPIClientHandler(apiClientRepo)
+	apiClientHandler.Audit = auditRepo
+	// Chatbot service cũ gửi khoá cấu hình sẵn, nhận tạm cho tới khi chuyển sang API client scope chatbot:read
+	legacyChatbotKey := ""
+	if cfg.APIKey.AcceptLegacyChatbotKey {
+		legacyChatbotKey = cfg.APIKey.ChatbotService
+	}
+	chatbotAuth := middleware.LegacyAPIKeyOr(legacyChatbotKey, middleware.APIClientAuth(apiClientRepo, models.APIScopeChatbotRead))
 
 	// Auth routes
+	router.GET("/.well-known/jwks.json", authHandler.JWKSHandler)
 	router.POST("/login", authHandler.LoginHandler)
 	router.POST("/refresh", authHandler.RefreshHandler)
 	router.POST("/logout", authHandler.LogoutHandler)
 	router.POST("/logout-all", authHandler.LogoutAllSessionsHandler)
-	router.POST("/oauth/microsoft/callback", authHandler.MicrosoftOAuthCallback)
-	router.GET("/api/chatbot/initialize", chatbotHandler.GetDatasets)
+	router.POST("/oauth/:provider/callback", authHandler.OIDCCallback)
+	router.POST("/mfa/verify", authHandler.MFAVerifyHandler)
+	router.POST("/mfa/enroll", authHandler.MFAEnrollHandler)
+	router.POST("/mfa/enroll/confirm", authHandler.MFAEnrollConfirmHandler)
+	router.GET("/api/chatbot/initialize", chatbotAuth, chatbotHandler.GetDatasets)
 
 	testHandler := handlers.NewTestHandler(cfg, userRepo)
 	test := router.Group("/api/test")
 	{
-		test.Use(middleware.Authentication(cfg.JWT.Secret))
+		test.Use(middleware.Authentication(jwtKeys))
 		test.GET("/getprofile", testHandler.GetProfileHandler)
 		test.GET("/sendmail", testHandler.SendEmailHandler)
 
@@ -55,49 +109,95 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 
 	ws := router.Group("/ws/v1")
 	{
-		ws.Use(middleware.AuthenticateWS(cfg.JWT.Secret))
+		ws.Use(middleware.AuthenticateWS(jwtKeys))
 		wsHandler := handlers.NewWSHandler(cfg, WSService, contractRepo)
+		wsHandler.ChatRepo = chatRepo
+		wsHandler.AreaRepo = dormAreaRepo
+		wsHandler.SupportRepo = supportThreadRepo
+		wsHandler.NotifyRepo = notificationRepo
 		ws.GET("/admin-connect", wsHandler.HandleWSAdmin)
 		ws.GET("/chat", wsHandler.HandleWSChat)
+		ws.GET("/notifications", wsHandler.HandleWSNotifications)
 	}
 
 	v1 := router.Group("/api/v1")
 	{
 		dormAppRepo := repository.NewDormApplicationRepository(database.GetDB())
 		dormAppHandler := handlers.NewDormApplicationHandler(dormAppRepo, cfg)
+		dormAppHandler.Audit = auditRepo
+		dormAppHandler.Notifier = notifier
 		mailHandler := handlers.NewMailHandler(cfg, userRepo)
-		dormAreaRepo := repository.NewDormAreaRepository(database.GetDB())
 		dormAreaHandler := handlers.NewDormAreaHandler(dormAreaRepo)
+		dormAreaHandler.Audit = auditRepo
 		registrationPeriodRepo := repository.NewRegistrationPeriodRepository(database.GetDB())
 		registrationPeriodHandler := handlers.NewRegistrationPeriodHandler(registrationPeriodRepo)
 		contractHandler := handlers.NewContractHandler(contractRepo, cfg)
 		contractHandler.UserRepo = userRepo
+		refundRepo := repository.NewRefundRepository(database.GetDB())
+		contractHandler.RefundRepo = refundRepo
+		moveOutRepo := repository.NewMoveOutRepository(database.GetDB())
+		contractHandler.MoveOutRepo = moveOutRepo
+		contractHandler.Audit = auditRepo
+		contractHandler.Notifier = notifier
+		refundHandler := handlers.NewRefundHandler(refundRepo, contractRepo, cfg)
+		refundHandler.Audit = auditRepo
 		managerRepo := repository.NewManagerRepository(database.GetDB(), cfg.Database.Schema)
 		managerHandler := handlers.NewManagerHandler(cfg, managerRepo, userRepo)
+		managerHandler.Audit = auditRepo
 
 		dutyRepo := repository.NewDutyScheduleRepository(database.GetDB())
-		dutyHandler := handlers.NewDutyScheduleHandler(dutyRepo)
+		supportThreadHandler := handlers.NewSupportThreadHandler(supportThreadRepo, chatRepo, contractRepo, dormAreaRepo, dutyRepo, WSService)
+		dutyHandler := handlers.NewDutyScheduleHandler(dutyRepo, dormAreaRepo)
+		dutyHandler.Audit = auditRepo
 		electricBillRepo := repository.NewElectricBillRepository(database.GetDB())
 		electricBillHandler := handlers.NewElectricBillHandler(electricBillRepo, cfg)
+		electricBillHandler.ContractRepo = contractRepo
+		electricBillHandler.Notifier = notifier
 		electricBillComplaintRepo := repository.NewElectricBillComplaintRepository(database.GetDB())
 		electricBillComplaintHandler := handlers.NewElectricBillComplaintHandler(electricBillComplaintRepo, cfg)
 		facilityComplaintRepo := repository.NewFacilityComplaintRepository(database.GetDB())
 		facilityComplaintHandler := handlers.NewFacilityComplaintHandler(facilityComplaintRepo, contractRepo, cfg)
+		facilityComplaintHandler.Notifier = notifier
 		roomTransferRequestHandler := handlers.NewRoomTransferRequestHandler(database.GetDB())
 		cancelRequestRepo := repository.NewContractCancelRequestRepository(database.GetDB())
-		cancelRequestHandler := handlers.NewContractCancelRequestHandler(cancelRequestRepo, contractRepo, userRepo, cfg)
+		cancelRequestHandler := handlers.NewContractCancelRequestHandler(cancelRequestRepo, contractRepo, userRepo, moveOutRepo, refundRepo, cfg)
+		cancelRequestHandler.Audit = auditRepo
+		moveOutHandler := handlers.NewMoveOutHandler(moveOutRepo, contractRepo, userRepo, electricBillRepo, refundRepo, cfg)
+		moveOutHandler.CancelRequestRepo = cancelRequestRepo
+		moveOutHandler.Audit = auditRepo
+
+		calendarFeedRepo := repository.NewCalendarFeedRepository(database.GetDB())
+		calendarHandler := handlers.NewCalendarHandler(calendarFeedRepo, userRepo, dutyRepo, contractRepo, electricBillRepo, cfg)
+
+		gateRepo := repository.NewGateRepository(database.GetDB())
+		gateHandler := handlers.NewGateHandler(gateRepo, contractRepo, cfg)
+		gateHandler.Audit = auditRepo
+
+		visitorRepo := repository.NewVisitorRepository(database.GetDB())
+		visitorHandler := handlers.NewVisitorHandler(visitorRepo, contractRepo, dutyRepo, cfg)
+		visitorHandler.Audit = auditRepo
 
 		backupRepo := repository.NewBackUpRepository(database.GetDB())
 		backupHandler := handlers.NewBackupHandler(cfg, backupRepo)
+		backupHandler.Audit = auditRepo
+		logHandler := handlers.NewLogHandler(service.NewLogSearchService(cfg.Logging))
+		logHandler.AuditRepo = auditRepo
 
 		// Đăng ký ký túc xá
 		v1.POST("/dorm-applications", dormAppHandler.CreateDormApplication)
 		v1.POST("/send-otp", mailHandler.SendOTPEmailHandler)
 		v1.POST("/verify-otp", mailHandler.VerifyOTPHandler)
+		v1.POST("/reset-password", mailHandler.ResetPasswordHandler)
+		// Link lịch iCal cho calendar app, xác thực bằng token ký sẵn trên URL
+		v1.GET("/calendar/:token", calendarHandler.GetFeed)
+
+		// Service-to-service APIs (API client key + scope)
+		v1.GET("/chatbot/datasets", chatbotAuth, chatbotHandler.GetDatasets)
+		v1.POST("/service/electric-bills", middleware.APIClientAuth(apiClientRepo, models.APIScopeBillsImport), electricBillHandler.Create)
 
 		v2 := v1.Group("/protected")
 		{
-			v2.Use(middleware.Authentication(cfg.JWT.Secret))
+			v2.Use(middleware.Authentication(jwtKeys))
 			v2.POST("/chatbot/sync-dataset", chatbotHandler.SyncDataset)
 			// Admin management for chatbot documents & prompting
 			v2.GET("/chatbot/documents", chatbotHandler.ListDocuments)
@@ -114,12 +214,60 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			// Đổi avatar và mật khẩu cho user hiện tại
 			v2.PATCH("/me/avatar", userHandler.UpdateAvatar)
 			v2.PATCH("/me/password", userHandler.UpdatePassword)
+			v2.GET("/sessions/me", authHandler.ListMySessions)
+			v2.DELETE("/sessions/me/:id", authHandler.RevokeMySession)
+			v2.GET("/mfa/me", authHandler.GetMyMFA)
+			v2.POST("/mfa/me/enroll", authHandler.StartMyMFAEnrollment)
+			v2.POST("/mfa/me/enroll/confirm", authHandler.ConfirmMyMFAEnrollment)
+			v2.POST("/mfa/me/recovery-codes", authHandler.RegenerateMyRecoveryCodes)
+			v2.DELETE("/mfa/me", authHandler.DisableMyMFA)
+			v2.DELETE("/mfa/users/:id", authHandler.ResetUserMFA)
+			v2.GET("/identities/me", authHandler.ListMyIdentities)
+			v2.DELETE("/users/:id/identities/:provider", authHandler.UnlinkUserIdentity)
 			// API: List all users with roles (admin_system only)
 			v2.GET("/users", userHandler.ListAllUsers)
 			// update profile ( manager and admin_system only)
 			v2.PUT("/me/profile", userHandler.UpdateOwnManagerProfile)
 			// update status user... (admin_system only)
 			v2.PATCH("/users/:id/status", userHandler.UpdateUserStatus)
+			v2.GET("/login-lockouts", authHandler.ListLoginLockouts)
+			v2.DELETE("/login-lockouts", authHandler.ClearLoginLock)
+			v2.GET("/api-clients", apiClientHandler.List)
+			v2.POST("/api-clients", apiClientHandler.Create)
+			v2.GET("/api-clients/:id", apiClientHandler.Get)
+			v2.PATCH("/api-clients/:id", apiClientHandler.Update)
+			v2.DELETE("/api-clients/:id", apiClientHandler.Revoke)
+			v2.POST("/api-clients/:id/keys", apiClientHandler.RotateKey)
+			v2.DELETE("/api-clients/:id/keys/:keyId", apiClientHandler.RevokeKey)
+
+			// Lịch sử chat và xác nhận đã đọc (channel: room:<id khu>:<phòng>, area:<id khu>)
+			v2.GET("/chat/channels/:channel/messages", chatHandler.ListMessages)
+			v2.GET("/chat/channels/:channel/read-receipts", chatHandler.ListReadReceipts)
+			v2.GET("/chat/channels/:channel/presence", chatHandler.ListPresence)
+			v2.POST("/chat/channels/:channel/read", chatHandler.MarkRead)
+
+			// Hộp thư thông báo
+			v2.GET("/notifications", notificationHandler.List)
+			v2.GET("/notifications/unread-count", notificationHandler.UnreadCount)
+			v2.POST("/notifications/read", notificationHandler.MarkRead)
+
+			// Hội thoại hỗ trợ giữa sinh viên và cán bộ (tin nhắn qua WS channel support:<id>)
+			v2.POST("/support-threads", supportThreadHandler.Create)
+			v2.GET("/support-threads", supportThreadHandler.Inbox)
+			v2.GET("/support-threads/:id", supportThreadHandler.Get)
+			v2.POST("/support-threads/:id/take-over", supportThreadHandler.TakeOver)
+			v2.POST("/support-threads/:id/close", supportThreadHandler.Close)
+
+			// Nhật ký thao tác quản trị (admin_system)
+			v2.GET("/audit-events", auditHandler.List)
+			v2.GET("/audit-events/export", auditHandler.Export)
+
+			// Log hệ thống: trực tiếp qua SSE, tìm và tải trong các file log (admin_system)
+			v2.GET("/logs/stream", handlers.StreamLogSSE)
+			v2.GET("/logs/files", logHandler.Files)
+			v2.GET("/logs/search", logHandler.SearchLogs)
+			v2.GET("/logs/export", logHandler.Export)
+
 			v2.GET("/contracts/me", contractHandler.GetMyContract)
 			v2.GET("/contracts/me/members", contractHandler.GetMyRoomMembers)
 			v2.PATCH("/contracts/:id/confirm", contractHandler.ConfirmContract)
@@ -134,6 +282,8 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			v2.POST("/dorm-area", dormAreaHandler.CreateDormArea)
 			v2.PATCH("/dorm-area/:id", dormAreaHandler.UpdateDormArea)
 			v2.DELETE("/dorm-area/:id", dormAreaHandler.DeleteDormArea)
+			v2.PATCH("/dorm-area/:id/curfew", gateHandler.SetCurfew)
+			v2.PATCH("/dorm-area/:id/visiting-rules", visitorHandler.SetRules)
 			v2.GET("/dorm-areas", dormAreaHandler.GetAllDormAreas)
 			v2.POST("/registration-periods", registrationPeriodHandler.CreateRegistrationPeriod)
 			v2.GET("/registration-periods", registrationPeriodHandler.GetAllRegistrationPeriods)
@@ -150,6 +300,34 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			v2.POST("/duty-schedules", dutyHandler.CreateDutySchedule)
 			v2.PUT("/duty-schedules/:id", dutyHandler.UpdateDutySchedule)
 			v2.DELETE("/duty-schedules/:id", dutyHandler.DeleteDutySchedule)
+			v2.GET("/duty-schedules/on-duty", dutyHandler.ListOnDuty)
+			v2.GET("/duty-schedules/:id", dutyHandler.GetDutyScheduleDetail)
+			v2.GET("/duty-rotations", dutyHandler.ListRotations)
+			v2.POST("/duty-rotations", dutyHandler.CreateRotation)
+			v2.DELETE("/duty-rotations/:id", dutyHandler.DeleteRotation)
+			v2.GET("/duty-swap-requests", dutyHandler.ListSwapRequests)
+			v2.POST("/duty-swap-requests", dutyHandler.CreateSwapRequest)
+			v2.PATCH("/duty-swap-requests/:id", dutyHandler.ReviewSwapRequest)
+			v2.GET("/calendar-feeds/me", calendarHandler.GetMyFeed)
+			v2.POST("/calendar-feeds/me", calendarHandler.RotateMyFeed)
+			v2.DELETE("/calendar-feeds/me", calendarHandler.RevokeMyFeed)
+
+			// Gate check-in/check-out APIs (protected)
+			v2.GET("/gate/qr", gateHandler.GetMyQR)
+			v2.POST("/gate/scan", gateHandler.Scan)
+			v2.POST("/gate/events", gateHandler.CreateEvent)
+			v2.GET("/gate/events", gateHandler.ListEvents)
+			v2.GET("/gate/events/me", gateHandler.ListMyEvents)
+			v2.GET("/gate/overnight-absences", gateHandler.ListOvernightAbsences)
+
+			// Khách thăm
+			v2.POST("/visitors", visitorHandler.Create)
+			v2.GET("/visitors", visitorHandler.List)
+			v2.GET("/visitors/me", visitorHandler.ListMine)
+			v2.PATCH("/visitors/:id/cancel", visitorHandler.Cancel)
+			v2.PATCH("/visitors/:id/review", visitorHandler.Review)
+			v2.POST("/visitors/check-in", visitorHandler.CheckIn)
+			v2.POST("/visitors/check-out", visitorHandler.CheckOut)
 
 			// Facility Complaint APIs (protected)
 			v2.GET("/facility-complaints", facilityComplaintHandler.List)
@@ -193,6 +371,19 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			v2.GET("/contract-cancel-requests", cancelRequestHandler.ListAll)
 			v2.GET("/contract-cancel-requests/:id", cancelRequestHandler.GetByID)
 			v2.PATCH("/contract-cancel-requests/:id/verify", cancelRequestHandler.Verify)
+
+			// Move-out checklist APIs (protected)
+			v2.GET("/move-outs/me", moveOutHandler.ListMyMoveOuts)
+			v2.GET("/move-outs", moveOutHandler.List)
+			v2.GET("/move-outs/:id", moveOutHandler.GetByID)
+			v2.PATCH("/move-outs/:id/checkout-date", moveOutHandler.ScheduleCheckout)
+			v2.PATCH("/move-outs/:id/items/:item_type", moveOutHandler.CompleteItem)
+			v2.GET("/contracts/:id/refund-quote", refundHandler.PreviewQuote)
+			v2.GET("/refunds/me", refundHandler.ListMyRefunds)
+			v2.GET("/refunds", refundHandler.List)
+			v2.GET("/refunds/:id", refundHandler.GetByID)
+			v2.PATCH("/refunds/:id/review", refundHandler.Review)
+			v2.PATCH("/refunds/:id/paid", refundHandler.MarkPaid)
 		}
 	}
 }
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// Khoá API dạng pdk_<prefix>_<secret>. prefix dùng để tra cứu trong DB và hiển thị cho admin,
+// secret 256 bit ngẫu nhiên nên chỉ cần lưu sha256 (không cần bcrypt như mật khẩu, và không làm chậm mỗi request).
+const apiKeyScheme = "pdk"
+
+// GenerateAPIKey sinh khoá mới, trả về khoá đầy đủ (chỉ hiển thị một lần), prefix và hash để lưu
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	if prefix, err = randomCode(8); err != nil {
+		return "", "", "", err
+	}
+	prefix = strings.ToLower(prefix)
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyScheme + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(b)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// ParseAPIKeyPrefix tách prefix từ khoá, false nếu sai định dạng
+func ParseAPIKeyPrefix(key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyScheme || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// HashAPIKey băm khoá để lưu và so sánh
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CaptchaVerifier kiểm tra token CAPTCHA do FE gửi lên. Tách interface để thay bằng bản giả khi test.
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// SiteVerifyCaptcha gọi endpoint siteverify chung của reCAPTCHA/hCaptcha/Turnstile
+type SiteVerifyCaptcha struct {
+	VerifyURL string
+	Secret    string
+	Client    *http.Client
+}
+
+// NewSiteVerifyCaptcha trả về nil nếu chưa cấu hình URL hoặc secret
+func NewSiteVerifyCaptcha(verifyURL, secret string) CaptchaVerifier {
+	if verifyURL == "" || secret == "" {
+		return nil
+	}
+	return &SiteVerifyCaptcha{VerifyURL: verifyURL, Secret: secret, Client: &http.Client{Timeout: 5 * time.Second, Transport: utils.RequestIDTransport{}}}
+}
+
+func (v *SiteVerifyCaptcha) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {v.Secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// parseClock đọc giờ dạng HH:MM thành số phút trong ngày
+func parseClock(hhmm string) (int, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, must be HH:MM", hhmm)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ValidateClock kiểm tra chuỗi giờ HH:MM
+func ValidateClock(hhmm string) error {
+	_, err := parseClock(hhmm)
+	return err
+}
+
+// IsAfterCurfew kiểm tra thời điểm at có nằm trong khoảng giới nghiêm [curfew, openTime) hay không.
+// Khoảng này có thể qua nửa đêm (vd: 23:00 - 05:00). curfew rỗng nghĩa là không giới nghiêm.
+func IsAfterCurfew(at time.Time, curfew, openTime string) (bool, error) {
+	if curfew == "" {
+		return false, nil
+	}
+	c, err := parseClock(curfew)
+	if err != nil {
+		return false, err
+	}
+	o, err := parseClock(openTime)
+	if err != nil {
+		return false, err
+	}
+	now := at.Hour()*60 + at.Minute()
+	if c > o {
+		return now >= c || now < o, nil
+	}
+	return now >= c && now < o, nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"strings"
+	"time"
+)
+
+// ICalEvent là một sự kiện trong file .ics
+type ICalEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool // sự kiện cả ngày, chỉ dùng phần ngày của Start/End
+}
+
+// SignCalendarToken ký feedID để tạo token đặt trên link .ics (feedID.signature)
+func SignCalendarToken(feedID, secret string) string {
+	return SignToken("calendar", feedID, secret)
+}
+
+// VerifyCalendarToken kiểm tra chữ ký và trả về feedID nếu hợp lệ
+func VerifyCalendarToken(token, secret string) (string, bool) {
+	return VerifyToken("calendar", token, secret)
+}
+
+// BuildICalendar sinh nội dung iCalendar (RFC 5545) cho danh sách sự kiện
+func BuildICalendar(name string, events []ICalEvent) string {
+	var b strings.Builder
+	writeICalLine(&b, "BEGIN:VCALENDAR")
+	writeICalLine(&b, "VERSION:2.0")
+	writeICalLine(&b, "PRODID:-//PTIT Dorm//Calendar Feed//VI")
+	writeICalLine(&b, "CALSCALE:GREGORIAN")
+	writeICalLine(&b, "METHOD:PUBLISH")
+	writeICalLine(&b, "X-WR-CALNAME:"+escapeICalText(name))
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, e := range events {
+		writeICalLine(&b, "BEGIN:VEVENT")
+		writeICalLine(&b, "UID:"+e.UID)
+		writeICalLine(&b, "DTSTAMP:"+stamp)
+		if e.AllDay {
+			end := e.End
+			if !end.After(e.Start) {
+				end = e.Start.AddDate(0, 0, 1)
+			}
+			writeICalLine(&b, "DTSTART;VALUE=DATE:"+e.Start.Format("20060102"))
+			writeICalLine(&b, "DTEND;VALUE=DATE:"+end.Format("20060102"))
+		} else {
+			writeICalLine(&b, "DTSTART:"+e.Start.UTC().Format("20060102T150405Z"))
+			writeICalLine(&b, "DTEND:"+e.End.UTC().Format("20060102T150405Z"))
+		}
+		writeICalLine(&b, "SUMMARY:"+escapeICalText(e.Summary))
+		if e.Description != "" {
+			writeICalLine(&b, "DESCRIPTION:"+escapeICalText(e.Description))
+		}
+		if e.Location != "" {
+			writeICalLine(&b, "LOCATION:"+escapeICalText(e.Location))
+		}
+		writeICalLine(&b, "END:VEVENT")
+	}
+	writeICalLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+func escapeICalText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// writeICalLine ghi một dòng, gập dòng dài hơn 75 byte theo RFC 5545 (không cắt giữa ký tự UTF-8)
+func writeICalLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && (line[cut]&0xC0) == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // dòng gập bắt đầu bằng một khoảng trắng
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/utils"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWK là một khoá công khai trong JWK Set (RFC 7517), hỗ trợ RSA, EC và Ed25519 (OKP)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS là tập khoá công khai trả về ở jwks_uri
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var ErrJWKNotFound = errors.New("signing key not found")
+
+// NewJWK tạo JWK từ khoá công khai RSA, EC hoặc Ed25519
+func NewJWK(kid, alg string, pub crypto.PublicKey) (JWK, error) {
+	k := JWK{Kid: kid, Use: "sig", Alg: alg}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		k.Kty = "RSA"
+		k.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		k.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		k.Kty = "EC"
+		k.Crv = pub.Curve.Params().Name
+		k.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		k.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		k.Kty = "OKP"
+		k.Crv = "Ed25519"
+		k.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return k, nil
+}
+
+// PublicKey giải mã JWK thành *rsa.PublicKey, *ecdsa.PublicKey hoặc ed25519.PublicKey
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk e: %w", err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid jwk exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported jwk curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk x: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk y: %w", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("invalid jwk point")
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported jwk curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid jwk x")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported jwk kty %q", k.Kty)
+	}
+}
+
+// KeySource trả về khoá công khai theo kid để kiểm tra chữ ký JWT
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+const (
+	jwksCacheTTL    = time.Hour
+	jwksMinRefresh  = time.Minute // kid lạ thì tải lại JWKS, nhưng không quá 1 lần/phút
+	jwksHTTPTimeout = 10 * time.Second
+)
+
+// RemoteJWKS tải và cache JWKS của issuer. Khoá được tải lại khi hết hạn cache hoặc gặp kid chưa biết (issuer xoay khoá).
+type RemoteJWKS struct {
+	URL       string // jwks_uri, để trống thì lấy từ Discovery
+	Discovery string // <issuer>/.well-known/openid-configuration
+	Client    *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func NewRemoteJWKS(jwksURL, issuer string) *RemoteJWKS {
+	return &RemoteJWKS{
+		URL:       jwksURL,
+		Discovery: strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration",
+		Client:    &http.Client{Timeout: jwksHTTPTimeout, Transport: utils.RequestIDTransport{}},
+	}
+}
+
+func (s *RemoteJWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[kid]
+	age := time.Since(s.fetchedAt)
+	if ok && age < jwksCacheTTL {
+		return key, nil
+	}
+	if !ok && s.keys != nil && age < jwksMinRefresh {
+		return nil, ErrJWKNotFound
+	}
+	if err := s.refresh(ctx); err != nil {
+		// Không tải được thì vẫn dùng khoá cũ nếu có, tránh phụ thuộc hoàn toàn vào issuer
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrJWKNotFound
+}
+
+func (s *RemoteJWKS) refresh(ctx context.Context) error {
+	if s.URL == "" {
+		var doc struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := s.getJSON(ctx, s.Discovery, &doc); err != nil {
+			return fmt.Errorf("openid discovery: %w", err)
+		}
+		if doc.JWKSURI == "" {
+			return errors.New("openid discovery: missing jwks_uri")
+		}
+		s.URL = doc.JWKSURI
+	}
+	var set JWKS
+	if err := s.getJSON(ctx, s.URL, &set); err != nil {
+		return fmt.Errorf("fetch jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.PublicKey()
+		if err != nil {
+			continue // bỏ qua khoá không hỗ trợ, không làm hỏng cả tập
+		}
+		keys[k.Kid] = pub
+	}
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+func (s *RemoteJWKS) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
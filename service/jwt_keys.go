@@ -0,0 +1,164 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtKey là một khoá ký access/refresh token
+type jwtKey struct {
+	id     string
+	method jwt.SigningMethod
+	signer crypto.Signer
+}
+
+// JWTKeySet ký token bằng khoá đang dùng và kiểm tra token theo kid trong header.
+// Nhiều khoá cùng hiệu lực để xoay khoá không làm đăng xuất người dùng.
+type JWTKeySet struct {
+	active *jwtKey            // nil = ký HS256 bằng secret
+	keys   map[string]*jwtKey // theo kid
+	order  []string           // thứ tự công bố trong JWKS
+	secret []byte             // HS256, nil nếu không nhận token HS256
+}
+
+func NewJWTKeySet(cfg config.JWTConfig) (*JWTKeySet, error) {
+	s := &JWTKeySet{keys: make(map[string]*jwtKey, len(cfg.Keys))}
+	for _, kc := range cfg.Keys {
+		if kc.ID == "" {
+			return nil, errors.New("jwt key is missing id")
+		}
+		if _, dup := s.keys[kc.ID]; dup {
+			return nil, fmt.Errorf("duplicate jwt key id %q", kc.ID)
+		}
+		k, err := loadJWTKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", kc.ID, err)
+		}
+		s.keys[kc.ID] = k
+		s.order = append(s.order, kc.ID)
+	}
+
+	if cfg.SigningKeyID != "" {
+		k, ok := s.keys[cfg.SigningKeyID]
+		if !ok {
+			return nil, fmt.Errorf("signing key %q not found in jwt keys", cfg.SigningKeyID)
+		}
+		s.active = k
+		if cfg.AcceptHS256 && cfg.Secret != "" {
+			s.secret = []byte(cfg.Secret)
+		}
+		return s, nil
+	}
+	if cfg.Secret == "" {
+		return nil, errors.New("jwt secret not configured")
+	}
+	s.secret = []byte(cfg.Secret)
+	return s, nil
+}
+
+func loadJWTKey(kc config.JWTKeyConfig) (*jwtKey, error) {
+	data := []byte(kc.PrivateKey)
+	if len(data) == 0 {
+		if kc.PrivateKeyFile == "" {
+			return nil, errors.New("private_key or private_key_file is required")
+		}
+		var err error
+		if data, err = os.ReadFile(kc.PrivateKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+
+	var priv interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		priv, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	k := &jwtKey{id: kc.ID}
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		if priv.N.BitLen() < 2048 {
+			return nil, errors.New("RSA key must be at least 2048 bits")
+		}
+		k.method, k.signer = jwt.SigningMethodRS256, priv
+	case *ecdsa.PrivateKey:
+		if priv.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 EC keys are supported (ES256)")
+		}
+		k.method, k.signer = jwt.SigningMethodES256, priv
+	case ed25519.PrivateKey:
+		k.method, k.signer = jwt.SigningMethodEdDSA, priv
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+	return k, nil
+}
+
+// Sign ký claims bằng khoá đang dùng, token có kid trong header để bên nhận chọn khoá
+func (s *JWTKeySet) Sign(claims jwt.Claims) (string, error) {
+	if s.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	}
+	token := jwt.NewWithClaims(s.active.method, claims)
+	token.Header["kid"] = s.active.id
+	return token.SignedString(s.active.signer)
+}
+
+// Parse kiểm tra chữ ký theo kid (hoặc HS256 khi token không có kid và còn nhận HS256)
+func (s *JWTKeySet) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, s.keyFunc)
+}
+
+func (s *JWTKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || s.secret == nil {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return s.secret, nil
+	}
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrJWKNotFound
+	}
+	// Không cho token tự chọn thuật toán khác với khoá (chặn nhầm RS256/HS256)
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return k.signer.Public(), nil
+}
+
+// JWKS trả về khoá công khai của mọi khoá còn hiệu lực (secret HS256 không bao giờ được công bố)
+func (s *JWTKeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(s.order))}
+	for _, id := range s.order {
+		k := s.keys[id]
+		if jwk, err := NewJWK(k.id, k.method.Alg(), k.signer.Public()); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
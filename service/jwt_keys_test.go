@@ -0,0 +1,259 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testJWTSecret = "jwt-keys-test-secret"
+
+var (
+	testJWTKeysOnce sync.Once
+	testJWTKeys     map[string]string // kid -> PEM
+)
+
+// testJWTKeyPEMs sinh một lần khoá RSA 2048, EC P-256 và Ed25519 dạng PEM
+func testJWTKeyPEMs(t *testing.T) map[string]string {
+	t.Helper()
+	testJWTKeysOnce.Do(func() {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+		ecDER, err := x509.MarshalECPrivateKey(ecKey)
+		if err != nil {
+			panic(err)
+		}
+		edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+		if err != nil {
+			panic(err)
+		}
+		testJWTKeys = map[string]string{
+			"rsa-1": string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})),
+			"ec-1":  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER})),
+			"ed-1":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER})),
+		}
+	})
+	return testJWTKeys
+}
+
+// newTestJWTKeySet tạo key set gồm các kid cho trước (theo thứ tự), ký bằng signingKID
+func newTestJWTKeySet(t *testing.T, signingKID string, acceptHS256 bool, kids ...string) *JWTKeySet {
+	t.Helper()
+	pems := testJWTKeyPEMs(t)
+	cfg := config.JWTConfig{Secret: testJWTSecret, SigningKeyID: signingKID, AcceptHS256: acceptHS256}
+	for _, kid := range kids {
+		cfg.Keys = append(cfg.Keys, config.JWTKeyConfig{ID: kid, PrivateKey: pems[kid]})
+	}
+	s, err := NewJWTKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testJWTClaims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": "u-1", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func signHS256(t *testing.T, header map[string]interface{}, key []byte) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testJWTClaims())
+	for k, v := range header {
+		token.Header[k] = v
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWTKeySetSelectsKeyByKid(t *testing.T) {
+	kids := []string{"rsa-1", "ec-1", "ed-1"}
+	algs := map[string]string{"rsa-1": "RS256", "ec-1": "ES256", "ed-1": "EdDSA"}
+
+	// Mỗi khoá lần lượt là khoá ký; key set đang ký bằng khoá khác vẫn nhận token cũ theo kid
+	verifier := newTestJWTKeySet(t, "ec-1", false, kids...)
+	for _, kid := range kids {
+		signed, err := newTestJWTKeySet(t, kid, false, kids...).Sign(testJWTClaims())
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := verifier.Parse(signed)
+		if err != nil {
+			t.Fatalf("%s: parse: %v", kid, err)
+		}
+		if token.Header["kid"] != kid || token.Method.Alg() != algs[kid] {
+			t.Fatalf("%s: header kid/alg = %v/%s, want %s/%s", kid, token.Header["kid"], token.Method.Alg(), kid, algs[kid])
+		}
+	}
+
+	// Khoá đã bị gỡ khỏi cấu hình thì token ký bằng nó không còn hợp lệ
+	signed, err := newTestJWTKeySet(t, "rsa-1", false, "rsa-1").Sign(testJWTClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestJWTKeySet(t, "ec-1", false, "ec-1").Parse(signed); !errors.Is(err, ErrJWKNotFound) {
+		t.Fatalf("unknown kid: err = %v, want ErrJWKNotFound", err)
+	}
+}
+
+func TestJWTKeySetRejectsAlgNotMatchingKid(t *testing.T) {
+	s := newTestJWTKeySet(t, "rsa-1", true, "rsa-1", "ec-1")
+
+	// Tấn công kinh điển: HS256 với "secret" là khoá công khai RSA, kid trỏ tới khoá RSA
+	pubDER, err := x509.MarshalPKIXPublicKey(s.keys["rsa-1"].signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	for _, key := range [][]byte{pubPEM, pubDER} {
+		forged := signHS256(t, map[string]interface{}{"kid": "rsa-1"}, key)
+		if _, err := s.Parse(forged); !errors.Is(err, jwt.ErrSignatureInvalid) {
+			t.Fatalf("HS256 with rsa kid: err = %v, want ErrSignatureInvalid", err)
+		}
+	}
+	// HS256 ký đúng secret nhưng gắn kid của khoá bất đối xứng cũng bị từ chối
+	if _, err := s.Parse(signHS256(t, map[string]interface{}{"kid": "rsa-1"}, []byte(testJWTSecret))); !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Fatalf("HS256 secret with rsa kid: err = %v, want ErrSignatureInvalid", err)
+	}
+
+	// Token ES256 hợp lệ nhưng header khai kid của khoá RS256
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, testJWTClaims())
+	token.Header["kid"] = "rsa-1"
+	signed, err := token.SignedString(s.keys["ec-1"].signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Parse(signed); !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Fatalf("ES256 with rsa kid: err = %v, want ErrSignatureInvalid", err)
+	}
+
+	// alg "none" không bao giờ được nhận
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, testJWTClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Parse(unsigned); err == nil {
+		t.Fatal("alg none accepted")
+	}
+}
+
+func TestJWTKeySetLegacyHS256WithoutKid(t *testing.T) {
+	legacy := signHS256(t, nil, []byte(testJWTSecret))
+
+	// Đang chuyển sang khoá bất đối xứng, vẫn nhận token HS256 cũ
+	if _, err := newTestJWTKeySet(t, "ec-1", true, "ec-1").Parse(legacy); err != nil {
+		t.Fatalf("accept_hs256: parse legacy token: %v", err)
+	}
+	// Tắt accept_hs256 thì token HS256 không còn hợp lệ
+	if _, err := newTestJWTKeySet(t, "ec-1", false, "ec-1").Parse(legacy); !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Fatalf("without accept_hs256: err = %v, want ErrSignatureInvalid", err)
+	}
+	// Sai secret
+	if _, err := newTestJWTKeySet(t, "ec-1", true, "ec-1").Parse(signHS256(t, nil, []byte("other-secret"))); err == nil {
+		t.Fatal("HS256 token with wrong secret accepted")
+	}
+
+	// Token bất đối xứng thiếu kid không được rơi về nhánh HS256
+	ecSet := newTestJWTKeySet(t, "ec-1", true, "ec-1")
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodES256, testJWTClaims()).SignedString(ecSet.keys["ec-1"].signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ecSet.Parse(signed); !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Fatalf("ES256 without kid: err = %v, want ErrSignatureInvalid", err)
+	}
+
+	// Chưa cấu hình khoá nào: ký và kiểm tra HS256 bằng secret, không có kid
+	secretOnly, err := NewJWTKeySet(config.JWTConfig{Secret: testJWTSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err = secretOnly.Sign(testJWTClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := secretOnly.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, hasKid := token.Header["kid"]; hasKid || token.Method.Alg() != "HS256" {
+		t.Fatalf("secret-only header = %v, want HS256 without kid", token.Header)
+	}
+	if _, err := secretOnly.Parse(legacy); err != nil {
+		t.Fatalf("secret-only: parse legacy token: %v", err)
+	}
+}
+
+func TestJWTKeySetJWKS(t *testing.T) {
+	kids := []string{"rsa-1", "ec-1", "ed-1"}
+	s := newTestJWTKeySet(t, "ec-1", true, kids...)
+
+	set := s.JWKS()
+	if len(set.Keys) != len(kids) {
+		t.Fatalf("JWKS has %d keys, want %d", len(set.Keys), len(kids))
+	}
+	want := []struct{ kid, kty, alg, crv string }{
+		{"rsa-1", "RSA", "RS256", ""},
+		{"ec-1", "EC", "ES256", "P-256"},
+		{"ed-1", "OKP", "EdDSA", "Ed25519"},
+	}
+	for i, w := range want {
+		k := set.Keys[i]
+		if k.Kid != w.kid || k.Kty != w.kty || k.Alg != w.alg || k.Crv != w.crv || k.Use != "sig" {
+			t.Fatalf("JWKS key %d = %+v, want kid/kty/alg/crv %s/%s/%s/%s", i, k, w.kid, w.kty, w.alg, w.crv)
+		}
+		// Khoá công bố phải khớp khoá ký để bên ngoài kiểm tra được token
+		pub, err := k.PublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(s.keys[w.kid].signer.Public()) {
+			t.Fatalf("JWKS key %s does not match the signing key", w.kid)
+		}
+	}
+
+	// Không bao giờ lộ secret HS256 hay phần private của khoá
+	raw, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{testJWTSecret, `"d"`, `"oct"`, `"k"`} {
+		if strings.Contains(string(raw), leak) {
+			t.Fatalf("JWKS output contains %s: %s", leak, raw)
+		}
+	}
+
+	secretOnly, err := NewJWTKeySet(config.JWTConfig{Secret: testJWTSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := secretOnly.JWKS().Keys; keys == nil || len(keys) != 0 {
+		t.Fatalf("secret-only JWKS = %#v, want empty key list", keys)
+	}
+}
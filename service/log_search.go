@@ -0,0 +1,210 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lumberjack đặt tên file đã xoay vòng là <tên>-<thời điểm xoay, UTC><đuôi>, nén thêm .gz
+const rotatedLogTimeFormat = "2006-01-02T15-04-05.000"
+
+const maxLogLineSize = 1024 * 1024
+
+var errStopLogScan = errors.New("stop log scan")
+
+// LogFile là một file log trên đĩa: file đang ghi hoặc file đã xoay vòng
+type LogFile struct {
+	Name       string     `json:"name"`
+	Size       int64      `json:"size"`
+	ModifiedAt time.Time  `json:"modified_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"` // nil với file đang ghi
+	Compressed bool       `json:"compressed"`
+	Current    bool       `json:"current"`
+}
+
+// LogRetention là chính sách giữ log đang áp dụng
+type LogRetention struct {
+	MaxSizeMB  int  `json:"max_size_mb"`
+	MaxAgeDays int  `json:"max_age_days"`
+	MaxBackups int  `json:"max_backups"`
+	Compress   bool `json:"compress"`
+}
+
+// LogSearchService tìm log trong file đang ghi và các file đã xoay vòng (kể cả .gz) của logging.file_path
+type LogSearchService struct {
+	cfg logger.LogConfig
+}
+
+func NewLogSearchService(cfg logger.LogConfig) *LogSearchService {
+	return &LogSearchService{cfg: cfg}
+}
+
+// Enabled cho biết log có được ghi ra file không (output=stdout thì không có gì để tìm)
+func (s *LogSearchService) Enabled() bool {
+	return s.cfg.Output == "file" && s.cfg.FilePath != ""
+}
+
+func (s *LogSearchService) Retention() LogRetention {
+	maxSize, maxAge := s.cfg.Rotation()
+	return LogRetention{MaxSizeMB: maxSize, MaxAgeDays: maxAge, MaxBackups: logger.MaxBackups, Compress: true}
+}
+
+// Files liệt kê các file log, cũ trước, file đang ghi ở cuối
+func (s *LogSearchService) Files() ([]LogFile, error) {
+	if !s.Enabled() {
+		return []LogFile{}, nil
+	}
+	dir := filepath.Dir(s.cfg.FilePath)
+	base := filepath.Base(s.cfg.FilePath)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []LogFile{}, nil
+		}
+		return nil, err
+	}
+	files := []LogFile{}
+	var current *LogFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		f := LogFile{Name: name}
+		switch {
+		case name == base:
+			f.Current = true
+		case strings.HasPrefix(name, prefix):
+			stamp := strings.TrimPrefix(name, prefix)
+			if strings.HasSuffix(stamp, ext+".gz") {
+				f.Compressed = true
+				stamp = strings.TrimSuffix(stamp, ext+".gz")
+			} else if strings.HasSuffix(stamp, ext) {
+				stamp = strings.TrimSuffix(stamp, ext)
+			} else {
+				continue
+			}
+			t, err := time.Parse(rotatedLogTimeFormat, stamp)
+			if err != nil {
+				continue
+			}
+			f.RotatedAt = &t
+		default:
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		f.Size = info.Size()
+		f.ModifiedAt = info.ModTime()
+		if f.Current {
+			current = &f
+		} else {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].RotatedAt.Before(*files[j].RotatedAt) })
+	if current != nil {
+		files = append(files, *current)
+	}
+	return files, nil
+}
+
+// Search trả về tối đa limit entry khớp filter theo thứ tự thời gian, bỏ qua offset entry đầu.
+// more = true khi còn entry khớp sau trang này.
+func (s *LogSearchService) Search(ctx context.Context, filter LogFilter, offset, limit int) ([]*LogEntry, bool, error) {
+	entries := []*LogEntry{}
+	more := false
+	skipped := 0
+	err := s.Each(ctx, filter, func(e *LogEntry) error {
+		if skipped < offset {
+			skipped++
+			return nil
+		}
+		if len(entries) == limit {
+			more = true
+			return errStopLogScan
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, more, err
+}
+
+// Each gọi fn với từng entry khớp filter theo thứ tự thời gian, dừng khi fn trả lỗi (lỗi được trả về).
+// File xoay vòng trước filter.Since được bỏ qua, dừng đọc khi file trước đó đã xoay vòng sau filter.Until.
+func (s *LogSearchService) Each(ctx context.Context, filter LogFilter, fn func(*LogEntry) error) error {
+	files, err := s.Files()
+	if err != nil {
+		return err
+	}
+	var prevRotated *time.Time
+	for _, f := range files {
+		if !filter.Until.IsZero() && prevRotated != nil && prevRotated.After(filter.Until) {
+			break
+		}
+		prevRotated = f.RotatedAt
+		if !filter.Since.IsZero() && f.RotatedAt != nil && f.RotatedAt.Before(filter.Since) {
+			continue
+		}
+		if err := s.scanFile(ctx, f, filter, fn); err != nil {
+			if errors.Is(err, errStopLogScan) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LogSearchService) scanFile(ctx context.Context, f LogFile, filter LogFilter, fn func(*LogEntry) error) error {
+	file, err := os.Open(filepath.Join(filepath.Dir(s.cfg.FilePath), f.Name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// bị xoá do hết hạn giữa lúc liệt kê và lúc đọc
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if f.Compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+	for n := 0; scanner.Scan(); n++ {
+		if n%1000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		e, err := ParseLogEntry(scanner.Bytes())
+		if err != nil || !filter.Match(e) {
+			continue
+		}
+		// ParseLogEntry giữ slice của scanner, copy trước khi đọc dòng tiếp
+		e.Raw = append([]byte(nil), e.Raw...)
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -1,37 +1,211 @@
 package service
 
 import (
-	"context"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/hpcloud/tail"
+	"github.com/rs/zerolog"
 )
 
-// ctx: context để dừng tail log khi client disconnect
-func StartTailLogFile(ctx context.Context, logPath string, onLine func(string)) {
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		for {
-			t, err := tail.TailFile(logPath, tail.Config{Follow: true, ReOpen: true, Poll: true})
-			if err != nil {
-				time.Sleep(2 * time.Second)
-				continue
-			}
-			for {
-				select {
-				case <-ctx.Done():
-					t.Stop()
-					return
-				case line, ok := <-t.Lines:
-					if !ok {
-						return
-					}
-					if line != nil {
-						onLine(line.Text)
-					}
-				}
-			}
+const (
+	defaultLogBacklog   = 1000
+	logSubscriberBuffer = 256
+)
+
+// LogEntry là một dòng log JSON đã parse các field dùng để lọc, Raw là nguyên dòng gửi cho client
+type LogEntry struct {
+	Time   time.Time
+	Level  zerolog.Level
+	Path   string
+	UserID string
+	Status int
+	Raw    json.RawMessage
+}
+
+// LogFilter lọc log theo level tối thiểu, tiền tố path, user, khoảng status, khoảng thời gian
+// và chuỗi tự do (Text, không phân biệt hoa thường, tìm trong cả dòng). Field rỗng là không lọc.
+type LogFilter struct {
+	MinLevel  zerolog.Level
+	Path      string
+	UserID    string
+	StatusMin int
+	StatusMax int
+	Since     time.Time
+	Until     time.Time
+	Text      string
+}
+
+func (f LogFilter) Match(e *LogEntry) bool {
+	if e.Level < f.MinLevel {
+		return false
+	}
+	if f.Path != "" && !strings.HasPrefix(e.Path, f.Path) {
+		return false
+	}
+	if f.UserID != "" && e.UserID != f.UserID {
+		return false
+	}
+	if (f.StatusMin > 0 || f.StatusMax > 0) && e.Status == 0 {
+		return false
+	}
+	if f.StatusMin > 0 && e.Status < f.StatusMin {
+		return false
+	}
+	if f.StatusMax > 0 && e.Status > f.StatusMax {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if f.Text != "" && !bytes.Contains(bytes.ToLower(e.Raw), []byte(strings.ToLower(f.Text))) {
+		return false
+	}
+	return true
+}
+
+// ParseLogEntry đọc các field lọc từ một dòng log của zerolog
+func ParseLogEntry(line []byte) (*LogEntry, error) {
+	var fields struct {
+		Time   string `json:"time"`
+		Level  string `json:"level"`
+		Path   string `json:"path"`
+		UserID string `json:"user_id"`
+		Status int    `json:"status"`
+	}
+	line = bytes.TrimSpace(line)
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, err
+	}
+	level, err := zerolog.ParseLevel(fields.Level)
+	if err != nil {
+		level = zerolog.NoLevel
+	}
+	t, _ := time.Parse(time.RFC3339, fields.Time)
+	return &LogEntry{Time: t, Level: level, Path: fields.Path, UserID: fields.UserID, Status: fields.Status, Raw: line}, nil
+}
+
+// LogSubscription nhận các entry mới khớp filter qua C. Client đọc không kịp thì entry bị bỏ, số dòng bỏ trả về khi Unsubscribe.
+type LogSubscription struct {
+	C       chan *LogEntry
+	filter  LogFilter
+	dropped int
+}
+
+// LogHub giữ các dòng log gần nhất và phát log mới tới các admin đang xem (singleton).
+// Được nạp trực tiếp từ logger (logger.AddSink), mọi admin dùng chung một nguồn thay vì mỗi người tail file.
+type LogHub struct {
+	mu      sync.Mutex
+	backlog []*LogEntry // ring buffer, next là vị trí ghi tiếp theo
+	next    int
+	full    bool
+	subs    map[*LogSubscription]struct{}
+}
+
+var logHubInstance *LogHub
+var once sync.Once
+
+func GetLogHub() *LogHub {
+	once.Do(func() {
+		logHubInstance = &LogHub{
+			backlog: make([]*LogEntry, defaultLogBacklog),
+			subs:    make(map[*LogSubscription]struct{}),
 		}
-	}()
+	})
+	return logHubInstance
+}
+
+// SetBacklog đổi số dòng log giữ lại để backfill, gọi lúc khởi động
+func (h *LogHub) SetBacklog(n int) {
+	if n <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.backlog = make([]*LogEntry, n)
+	h.next = 0
+	h.full = false
+}
+
+// Ingest nhận một dòng log từ logger. Không được ghi log ở đây (logger đang gọi vào).
+func (h *LogHub) Ingest(line []byte) {
+	e, err := ParseLogEntry(line)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.backlog[h.next] = e
+	h.next = (h.next + 1) % len(h.backlog)
+	if h.next == 0 {
+		h.full = true
+	}
+	for sub := range h.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.C <- e:
+		default:
+			// client không đọc kịp, bỏ qua để không chặn logger
+			sub.dropped++
+		}
+	}
+}
+
+// Subscribe trả về tối đa backfill entry gần nhất khớp filter (cũ trước) và đăng ký nhận entry mới,
+// cùng dưới một lock nên không sót hay trùng dòng nào giữa backfill và luồng trực tiếp.
+func (h *LogHub) Subscribe(filter LogFilter, backfill int) ([]*LogEntry, *LogSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entries := h.recent(filter, backfill)
+	sub := &LogSubscription{C: make(chan *LogEntry, logSubscriberBuffer), filter: filter}
+	h.subs[sub] = struct{}{}
+	return entries, sub
+}
+
+// Recent trả về tối đa limit entry gần nhất khớp filter (cũ trước)
+func (h *LogHub) Recent(filter LogFilter, limit int) []*LogEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.recent(filter, limit)
+}
+
+func (h *LogHub) recent(filter LogFilter, limit int) []*LogEntry {
+	if limit <= 0 {
+		return []*LogEntry{}
+	}
+	size := h.next
+	if h.full {
+		size = len(h.backlog)
+	}
+	matched := []*LogEntry{}
+	// duyệt từ mới về cũ
+	for i := 1; i <= size && len(matched) < limit; i++ {
+		e := h.backlog[(h.next-i+len(h.backlog))%len(h.backlog)]
+		if filter.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	return matched
+}
+
+// Unsubscribe huỷ đăng ký và đóng C, trả về số entry đã bị bỏ vì client đọc chậm
+func (h *LogHub) Unsubscribe(sub *LogSubscription) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; !ok {
+		return sub.dropped
+	}
+	delete(h.subs, sub)
+	close(sub.C)
+	return sub.dropped
 }
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// FakeOIDCIssuer là issuer OpenID Connect chạy cục bộ để test luồng đăng nhập mà không cần Microsoft/Google.
+// Chỉ có trong file test nên không được build vào binary. Dùng kèm httptest:
+//
+//	fake, _ := NewFakeOIDCIssuer()
+//	srv := httptest.NewServer(fake)
+//	fake.Issuer = srv.URL // cấu hình provider với issuer = srv.URL, jwks_url để trống
+//	token, _ := fake.IDToken("client-id", "sub-1", "b21dccn001@stu.ptit.edu.vn", nil)
+type FakeOIDCIssuer struct {
+	Issuer string
+
+	mu  sync.RWMutex
+	kid string
+	key *rsa.PrivateKey
+}
+
+func NewFakeOIDCIssuer() (*FakeOIDCIssuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &FakeOIDCIssuer{kid: uuid.NewString(), key: key}, nil
+}
+
+// ServeHTTP trả về discovery document và JWKS giống một issuer thật
+func (f *FakeOIDCIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   f.Issuer,
+			"jwks_uri": strings.TrimRight(f.Issuer, "/") + "/jwks",
+		})
+	case "/jwks":
+		f.mu.RLock()
+		jwk, _ := NewJWK(f.kid, "RS256", &f.key.PublicKey)
+		f.mu.RUnlock()
+		json.NewEncoder(w).Encode(JWKS{Keys: []JWK{jwk}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Rotate thay khoá ký bằng khoá mới có kid mới, như issuer xoay khoá định kỳ
+func (f *FakeOIDCIssuer) Rotate() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.kid, f.key = uuid.NewString(), key
+	f.mu.Unlock()
+	return nil
+}
+
+// IDToken ký ID token hợp lệ trong 5 phút, extra ghi đè hoặc bổ sung claim (vd. nonce, email_verified, exp)
+func (f *FakeOIDCIssuer) IDToken(clientID, subject, email string, extra jwt.MapClaims) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   f.Issuer,
+		"aud":   clientID,
+		"sub":   subject,
+		"email": email,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = f.kid
+	return token.SignedString(f.key)
+}
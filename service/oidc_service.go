@@ -0,0 +1,163 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrOIDCUnknownProvider = errors.New("unknown oidc provider")
+	ErrOIDCInvalidToken    = errors.New("invalid id_token")
+)
+
+// oidcSigningMethods là các thuật toán ký ID token được chấp nhận (không nhận HS* và none)
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCIdentity là danh tính đã xác thực từ ID token
+type OIDCIdentity struct {
+	Provider string
+	Subject  string // claim sub, cố định theo tài khoản ở issuer
+	Email    string
+	Name     string
+	// EmailVerified = true khi Email lấy từ claim email và issuer xác nhận (email_verified hoặc trusted_email_claim).
+	// Chỉ khi đó mới được liên kết với tài khoản có sẵn theo email.
+	EmailVerified bool
+}
+
+// OIDCProvider là một issuer đã cấu hình cùng nguồn khoá ký của nó
+type OIDCProvider struct {
+	Config config.OIDCProviderConfig
+	Keys   KeySource
+}
+
+// DomainRule trả về quy tắc theo domain email, nil nếu domain không được phép
+func (p *OIDCProvider) DomainRule(email string) *config.OIDCDomainRule {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return nil
+	}
+	domain := strings.ToLower(email[at+1:])
+	for i := range p.Config.Domains {
+		if strings.ToLower(p.Config.Domains[i].Domain) == domain {
+			return &p.Config.Domains[i]
+		}
+	}
+	return nil
+}
+
+// OIDCVerifier kiểm tra ID token của các nhà cung cấp OpenID Connect đã cấu hình
+type OIDCVerifier struct {
+	providers map[string]*OIDCProvider
+}
+
+func NewOIDCVerifier(cfg config.OIDCConfig) *OIDCVerifier {
+	v := &OIDCVerifier{providers: make(map[string]*OIDCProvider, len(cfg.Providers))}
+	for _, p := range cfg.Providers {
+		v.providers[p.Name] = &OIDCProvider{Config: p, Keys: NewRemoteJWKS(p.JWKSURL, p.Issuer)}
+	}
+	return v
+}
+
+// Provider tìm nhà cung cấp theo tên trong đường dẫn
+func (v *OIDCVerifier) Provider(name string) (*OIDCProvider, bool) {
+	p, ok := v.providers[name]
+	return p, ok
+}
+
+// Verify kiểm tra chữ ký (qua JWKS), iss, aud, exp và nonce (nếu FE gửi) của ID token rồi trả về danh tính
+func (v *OIDCVerifier) Verify(ctx context.Context, providerName, rawIDToken, nonce string) (*OIDCIdentity, error) {
+	p, ok := v.Provider(providerName)
+	if !ok {
+		return nil, ErrOIDCUnknownProvider
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.Keys.Key(ctx, kid)
+	},
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(p.Config.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCInvalidToken, err)
+	}
+
+	aud, _ := claims.GetAudience()
+	if !containsAny(p.Config.ClientIDs, aud) {
+		return nil, fmt.Errorf("%w: audience not allowed", ErrOIDCInvalidToken)
+	}
+	// Token cấp cho nhiều audience thì azp phải là client của mình (OIDC Core 3.1.3.7)
+	if azp, ok := claims["azp"].(string); ok && azp != "" && !containsAny(p.Config.ClientIDs, []string{azp}) {
+		return nil, fmt.Errorf("%w: authorized party not allowed", ErrOIDCInvalidToken)
+	}
+	if nonce != "" {
+		if got, _ := claims["nonce"].(string); got != nonce {
+			return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCInvalidToken)
+		}
+	}
+
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrOIDCInvalidToken)
+	}
+	verified, hasVerified := claims["email_verified"].(bool)
+	if hasVerified && !verified {
+		return nil, fmt.Errorf("%w: email not verified", ErrOIDCInvalidToken)
+	}
+	identity := &OIDCIdentity{Provider: providerName, Subject: sub}
+	if email, _ := claims["email"].(string); strings.Contains(email, "@") {
+		identity.Email = email
+		identity.EmailVerified = verified || trustedClaim(claims, p.Config.TrustedEmailClaim)
+	} else {
+		// Microsoft không luôn có claim email, khi đó dùng preferred_username/upn để lọc domain và tạo tài khoản mới.
+		// Hai claim này người dùng/tenant đổi được nên không bao giờ dùng để liên kết tài khoản có sẵn.
+		for _, name := range []string{"preferred_username", "upn"} {
+			if s, _ := claims[name].(string); strings.Contains(s, "@") {
+				identity.Email = s
+				break
+			}
+		}
+	}
+	if identity.Email == "" {
+		return nil, fmt.Errorf("%w: missing email", ErrOIDCInvalidToken)
+	}
+	identity.Name, _ = claims["name"].(string)
+	return identity, nil
+}
+
+// trustedClaim kiểm tra claim xác nhận email riêng của provider, chấp nhận true hoặc "true"/"1"
+func trustedClaim(claims jwt.MapClaims, name string) bool {
+	if name == "" {
+		return false
+	}
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true" || v == "1"
+	case float64:
+		return v == 1
+	}
+	return false
+}
+
+func containsAny(allowed, values []string) bool {
+	for _, v := range values {
+		for _, a := range allowed {
+			if a == v {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testOIDCProvider = "fake"
+	testOIDCClientID = "dorm-client"
+	testOIDCEmail    = "b21dccn001@stu.ptit.edu.vn"
+)
+
+type oidcTestEnv struct {
+	fake        *FakeOIDCIssuer
+	verifier    *OIDCVerifier
+	jwksFetches atomic.Int32
+}
+
+func newOIDCTestEnv(t *testing.T, trustedClaim string) *oidcTestEnv {
+	t.Helper()
+	fake, err := NewFakeOIDCIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &oidcTestEnv{fake: fake}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jwks" {
+			env.jwksFetches.Add(1)
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	fake.Issuer = srv.URL
+
+	env.verifier = NewOIDCVerifier(config.OIDCConfig{Providers: []config.OIDCProviderConfig{{
+		Name:              testOIDCProvider,
+		Issuer:            srv.URL,
+		ClientIDs:         []string{testOIDCClientID},
+		TrustedEmailClaim: trustedClaim,
+	}}})
+	return env
+}
+
+func (e *oidcTestEnv) token(t *testing.T, extra jwt.MapClaims) string {
+	t.Helper()
+	token, err := e.fake.IDToken(testOIDCClientID, "sub-1", testOIDCEmail, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func (e *oidcTestEnv) verify(token, nonce string) (*OIDCIdentity, error) {
+	return e.verifier.Verify(context.Background(), testOIDCProvider, token, nonce)
+}
+
+func expectInvalidToken(t *testing.T, err error, reason string) {
+	t.Helper()
+	if !errors.Is(err, ErrOIDCInvalidToken) {
+		t.Fatalf("err = %v, want ErrOIDCInvalidToken", err)
+	}
+	if !strings.Contains(err.Error(), reason) {
+		t.Fatalf("err = %v, want reason %q", err, reason)
+	}
+}
+
+func TestOIDCVerifyValidToken(t *testing.T) {
+	env := newOIDCTestEnv(t, "")
+	identity, err := env.verify(env.token(t, jwt.MapClaims{"email_verified": true, "name": "Nguyen Van A", "nonce": "n-1"}), "n-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Provider != testOIDCProvider || identity.Subject != "sub-1" || identity.Email != testOIDCEmail || identity.Name != "Nguyen Van A" {
+		t.Fatalf("identity = %+v", identity)
+	}
+	if !identity.EmailVerified {
+		t.Fatal("email_verified=true not reported as verified")
+	}
+}
+
+func TestOIDCVerifyUnknownProvider(t *testing.T) {
+	env := newOIDCTestEnv(t, "")
+	_, err := env.verifier.Verify(context.Background(), "other", env.token(t, nil), "")
+	if !errors.Is(err, ErrOIDCUnknownProvider) {
+		t.Fatalf("err = %v, want ErrOIDCUnknownProvider", err)
+	}
+}
+
+func TestOIDCVerifyRejectsWrongAudience(t *testing.T) {
+	env := newOIDCTestEnv(t, "")
+	_, err := env.verify(env.token(t, jwt.MapClaims{"aud": "another-app"}), "")
+	expectInvalidToken(t, err, "audience not allowed")
+}
+
+func TestOIDCVerifyRejectsWrongAuthorizedParty(t *testing.T) {
+	env := newOIDCTestEnv(t, "")
+	token := env.token(t, jwt.MapClaims{"aud": []string{testOIDCClientID, "another-app"}, "azp": "another-app"})
+	_, err := env.verify(token, "")
+	expectInvalidToken(t, err, "authorized party not allowed")
+
+	token = env.token(t, jwt.MapClaims{"aud": []string{testOIDCClientID, "another-app"}, "azp": testOIDCClientID})
+	if _, err := env.verify(token, ""); err != nil {
+		t.Fatalf("token with own azp rejected: %v", err)
+	}
+}
+
+func TestOIDCVerifyRejectsExpiredToken(t *testing.T) {
+	env := newOIDCTestEnv(t, "")
+	past := time.Now().Add(-10 * time.Minute)
+	token := env.token(t, jwt.MapClaims{"iat": past.Add(-5 * time.Minute).Unix(), "exp": past.Unix()})
+	_, err := env.verify(token, "")
+	expectInvalidToken(t, err, "expired")
+}
+
+func TestOIDCVerifyRejectsWrongIssuer(t *testing.T) {
+	env := newOIDCTestEnv(t, "")
+	_, err := env.verify(env.token(t, jwt.MapClaims{"iss": "https://evil.example.com"}), "")
+	expectInvalidToken(t, err, "issuer")
+}
+
+func TestOIDCVerifyRejectsNonceMismatch(t *testing.T) {
+	env := newOIDCTestEnv(t, "")
+	_, err := env.verify(env.token(t, jwt.MapClaims{"nonce": "n-1"}), "n-2")
+	expectInvalidToken(t, err, "nonce mismatch")
+
+	_, err = env.verify(env.token(t, nil), "n-2")
+	expectInvalidToken(t, err, "nonce mismatch")
+}
+
+func TestOIDCVerifyRejectsUnverifiedEmail(t *testing.T) {
+	env := newOIDCTestEnv(t, "")
+	_, err := env.verify(env.token(t, jwt.MapClaims{"email_verified": false}), "")
+	expectInvalidToken(t, err, "email not verified")
+}
+
+func TestOIDCVerifyEmailVerification(t *testing.T) {
+	env := newOIDCTestEnv(t, "xms_edov")
+
+	// Không có email_verified: dùng được để đăng nhập nhưng không được liên kết theo email
+	identity, err := env.verify(env.token(t, nil), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.EmailVerified {
+		t.Fatal("email without email_verified reported as verified")
+	}
+
+	identity, err = env.verify(env.token(t, jwt.MapClaims{"xms_edov": true}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.EmailVerified {
+		t.Fatal("trusted provider claim not reported as verified")
+	}
+
+	// preferred_username/upn chỉ dùng để lọc domain, không bao giờ được coi là đã xác minh
+	token := env.token(t, jwt.MapClaims{"email": nil, "preferred_username": testOIDCEmail, "email_verified": true, "xms_edov": true})
+	identity, err = env.verify(token, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Email != testOIDCEmail || identity.EmailVerified {
+		t.Fatalf("preferred_username identity = %+v, want unverified %s", identity, testOIDCEmail)
+	}
+}
+
+func TestOIDCVerifyRefetchesJWKSOnUnknownKid(t *testing.T) {
+	env := newOIDCTestEnv(t, "")
+	if _, err := env.verify(env.token(t, nil), ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.jwksFetches.Load(); n != 1 {
+		t.Fatalf("jwks fetches = %d, want 1", n)
+	}
+	if _, err := env.verify(env.token(t, nil), ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.jwksFetches.Load(); n != 1 {
+		t.Fatalf("jwks fetches with cached key = %d, want 1", n)
+	}
+
+	if err := env.fake.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	rotated := env.token(t, nil)
+
+	// Trong jwksMinRefresh không tải lại để kid giả không làm dội request tới issuer
+	_, err := env.verify(rotated, "")
+	if !errors.Is(err, ErrOIDCInvalidToken) {
+		t.Fatalf("err = %v, want ErrOIDCInvalidToken before refresh is allowed", err)
+	}
+	if n := env.jwksFetches.Load(); n != 1 {
+		t.Fatalf("jwks fetches within min refresh = %d, want 1", n)
+	}
+
+	p, _ := env.verifier.Provider(testOIDCProvider)
+	jwks := p.Keys.(*RemoteJWKS)
+	jwks.mu.Lock()
+	jwks.fetchedAt = time.Now().Add(-2 * jwksMinRefresh)
+	jwks.mu.Unlock()
+
+	if _, err := env.verify(rotated, ""); err != nil {
+		t.Fatalf("token signed with rotated key rejected: %v", err)
+	}
+	if n := env.jwksFetches.Load(); n != 2 {
+		t.Fatalf("jwks fetches after unknown kid = %d, want 2", n)
+	}
+}
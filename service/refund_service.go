@@ -0,0 +1,77 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/models"
+	"errors"
+	"math"
+	"time"
+)
+
+var (
+	ErrRefundMissingDates    = errors.New("contract has no start_date or end_date")
+	ErrRefundInvalidTermDate = errors.New("termination date must be within the contract period")
+	ErrRefundContractNotPaid = errors.New("contract has not been paid, nothing to refund")
+)
+
+// dateOnly bỏ phần giờ để tính theo ngày lịch
+func dateOnly(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(dateOnly(to).Sub(dateOnly(from)).Hours() / 24)
+}
+
+// CalculateRefund tính số tiền hoàn lại cho hợp đồng kết thúc trước hạn.
+//
+// Tiền phòng được chia đều theo ngày (TotalAmount / tổng số ngày hợp đồng).
+// Số tiền của những ngày chưa ở được hoàn lại sau khi trừ:
+//   - tiền cọc không hoàn lại (rules.NonRefundableDeposit)
+//   - tiền phạt báo trễ: mỗi ngày thiếu so với rules.NoticePeriodDays bị tính bằng một ngày tiền phòng
+//
+// noticeDate là ngày sinh viên/ban quản lý thông báo kết thúc hợp đồng.
+func CalculateRefund(contract *models.Contract, terminationDate, noticeDate time.Time, rules config.RefundConfig) (*models.RefundQuote, error) {
+	if contract.StartDate == nil || contract.EndDate == nil {
+		return nil, ErrRefundMissingDates
+	}
+	if contract.StatusPayment != models.PaymentStatusPaid {
+		return nil, ErrRefundContractNotPaid
+	}
+	start := dateOnly(*contract.StartDate)
+	end := dateOnly(*contract.EndDate)
+	term := dateOnly(terminationDate)
+	if term.Before(start) || term.After(end) {
+		return nil, ErrRefundInvalidTermDate
+	}
+
+	quote := &models.RefundQuote{
+		ContractID:      contract.ID.String(),
+		TerminationDate: term,
+		NoticeDate:      dateOnly(noticeDate),
+		TotalDays:       daysBetween(start, end),
+		OccupiedDays:    daysBetween(start, term),
+	}
+	if quote.TotalDays <= 0 {
+		return quote, nil
+	}
+	quote.UnusedDays = quote.TotalDays - quote.OccupiedDays
+	quote.DailyRate = contract.TotalAmount / float64(quote.TotalDays)
+	quote.UnusedAmount = math.Round(quote.DailyRate * float64(quote.UnusedDays))
+
+	// Tiền cọc chỉ trừ tối đa bằng số tiền còn lại
+	quote.DepositDeduction = math.Min(rules.NonRefundableDeposit, quote.UnusedAmount)
+
+	noticeDays := daysBetween(quote.NoticeDate, term)
+	if noticeDays < rules.NoticePeriodDays {
+		quote.NoticeShortfallDays = rules.NoticePeriodDays - noticeDays
+		if quote.NoticeShortfallDays > quote.UnusedDays {
+			quote.NoticeShortfallDays = quote.UnusedDays
+		}
+		quote.NoticePenalty = math.Round(quote.DailyRate * float64(quote.NoticeShortfallDays))
+	}
+
+	quote.RefundAmount = math.Max(0, quote.UnusedAmount-quote.DepositDeduction-quote.NoticePenalty)
+	return quote, nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func refundDate(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// testRefundContract: hợp đồng 30 ngày, 3.000.000đ, tức 100.000đ mỗi ngày
+func testRefundContract() *models.Contract {
+	start, end := refundDate("2025-01-01"), refundDate("2025-01-31")
+	return &models.Contract{
+		ID:            uuid.New(),
+		StartDate:     &start,
+		EndDate:       &end,
+		TotalAmount:   3000000,
+		StatusPayment: models.PaymentStatusPaid,
+	}
+}
+
+func calculateTestRefund(t *testing.T, term, notice string, rules config.RefundConfig) *models.RefundQuote {
+	t.Helper()
+	quote, err := CalculateRefund(testRefundContract(), refundDate(term), refundDate(notice), rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return quote
+}
+
+func TestCalculateRefundProratesUnusedDays(t *testing.T) {
+	quote := calculateTestRefund(t, "2025-01-11", "2025-01-01", config.RefundConfig{})
+	if quote.TotalDays != 30 || quote.OccupiedDays != 10 || quote.UnusedDays != 20 {
+		t.Fatalf("days total/occupied/unused = %d/%d/%d, want 30/10/20", quote.TotalDays, quote.OccupiedDays, quote.UnusedDays)
+	}
+	if quote.DailyRate != 100000 || quote.UnusedAmount != 2000000 || quote.RefundAmount != 2000000 {
+		t.Fatalf("daily/unused/refund = %v/%v/%v, want 100000/2000000/2000000", quote.DailyRate, quote.UnusedAmount, quote.RefundAmount)
+	}
+
+	// Trả phòng đúng ngày kết thúc thì không còn gì để hoàn
+	quote = calculateTestRefund(t, "2025-01-31", "2025-01-01", config.RefundConfig{})
+	if quote.UnusedDays != 0 || quote.RefundAmount != 0 {
+		t.Fatalf("refund at end date = %+v, want nothing", quote)
+	}
+}
+
+func TestCalculateRefundDepositIsCappedAtUnusedAmount(t *testing.T) {
+	quote := calculateTestRefund(t, "2025-01-11", "2025-01-01", config.RefundConfig{NonRefundableDeposit: 500000})
+	if quote.DepositDeduction != 500000 || quote.RefundAmount != 1500000 {
+		t.Fatalf("deposit/refund = %v/%v, want 500000/1500000", quote.DepositDeduction, quote.RefundAmount)
+	}
+
+	quote = calculateTestRefund(t, "2025-01-11", "2025-01-01", config.RefundConfig{NonRefundableDeposit: 5000000})
+	if quote.DepositDeduction != 2000000 || quote.RefundAmount != 0 {
+		t.Fatalf("deposit/refund = %v/%v, want deduction capped at 2000000 and refund 0", quote.DepositDeduction, quote.RefundAmount)
+	}
+}
+
+func TestCalculateRefundNoticeShortfall(t *testing.T) {
+	rules := config.RefundConfig{NoticePeriodDays: 15}
+
+	// Báo trước 5 ngày, thiếu 10 ngày
+	quote := calculateTestRefund(t, "2025-01-11", "2025-01-06", rules)
+	if quote.NoticeShortfallDays != 10 || quote.NoticePenalty != 1000000 || quote.RefundAmount != 1000000 {
+		t.Fatalf("shortfall/penalty/refund = %d/%v/%v, want 10/1000000/1000000", quote.NoticeShortfallDays, quote.NoticePenalty, quote.RefundAmount)
+	}
+
+	// Báo đủ số ngày thì không bị phạt
+	quote = calculateTestRefund(t, "2025-01-20", "2025-01-05", rules)
+	if quote.NoticeShortfallDays != 0 || quote.NoticePenalty != 0 {
+		t.Fatalf("shortfall/penalty = %d/%v, want none", quote.NoticeShortfallDays, quote.NoticePenalty)
+	}
+
+	// Số ngày phạt không vượt quá số ngày chưa ở
+	quote = calculateTestRefund(t, "2025-01-25", "2025-01-25", config.RefundConfig{NoticePeriodDays: 30})
+	if quote.NoticeShortfallDays != 6 || quote.RefundAmount != 0 {
+		t.Fatalf("shortfall/refund = %d/%v, want 6/0", quote.NoticeShortfallDays, quote.RefundAmount)
+	}
+}
+
+func TestCalculateRefundRejectsTerminationOutsideContract(t *testing.T) {
+	for _, term := range []string{"2024-12-31", "2025-02-01"} {
+		_, err := CalculateRefund(testRefundContract(), refundDate(term), refundDate("2024-12-01"), config.RefundConfig{})
+		if !errors.Is(err, ErrRefundInvalidTermDate) {
+			t.Fatalf("termination %s: err = %v, want ErrRefundInvalidTermDate", term, err)
+		}
+	}
+}
+
+func TestCalculateRefundRequiresPaidContractWithDates(t *testing.T) {
+	contract := testRefundContract()
+	contract.StatusPayment = models.PaymentStatusUnpaid
+	if _, err := CalculateRefund(contract, refundDate("2025-01-11"), refundDate("2025-01-01"), config.RefundConfig{}); !errors.Is(err, ErrRefundContractNotPaid) {
+		t.Fatalf("err = %v, want ErrRefundContractNotPaid", err)
+	}
+
+	contract = testRefundContract()
+	contract.EndDate = nil
+	if _, err := CalculateRefund(contract, refundDate("2025-01-11"), refundDate("2025-01-01"), config.RefundConfig{}); !errors.Is(err, ErrRefundMissingDates) {
+		t.Fatalf("err = %v, want ErrRefundMissingDates", err)
+	}
+}
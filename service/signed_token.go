@@ -0,0 +1,34 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// SignToken ký id theo mục đích sử dụng (purpose) để tạo token dạng id.signature.
+// Token của mục đích này không dùng được cho mục đích khác.
+func SignToken(purpose, id, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + ":" + id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyToken kiểm tra chữ ký và trả về id nếu hợp lệ
+func VerifyToken(purpose, token, secret string) (string, bool) {
+	if secret == "" {
+		// Chưa cấu hình khoá thì ai cũng ký được token, không chấp nhận
+		return "", false
+	}
+	idx := strings.LastIndex(token, ".")
+	if idx <= 0 {
+		return "", false
+	}
+	id := token[:idx]
+	expected := SignToken(purpose, id, secret)
+	if !hmac.Equal([]byte(expected), []byte(token)) {
+		return "", false
+	}
+	return id, true
+}
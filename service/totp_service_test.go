@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// Secret "12345678901234567890" (ASCII) của RFC 6238 phụ lục B, mã hoá base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Vector SHA1 của RFC 6238 (8 chữ số), lấy 6 chữ số cuối như app xác thực
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},          // 94287082
+	{1111111109, "081804"},  // 07081804
+	{1111111111, "050471"},  // 14050471
+	{1234567890, "005924"},  // 89005924
+	{2000000000, "279037"},  // 69279037
+	{20000000000, "353130"}, // 65353130
+}
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		got, err := TOTPCode(rfc6238Secret, v.unix/totpPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.code {
+			t.Fatalf("TOTPCode at %d = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTPRFC6238Vectors(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		counter, ok := ValidateTOTP(rfc6238Secret, v.code, time.Unix(v.unix, 0), 0)
+		if !ok || counter != v.unix/totpPeriod {
+			t.Fatalf("ValidateTOTP(%s) at %d = %d, %v; want counter %d", v.code, v.unix, counter, ok, v.unix/totpPeriod)
+		}
+	}
+	// Secret viết thường và có khoảng trắng vẫn được chấp nhận
+	if _, ok := ValidateTOTP(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", "050471", time.Unix(1111111111, 0), 0); !ok {
+		t.Fatal("lower-case secret rejected")
+	}
+}
+
+func TestValidateTOTPSkewWindow(t *testing.T) {
+	const at = int64(1111111109) // bước 37037036, mã 081804
+	step := int64(totpPeriod)
+	code := "081804"
+
+	for _, offset := range []int64{-step, 0, step} {
+		counter, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(at+offset, 0), 1)
+		if !ok || counter != at/step {
+			t.Fatalf("offset %ds: counter = %d, ok = %v; want accepted at step %d", offset, counter, ok, at/step)
+		}
+	}
+	for _, offset := range []int64{-2 * step, 2 * step} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(at+offset, 0), 1); ok {
+			t.Fatalf("offset %ds: code accepted outside ±1 step", offset)
+		}
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(at+step, 0), 0); ok {
+		t.Fatal("previous step accepted with skew 0")
+	}
+}
+
+func TestValidateTOTPRejectsMalformedCode(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "94287082", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now, 1); ok {
+			t.Fatalf("code %q accepted", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "287082", now, 1); ok {
+		t.Fatal("invalid secret accepted")
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Bỏ các ký tự dễ nhầm (0/O, 1/I) để bảo vệ đọc mã dễ hơn
+const passCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const passCodeLength = 8
+
+var (
+	ErrVisitInvalidWindow   = errors.New("visit_end must be after visit_start")
+	ErrVisitInPast          = errors.New("visit_start must be in the future")
+	ErrVisitTooLong         = errors.New("visit is longer than allowed")
+	ErrVisitOutsideHours    = errors.New("visit must start within visiting hours")
+	ErrVisitOvernightDenied = errors.New("overnight guests are not allowed in this area")
+)
+
+// VisitPolicy là quy định tiếp khách đã áp dụng giá trị mặc định
+type VisitPolicy struct {
+	VisitingStart     string // HH:MM
+	VisitingEnd       string // HH:MM
+	OvernightGuestCap int
+	MaxDuration       time.Duration
+}
+
+// CheckVisitWindow kiểm tra khung giờ thăm theo quy định của khu.
+// Trả về overnight = true nếu khách ở lại sau giờ tiếp khách của ngày bắt đầu.
+func CheckVisitWindow(start, end, now time.Time, p VisitPolicy) (overnight bool, err error) {
+	if !end.After(start) {
+		return false, ErrVisitInvalidWindow
+	}
+	if start.Before(now) {
+		return false, ErrVisitInPast
+	}
+	if p.MaxDuration > 0 && end.Sub(start) > p.MaxDuration {
+		return false, fmt.Errorf("%w (max %s)", ErrVisitTooLong, p.MaxDuration)
+	}
+	open, err := parseClock(p.VisitingStart)
+	if err != nil {
+		return false, err
+	}
+	closeAt, err := parseClock(p.VisitingEnd)
+	if err != nil {
+		return false, err
+	}
+	startMin := start.Hour()*60 + start.Minute()
+	if startMin < open || startMin >= closeAt {
+		return false, fmt.Errorf("%w (%s - %s)", ErrVisitOutsideHours, p.VisitingStart, p.VisitingEnd)
+	}
+	y, m, d := start.Date()
+	endOfVisiting := time.Date(y, m, d, closeAt/60, closeAt%60, 0, 0, start.Location())
+	if end.After(endOfVisiting) {
+		if p.OvernightGuestCap <= 0 {
+			return true, ErrVisitOvernightDenied
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// GeneratePassCode sinh mã vào cổng ngẫu nhiên cho khách
+func GeneratePassCode() (string, error) {
+	return randomCode(passCodeLength)
+}
+
+// randomCode sinh chuỗi ngẫu nhiên từ bảng chữ dễ đọc (bỏ các ký tự dễ nhầm)
+func randomCode(length int) (string, error) {
+	b := make([]byte, length)
+	alphabetSize := big.NewInt(int64(len(passCodeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		b[i] = passCodeAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
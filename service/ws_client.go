@@ -0,0 +1,132 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"Backend_Dorm_PTIT/logger"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultWSSendBuffer     = 256
+	defaultWSMaxMessageSize = 64 * 1024
+)
+
+// WSClient bọc một connection WebSocket. gorilla/websocket không cho ghi đồng thời nên mọi message
+// đi qua hàng đợi send và chỉ WritePump ghi ra connection (kể cả ping).
+// Client đọc chậm làm đầy hàng đợi sẽ bị ngắt để không làm nghẽn cả room.
+type WSClient struct {
+	UserID string
+
+	log        *zerolog.Logger // logger của request mở kết nối (có request_id)
+	conn       *websocket.Conn
+	send       chan []byte
+	done       chan struct{}
+	closeOnce  sync.Once
+	writeWait  time.Duration
+	pingPeriod time.Duration
+}
+
+// NewWSClient tạo client cho connection vừa upgrade, cần chạy WritePump trong goroutine riêng.
+// ctx là context của request upgrade, log của client mang request_id của request đó.
+func NewWSClient(ctx context.Context, conn *websocket.Conn, userID string, cfg config.WebSocketConfig) *WSClient {
+	buffer := cfg.SendBuffer
+	if buffer <= 0 {
+		buffer = defaultWSSendBuffer
+	}
+	maxSize := cfg.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = defaultWSMaxMessageSize
+	}
+	conn.SetReadLimit(maxSize)
+	return &WSClient{
+		UserID:     userID,
+		log:        logger.Ctx(ctx),
+		conn:       conn,
+		send:       make(chan []byte, buffer),
+		done:       make(chan struct{}),
+		writeWait:  time.Duration(cfg.WriteWait) * time.Second,
+		pingPeriod: time.Duration(cfg.PingPeriod) * time.Second,
+	}
+}
+
+// Done đóng khi client đã bị ngắt
+func (c *WSClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close ngắt client, an toàn khi gọi nhiều lần và từ nhiều goroutine. ReadMessage đang chờ sẽ trả lỗi.
+func (c *WSClient) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// Send đưa message text vào hàng đợi, không chặn. Hàng đợi đầy thì ngắt client và trả về false.
+func (c *WSClient) Send(data []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		c.log.Warn().Str("user_id", c.UserID).Int("buffer", cap(c.send)).Msg("WebSocket client too slow, disconnecting")
+		c.Close()
+		return false
+	}
+}
+
+// SendJSON mã hoá v rồi Send
+func (c *WSClient) SendJSON(v interface{}) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.log.Error().Err(err).Msg("Failed to encode WebSocket message")
+		return false
+	}
+	return c.Send(data)
+}
+
+// WritePump là goroutine duy nhất ghi ra connection: gửi message trong hàng đợi và ping định kỳ.
+// Kết thúc (và ngắt client) khi ghi lỗi hoặc client bị Close.
+func (c *WSClient) WritePump() {
+	var tick <-chan time.Time
+	if c.pingPeriod > 0 {
+		ticker := time.NewTicker(c.pingPeriod)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	defer c.Close()
+	for {
+		select {
+		case data := <-c.send:
+			c.setWriteDeadline()
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.log.Info().Err(err).Str("user_id", c.UserID).Msg("WebSocket write failed, closing connection")
+				return
+			}
+		case <-tick:
+			c.setWriteDeadline()
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.log.Info().Err(err).Str("user_id", c.UserID).Msg("WebSocket ping failed, closing connection")
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *WSClient) setWriteDeadline() {
+	if c.writeWait > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
+	}
+}
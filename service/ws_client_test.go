@@ -0,0 +1,212 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/config"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testWSRoom = "room:B2:101"
+
+// newWSTestPair mở một kết nối WebSocket thật qua httptest, trả về WSClient phía server và connection phía trình duyệt
+func newWSTestPair(t *testing.T, cfg config.WebSocketConfig) (*WSClient, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	remote, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Close() })
+
+	var serverConn *websocket.Conn
+	select {
+	case serverConn = <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("websocket upgrade timed out")
+	}
+	client := NewWSClient(context.Background(), serverConn, "u-1", cfg)
+	t.Cleanup(client.Close)
+	return client, remote
+}
+
+func waitClosed(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s not closed", what)
+	}
+}
+
+func TestWSClientConcurrentSendsWithPing(t *testing.T) {
+	client, remote := newWSTestPair(t, config.WebSocketConfig{WriteWait: 5, SendBuffer: 1024})
+	// Ping dày để WritePump ghi ping xen giữa các message
+	client.pingPeriod = 2 * time.Millisecond
+
+	svc := NewWSService()
+	svc.JoinRoom(testWSRoom, client.UserID, client)
+
+	var pings atomic.Int32
+	remote.SetPingHandler(func(data string) error {
+		pings.Add(1)
+		return remote.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	const perSender = 100
+	const senders = 3
+	received := make(chan int, 1)
+	go func() {
+		n := 0
+		for n < senders*perSender {
+			if _, _, err := remote.ReadMessage(); err != nil {
+				break
+			}
+			n++
+		}
+		received <- n
+	}()
+
+	pumpDone := make(chan struct{})
+	go func() {
+		client.WritePump()
+		close(pumpDone)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(senders)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < perSender; i++ {
+			if !client.Send([]byte(`{"type":"raw"}`)) {
+				t.Error("Send rejected")
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < perSender; i++ {
+			if !client.SendJSON(map[string]int{"seq": i}) {
+				t.Error("SendJSON rejected")
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < perSender; i++ {
+			svc.BroadcastToRoom(testWSRoom, map[string]int{"broadcast": i}, nil)
+			if i%10 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	wg.Wait()
+
+	select {
+	case n := <-received:
+		if n != senders*perSender {
+			t.Fatalf("received %d messages, want %d", n, senders*perSender)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for messages")
+	}
+	if pings.Load() == 0 {
+		t.Fatal("no ping written while sending")
+	}
+	select {
+	case <-client.Done():
+		t.Fatal("healthy client disconnected")
+	default:
+	}
+
+	client.Close()
+	waitClosed(t, pumpDone, "WritePump")
+}
+
+func TestWSClientSlowConsumerDisconnected(t *testing.T) {
+	client, remote := newWSTestPair(t, config.WebSocketConfig{SendBuffer: 2})
+	svc := NewWSService()
+	svc.JoinRoom(testWSRoom, client.UserID, client)
+
+	// Không chạy WritePump: hàng đợi không bao giờ được rút, giống client không đọc kịp
+	if !client.Send([]byte("1")) || !client.Send([]byte("2")) {
+		t.Fatal("send rejected before buffer is full")
+	}
+
+	broadcastDone := make(chan struct{})
+	go func() {
+		svc.BroadcastToRoom(testWSRoom, map[string]string{"type": "overflow"}, nil)
+		close(broadcastDone)
+	}()
+	waitClosed(t, broadcastDone, "broadcast to a full client (blocked)")
+	waitClosed(t, client.Done(), "slow client")
+
+	if client.Send([]byte("3")) {
+		t.Fatal("send accepted after disconnect")
+	}
+	remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := remote.ReadMessage(); err == nil {
+		t.Fatal("remote still connected after slow client was disconnected")
+	}
+}
+
+func TestWSClientCloseFromManyGoroutines(t *testing.T) {
+	client, remote := newWSTestPair(t, config.WebSocketConfig{WriteWait: 5, SendBuffer: 16})
+	client.pingPeriod = time.Millisecond
+
+	pumpDone := make(chan struct{})
+	go func() {
+		client.WritePump()
+		close(pumpDone)
+	}()
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 16; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			client.Close()
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			client.Send([]byte("late"))
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	waitClosed(t, client.Done(), "client")
+	waitClosed(t, pumpDone, "WritePump")
+	if client.Send([]byte("after close")) {
+		t.Fatal("send accepted after Close")
+	}
+	remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := remote.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
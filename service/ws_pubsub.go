@@ -0,0 +1,185 @@
+package service
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Chat chạy nhiều instance: mọi broadcast đi qua Redis pub/sub (kể cả tới chính instance gửi)
+// để các instance nhận event của một room theo cùng một thứ tự.
+const (
+	wsRoomChannelPrefix = "ws:room:"
+	wsPresenceKeyPrefix = "ws:presence:"
+	// Instance chết không kịp dọn thì thành viên hết hạn sau presenceTTL
+	presenceTTL     = 90 * time.Second
+	presenceRefresh = 30 * time.Second
+)
+
+// wsEnvelope là event gửi qua Redis, Except là connection (của instance Origin) không nhận event
+type wsEnvelope struct {
+	Origin string          `json:"origin"`
+	Except string          `json:"except,omitempty"`
+	Event  json.RawMessage `json:"event"`
+}
+
+func connID(conn *WSClient) string {
+	if conn == nil {
+		return ""
+	}
+	return fmt.Sprintf("%p", conn)
+}
+
+// UseRedis bật fan-out room qua Redis pub/sub và theo dõi online theo room. client nil thì chạy một instance như cũ.
+// Gọi một lần lúc khởi động, trước khi nhận kết nối.
+func (s *WSService) UseRedis(ctx context.Context, client *redis.Client) error {
+	if client == nil {
+		return nil
+	}
+	pubsub := client.PSubscribe(ctx, wsRoomChannelPrefix+"*")
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+	s.redis = client
+	s.instanceID = uuid.NewString()
+
+	go s.consume(ctx, pubsub)
+	go s.refreshPresence(ctx)
+	logger.Info().Str("instance_id", s.instanceID).Msg("WebSocket rooms fan out via Redis pub/sub")
+	return nil
+}
+
+// publish gửi event lên Redis, trả lỗi để BroadcastToRoom gửi trực tiếp trong instance
+func (s *WSService) publish(roomID string, data []byte, except *WSClient) error {
+	payload, err := json.Marshal(wsEnvelope{Origin: s.instanceID, Except: connID(except), Event: data})
+	if err != nil {
+		return err
+	}
+	return s.redis.Publish(context.Background(), wsRoomChannelPrefix+roomID, payload).Err()
+}
+
+// consume nhận event từ Redis và gửi tới các connection của instance này, tuần tự để giữ thứ tự trong room
+func (s *WSService) consume(ctx context.Context, pubsub *redis.PubSub) {
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var env wsEnvelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				logger.Error().Err(err).Str("channel", msg.Channel).Msg("Invalid WebSocket room event from Redis")
+				continue
+			}
+			except := ""
+			if env.Origin == s.instanceID {
+				except = env.Except
+			}
+			s.deliverLocal(strings.TrimPrefix(msg.Channel, wsRoomChannelPrefix), env.Event, except)
+		}
+	}
+}
+
+func presenceMember(instanceID string, conn *WSClient, userID string) string {
+	return instanceID + "|" + connID(conn) + "|" + userID
+}
+
+func (s *WSService) presenceAdd(roomID, userID string, conn *WSClient) {
+	if s.redis == nil {
+		return
+	}
+	key := wsPresenceKeyPrefix + roomID
+	pipe := s.redis.Pipeline()
+	pipe.ZAdd(context.Background(), key, redis.Z{Score: float64(time.Now().Unix()), Member: presenceMember(s.instanceID, conn, userID)})
+	pipe.Expire(context.Background(), key, 2*presenceTTL)
+	if _, err := pipe.Exec(context.Background()); err != nil {
+		logger.Error().Err(err).Str("room", roomID).Msg("Failed to record room presence")
+	}
+}
+
+func (s *WSService) presenceRemove(roomID, userID string, conn *WSClient) {
+	if s.redis == nil {
+		return
+	}
+	if err := s.redis.ZRem(context.Background(), wsPresenceKeyPrefix+roomID, presenceMember(s.instanceID, conn, userID)).Err(); err != nil {
+		logger.Error().Err(err).Str("room", roomID).Msg("Failed to remove room presence")
+	}
+}
+
+// refreshPresence gia hạn định kỳ các connection còn mở của instance này
+func (s *WSService) refreshPresence(ctx context.Context) {
+	ticker := time.NewTicker(presenceRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.RLock()
+			members := map[string][]redis.Z{}
+			now := float64(time.Now().Unix())
+			for roomID, conns := range s.rooms {
+				for conn, userID := range conns {
+					members[roomID] = append(members[roomID], redis.Z{Score: now, Member: presenceMember(s.instanceID, conn, userID)})
+				}
+			}
+			s.mu.RUnlock()
+			pipe := s.redis.Pipeline()
+			for roomID, zs := range members {
+				pipe.ZAdd(ctx, wsPresenceKeyPrefix+roomID, zs...)
+				pipe.Expire(ctx, wsPresenceKeyPrefix+roomID, 2*presenceTTL)
+			}
+			if len(members) > 0 {
+				if _, err := pipe.Exec(ctx); err != nil {
+					logger.Error().Err(err).Msg("Failed to refresh room presence")
+				}
+			}
+		}
+	}
+}
+
+// OnlineUsers trả về các user đang online trong room trên mọi instance (đã bỏ trùng, sắp xếp)
+func (s *WSService) OnlineUsers(ctx context.Context, roomID string) ([]string, error) {
+	seen := map[string]bool{}
+	if s.redis == nil {
+		s.mu.RLock()
+		for _, userID := range s.rooms[roomID] {
+			seen[userID] = true
+		}
+		s.mu.RUnlock()
+	} else {
+		key := wsPresenceKeyPrefix + roomID
+		cutoff := strconv.FormatInt(time.Now().Add(-presenceTTL).Unix(), 10)
+		if err := s.redis.ZRemRangeByScore(ctx, key, "-inf", "("+cutoff).Err(); err != nil {
+			return nil, err
+		}
+		members, err := s.redis.ZRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			if parts := strings.SplitN(m, "|", 3); len(parts) == 3 {
+				seen[parts[2]] = true
+			}
+		}
+	}
+	users := make([]string, 0, len(seen))
+	for userID := range seen {
+		users = append(users, userID)
+	}
+	sort.Strings(users)
+	return users, nil
+}
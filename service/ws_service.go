@@ -1,41 +1,49 @@
 package service
 
 import (
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/models"
+	"encoding/json"
+	"strings"
 	"sync"
 
-	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
 )
 
 type WSService struct {
 	mu sync.RWMutex
 	// connections dùng cho luồng WS admin (log)
-	connections map[string][]*websocket.Conn
+	connections map[string][]*WSClient
 	// rooms: roomID -> (conn -> userID)
-	rooms map[string]map[*websocket.Conn]string
+	rooms map[string]map[*WSClient]string
 	// connRooms: conn -> set(roomID)
-	connRooms map[*websocket.Conn]map[string]struct{}
+	connRooms map[*WSClient]map[string]struct{}
 	// TODO a Hoàng: có thể dùng map.sync sau.
+
+	// redis khác nil khi chạy nhiều instance, xem UseRedis
+	redis      *redis.Client
+	instanceID string
 }
 
 func NewWSService() *WSService {
 	return &WSService{
-		connections: make(map[string][]*websocket.Conn),
-		rooms:       make(map[string]map[*websocket.Conn]string),
-		connRooms:   make(map[*websocket.Conn]map[string]struct{}),
+		connections: make(map[string][]*WSClient),
+		rooms:       make(map[string]map[*WSClient]string),
+		connRooms:   make(map[*WSClient]map[string]struct{}),
 	}
 }
 
-func (s *WSService) AddConnection(userID string, conn *websocket.Conn) {
+func (s *WSService) AddConnection(userID string, conn *WSClient) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.connections[userID] = append(s.connections[userID], conn)
 }
 
-func (s *WSService) RemoveConnection(userID string, conn *websocket.Conn) {
+func (s *WSService) RemoveConnection(userID string, conn *WSClient) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	conns := s.connections[userID]
-	newConns := make([]*websocket.Conn, 0, len(conns))
+	newConns := make([]*WSClient, 0, len(conns))
 	for _, c := range conns {
 		if c != conn {
 			newConns = append(newConns, c)
@@ -50,22 +58,38 @@ func (s *WSService) RemoveConnection(userID string, conn *websocket.Conn) {
 	}
 }
 
-func (s *WSService) GetConnections(userID string) ([]*websocket.Conn, bool) {
+func (s *WSService) GetConnections(userID string) ([]*WSClient, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	conns, ok := s.connections[userID]
 	return conns, ok
 }
 
+// Stats đếm connection đang mở (chat, thông báo và admin log) và room chat có connection trên instance này.
+// Kênh riêng user:<id> không tính là room chat.
+func (s *WSService) Stats() (connections, rooms int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	connections = len(s.connRooms)
+	for _, conns := range s.connections {
+		connections += len(conns)
+	}
+	for roomID := range s.rooms {
+		if !strings.HasPrefix(roomID, models.ChatChannelUserPrefix) {
+			rooms++
+		}
+	}
+	return connections, rooms
+}
+
 // --- Chat rooms helpers ---
 
 // JoinRoom thêm connection vào một room nhất định
-func (s *WSService) JoinRoom(roomID, userID string, conn *websocket.Conn) {
+func (s *WSService) JoinRoom(roomID, userID string, conn *WSClient) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 
 	if s.rooms[roomID] == nil {
-		s.rooms[roomID] = make(map[*websocket.Conn]string)
+		s.rooms[roomID] = make(map[*WSClient]string)
 	}
 	s.rooms[roomID][conn] = userID
 
@@ -73,14 +97,23 @@ func (s *WSService) JoinRoom(roomID, userID string, conn *websocket.Conn) {
 		s.connRooms[conn] = make(map[string]struct{})
 	}
 	s.connRooms[conn][roomID] = struct{}{}
+	s.mu.Unlock()
+	s.presenceAdd(roomID, userID, conn)
 }
 
 // LeaveRoom loại bỏ connection khỏi một room
-func (s *WSService) LeaveRoom(roomID string, conn *websocket.Conn) {
+func (s *WSService) LeaveRoom(roomID string, conn *WSClient) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	var userID string
+	defer func() {
+		s.mu.Unlock()
+		if userID != "" {
+			s.presenceRemove(roomID, userID, conn)
+		}
+	}()
 
 	if conns, ok := s.rooms[roomID]; ok {
+		userID = conns[conn]
 		delete(conns, conn)
 		if len(conns) == 0 {
 			delete(s.rooms, roomID)
@@ -95,17 +128,26 @@ func (s *WSService) LeaveRoom(roomID string, conn *websocket.Conn) {
 	}
 }
 
-// LeaveAllRooms loại bỏ connection khỏi tất cả room đang tham gia
-func (s *WSService) LeaveAllRooms(conn *websocket.Conn) {
+// LeaveAllRooms loại bỏ connection khỏi tất cả room đang tham gia, trả về các room đã rời
+func (s *WSService) LeaveAllRooms(conn *WSClient) []string {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	left := []string{}
+	userID := ""
+	defer func() {
+		s.mu.Unlock()
+		for _, roomID := range left {
+			s.presenceRemove(roomID, userID, conn)
+		}
+	}()
 
 	rooms, ok := s.connRooms[conn]
 	if !ok {
-		return
+		return nil
 	}
 	for roomID := range rooms {
+		left = append(left, roomID)
 		if conns, ok := s.rooms[roomID]; ok {
+			userID = conns[conn]
 			delete(conns, conn)
 			if len(conns) == 0 {
 				delete(s.rooms, roomID)
@@ -113,10 +155,38 @@ func (s *WSService) LeaveAllRooms(conn *websocket.Conn) {
 		}
 	}
 	delete(s.connRooms, conn)
+	return left
+}
+
+// InRoom kiểm tra connection đã join room chưa
+func (s *WSService) InRoom(roomID string, conn *WSClient) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.rooms[roomID][conn]
+	return ok
+}
+
+// BroadcastToRoom gửi event (JSON) tới toàn bộ connection trong room, trừ except (nil = gửi cho tất cả).
+// Khi bật Redis, event đi qua pub/sub để mọi instance nhận theo cùng thứ tự.
+func (s *WSService) BroadcastToRoom(roomID string, event interface{}, except *WSClient) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		logger.Error().Err(err).Str("room", roomID).Msg("Failed to encode room event")
+		return
+	}
+	if s.redis != nil {
+		err := s.publish(roomID, data, except)
+		if err == nil {
+			return
+		}
+		logger.Error().Err(err).Str("room", roomID).Msg("Failed to publish room event, delivering locally only")
+	}
+	s.deliverLocal(roomID, data, connID(except))
 }
 
-// BroadcastToRoom gửi message tới toàn bộ connection trong room
-func (s *WSService) BroadcastToRoom(roomID, fromUserID, content string) {
+// deliverLocal gửi event tới các connection của instance này trong room.
+// Send không chặn: client đọc chậm bị ngắt thay vì làm nghẽn cả room.
+func (s *WSService) deliverLocal(roomID string, data []byte, exceptID string) {
 	s.mu.RLock()
 	connsMap, ok := s.rooms[roomID]
 	if !ok {
@@ -124,18 +194,15 @@ func (s *WSService) BroadcastToRoom(roomID, fromUserID, content string) {
 		return
 	}
 	// copy để tránh giữ lock khi ghi WS
-	conns := make([]*websocket.Conn, 0, len(connsMap))
+	conns := make([]*WSClient, 0, len(connsMap))
 	for conn := range connsMap {
-		conns = append(conns, conn)
+		if exceptID == "" || connID(conn) != exceptID {
+			conns = append(conns, conn)
+		}
 	}
 	s.mu.RUnlock()
 
 	for _, conn := range conns {
-		_ = conn.WriteJSON(map[string]string{
-			"type":    "chat_message",
-			"room":    roomID,
-			"from":    fromUserID,
-			"content": content,
-		})
+		conn.Send(data)
 	}
 }
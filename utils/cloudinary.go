@@ -1,17 +1,21 @@
 package utils
 
 import (
+	"Backend_Dorm_PTIT/metrics"
 	"context"
 	"mime/multipart"
+	"net/http"
 	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 )
 
-func UploadToCloudinary(file multipart.File, fileHeader *multipart.FileHeader, cloudName, apiKey, apiSecret string, folder string, publicID string) (string, error) {
+// UploadToCloudinary tải file lên Cloudinary, ctx là context của request (huỷ theo request, gắn X-Request-ID)
+func UploadToCloudinary(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, cloudName, apiKey, apiSecret string, folder string, publicID string) (string, error) {
 	cld, err := cloudinary.NewFromParams(cloudName, apiKey, apiSecret)
 	if err != nil {
 		return "", err
 	}
+	cld.Upload.Client = http.Client{Transport: RequestIDTransport{}}
 	params := uploader.UploadParams{}
 	if folder != "" {
 		params.Folder = folder
@@ -21,8 +25,9 @@ func UploadToCloudinary(file multipart.File, fileHeader *multipart.FileHeader, c
 	} else {
 		params.PublicID = fileHeader.Filename
 	}
-	resp, err := cld.Upload.Upload(context.Background(), file, params)
+	resp, err := cld.Upload.Upload(ctx, file, params)
 	if err != nil {
+		metrics.ExternalFailure(metrics.ServiceCloudinary)
 		return "", err
 	}
 	return resp.SecureURL, nil
@@ -19,4 +19,32 @@ func GetUserIDFromContext(c *gin.Context) (string, error) {
 
 	fmt.Println("userID", userID)
 	return userID, nil
-}
\ No newline at end of file
+}
+
+// HasAnyRole kiểm tra user trong context có ít nhất một trong các role truyền vào
+func HasAnyRole(c *gin.Context, roles ...string) bool {
+	claimsAny, ok := c.Get("user")
+	if !ok {
+		return false
+	}
+	claims, ok := claimsAny.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	rolesAny, ok := claims["roles"].([]interface{})
+	if !ok {
+		return false
+	}
+	for _, r := range rolesAny {
+		roleStr, ok := r.(string)
+		if !ok {
+			continue
+		}
+		for _, want := range roles {
+			if roleStr == want {
+				return true
+			}
+		}
+	}
+	return false
+}
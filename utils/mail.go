@@ -1,13 +1,17 @@
 package utils
 
 import (
+	"Backend_Dorm_PTIT/logger"
+	"Backend_Dorm_PTIT/metrics"
+	"context"
 	"fmt"
 	"net/smtp"
 	"strings"
 )
 
-// SendMail sends a professional HTML email with organization branding
-func SendMail(smtpHost, smtpPort, sender, password, recipient, subject, body string) error {
+// SendMail sends a professional HTML email with organization branding.
+// The request ID in ctx (if any) is added as an X-Request-ID header of the message.
+func SendMail(ctx context.Context, smtpHost, smtpPort, sender, password, recipient, subject, body string) error {
 	auth := smtp.PlainAuth("", sender, password, smtpHost)
 
 	// Professional HTML template
@@ -42,15 +46,21 @@ func SendMail(smtpHost, smtpPort, sender, password, recipient, subject, body str
 `, recipient, body)
 
 	// Compose MIME message for HTML email
-	msg := strings.Join([]string{
+	headers := []string{
 		fmt.Sprintf("From: PTIT Dormitory <%s>", sender),
 		fmt.Sprintf("To: %s", recipient),
 		fmt.Sprintf("Subject: %s", subject),
 		"MIME-Version: 1.0",
 		"Content-Type: text/html; charset=\"UTF-8\"",
-		"",
-		htmlBody,
-	}, "\r\n")
+	}
+	if id := logger.RequestID(ctx); id != "" {
+		headers = append(headers, logger.RequestIDHeader+": "+id)
+	}
+	msg := strings.Join(append(headers, "", htmlBody), "\r\n")
 
-	return smtp.SendMail(smtpHost+":"+smtpPort, auth, sender, []string{recipient}, []byte(msg))
+	if err := smtp.SendMail(smtpHost+":"+smtpPort, auth, sender, []string{recipient}, []byte(msg)); err != nil {
+		metrics.ExternalFailure(metrics.ServiceSMTP)
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"Backend_Dorm_PTIT/logger"
+	"net/http"
+)
+
+// RequestIDTransport gắn X-Request-ID của request đang xử lý (lấy từ context của request gọi ra) vào lời gọi ra ngoài
+type RequestIDTransport struct {
+	Base http.RoundTripper // nil = http.DefaultTransport
+}
+
+func (t RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if id := logger.RequestID(req.Context()); id != "" && req.Header.Get(logger.RequestIDHeader) == "" {
+		// RoundTripper không được sửa request gốc
+		req = req.Clone(req.Context())
+		req.Header.Set(logger.RequestIDHeader, id)
+	}
+	return base.RoundTrip(req)
+}
+
+// OutboundHTTPClient dùng cho lời gọi HTTP ra dịch vụ ngoài trong lúc xử lý request
+var OutboundHTTPClient = &http.Client{Transport: RequestIDTransport{}}